@@ -0,0 +1,90 @@
+package bot
+
+/* apiauth.go - credentials for external tasks calling back in to the robot
+   through the JSON api in http.go. Every run of an external task gets a
+   new random token in GOPHER_CALLER_TOKEN, which has to be sent as a bearer
+   token along with the GOPHER_CALLER_ID. With LocalSocket: true, the api
+   listens on a unix domain socket in a private directory instead of on
+   localhost tcp, so it isn't reachable from the network namespace at all.
+*/
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// newCallerToken returns 16 bytes of entropy as a hex string. An error
+// from the random source is returned rather than handing out a predictable
+// token.
+func newCallerToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkCallerToken verifies the bearer token sent with a request matches
+// the token issued to the task currently running for the eid.
+func checkCallerToken(eid string, req *http.Request) bool {
+	taskLookup.RLock()
+	token, ok := taskLookup.t[eid]
+	taskLookup.RUnlock()
+	if !ok || len(token) == 0 {
+		return false
+	}
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	sent := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// listenAPISocket creates a new private directory and listens on a unix
+// socket with a random name inside it, returning the listener and the path
+// to the socket. Without privilege separation, the directory is 0700 and
+// the socket 0600. With privilege separation, unprivileged plugins run
+// with a different uid and need to connect, so the socket is 0666; the
+// directory is then searchable but not readable (0711), so the random name
+// can only be found from GOPHER_API_SOCKET, and every request still needs
+// the caller token for a running task.
+func listenAPISocket() (net.Listener, string, error) {
+	dir, err := ioutil.TempDir("", "gopherbot-api-")
+	if err != nil {
+		return nil, "", err
+	}
+	name, err := newCallerToken()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	sockPath := filepath.Join(dir, name+".sock")
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	// The directory is 0700 until the socket permissions are set
+	if privSep {
+		os.Chmod(sockPath, 0666)
+		os.Chmod(dir, 0711)
+	} else {
+		os.Chmod(sockPath, 0600)
+	}
+	return listener, sockPath, nil
+}
+
+// removeAPISocket cleans up the socket directory when the robot exits
+func removeAPISocket() {
+	if len(listenSocket) > 0 {
+		os.RemoveAll(filepath.Dir(listenSocket))
+	}
+}
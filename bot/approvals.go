@@ -0,0 +1,244 @@
+package bot
+
+/* approvals.go - human approval gates for pipelines. A pipeline posts an
+   approval request to its channel and waits until a user who passes the
+   pipeline's Authorizer approves or rejects it, or the request times out.
+   Approvers use the 'approve' and 'reject' commands in builtin-jobcmd, so
+   waiting isn't limited by the replyTimeout for PromptForReply.
+*/
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// How long an approval request waits when no timeout is given
+const defaultApprovalTimeout = time.Hour
+
+type approvalDecision struct {
+	approved bool
+	user     string
+	reason   string
+}
+
+// a pending approval request
+type approval struct {
+	id          string
+	request     string
+	pipeName    string // passed to the authorizer as the task name
+	authorizer  string
+	authRequire string
+	decision    chan approvalDecision // buffered, sent to once
+}
+
+// Pending approvals by ID; a request is removed from the map when it's
+// decided or times out, so only one can happen.
+var approvals = struct {
+	m map[string]*approval
+	sync.Mutex
+}{
+	make(map[string]*approval),
+	sync.Mutex{},
+}
+
+// RequestApproval posts an approval request in the pipeline's channel, and
+// waits until a user that the pipeline's Authorizer (or the DefaultAuthorizer)
+// authorizes for authRequire approves or rejects it, with the 'approve' or
+// 'reject' commands. Returns the user that decided with robot.Normal if
+// approved or robot.Fail if rejected, or robot.TaskTimeout if nobody decided
+// within the timeout (an hour when 0). A request canceled with 'kill' returns
+// robot.Fail, and one canceled by shutdown robot.RobotStopping. The request
+// and decision are written to the pipeline history and the audit log.
+func (r Robot) RequestApproval(authRequire string, timeout time.Duration, request string) (string, robot.TaskRetVal) {
+	if r.pipeContext == nil || len(r.pipeName) == 0 {
+		r.Log(robot.Error, "RequestApproval called outside of a pipeline")
+		return "", robot.ConfigurationError
+	}
+	authorizer := r.cfg.defaultAuthorizer
+	if t := r.tasks.getTaskByName(r.pipeName); t != nil {
+		task, _, _ := getTask(t)
+		if len(task.Authorizer) > 0 {
+			authorizer = task.Authorizer
+		}
+	}
+	if len(authorizer) == 0 {
+		r.Log(robot.Error, "RequestApproval called in pipeline '%s' with no Authorizer or DefaultAuthorizer configured", r.pipeName)
+		return "", robot.ConfigurationError
+	}
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	abort := make(chan struct{})
+	w := getLockedWorker(r.tid)
+	histName, runIndex := w.histName, w.runIndex
+	w.approvalAbort = abort
+	w.Unlock()
+	defer func() {
+		w.Lock()
+		w.approvalAbort = nil
+		w.Unlock()
+	}()
+
+	a := &approval{
+		request:     request,
+		pipeName:    r.pipeName,
+		authorizer:  authorizer,
+		authRequire: authRequire,
+		decision:    make(chan approvalDecision, 1),
+	}
+	approvals.Lock()
+	for {
+		b := make([]byte, 4)
+		rand.Read(b)
+		a.id = fmt.Sprintf("%02x%02x%02x%02x", b[0], b[1], b[2], b[3])
+		if _, exists := approvals.m[a.id]; !exists {
+			break
+		}
+	}
+	approvals.m[a.id] = a
+	approvals.Unlock()
+
+	Log(robot.Audit, "Approval %s requested by pipeline '%s' (log '%s' run %d) in channel '%s', requires '%s': %s", a.id, r.pipeName, histName, runIndex, r.Channel, authRequire, request)
+	w.section("approval", fmt.Sprintf("approval %s requested, requires '%s', expires in %s: %s", a.id, authRequire, timeout, request))
+	r.Say("Approval needed for '%s', run %d: %s\nTo decide, tell me 'approve %s' or 'reject %s <reason>' (requires '%s'; expires in %s)", r.pipeName, runIndex, request, a.id, a.id, authRequire, timeout)
+
+	state.RLock()
+	shutdown := shutdownStarted
+	state.RUnlock()
+	expired := time.NewTimer(timeout)
+	defer expired.Stop()
+	var d approvalDecision
+	select {
+	case d = <-a.decision:
+	case <-expired.C:
+		if a.cancel() {
+			Log(robot.Audit, "Approval %s for pipeline '%s' (log '%s' run %d) timed out after %s", a.id, r.pipeName, histName, runIndex, timeout)
+			w.section("approval", fmt.Sprintf("approval %s timed out after %s", a.id, timeout))
+			r.Say("Approval %s for '%s', run %d timed out after %s", a.id, r.pipeName, runIndex, timeout)
+			return "", robot.TaskTimeout
+		}
+		// decided at the same moment
+		d = <-a.decision
+	case <-abort:
+		if a.cancel() {
+			Log(robot.Audit, "Approval %s for pipeline '%s' (log '%s' run %d) canceled by an administrator", a.id, r.pipeName, histName, runIndex)
+			w.section("approval", fmt.Sprintf("approval %s canceled by an administrator", a.id))
+			return "", robot.Fail
+		}
+		d = <-a.decision
+	case <-shutdown:
+		if a.cancel() {
+			Log(robot.Audit, "Approval %s for pipeline '%s' (log '%s' run %d) canceled, robot shutting down", a.id, r.pipeName, histName, runIndex)
+			w.section("approval", fmt.Sprintf("approval %s canceled, robot shutting down", a.id))
+			return "", robot.RobotStopping
+		}
+		d = <-a.decision
+	}
+	if d.approved {
+		Log(robot.Audit, "Approval %s for pipeline '%s' (log '%s' run %d) APPROVED by user '%s'", a.id, r.pipeName, histName, runIndex, d.user)
+		w.section("approval", fmt.Sprintf("approval %s approved by user '%s'", a.id, d.user))
+		return d.user, robot.Normal
+	}
+	reason := ""
+	if len(d.reason) > 0 {
+		reason = ": " + d.reason
+	}
+	Log(robot.Audit, "Approval %s for pipeline '%s' (log '%s' run %d) REJECTED by user '%s'%s", a.id, r.pipeName, histName, runIndex, d.user, reason)
+	w.section("approval", fmt.Sprintf("approval %s rejected by user '%s'%s", a.id, d.user, reason))
+	return d.user, robot.Fail
+}
+
+// cancel removes a pending approval, returning false if it was already decided
+func (a *approval) cancel() bool {
+	approvals.Lock()
+	defer approvals.Unlock()
+	if _, pending := approvals.m[a.id]; !pending {
+		return false
+	}
+	delete(approvals.m, a.id)
+	return true
+}
+
+// pendingApproval looks up a pending request; IDs are lower-case hex, but
+// the 'approve' and 'reject' matchers are case-insensitive.
+func pendingApproval(id string) (*approval, bool) {
+	approvals.Lock()
+	defer approvals.Unlock()
+	a, ok := approvals.m[strings.ToLower(id)]
+	return a, ok
+}
+
+// decideApproval handles the 'approve' and 'reject' commands, checking the
+// user with the pipeline's authorizer before sending the decision.
+func decideApproval(r Robot, approve bool, id, reason string) {
+	a, ok := pendingApproval(id)
+	if !ok {
+		r.Say("I don't have a pending approval request '%s'", id)
+		return
+	}
+	id = a.id
+	verb := "reject"
+	if approve {
+		verb = "approve"
+	}
+	authTask := r.tasks.getTaskByName(a.authorizer)
+	if authTask == nil {
+		Log(robot.Audit, "Authorizer '%s' not found checking user '%s' deciding approval %s for pipeline '%s'", a.authorizer, r.User, id, a.pipeName)
+		r.Say(configAuthError)
+		return
+	}
+	_, authPlug, _ := getTask(authTask)
+	if authPlug == nil {
+		Log(robot.Audit, "Authorizer '%s' isn't a plugin, checking user '%s' deciding approval %s for pipeline '%s'", a.authorizer, r.User, id, a.pipeName)
+		r.Say(configAuthError)
+		return
+	}
+	w := getLockedWorker(r.tid)
+	w.Unlock()
+	_, authRet := w.callTask(authPlug, "authorize", a.pipeName, a.authRequire, verb, id)
+	w.Lock()
+	w.currentTask = r.currentTask
+	w.Unlock()
+	if authRet != robot.Success {
+		Log(robot.Audit, "Authorization FAILED (%s) by authorizer '%s' for user '%s' trying to %s approval %s for pipeline '%s'; AuthRequire: '%s'", authRet, a.authorizer, r.User, verb, id, a.pipeName, a.authRequire)
+		r.Say("Sorry, you're not authorized to %s that request", verb)
+		return
+	}
+	if !a.cancel() {
+		r.Say("Approval request '%s' was already decided or expired", id)
+		return
+	}
+	// acknowledge before the pipeline continues, so replies stay in order
+	if approve {
+		r.Say("Approved '%s' for pipeline '%s'", id, a.pipeName)
+	} else {
+		r.Say("Rejected '%s' for pipeline '%s'", id, a.pipeName)
+	}
+	a.decision <- approvalDecision{approve, r.User, strings.TrimSpace(reason)}
+}
+
+// approvaltask - task approval; post an approval request and wait for a
+// decision, failing the pipeline if it's rejected or times out
+func approvaltask(m robot.Robot, args ...string) (retval robot.TaskRetVal) {
+	r := m.(Robot)
+	if len(args) < 3 {
+		r.Log(robot.Error, "approval task requires <authrequire> <timeout> <request...>, got: %q", args)
+		return robot.Fail
+	}
+	timeout, err := time.ParseDuration(args[1])
+	if err != nil {
+		r.Log(robot.Error, "Invalid timeout '%s' for approval task: %v", args[1], err)
+		return robot.Fail
+	}
+	_, retval = r.RequestApproval(args[0], timeout, strings.Join(args[2:], " "))
+	return
+}
+
+func init() {
+	RegisterTask("approval", false, robot.TaskHandler{Handler: approvaltask})
+}
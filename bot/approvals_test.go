@@ -0,0 +1,30 @@
+package bot
+
+import "testing"
+
+func TestPendingApproval(t *testing.T) {
+	a := &approval{id: "0a1b2c3d", decision: make(chan approvalDecision, 1)}
+	approvals.Lock()
+	approvals.m[a.id] = a
+	approvals.Unlock()
+	defer a.cancel()
+
+	for _, id := range []string{"0a1b2c3d", "0A1B2C3D", "0a1B2c3D"} {
+		if got, ok := pendingApproval(id); !ok || got != a {
+			t.Errorf("pendingApproval(%q): request not found", id)
+		}
+	}
+	if _, ok := pendingApproval("0a1b2c3e"); ok {
+		t.Errorf("pendingApproval found a request that doesn't exist")
+	}
+
+	if !a.cancel() {
+		t.Fatalf("cancel of a pending request returned false")
+	}
+	if _, ok := pendingApproval("0A1B2C3D"); ok {
+		t.Errorf("request still pending after cancel")
+	}
+	if a.cancel() {
+		t.Errorf("second cancel returned true; a request could be decided twice")
+	}
+}
@@ -19,7 +19,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // VersionInfo holds information about the version, duh. (stupid linter)
@@ -50,13 +50,15 @@ func RegisterConnector(name string, connstarter func(robot.Handler, *log.Logger)
 
 // Interfaces to external stuff, items should be set while single-threaded and never change
 var interfaces struct {
-	robot.Connector                       // Connector interface, implemented by each specific protocol
-	brain           robot.SimpleBrain     // Interface for robot to Store and Retrieve data
-	history         robot.HistoryProvider // Provider for storing and retrieving job / plugin histories
+	robot.Connector                                    // Connector interface, implemented by each specific protocol
+	secondary       map[robot.Protocol]robot.Connector // Secondary connectors, see connectors.go
+	brain           robot.SimpleBrain                  // Interface for robot to Store and Retrieve data
+	history         robot.HistoryProvider              // Provider for storing and retrieving job / plugin histories
 }
 
 var done = make(chan bool)              // shutdown channel, true to restart
 var stopConnector = make(chan struct{}) // stop channel for stopping the connector
+var shutdownStarted chan struct{}       // closed by stop, for pipelines waiting on timers
 
 // internal state tracking
 var state struct {
@@ -67,11 +69,18 @@ var state struct {
 	sync.RWMutex          // for safe updating of bot data structures
 }
 
-// regexes the bot uses to determine if it's being spoken to
-var regexes struct {
+// botRegexes are the regexes the bot uses to determine if it's being spoken to
+type botRegexes struct {
 	preRegex  *regexp.Regexp // regex for matching prefixed commands, e.g. "Gort, drop your weapon"
 	postRegex *regexp.Regexp // regex for matching, e.g. "open the pod bay doors, hal"
 	bareRegex *regexp.Regexp // regex for matching the robot's bare name, if you forgot it in the previous command
+}
+
+// regexes for the primary protocol, and for each secondary protocol, since
+// each connector can have a different mention string
+var regexes struct {
+	botRegexes
+	secondary map[robot.Protocol]*botRegexes
 	sync.RWMutex
 }
 
@@ -90,6 +99,7 @@ type configuration struct {
 	defaultMessageFormat robot.MessageFormat // Raw unless set to Variable or Fixed
 	plugChannels         []string            // list of channels where plugins are available by default
 	protocol             string              // Name of the protocol, e.g. "slack"
+	secondaryProtocols   []ProtocolInfo      // Secondary connectors to run alongside the primary protocol
 	brainProvider        string              // Type of Brain provider to use
 	encryptionKey        string              // Key for encrypting data (unlocks "real" key in brain)
 	historyProvider      string              // Name of the history provider to use
@@ -106,6 +116,12 @@ type configuration struct {
 	loadableModules      []LoadableModule    // List of loadable modules to load
 	ScheduledJobs        []ScheduledTask     // List of scheduled tasks
 	port                 string              // Configured localhost port to listen on, or 0 for first open
+	webhookListen        string              // Address for the inbound webhook listener, or "" when disabled
+	historyListen        string              // Address for the history web UI, or "" when disabled
+	historyURL           string              // External base URL for the history web UI
+	historyTLSCert       string              // Certificate file for serving the history web UI with TLS
+	historyTLSKey        string              // Key file for historyTLSCert
+	localSocket          bool                // Serve the plugin api on a unix socket instead of localhost tcp
 	timeZone             *time.Location      // for forcing the TimeZone, Unix only
 	defaultJobChannel    string              // where job statuses will post if not otherwise specified
 }
@@ -129,6 +145,9 @@ var currentCfg = struct {
 var listening bool    // for tests where initBot runs multiple times
 var listenPort string // actual listening port
 
+// path to the api socket when LocalSocket is set
+var listenSocket string
+
 // initBot sets up the global robot; when cli is false it also loads configuration.
 // cli indicates that a CLI command is being processed, as opposed to actually running
 // a robot.
@@ -157,6 +176,7 @@ func initBot(cpath, epath string) {
 	installPath = epath
 
 	state.shuttingDown = false
+	shutdownStarted = make(chan struct{})
 
 	if cliOp {
 		setLogLevel(robot.Warn)
@@ -203,6 +223,9 @@ func initBot(cpath, epath string) {
 			Log(robot.Error, "Failed to initialize brain encryption with configured EncryptionKey")
 		}
 	}
+	if encryptionInitialized && !checkPendingRotation() {
+		encryptionInitialized = false
+	}
 	if encryptBrain && !encryptionInitialized {
 		Log(robot.Warn, "Brain encryption specified but not initialized; use 'initialize brain <key>' to initialize the encrypted brain interactively")
 	}
@@ -214,19 +237,38 @@ func initBot(cpath, epath string) {
 
 	if !listening {
 		listening = true
-		listener, err := net.Listen("tcp4", fmt.Sprintf("127.0.0.1:%s", currentCfg.port))
-		if err != nil {
-			Log(robot.Fatal, "Listening on tcp4 port 127.0.0.1:%s: %v", currentCfg.port, err)
+		var listener net.Listener
+		if currentCfg.localSocket {
+			listener, listenSocket, err = listenAPISocket()
+			if err != nil {
+				Log(robot.Fatal, "Listening on unix socket for external plugins: %v", err)
+			}
+			listenPort = "unix:" + listenSocket
+		} else {
+			listener, err = net.Listen("tcp4", fmt.Sprintf("127.0.0.1:%s", currentCfg.port))
+			if err != nil {
+				Log(robot.Fatal, "Listening on tcp4 port 127.0.0.1:%s: %v", currentCfg.port, err)
+			}
+			listenPort = listener.Addr().String()
 		}
-		listenPort = listener.Addr().String()
+		writeAdminAccess()
 		go func() {
 			raiseThreadPriv("http handler")
 			apiServer := http.NewServeMux()
 			apiServer.Handle("/json", handle)
+			apiServer.HandleFunc("/admin", serveAdmin)
 			Log(robot.Info, "Listening for external plugin connections on http://%s", listenPort)
 			Log(robot.Fatal, "Error serving '/json': %s", http.Serve(listener, apiServer))
 		}()
 	}
+	if !webhookListening && len(currentCfg.webhookListen) > 0 {
+		webhookListening = true
+		go serveWebhooks(currentCfg.webhookListen)
+	}
+	if !historyWebListening && len(currentCfg.historyListen) > 0 {
+		historyWebListening = true
+		go serveHistoryWeb(currentCfg.historyListen, currentCfg.historyTLSCert, currentCfg.historyTLSKey)
+	}
 }
 
 // set connector sets the connector, which should already be initialized
@@ -247,6 +289,7 @@ func initCrypt() bool {
 				if key, err := decrypt(bke, ik); err == nil {
 					cryptKey.Lock()
 					cryptKey.key = key
+					cryptKey.userKey = ik
 					cryptKey.initialized = true
 					cryptKey.Unlock()
 					encryptionInitialized = true
@@ -282,6 +325,7 @@ func initCrypt() bool {
 				Log(robot.Info, "Successfully wrote new binary encryption key to '%s'", keyFile)
 				cryptKey.Lock()
 				cryptKey.key = bk
+				cryptKey.userKey = ik
 				cryptKey.initialized = true
 				cryptKey.Unlock()
 				encryptionInitialized = true
@@ -312,6 +356,7 @@ func run() {
 			interfaces.JoinChannel(channel)
 		}
 	}
+	runSecondaryConnectors()
 
 	// signal handler
 	sigBreak := make(chan struct{})
@@ -328,6 +373,7 @@ func run() {
 		if restart {
 			Log(robot.Info, "Restarting...")
 		}
+		removeAdminAccess()
 		done <- restart
 	}(interfaces.Connector, sigBreak)
 
@@ -345,7 +391,11 @@ func stop() {
 	pr := state.pipelinesRunning
 	state.RUnlock()
 	Log(robot.Info, "Stop called with %d pipelines running", pr)
+	state.Lock()
+	close(shutdownStarted)
+	state.Unlock()
 	state.Wait()
 	brainQuit()
+	stopSecondaryConnectors()
 	stopConnector <- struct{}{}
 }
@@ -15,7 +15,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // Map of registered brains
@@ -25,6 +25,7 @@ var brains = make(map[string]func(robot.Handler) robot.SimpleBrain)
 type shortTermMemory struct {
 	memory    string
 	timestamp time.Time
+	ttl       time.Duration // zero for the default shortTermDuration
 }
 
 type memoryContext struct {
@@ -43,6 +44,8 @@ var encryptBrain bool
 var cryptKey = struct {
 	key                       []byte
 	initializing, initialized bool
+	userKey                   []byte // the user-supplied key that unlocks key
+	inBrain                   bool   // key is stored in the brain, not encryptedKeyFile
 	sync.RWMutex
 }{}
 
@@ -72,14 +75,18 @@ type memstatus struct {
 	state   memState
 	token   string // whoever has this token owns the lock for this memory
 	waiters []checkOutRequest
+	holder  lockHolder // who has the token, see brain_locks.go
+	since   time.Time  // when the token was handed out
 }
 
 var brainChanEvents = make(chan interface{})
 
 type checkOutRequest struct {
-	key   string
-	rw    bool
-	reply chan checkOutReply
+	key       string
+	rw        bool
+	reply     chan checkOutReply
+	holder    lockHolder
+	requested time.Time
 }
 
 type checkOutReply struct {
@@ -95,10 +102,11 @@ type checkInRequest struct {
 }
 
 type updateRequest struct {
-	key   string
-	token string
-	datum *[]byte
-	reply chan robot.RetVal
+	key     string
+	token   string
+	datum   *[]byte
+	expires time.Time // zero for memories that don't expire
+	reply   chan robot.RetVal
 }
 
 type pauseRequest struct {
@@ -120,6 +128,9 @@ func replyToWaiter(m *memstatus) {
 	lt, d, e, r := getDatum(creq.key, true)
 	m.state = newMemory
 	m.token = lt
+	m.holder = creq.holder
+	m.since = time.Now()
+	recordLockWait(creq, true)
 	creq.reply <- checkOutReply{lt, d, e, r}
 }
 
@@ -146,6 +157,7 @@ func runBrain() {
 	// map key to status
 	memories := make(map[string]*memstatus)
 	processMemories := time.Tick(memCycle)
+	processExpirations := time.Tick(expiryCycle)
 loop:
 	for {
 		select {
@@ -180,8 +192,11 @@ loop:
 							newMemory,
 							lt,
 							make([]checkOutRequest, 0, 2),
+							creq.holder,
+							time.Now(),
 						}
 						memories[creq.key] = m
+						recordLockWait(creq, false)
 					}
 					creq.reply <- checkOutReply{lt, d, e, r}
 					continue
@@ -196,11 +211,15 @@ loop:
 					lt, d, e, r := getDatum(creq.key, creq.rw)
 					memStat.state = newMemory
 					memStat.token = lt // this memory has a new owner now
+					memStat.holder = creq.holder
+					memStat.since = time.Now()
 					memories[creq.key] = memStat
+					recordLockWait(creq, false)
 					creq.reply <- checkOutReply{lt, d, e, r}
 				} else {
 					memStat.waiters = append(memStat.waiters, creq)
 					memories[creq.key] = memStat
+					recordLockContention(memStat.holder)
 				}
 			case checkInRequest:
 				ci := evt.(checkInRequest)
@@ -228,12 +247,31 @@ loop:
 					ur.reply <- robot.DatumLockExpired
 					continue
 				}
-				ur.reply <- storeDatum(ur.key, ur.datum)
+				ret := storeExpiringDatum(ur.key, ur.datum, ur.expires)
+				if ret == robot.Ok {
+					ret = setExpiration(ur.key, ur.expires)
+				}
+				ur.reply <- ret
 				if len(m.waiters) > 0 {
 					replyToWaiter(m)
 					continue
 				}
 				delete(memories, ur.key)
+			case listRequest:
+				lr := evt.(listRequest)
+				lr.reply <- listKeys(lr.prefix)
+			case readRequest:
+				rr := evt.(readRequest)
+				rr.reply <- readKeys(rr.keys)
+			case lockListRequest:
+				lr := evt.(lockListRequest)
+				lr.reply <- listLocks(memories)
+			case lockReleaseRequest:
+				rr := evt.(lockReleaseRequest)
+				rr.reply <- releaseLock(memories, rr.key)
+			case rotateRequest:
+				rr := evt.(rotateRequest)
+				rr.reply <- rr.run()
 			case quitRequest:
 				qr := evt.(quitRequest)
 				qr.reply <- struct{}{}
@@ -243,7 +281,11 @@ loop:
 			now := time.Now()
 			shortTermMemories.Lock()
 			for k, v := range shortTermMemories.m {
-				if now.Sub(v.timestamp) > shortTermDuration {
+				ttl := v.ttl
+				if ttl == 0 {
+					ttl = shortTermDuration
+				}
+				if now.Sub(v.timestamp) > ttl {
 					delete(shortTermMemories.m, k)
 				}
 			}
@@ -260,6 +302,8 @@ loop:
 					m.state = available
 				}
 			}
+		case <-processExpirations:
+			sweepExpiredMemories(memories)
 		}
 	}
 }
@@ -277,12 +321,17 @@ var keyRe = regexp.MustCompile(keyRegex)
 // checkout returns the []byte from the brain, with a lock token granting
 // ownership for a limited time
 func checkout(d string, rw bool) (string, *[]byte, bool, robot.RetVal) {
+	return checkoutFor(d, rw, robotHolder)
+}
+
+// checkoutFor is checkout on behalf of a task, recording the lock holder
+func checkoutFor(d string, rw bool, h lockHolder) (string, *[]byte, bool, robot.RetVal) {
 	if !keyRe.MatchString(d) {
 		Log(robot.Error, "Invalid memory key, ':' disallowed: %s", d)
 		return "", nil, false, robot.InvalidDatumKey
 	}
 	reply := make(chan checkOutReply)
-	brainChanEvents <- checkOutRequest{d, rw, reply}
+	brainChanEvents <- checkOutRequest{d, rw, reply, h, time.Now()}
 	rep := <-reply
 	Log(robot.Trace, "Brain datum checkout for %s, rw: %t - token: %s, exists: %t, ret: %d",
 		d, rw, rep.token, rep.exists, rep.RetVal)
@@ -292,12 +341,18 @@ func checkout(d string, rw bool) (string, *[]byte, bool, robot.RetVal) {
 // update sends updated []byte to the brain while holding the lock, or discards
 // the data and returns an error.
 func update(d, lt string, datum *[]byte) (ret robot.RetVal) {
+	return updateExpiring(d, lt, datum, time.Time{})
+}
+
+// updateExpiring is update for a memory that expires at a given time; a
+// zero time clears any previous expiration.
+func updateExpiring(d, lt string, datum *[]byte, expires time.Time) (ret robot.RetVal) {
 	if lt == "" {
 		return robot.Ok
 	}
 	reply := make(chan robot.RetVal)
 	Log(robot.Trace, "Updating datum %s, token: %s", d, lt)
-	brainChanEvents <- updateRequest{d, lt, datum, reply}
+	brainChanEvents <- updateRequest{d, lt, datum, expires, reply}
 	return <-reply
 }
 
@@ -318,8 +373,13 @@ func pauseBrain(wid int, resume chan struct{}) {
 // checkoutDatum is the robot internal version of CheckoutDatum that uses
 // the provided key as-is.
 func checkoutDatum(key string, datum interface{}, rw bool) (locktoken string, exists bool, ret robot.RetVal) {
+	return checkoutDatumFor(key, datum, rw, robotHolder)
+}
+
+// checkoutDatumFor is checkoutDatum on behalf of a task
+func checkoutDatumFor(key string, datum interface{}, rw bool, h lockHolder) (locktoken string, exists bool, ret robot.RetVal) {
 	var dbytes *[]byte
-	locktoken, dbytes, exists, ret = checkout(key, rw)
+	locktoken, dbytes, exists, ret = checkoutFor(key, rw, h)
 	if exists { // exists = true implies no error
 		err := json.Unmarshal(*dbytes, datum)
 		if err != nil {
@@ -333,12 +393,17 @@ func checkoutDatum(key string, datum interface{}, rw bool) (locktoken string, ex
 
 // updateDatum is the internal version of UpdateDatum that uses the key as-is
 func updateDatum(key, locktoken string, datum interface{}) (ret robot.RetVal) {
+	return updateExpiringDatum(key, locktoken, datum, time.Time{})
+}
+
+// updateExpiringDatum is the internal version of UpdateDatumTTL
+func updateExpiringDatum(key, locktoken string, datum interface{}, expires time.Time) (ret robot.RetVal) {
 	dbytes, err := json.Marshal(datum)
 	if err != nil {
 		Log(robot.Error, "Marshalling datum %s: %v", key, err)
 		return robot.DataFormatError
 	}
-	return update(key, locktoken, &dbytes)
+	return updateExpiring(key, locktoken, &dbytes, expires)
 }
 
 func getNameSpace(task *Task) string {
@@ -366,7 +431,7 @@ func (r Robot) CheckoutDatum(key string, datum interface{}, rw bool) (locktoken
 	} else {
 		key = ns + ":" + key
 	}
-	return checkoutDatum(key, datum, rw)
+	return checkoutDatumFor(key, datum, rw, r.lockHolder())
 }
 
 // CheckinDatum unlocks a datum without updating it, it always succeeds
@@ -389,8 +454,17 @@ func (r Robot) CheckinDatum(key, locktoken string) {
 
 // UpdateDatum tries to update a piece of data in the robot's brain, providing
 // a struct to marshall and a (hopefully good) lock token. If err != nil, the
-// update failed.
+// update failed. The memory never expires, clearing any expiration set by
+// a previous UpdateDatumTTL.
 func (r Robot) UpdateDatum(key, locktoken string, datum interface{}) (ret robot.RetVal) {
+	return r.UpdateDatumTTL(key, locktoken, datum, 0)
+}
+
+// UpdateDatumTTL is UpdateDatum for a memory that should be forgotten after
+// ttl, e.g. for caches and other data that would otherwise accumulate
+// forever. A ttl <= 0 means the memory never expires. Every update sets a
+// new expiration.
+func (r Robot) UpdateDatumTTL(key, locktoken string, datum interface{}, ttl time.Duration) (ret robot.RetVal) {
 	if strings.ContainsRune(key, ':') {
 		Log(robot.Error, "Invalid memory key, ':' disallowed: %s", key)
 		return robot.InvalidDatumKey
@@ -402,7 +476,7 @@ func (r Robot) UpdateDatum(key, locktoken string, datum interface{}) (ret robot.
 	} else {
 		key = ns + ":" + key
 	}
-	return updateDatum(key, locktoken, datum)
+	return updateExpiringDatum(key, locktoken, datum, expiration(ttl))
 }
 
 // Remember adds a short-term memory (with no backing store) to the robot's
@@ -411,10 +485,18 @@ func (r Robot) UpdateDatum(key, locktoken string, datum interface{}) (ret robot.
 // indexed by user and channel, but not plugin, these facts can be referenced
 // between plugins. This functionality is considered EXPERIMENTAL.
 func (r Robot) Remember(key, value string) {
-	timestamp := time.Now()
-	memory := shortTermMemory{value, timestamp}
+	r.RememberFor(key, value, 0)
+}
+
+// RememberFor is Remember for a short-term memory that lasts for ttl
+// instead of the default 7 minutes.
+func (r Robot) RememberFor(key, value string, ttl time.Duration) {
+	if ttl < 0 {
+		ttl = 0
+	}
+	memory := shortTermMemory{value, time.Now(), ttl}
 	context := memoryContext{key, r.User, r.Channel}
-	Log(robot.Trace, "SHORTMEM: Storing short-term memory \"%s\" -> \"%s\"", key, value)
+	Log(robot.Trace, "SHORTMEM: Storing short-term memory \"%s\" -> \"%s\" for %v", key, value, ttl)
 	shortTermMemories.Lock()
 	shortTermMemories.m[context] = memory
 	shortTermMemories.Unlock()
@@ -487,6 +569,8 @@ func initializeEncryptionFromBrain(key string) bool {
 	if exists {
 		cryptKey.Lock()
 		cryptKey.key = *rk
+		cryptKey.userKey = kbytes
+		cryptKey.inBrain = true
 		cryptKey.initialized = true
 		cryptKey.initializing = false
 		cryptKey.Unlock()
@@ -518,17 +602,39 @@ func initializeEncryptionFromBrain(key string) bool {
 	}
 	cryptKey.Lock()
 	cryptKey.key = sb
+	cryptKey.userKey = kbytes
 	cryptKey.initialized = true
 	cryptKey.initializing = false
 	cryptKey.Unlock()
 	return true
 }
 
-// Most likely used when switching from configured to interactively-provided
-// encryption key
-func reKey(newkey string) bool {
-	// NOTE: this function should temporarily set initialized = false
-	return true
+// reKey changes the user-supplied key that unlocks the internal key,
+// leaving memories encrypted with the same internal key. Replacing the
+// wrapped key is a single atomic write, either a rename of the key file or
+// one Store of botEncryptionKey. See brain_rotate.go for replacing the
+// internal key.
+func reKey(newkey string) error {
+	nk := []byte(newkey)
+	if len(nk) < 32 {
+		return fmt.Errorf("new encryption key must be at least 32 bytes")
+	}
+	nk = nk[0:32]
+	cryptKey.RLock()
+	initialized := cryptKey.initialized
+	key := cryptKey.key
+	cryptKey.RUnlock()
+	if !initialized {
+		return fmt.Errorf("encryption not initialized")
+	}
+	if err := writeWrappedKey(key, nk); err != nil {
+		return err
+	}
+	cryptKey.Lock()
+	cryptKey.userKey = nk
+	cryptKey.Unlock()
+	Log(robot.Audit, "Rotated the user-supplied encryption key")
+	return nil
 }
 
 // getDatum retrieves a blob of bytes from the brain provider and optionally
@@ -558,7 +664,7 @@ func getDatum(dkey string, rw bool) (token string, databytes *[]byte, exists boo
 	if err != nil {
 		return "", nil, false, robot.BrainFailed
 	}
-	if !exists {
+	if !exists || isExpired(dkey) {
 		return token, nil, false, robot.Ok
 	}
 	if encryptBrain {
@@ -604,6 +710,12 @@ func getDatum(dkey string, rw bool) (token string, databytes *[]byte, exists boo
 // storeDatum takes a blob of bytes and optionally encrypts it before sending it
 // to the brain provider
 func storeDatum(dkey string, datum *[]byte) robot.RetVal {
+	return storeExpiringDatum(dkey, datum, time.Time{})
+}
+
+// storeExpiringDatum is storeDatum for a memory with an expiration, which is
+// passed to brains that support expiring memories natively.
+func storeExpiringDatum(dkey string, datum *[]byte, expires time.Time) robot.RetVal {
 	brain := interfaces.brain
 	if brain == nil {
 		Log(robot.Error, "Brain function called with no brain configured")
@@ -629,7 +741,12 @@ func storeDatum(dkey string, datum *[]byte) robot.RetVal {
 		}
 		datum = &encrypted
 	}
-	err := brain.Store(dkey, datum)
+	var err error
+	if eb, ok := brain.(robot.ExpiringBrain); ok && !expires.IsZero() {
+		err = eb.StoreExpiring(dkey, datum, expires)
+	} else {
+		err = brain.Store(dkey, datum)
+	}
 	if err != nil {
 		Log(robot.Error, "Storing datum %s: %v", dkey, err)
 		return robot.BrainFailed
@@ -0,0 +1,181 @@
+package bot
+
+/* brain_expiry.go - optional expiration for long-term memories. Each
+   expiring memory has a small record of its own next to the datum,
+   bot:expires:<key>, holding the expiration time; setting or clearing an
+   expiration only writes that one record. The records are read into an
+   index once the brain can be read (i.e. after encryption is initialized).
+   Reads of an expired memory return "not found", and the brain loop
+   periodically deletes expired memories that aren't checked out, along
+   with their records. Brains implementing robot.ExpiringBrain are also
+   told the expiration when the memory and record are stored.
+*/
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// prefix for the expiration record stored next to an expiring memory
+const expiryPrefix = "bot:expires:"
+
+// how often the brain loop checks for expired memories
+const expiryCycle = time.Minute
+
+// index of memory key -> expiration, read from the expiration records
+var memoryExpirations = struct {
+	m      map[string]time.Time
+	loaded bool
+	sync.Mutex
+}{}
+
+// expiration returns the expiration for a ttl, or the zero time when
+// the memory shouldn't expire
+func expiration(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// noExpiry is true for the robot's own bookkeeping memories
+func noExpiry(key string) bool {
+	return key == botEncryptionKey || strings.HasPrefix(key, expiryPrefix)
+}
+
+// loadExpirations builds the index from the expiration records, if it
+// hasn't already been built; memoryExpirations must be locked. Returns
+// false if the brain isn't ready.
+func loadExpirations() bool {
+	if memoryExpirations.loaded {
+		return true
+	}
+	brain := interfaces.brain
+	if brain == nil {
+		return false
+	}
+	if encryptBrain {
+		cryptKey.RLock()
+		initialized := cryptKey.initialized
+		cryptKey.RUnlock()
+		if !initialized {
+			return false
+		}
+	}
+	keys, err := brain.List()
+	if err != nil {
+		Log(robot.Error, "Listing memories for expirations: %v", err)
+		return false
+	}
+	memoryExpirations.m = make(map[string]time.Time)
+	for _, rkey := range keys {
+		if !strings.HasPrefix(rkey, expiryPrefix) {
+			continue
+		}
+		_, db, exists, ret := getDatum(rkey, false)
+		if ret != robot.Ok {
+			return false
+		}
+		if !exists {
+			continue
+		}
+		exp, err := strconv.ParseInt(string(*db), 10, 64)
+		if err != nil {
+			Log(robot.Error, "Parsing expiration record '%s', ignoring: %v", rkey, err)
+			continue
+		}
+		memoryExpirations.m[strings.TrimPrefix(rkey, expiryPrefix)] = time.Unix(exp, 0)
+	}
+	memoryExpirations.loaded = true
+	return true
+}
+
+// setExpiration records when a memory expires; a zero time removes the
+// expiration.
+func setExpiration(key string, expires time.Time) robot.RetVal {
+	if noExpiry(key) {
+		return robot.Ok
+	}
+	memoryExpirations.Lock()
+	defer memoryExpirations.Unlock()
+	if !loadExpirations() {
+		if expires.IsZero() {
+			return robot.Ok
+		}
+		Log(robot.Error, "Unable to set expiration for '%s'; brain not ready", key)
+		return robot.BrainFailed
+	}
+	if expires.IsZero() {
+		if _, ok := memoryExpirations.m[key]; !ok {
+			return robot.Ok
+		}
+		if err := interfaces.brain.Delete(expiryPrefix + key); err != nil {
+			Log(robot.Error, "Deleting expiration record for '%s': %v", key, err)
+			return robot.BrainFailed
+		}
+		delete(memoryExpirations.m, key)
+		return robot.Ok
+	}
+	rec := []byte(strconv.FormatInt(expires.Unix(), 10))
+	if ret := storeExpiringDatum(expiryPrefix+key, &rec, expires); ret != robot.Ok {
+		return ret
+	}
+	memoryExpirations.m[key] = expires
+	return robot.Ok
+}
+
+// getExpiration returns the expiration for a memory, if it has one
+func getExpiration(key string) (time.Time, bool) {
+	if noExpiry(key) {
+		return time.Time{}, false
+	}
+	memoryExpirations.Lock()
+	defer memoryExpirations.Unlock()
+	if !loadExpirations() {
+		return time.Time{}, false
+	}
+	expires, ok := memoryExpirations.m[key]
+	return expires, ok
+}
+
+// isExpired checks whether a memory has expired but not yet been removed
+func isExpired(key string) bool {
+	expires, ok := getExpiration(key)
+	return ok && time.Now().After(expires)
+}
+
+// sweepExpiredMemories is called from the brain loop to delete expired
+// memories; memories currently checked out are left for the next sweep.
+func sweepExpiredMemories(checkedOut map[string]*memstatus) {
+	brain := interfaces.brain
+	if brain == nil {
+		return
+	}
+	memoryExpirations.Lock()
+	defer memoryExpirations.Unlock()
+	if !loadExpirations() {
+		return
+	}
+	now := time.Now()
+	for key, expires := range memoryExpirations.m {
+		if now.Before(expires) {
+			continue
+		}
+		if _, busy := checkedOut[key]; busy {
+			continue
+		}
+		if err := brain.Delete(key); err != nil {
+			Log(robot.Error, "Deleting expired memory '%s': %v", key, err)
+			continue
+		}
+		if err := brain.Delete(expiryPrefix + key); err != nil {
+			Log(robot.Error, "Deleting expiration record for '%s': %v", key, err)
+		}
+		Log(robot.Debug, "Deleted memory '%s', expired %s", key, expires.Format(time.RFC3339))
+		delete(memoryExpirations.m, key)
+	}
+}
@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// expiringMemBrain is a memBrain that records native expirations
+type expiringMemBrain struct {
+	*memBrain
+	expires map[string]time.Time
+}
+
+func (eb expiringMemBrain) StoreExpiring(k string, b *[]byte, expires time.Time) error {
+	eb.expires[k] = expires
+	return eb.Store(k, b)
+}
+
+// setupExpiryBrain installs an empty, unencrypted memory brain and resets
+// the expiration index.
+func setupExpiryBrain(t *testing.T) *memBrain {
+	t.Helper()
+	mb := provider(nil).(*memBrain)
+	interfaces.brain = mb
+	encryptBrain = false
+	memoryExpirations.m = nil
+	memoryExpirations.loaded = false
+	t.Cleanup(func() {
+		interfaces.brain = nil
+		memoryExpirations.m = nil
+		memoryExpirations.loaded = false
+	})
+	return mb
+}
+
+func storeTestMemory(t *testing.T, key string, expires time.Time) {
+	t.Helper()
+	datum := []byte(`"` + key + `"`)
+	if ret := storeExpiringDatum(key, &datum, expires); ret != robot.Ok {
+		t.Fatalf("storing '%s': %s", key, ret)
+	}
+	if ret := setExpiration(key, expires); ret != robot.Ok {
+		t.Fatalf("setting expiration for '%s': %s", key, ret)
+	}
+}
+
+func TestExpirationRecord(t *testing.T) {
+	mb := setupExpiryBrain(t)
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	storeTestMemory(t, "links:links", expires)
+
+	rec, exists, _ := mb.Retrieve(expiryPrefix + "links:links")
+	if !exists {
+		t.Fatalf("no expiration record stored next to the memory")
+	}
+	if got := string(*rec); got != strconv.FormatInt(expires.Unix(), 10) {
+		t.Errorf("expiration record: want %d, got %s", expires.Unix(), got)
+	}
+	if got, ok := getExpiration("links:links"); !ok || !got.Equal(expires) {
+		t.Errorf("getExpiration: want %s, got %s (%t)", expires, got, ok)
+	}
+
+	// Setting an expiration only writes the one record
+	storeTestMemory(t, "lists:lists", time.Time{})
+	if len(mb.memories) != 3 {
+		t.Errorf("want 3 memories (2 memories, 1 record), got %d", len(mb.memories))
+	}
+
+	// The index is rebuilt from the records
+	memoryExpirations.loaded = false
+	if got, ok := getExpiration("links:links"); !ok || !got.Equal(expires) {
+		t.Errorf("getExpiration after reload: want %s, got %s (%t)", expires, got, ok)
+	}
+
+	// Updating without an expiration removes the record
+	if ret := setExpiration("links:links", time.Time{}); ret != robot.Ok {
+		t.Fatalf("clearing expiration: %s", ret)
+	}
+	if _, exists, _ := mb.Retrieve(expiryPrefix + "links:links"); exists {
+		t.Errorf("expiration record not removed")
+	}
+	if _, ok := getExpiration("links:links"); ok {
+		t.Errorf("expiration not cleared from index")
+	}
+}
+
+func TestExpirationNative(t *testing.T) {
+	mb := setupExpiryBrain(t)
+	eb := expiringMemBrain{mb, make(map[string]time.Time)}
+	interfaces.brain = eb
+	expires := time.Now().Add(time.Hour)
+	storeTestMemory(t, "links:links", expires)
+	for _, key := range []string{"links:links", expiryPrefix + "links:links"} {
+		if got, ok := eb.expires[key]; !ok || !got.Equal(expires) {
+			t.Errorf("'%s' not stored with native expiration %s, got %s", key, expires, got)
+		}
+	}
+}
+
+func TestExpiredMemory(t *testing.T) {
+	setupExpiryBrain(t)
+	storeTestMemory(t, "links:links", time.Now().Add(-time.Second))
+	storeTestMemory(t, "lists:lists", time.Now().Add(time.Hour))
+
+	if !isExpired("links:links") {
+		t.Errorf("memory past its expiration not expired")
+	}
+	if isExpired("lists:lists") {
+		t.Errorf("memory expired before its expiration")
+	}
+	if _, _, exists, ret := getDatum("links:links", false); ret != robot.Ok || exists {
+		t.Errorf("expired memory retrieved: exists %t, ret %s", exists, ret)
+	}
+	if _, _, exists, ret := getDatum("lists:lists", false); ret != robot.Ok || !exists {
+		t.Errorf("unexpired memory not retrieved: exists %t, ret %s", exists, ret)
+	}
+	rep := listKeys("")
+	if len(rep.keys) != 1 || rep.keys[0] != "lists:lists" {
+		t.Errorf("listKeys should only list unexpired memories, got %v", rep.keys)
+	}
+}
+
+func TestSweepExpiredMemories(t *testing.T) {
+	mb := setupExpiryBrain(t)
+	past := time.Now().Add(-time.Second)
+	storeTestMemory(t, "links:links", past)
+	storeTestMemory(t, "lists:lists", past)
+	storeTestMemory(t, "memes:memes", time.Now().Add(time.Hour))
+	storeTestMemory(t, "notes:notes", time.Time{})
+
+	// Checked out memories are left for the next sweep
+	sweepExpiredMemories(map[string]*memstatus{"lists:lists": {}})
+
+	want := map[string]bool{
+		"links:links":                false,
+		expiryPrefix + "links:links": false,
+		"lists:lists":                true,
+		expiryPrefix + "lists:lists": true,
+		"memes:memes":                true,
+		expiryPrefix + "memes:memes": true,
+		"notes:notes":                true,
+		expiryPrefix + "notes:notes": false,
+	}
+	for key, present := range want {
+		if _, exists := mb.memories[key]; exists != present {
+			t.Errorf("after sweep, '%s' present: want %t, got %t", key, present, exists)
+		}
+	}
+	if _, ok := getExpiration("links:links"); ok {
+		t.Errorf("swept memory still in the expiration index")
+	}
+
+	sweepExpiredMemories(map[string]*memstatus{})
+	if _, exists := mb.memories["lists:lists"]; exists {
+		t.Errorf("checked-in expired memory not swept")
+	}
+}
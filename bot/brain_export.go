@@ -0,0 +1,340 @@
+package bot
+
+/* brain_export.go - exporting and importing every memory in the robot's
+   brain in a portable format, independent of the brain provider. Exports
+   are JSON-lines files (gzipped when the name ends in .gz); the first line
+   is a header with the format version, followed by one line per memory.
+   Memories are decrypted with the robot's key and re-encrypted with a
+   separate export key, so an export can be restored to a robot with a
+   different brain or encryption key. The export key comes from
+   GOPHER_EXPORT_KEY, either a task parameter or the robot's environment.
+   Exports from chat and the export-brain job are limited to plain file
+   names in state/export, since they run with the robot's privileges.
+*/
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+const exportKeyEnv = "GOPHER_EXPORT_KEY"
+const exportFormat = "gopherbot-brain"
+const exportVersion = 1
+
+// exportCheck is encrypted in the header for verifying the key on import
+const exportCheck = "gopherbot-brain-export"
+
+// exportDirectory holds exports from chat and the export-brain job,
+// relative to the robot's working directory
+const exportDirectory = "state/export"
+
+type exportHeader struct {
+	Format  string
+	Version int
+	Created time.Time
+	Check   []byte
+}
+
+type exportRecord struct {
+	Key     string
+	Datum   []byte
+	Expires int64 `json:",omitempty"`
+}
+
+// exportPath returns the path in exportDirectory for an export named in
+// chat or a job argument; only a plain file name is allowed.
+func exportPath(name string) (string, error) {
+	if len(name) == 0 || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("'%s' isn't a plain file name; exports are always in %s", name, exportDirectory)
+	}
+	return filepath.Join(exportDirectory, name), nil
+}
+
+// getExportKey returns the 32-byte export key from a task parameter or the
+// environment.
+func getExportKey(r *Robot) ([]byte, error) {
+	var ek string
+	if r != nil {
+		ek = r.GetParameter(exportKeyEnv)
+	}
+	if len(ek) == 0 {
+		ek = os.Getenv(exportKeyEnv)
+	}
+	if len(ek) < 32 {
+		return nil, fmt.Errorf("%s not set, or shorter than 32 bytes", exportKeyEnv)
+	}
+	return []byte(ek)[0:32], nil
+}
+
+// skipExport is true for memories tied to a particular robot instance
+func skipExport(key string) bool {
+	return key == botEncryptionKey || strings.HasPrefix(key, expiryPrefix)
+}
+
+// exportBrain writes every memory to file, returning the number of
+// memories exported. The file is written to a temporary name first, so a
+// scheduled export never leaves a partial file in place.
+func exportBrain(file string, ekey []byte) (int, error) {
+	brain := interfaces.brain
+	if brain == nil {
+		return 0, fmt.Errorf("no brain configured")
+	}
+	keys, err := brain.List()
+	if err != nil {
+		return 0, fmt.Errorf("listing memories: %v", err)
+	}
+	sort.Strings(keys)
+	check, err := encrypt([]byte(exportCheck), ekey)
+	if err != nil {
+		return 0, fmt.Errorf("encrypting header: %v", err)
+	}
+	tf, err := ioutil.TempFile(filepath.Dir(file), ".brain-export-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tf.Name())
+	var w io.Writer = tf
+	var zw *gzip.Writer
+	if strings.HasSuffix(file, ".gz") {
+		zw = gzip.NewWriter(tf)
+		w = zw
+	}
+	enc := json.NewEncoder(w)
+	hdr := exportHeader{exportFormat, exportVersion, time.Now().UTC(), check}
+	if err := enc.Encode(hdr); err != nil {
+		tf.Close()
+		return 0, err
+	}
+	count := 0
+	for _, key := range keys {
+		if skipExport(key) {
+			continue
+		}
+		_, datum, exists, ret := checkout(key, false)
+		if ret != robot.Ok {
+			tf.Close()
+			return 0, fmt.Errorf("retrieving '%s': %s", key, ret)
+		}
+		if !exists {
+			continue
+		}
+		rec := exportRecord{Key: key}
+		if expires, ok := getExpiration(key); ok {
+			rec.Expires = expires.Unix()
+		}
+		if rec.Datum, err = encrypt(*datum, ekey); err != nil {
+			tf.Close()
+			return 0, fmt.Errorf("encrypting '%s': %v", key, err)
+		}
+		if err := enc.Encode(rec); err != nil {
+			tf.Close()
+			return 0, err
+		}
+		count++
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			tf.Close()
+			return 0, err
+		}
+	}
+	if err := tf.Close(); err != nil {
+		return 0, err
+	}
+	os.Chmod(tf.Name(), 0600)
+	if err := os.Rename(tf.Name(), file); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// readExport reads and decrypts an entire export before anything in the
+// brain is touched, so a bad key or corrupt file changes nothing.
+func readExport(file string, ekey []byte) ([]exportRecord, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rd io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(file, ".gz") {
+		zr, err := gzip.NewReader(rd)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		rd = zr
+	}
+	dec := json.NewDecoder(rd)
+	var hdr exportHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	if hdr.Format != exportFormat {
+		return nil, fmt.Errorf("not a brain export")
+	}
+	if hdr.Version > exportVersion {
+		return nil, fmt.Errorf("export version %d is newer than supported version %d", hdr.Version, exportVersion)
+	}
+	if check, err := decrypt(hdr.Check, ekey); err != nil || string(check) != exportCheck {
+		return nil, fmt.Errorf("export key doesn't match the key used for the export")
+	}
+	records := make([]exportRecord, 0)
+	for {
+		var rec exportRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading memory %d: %v", len(records)+1, err)
+		}
+		if rec.Datum, err = decrypt(rec.Datum, ekey); err != nil {
+			return nil, fmt.Errorf("decrypting '%s': %v", rec.Key, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// importBrain restores memories from an export. When replace is false,
+// memories in the export are merged with (and overwrite) existing
+// memories; when true, existing memories not in the export are deleted.
+// Returns the number of memories stored and deleted.
+func importBrain(file string, ekey []byte, replace bool) (stored, deleted int, err error) {
+	brain := interfaces.brain
+	if brain == nil {
+		return 0, 0, fmt.Errorf("no brain configured")
+	}
+	records, err := readExport(file, ekey)
+	if err != nil {
+		return 0, 0, err
+	}
+	if replace {
+		keys, err := brain.List()
+		if err != nil {
+			return 0, 0, fmt.Errorf("listing memories: %v", err)
+		}
+		imported := make(map[string]struct{})
+		for _, rec := range records {
+			imported[rec.Key] = struct{}{}
+		}
+		for _, key := range keys {
+			if _, ok := imported[key]; ok || skipExport(key) {
+				continue
+			}
+			if ret := deleteDatum(key); ret != robot.Ok {
+				return stored, deleted, fmt.Errorf("deleting '%s': %s", key, ret)
+			}
+			deleted++
+		}
+	}
+	now := time.Now()
+	for _, rec := range records {
+		var expires time.Time
+		if rec.Expires != 0 {
+			expires = time.Unix(rec.Expires, 0)
+			if now.After(expires) {
+				continue
+			}
+		}
+		tok, _, _, ret := checkout(rec.Key, true)
+		if ret != robot.Ok {
+			return stored, deleted, fmt.Errorf("checking out '%s': %s", rec.Key, ret)
+		}
+		datum := rec.Datum
+		if ret := updateExpiring(rec.Key, tok, &datum, expires); ret != robot.Ok {
+			checkinDatum(rec.Key, tok)
+			return stored, deleted, fmt.Errorf("storing '%s': %s", rec.Key, ret)
+		}
+		stored++
+	}
+	return stored, deleted, nil
+}
+
+// deleteDatum removes a memory while holding the lock
+func deleteDatum(key string) robot.RetVal {
+	tok, _, _, ret := checkout(key, true)
+	if ret != robot.Ok {
+		return ret
+	}
+	defer checkinDatum(key, tok)
+	if err := interfaces.brain.Delete(key); err != nil {
+		Log(robot.Error, "Deleting memory '%s': %v", key, err)
+		return robot.BrainFailed
+	}
+	return setExpiration(key, time.Time{})
+}
+
+func cliExportBrain(file string) {
+	ekey, err := getExportKey(nil)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	count, err := exportBrain(file, ekey)
+	if err != nil {
+		fmt.Printf("Exporting brain: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d memories to '%s'\n", count, file)
+}
+
+func cliImportBrain(file string, replace bool) {
+	ekey, err := getExportKey(nil)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	stored, deleted, err := importBrain(file, ekey, replace)
+	if err != nil {
+		fmt.Printf("Importing brain: %v (stored %d, deleted %d before the error)\n", err, stored, deleted)
+		os.Exit(1)
+	}
+	fmt.Printf("Imported %d memories from '%s', deleted %d\n", stored, file, deleted)
+}
+
+// exportbrain is a Go job for scheduled exports; the optional argument is
+// the file to write.
+func exportbrain(m robot.Robot, args ...string) (retval robot.TaskRetVal) {
+	r := m.(Robot)
+	name := "brain-export.jsonl.gz"
+	if len(args) > 0 && len(args[0]) > 0 {
+		name = args[0]
+	}
+	file, err := exportPath(name)
+	if err != nil {
+		r.Log(robot.Error, "Exporting brain: %v", err)
+		return robot.Fail
+	}
+	ekey, err := getExportKey(&r)
+	if err != nil {
+		r.Log(robot.Error, "Exporting brain: %v", err)
+		return robot.MechanismFail
+	}
+	raiseThreadPriv("exporting brain")
+	if err := os.MkdirAll(exportDirectory, 0700); err != nil {
+		r.Log(robot.Error, "Creating export directory: %v", err)
+		return robot.MechanismFail
+	}
+	count, err := exportBrain(file, ekey)
+	if err != nil {
+		r.Log(robot.Error, "Exporting brain to '%s': %v", file, err)
+		return robot.Fail
+	}
+	r.Log(robot.Info, "Exported %d memories to '%s'", count, file)
+	return
+}
+
+func init() {
+	RegisterJob("export-brain", robot.JobHandler{Handler: exportbrain})
+}
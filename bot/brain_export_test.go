@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testExportKey = "export-key-0123456789abcdef012345"
+
+// startExportBrain runs the brain loop with an unencrypted memory brain
+// holding two memories, one of them expiring, and the robot's own key.
+func startExportBrain(t *testing.T) (*memBrain, time.Time) {
+	t.Helper()
+	mb := setupExpiryBrain(t)
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	storeTestMemory(t, "links:links", time.Time{})
+	storeTestMemory(t, "lists:lists", expires)
+	key := []byte("wrapped key")
+	mb.Store(botEncryptionKey, &key)
+	go runBrain()
+	t.Cleanup(brainQuit)
+	return mb, expires
+}
+
+func testExportKeyEnv(t *testing.T) []byte {
+	t.Helper()
+	t.Setenv(exportKeyEnv, testExportKey)
+	ekey, err := getExportKey(nil)
+	if err != nil {
+		t.Fatalf("getExportKey: %v", err)
+	}
+	return ekey
+}
+
+func TestGetExportKey(t *testing.T) {
+	t.Setenv(exportKeyEnv, "")
+	if _, err := getExportKey(nil); err == nil {
+		t.Errorf("want an error with no %s", exportKeyEnv)
+	}
+	t.Setenv(exportKeyEnv, "too short")
+	if _, err := getExportKey(nil); err == nil {
+		t.Errorf("want an error with a short %s", exportKeyEnv)
+	}
+	ekey := testExportKeyEnv(t)
+	if string(ekey) != testExportKey[0:32] {
+		t.Errorf("want the first 32 bytes of %s, got %q", exportKeyEnv, ekey)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	for _, name := range []string{"brain.jsonl", "brain.jsonl.gz"} {
+		t.Run(name, func(t *testing.T) {
+			src, expires := startExportBrain(t)
+			ekey := testExportKeyEnv(t)
+			file := filepath.Join(t.TempDir(), name)
+			count, err := exportBrain(file, ekey)
+			if err != nil {
+				t.Fatalf("exporting: %v", err)
+			}
+			if count != 2 {
+				t.Errorf("want 2 memories exported, got %d", count)
+			}
+			raw, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gzipped := bytes.HasPrefix(raw, []byte{0x1f, 0x8b})
+			if gzipped != strings.HasSuffix(name, ".gz") {
+				t.Errorf("'%s' gzipped: %t", name, gzipped)
+			}
+
+			// Import to an empty brain
+			dst := provider(nil).(*memBrain)
+			interfaces.brain = dst
+			memoryExpirations.m = nil
+			memoryExpirations.loaded = false
+			stored, deleted, err := importBrain(file, ekey, false)
+			if err != nil {
+				t.Fatalf("importing: %v", err)
+			}
+			if stored != 2 || deleted != 0 {
+				t.Errorf("want 2 stored, 0 deleted; got %d, %d", stored, deleted)
+			}
+			for _, key := range []string{"links:links", "lists:lists"} {
+				got, ok := dst.memories[key]
+				if !ok || string(*got) != string(*src.memories[key]) {
+					t.Errorf("'%s' not restored", key)
+				}
+			}
+			if _, ok := dst.memories[botEncryptionKey]; ok {
+				t.Errorf("the robot's encryption key was exported")
+			}
+			if got, ok := getExpiration("lists:lists"); !ok || !got.Equal(expires) {
+				t.Errorf("expiration: want %s, got %s (%t)", expires, got, ok)
+			}
+			if _, ok := getExpiration("links:links"); ok {
+				t.Errorf("expiration set for a memory that doesn't expire")
+			}
+		})
+	}
+}
+
+func TestImportWrongKey(t *testing.T) {
+	mb, _ := startExportBrain(t)
+	file := filepath.Join(t.TempDir(), "brain.jsonl")
+	if _, err := exportBrain(file, testExportKeyEnv(t)); err != nil {
+		t.Fatalf("exporting: %v", err)
+	}
+	before := len(mb.memories)
+	wrong := []byte(strings.Repeat("w", 32))
+	if _, _, err := importBrain(file, wrong, true); err == nil {
+		t.Errorf("import with the wrong key succeeded")
+	}
+	if len(mb.memories) != before {
+		t.Errorf("failed import changed the brain: %d memories, want %d", len(mb.memories), before)
+	}
+}
+
+func TestImportReplace(t *testing.T) {
+	for _, replace := range []bool{false, true} {
+		t.Run(map[bool]string{false: "merge", true: "replace"}[replace], func(t *testing.T) {
+			mb, _ := startExportBrain(t)
+			ekey := testExportKeyEnv(t)
+			file := filepath.Join(t.TempDir(), "brain.jsonl.gz")
+			if _, err := exportBrain(file, ekey); err != nil {
+				t.Fatalf("exporting: %v", err)
+			}
+			// A changed and a new memory since the export
+			extra := []byte(`"extra"`)
+			mb.memories["links:links"] = &extra
+			mb.memories["memes:memes"] = &extra
+
+			stored, deleted, err := importBrain(file, ekey, replace)
+			if err != nil {
+				t.Fatalf("importing: %v", err)
+			}
+			wantDeleted := 0
+			if replace {
+				wantDeleted = 1
+			}
+			if stored != 2 || deleted != wantDeleted {
+				t.Errorf("want 2 stored, %d deleted; got %d, %d", wantDeleted, stored, deleted)
+			}
+			if got := string(*mb.memories["links:links"]); got != `"links:links"` {
+				t.Errorf("imported memory not restored, got %s", got)
+			}
+			if _, ok := mb.memories["memes:memes"]; ok == replace {
+				t.Errorf("memory not in the export exists: %t", ok)
+			}
+			if _, ok := mb.memories[botEncryptionKey]; !ok {
+				t.Errorf("the robot's encryption key was deleted")
+			}
+		})
+	}
+}
+
+func TestImportFailureChecksIn(t *testing.T) {
+	mb, _ := startExportBrain(t)
+	ekey := testExportKeyEnv(t)
+	file := filepath.Join(t.TempDir(), "brain.jsonl")
+	if _, err := exportBrain(file, ekey); err != nil {
+		t.Fatalf("exporting: %v", err)
+	}
+	interfaces.brain = &failingBrain{mb, 0}
+	stored, _, err := importBrain(file, ekey, false)
+	if err == nil {
+		t.Fatalf("import to a failing brain succeeded")
+	}
+	if stored != 0 {
+		t.Errorf("want nothing stored, got %d", stored)
+	}
+	if locks := getBrainLocks(); len(locks) != 0 {
+		t.Errorf("failed import left memories checked out: %+v", locks)
+	}
+	interfaces.brain = mb
+	checkedOut := make(chan struct{})
+	go func() {
+		tok, _, _, _ := checkout("links:links", true)
+		checkinDatum("links:links", tok)
+		close(checkedOut)
+	}()
+	select {
+	case <-checkedOut:
+	case <-time.After(time.Second):
+		t.Errorf("memory still locked after a failed import")
+	}
+}
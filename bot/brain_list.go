@@ -0,0 +1,170 @@
+package bot
+
+/* brain_list.go - listing memories in a plugin's namespace and reading
+   several at once, so plugins don't need to keep their own index of
+   memory keys.
+*/
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+type listRequest struct {
+	prefix string
+	reply  chan listReply
+}
+
+type listReply struct {
+	keys []string
+	ret  robot.RetVal
+}
+
+type readRequest struct {
+	keys  []string
+	reply chan readReply
+}
+
+type readReply struct {
+	data map[string]*[]byte
+	ret  robot.RetVal
+}
+
+// listKeys is called from the brain loop; expired memories aren't listed.
+func listKeys(prefix string) listReply {
+	brain := interfaces.brain
+	if brain == nil {
+		Log(robot.Error, "Brain function called with no brain configured")
+		return listReply{nil, robot.BrainFailed}
+	}
+	keys, err := brain.List()
+	if err != nil {
+		Log(robot.Error, "Listing memories with prefix '%s': %v", prefix, err)
+		return listReply{nil, robot.BrainFailed}
+	}
+	matched := make([]string, 0)
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) && !noExpiry(key) && !isExpired(key) {
+			matched = append(matched, key)
+		}
+	}
+	sort.Strings(matched)
+	return listReply{matched, robot.Ok}
+}
+
+// readKeys is called from the brain loop to read several memories without
+// locking them; memories that don't exist are left out.
+func readKeys(keys []string) readReply {
+	data := make(map[string]*[]byte)
+	for _, key := range keys {
+		_, db, exists, ret := getDatum(key, false)
+		if ret != robot.Ok {
+			return readReply{nil, ret}
+		}
+		if exists {
+			data[key] = db
+		}
+	}
+	return readReply{data, robot.Ok}
+}
+
+// readData reads several memories read-only in a single request to the
+// brain loop.
+func readData(keys []string) (map[string]*[]byte, robot.RetVal) {
+	reply := make(chan readReply)
+	brainChanEvents <- readRequest{keys, reply}
+	rep := <-reply
+	return rep.data, rep.ret
+}
+
+// listDatum returns the full keys of memories starting with prefix
+func listDatum(prefix string) ([]string, robot.RetVal) {
+	reply := make(chan listReply)
+	brainChanEvents <- listRequest{prefix, reply}
+	rep := <-reply
+	return rep.keys, rep.ret
+}
+
+// datumNameSpace returns the namespace prefix for the Robot's memories,
+// including the ':' separator.
+func (r Robot) datumNameSpace() string {
+	task, _, _ := getTask(r.currentTask)
+	ns := getNameSpace(task)
+	if len(r.nsExtension) > 0 {
+		return ns + ":" + r.nsExtension + ":"
+	}
+	return ns + ":"
+}
+
+// ListDatum returns the keys of the plugin's memories that start with
+// prefix, without the namespace; an empty prefix lists all of them.
+func (r Robot) ListDatum(prefix string) (keys []string, ret robot.RetVal) {
+	if strings.ContainsRune(prefix, ':') {
+		Log(robot.Error, "Invalid memory key prefix, ':' disallowed: %s", prefix)
+		return nil, robot.InvalidDatumKey
+	}
+	ns := r.datumNameSpace()
+	full, ret := listDatum(ns + prefix)
+	if ret != robot.Ok {
+		return nil, ret
+	}
+	keys = make([]string, 0, len(full))
+	for _, key := range full {
+		key = strings.TrimPrefix(key, ns)
+		// memories in an extended namespace aren't accessible
+		// with CheckoutDatum
+		if strings.ContainsRune(key, ':') {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, robot.Ok
+}
+
+// checkoutData reads several memories without locking them, returning the
+// raw JSON for each memory that exists.
+func (r Robot) checkoutData(keys []string) (map[string]json.RawMessage, robot.RetVal) {
+	ns := r.datumNameSpace()
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		if strings.ContainsRune(key, ':') {
+			Log(robot.Error, "Invalid memory key, ':' disallowed: %s", key)
+			return nil, robot.InvalidDatumKey
+		}
+		full[i] = ns + key
+	}
+	read, ret := readData(full)
+	if ret != robot.Ok {
+		return nil, ret
+	}
+	data := make(map[string]json.RawMessage)
+	for _, key := range keys {
+		if dbytes, ok := read[ns+key]; ok {
+			data[key] = json.RawMessage(*dbytes)
+		}
+	}
+	return data, robot.Ok
+}
+
+// CheckoutData reads several memories at once, read-only. Data must be a
+// pointer to a map from key to the memory's type, e.g.
+// *map[string]ItemType; memories that don't exist are left out of the map.
+func (r Robot) CheckoutData(keys []string, data interface{}) (ret robot.RetVal) {
+	raw, ret := r.checkoutData(keys)
+	if ret != robot.Ok {
+		return ret
+	}
+	jb, err := json.Marshal(raw)
+	if err != nil {
+		Log(robot.Error, "Marshalling memories: %v", err)
+		return robot.DataFormatError
+	}
+	if err := json.Unmarshal(jb, data); err != nil {
+		Log(robot.Error, "Unmarshalling memories: %v", err)
+		return robot.DataFormatError
+	}
+	return robot.Ok
+}
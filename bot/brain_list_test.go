@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// startListBrain runs the brain loop with memories in two plugin namespaces,
+// an extended namespace, and one memory that's expired.
+func startListBrain(t *testing.T) {
+	t.Helper()
+	setupExpiryBrain(t)
+	for _, key := range []string{"links:alpha", "links:alpine", "links:beta", "lists:alpha", "links:work:gamma"} {
+		storeTestMemory(t, key, time.Time{})
+	}
+	storeTestMemory(t, "links:alps", time.Now().Add(-time.Minute))
+	go runBrain()
+	t.Cleanup(brainQuit)
+}
+
+// taskRobot returns a Robot running the named task, for brain methods
+// that only need the namespace.
+func taskRobot(task *Task, extension string) Robot {
+	return Robot{pipeContext: &pipeContext{currentTask: task, nsExtension: extension}}
+}
+
+func TestListDatum(t *testing.T) {
+	startListBrain(t)
+	cases := []struct {
+		name   string
+		r      Robot
+		prefix string
+		want   []string
+	}{
+		{"all", taskRobot(&Task{name: "links"}, ""), "", []string{"alpha", "alpine", "beta"}},
+		{"prefix", taskRobot(&Task{name: "links"}, ""), "alp", []string{"alpha", "alpine"}},
+		{"no match", taskRobot(&Task{name: "links"}, ""), "zeta", []string{}},
+		{"other namespace", taskRobot(&Task{name: "lists"}, ""), "", []string{"alpha"}},
+		{"shared namespace", taskRobot(&Task{name: "bookmarks", NameSpace: "links"}, ""), "b", []string{"beta"}},
+		{"extended namespace", taskRobot(&Task{name: "links"}, "work"), "", []string{"gamma"}},
+	}
+	for _, c := range cases {
+		keys, ret := c.r.ListDatum(c.prefix)
+		if ret != robot.Ok {
+			t.Errorf("%s: ListDatum returned %s", c.name, ret)
+			continue
+		}
+		if len(keys) != len(c.want) {
+			t.Errorf("%s: want %q, got %q", c.name, c.want, keys)
+			continue
+		}
+		for i := range keys {
+			if keys[i] != c.want[i] {
+				t.Errorf("%s: want %q, got %q", c.name, c.want, keys)
+				break
+			}
+		}
+	}
+	if _, ret := taskRobot(&Task{name: "links"}, "").ListDatum("work:"); ret != robot.InvalidDatumKey {
+		t.Errorf("prefix with ':': want InvalidDatumKey, got %s", ret)
+	}
+}
+
+func TestCheckoutData(t *testing.T) {
+	startListBrain(t)
+	r := taskRobot(&Task{name: "links"}, "")
+
+	// a read-write checkout by another task doesn't block reading
+	var datum string
+	holder := lockHolder{1, "writer"}
+	if _, _, ret := checkoutDatumFor("links:alpha", &datum, true, holder); ret != robot.Ok {
+		t.Fatalf("read-write checkout: %s", ret)
+	}
+	data := make(map[string]string)
+	done := make(chan robot.RetVal)
+	go func() { done <- r.CheckoutData([]string{"alpha", "beta", "missing"}, &data) }()
+	select {
+	case ret := <-done:
+		if ret != robot.Ok {
+			t.Fatalf("CheckoutData: %s", ret)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("CheckoutData waited for a read-write lock")
+	}
+	if len(data) != 2 || data["alpha"] != "links:alpha" || data["beta"] != "links:beta" {
+		t.Errorf("want alpha and beta, got %q", data)
+	}
+	if locks := getBrainLocks(); len(locks) != 1 || locks[0].Task != "writer" {
+		t.Errorf("CheckoutData changed the locks held: %+v", locks)
+	}
+	if ret := r.CheckoutData([]string{"work:gamma"}, &data); ret != robot.InvalidDatumKey {
+		t.Errorf("key with ':': want InvalidDatumKey, got %s", ret)
+	}
+	var wrong map[string]int
+	if ret := r.CheckoutData([]string{"alpha"}, &wrong); ret != robot.DataFormatError {
+		t.Errorf("wrong type: want DataFormatError, got %s", ret)
+	}
+}
+
+func TestCheckoutDataSingleRequest(t *testing.T) {
+	setupExpiryBrain(t)
+	storeTestMemory(t, "links:alpha", time.Time{})
+	storeTestMemory(t, "links:beta", time.Time{})
+	// stand in for the brain loop, recording each request
+	events := make(chan interface{}, 10)
+	quit := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case evt := <-brainChanEvents:
+				events <- evt
+				if rr, ok := evt.(readRequest); ok {
+					rr.reply <- readKeys(rr.keys)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+	defer close(quit)
+
+	data := make(map[string]string)
+	r := taskRobot(&Task{name: "links"}, "")
+	if ret := r.CheckoutData([]string{"alpha", "beta"}, &data); ret != robot.Ok {
+		t.Fatalf("CheckoutData: %s", ret)
+	}
+	if len(events) != 1 {
+		t.Fatalf("want 1 request to the brain loop, got %d", len(events))
+	}
+	rr, ok := (<-events).(readRequest)
+	if !ok {
+		t.Fatalf("want a readRequest")
+	}
+	if len(rr.keys) != 2 || rr.keys[0] != "links:alpha" || rr.keys[1] != "links:beta" {
+		t.Errorf("want keys [links:alpha links:beta], got %q", rr.keys)
+	}
+}
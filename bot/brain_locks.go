@@ -0,0 +1,200 @@
+package bot
+
+/* brain_locks.go - introspection for memories checked out read-write.
+   The brain loop records which pipeline and task holds each lock; admins
+   can list held locks and force-release a lock held by a task that's
+   stuck or crashed. Lock wait statistics are kept per task, along with
+   how often each task's locks made another task wait, to help find the
+   plugins causing contention.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockHolder identifies who checked out a memory
+type lockHolder struct {
+	wid  int    // pipeline (worker) ID, 0 for the robot itself
+	task string // task name
+}
+
+// robotHolder is used for the robot's own checkouts
+var robotHolder = lockHolder{0, "(robot)"}
+
+// lockInfo describes a held lock, for admin commands and the JSON api
+type lockInfo struct {
+	Key     string
+	WID     int
+	Task    string
+	Age     time.Duration
+	Waiters int
+}
+
+// lockStat holds lock statistics for a task
+type lockStat struct {
+	Task      string
+	Checkouts int           // read-write checkouts
+	Waits     int           // checkouts that had to wait for another task
+	TotalWait time.Duration // total time spent waiting
+	MaxWait   time.Duration // longest wait
+	Contended int           // times another task waited for this task's lock
+}
+
+var lockStats = struct {
+	m map[string]*lockStat
+	sync.Mutex
+}{
+	m: make(map[string]*lockStat),
+}
+
+type lockListRequest struct {
+	reply chan []lockInfo
+}
+
+type lockReleaseRequest struct {
+	key   string
+	reply chan bool
+}
+
+// lockHolder returns the holder for checkouts by this Robot
+func (r Robot) lockHolder() lockHolder {
+	h := lockHolder{}
+	if task, _, _ := getTask(r.currentTask); task != nil {
+		h.task = task.name
+	}
+	if w := getLockedWorker(r.tid); w != nil {
+		h.wid = w.id
+		w.Unlock()
+	}
+	return h
+}
+
+func getLockStat(task string) *lockStat {
+	ls, ok := lockStats.m[task]
+	if !ok {
+		ls = &lockStat{Task: task}
+		lockStats.m[task] = ls
+	}
+	return ls
+}
+
+// recordLockWait is called from the brain loop when a read-write checkout
+// is granted; waited is true if the request was queued.
+func recordLockWait(creq checkOutRequest, waited bool) {
+	lockStats.Lock()
+	defer lockStats.Unlock()
+	ls := getLockStat(creq.holder.task)
+	ls.Checkouts++
+	if !waited {
+		return
+	}
+	wait := time.Since(creq.requested)
+	ls.Waits++
+	ls.TotalWait += wait
+	if wait > ls.MaxWait {
+		ls.MaxWait = wait
+	}
+}
+
+// recordLockContention counts a request queued behind the holder's lock
+func recordLockContention(h lockHolder) {
+	lockStats.Lock()
+	getLockStat(h.task).Contended++
+	lockStats.Unlock()
+}
+
+// getLockStats returns a copy of the lock statistics, sorted by total
+// wait time, longest first
+func getLockStats() []lockStat {
+	lockStats.Lock()
+	stats := make([]lockStat, 0, len(lockStats.m))
+	for _, ls := range lockStats.m {
+		stats = append(stats, *ls)
+	}
+	lockStats.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalWait != stats[j].TotalWait {
+			return stats[i].TotalWait > stats[j].TotalWait
+		}
+		return stats[i].Task < stats[j].Task
+	})
+	return stats
+}
+
+// listLocks is called from the brain loop; memories in the available state
+// have timed out and aren't reported.
+func listLocks(memories map[string]*memstatus) []lockInfo {
+	now := time.Now()
+	locks := make([]lockInfo, 0, len(memories))
+	for key, m := range memories {
+		if m.state == available {
+			continue
+		}
+		locks = append(locks, lockInfo{
+			Key:     key,
+			WID:     m.holder.wid,
+			Task:    m.holder.task,
+			Age:     now.Sub(m.since),
+			Waiters: len(m.waiters),
+		})
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Key < locks[j].Key })
+	return locks
+}
+
+// releaseLock is called from the brain loop to force-release a lock; the
+// next waiter, if any, gets the lock. Otherwise the memory is left
+// available with no token, rather than deleted, so either way the old
+// holder's update fails with DatumLockExpired instead of DatumNotFound.
+func releaseLock(memories map[string]*memstatus, key string) bool {
+	m, ok := memories[key]
+	if !ok || m.state == available {
+		return false
+	}
+	if len(m.waiters) > 0 {
+		replyToWaiter(m)
+		return true
+	}
+	m.state = available
+	m.token = ""
+	return true
+}
+
+// getBrainLocks lists the locks currently held
+func getBrainLocks() []lockInfo {
+	reply := make(chan []lockInfo)
+	brainChanEvents <- lockListRequest{reply}
+	return <-reply
+}
+
+// releaseBrainLock force-releases the lock on a memory, returning false
+// if the memory isn't checked out.
+func releaseBrainLock(key string) bool {
+	reply := make(chan bool)
+	brainChanEvents <- lockReleaseRequest{key, reply}
+	return <-reply
+}
+
+func formatLocks(locks []lockInfo) string {
+	lines := []string{"KEY                            WID   TASK             AGE      WAITERS"}
+	for _, l := range locks {
+		wid := "-"
+		if l.WID != 0 {
+			wid = fmt.Sprintf("%d", l.WID)
+		}
+		lines = append(lines, fmt.Sprintf("%-30.30s %-5.5s %-16.16s %-8.8s %d", l.Key, wid, l.Task, l.Age.Round(time.Millisecond), l.Waiters))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatLockStats(stats []lockStat) string {
+	lines := []string{"TASK             CHECKOUTS WAITS  TOTAL-WAIT MAX-WAIT   CONTENDED"}
+	for _, s := range stats {
+		lines = append(lines, fmt.Sprintf("%-16.16s %-9d %-6d %-10.10s %-10.10s %d", s.Task, s.Checkouts, s.Waits, s.TotalWait.Round(time.Millisecond), s.MaxWait.Round(time.Millisecond), s.Contended))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// startLockBrain runs the brain loop with an unencrypted memory brain
+// holding one memory.
+func startLockBrain(t *testing.T) {
+	t.Helper()
+	setupExpiryBrain(t)
+	storeTestMemory(t, "locks:memory", time.Time{})
+	go runBrain()
+	t.Cleanup(brainQuit)
+}
+
+func TestReleaseLockNoWaiters(t *testing.T) {
+	startLockBrain(t)
+	var datum string
+	holder := lockHolder{1, "stuck"}
+	token, _, ret := checkoutDatumFor("locks:memory", &datum, true, holder)
+	if ret != robot.Ok {
+		t.Fatalf("checkout: %s", ret)
+	}
+	if locks := getBrainLocks(); len(locks) != 1 || locks[0].Task != "stuck" {
+		t.Fatalf("want one lock held by 'stuck', got %+v", locks)
+	}
+	if !releaseBrainLock("locks:memory") {
+		t.Fatalf("releasing a held lock returned false")
+	}
+	if locks := getBrainLocks(); len(locks) != 0 {
+		t.Errorf("want no locks after release, got %+v", locks)
+	}
+	if releaseBrainLock("locks:memory") {
+		t.Errorf("releasing a released lock returned true")
+	}
+	if ret := updateDatum("locks:memory", token, "late"); ret != robot.DatumLockExpired {
+		t.Errorf("update by the old holder: want DatumLockExpired, got %s", ret)
+	}
+
+	// the memory can be checked out again, and the update is stored
+	newToken, _, ret := checkoutDatumFor("locks:memory", &datum, true, lockHolder{2, "next"})
+	if ret != robot.Ok || newToken == token {
+		t.Fatalf("checkout after release: %s, token %q", ret, newToken)
+	}
+	if ret := updateDatum("locks:memory", newToken, "updated"); ret != robot.Ok {
+		t.Fatalf("update by the new holder: %s", ret)
+	}
+	checkoutDatumFor("locks:memory", &datum, false, robotHolder)
+	if datum != "updated" {
+		t.Errorf("want 'updated' stored, got '%s'", datum)
+	}
+}
+
+func TestReleaseLockToWaiter(t *testing.T) {
+	startLockBrain(t)
+	var datum string
+	token, _, ret := checkoutDatumFor("locks:memory", &datum, true, lockHolder{1, "stuck"})
+	if ret != robot.Ok {
+		t.Fatalf("checkout: %s", ret)
+	}
+	type checkout struct {
+		token string
+		ret   robot.RetVal
+	}
+	waiter := make(chan checkout)
+	go func() {
+		var wdatum string
+		wt, _, wret := checkoutDatumFor("locks:memory", &wdatum, true, lockHolder{2, "waiter"})
+		waiter <- checkout{wt, wret}
+	}()
+	// wait for the request to queue
+	deadline := time.Now().Add(time.Second)
+	for {
+		locks := getBrainLocks()
+		if len(locks) == 1 && locks[0].Waiters == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("checkout never queued behind the held lock: %+v", locks)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if !releaseBrainLock("locks:memory") {
+		t.Fatalf("releasing a held lock returned false")
+	}
+	var w checkout
+	select {
+	case w = <-waiter:
+	case <-time.After(time.Second):
+		t.Fatalf("waiter didn't get the lock after release")
+	}
+	if w.ret != robot.Ok || w.token == token {
+		t.Fatalf("waiter checkout: %s, token %q", w.ret, w.token)
+	}
+	if locks := getBrainLocks(); len(locks) != 1 || locks[0].Task != "waiter" || locks[0].Waiters != 0 {
+		t.Errorf("want the lock held by 'waiter', got %+v", locks)
+	}
+	if ret := updateDatum("locks:memory", token, "late"); ret != robot.DatumLockExpired {
+		t.Errorf("update by the old holder: want DatumLockExpired, got %s", ret)
+	}
+	if ret := updateDatum("locks:memory", w.token, "waited"); ret != robot.Ok {
+		t.Errorf("update by the waiter: %s", ret)
+	}
+}
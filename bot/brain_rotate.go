@@ -0,0 +1,351 @@
+package bot
+
+/* brain_rotate.go - replacing the robot's internal encryption key, e.g.
+   after a suspected leak, and re-encrypting every memory with the new key.
+   Before anything is re-encrypted, the old and new internal keys are
+   written to a journal next to the key file, wrapped with the current
+   user-supplied key. Since memories are encrypted with AES-GCM, every
+   memory can be checked for which key it's encrypted with, so the
+   re-encryption pass can simply be run again in either direction. Only
+   after every memory is re-encrypted is the new key stored in place of
+   the old one and the journal removed. If the robot finds a journal on
+   start-up, a rotation was interrupted; the brain stays locked until the
+   rotation is resumed or rolled back with 'gopherbot rotate-key'.
+*/
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+const rotationJournal = encryptedKeyFile + ".rotating"
+
+// environment variable with the new user-supplied key for the CLI
+const newKeyEnv = "GOPHER_NEW_ENCRYPTION_KEY"
+
+type rotateOp int
+
+const (
+	rotateInternal rotateOp = iota // generate a new internal key and re-encrypt
+	rotateResume                   // finish an interrupted rotation
+	rotateRollback                 // return to the old key after an interrupted rotation
+	rotateUser                     // change the user-supplied key; see reKey
+)
+
+// rotationState is the journal; both keys are encrypted with the
+// user-supplied key in use when the rotation started.
+type rotationState struct {
+	Started time.Time
+	OldKey  []byte
+	NewKey  []byte
+}
+
+// rotateRequest runs a rotation in the brain loop, so no memories are
+// stored or retrieved while keys are changing.
+type rotateRequest struct {
+	op      rotateOp
+	userKey string // new user-supplied key for rotateUser
+	reply   chan error
+}
+
+func journalPath() string {
+	return filepath.Join(configPath, rotationJournal)
+}
+
+// checkPendingRotation is called after encryption is initialized on
+// start-up; when a rotation was interrupted, the brain is left
+// uninitialized except for the rotate-key CLI command.
+func checkPendingRotation() bool {
+	if _, err := os.Stat(journalPath()); err != nil {
+		return true
+	}
+	if cliOp && flag.Arg(0) == "rotate-key" {
+		return true
+	}
+	Log(robot.Error, "Encryption key rotation was interrupted; use 'gopherbot rotate-key -resume' or 'gopherbot rotate-key -rollback' before starting the robot")
+	cryptKey.Lock()
+	cryptKey.initialized = false
+	cryptKey.Unlock()
+	return false
+}
+
+const finishRotation = "the brain is locked until the rotation is finished with 'gopherbot rotate-key -resume' or 'gopherbot rotate-key -rollback'"
+
+// lockInterruptedRotation leaves the brain uninitialized after a rotation
+// fails part way, the same as finding the journal on start-up; memories
+// are then encrypted with a mix of keys, and any read or write with the
+// old key could corrupt them.
+func lockInterruptedRotation() {
+	Log(robot.Error, "Encryption key rotation was interrupted; %s", finishRotation)
+	cryptKey.Lock()
+	cryptKey.initialized = false
+	cryptKey.Unlock()
+}
+
+// rotateKeys sends a rotation request to the brain loop and waits for it
+// to finish.
+func rotateKeys(op rotateOp, userKey string) error {
+	reply := make(chan error)
+	brainChanEvents <- rotateRequest{op, userKey, reply}
+	return <-reply
+}
+
+// run is called from the brain loop
+func (rr rotateRequest) run() error {
+	cryptKey.RLock()
+	initialized := cryptKey.initialized
+	userKey := cryptKey.userKey
+	key := cryptKey.key
+	cryptKey.RUnlock()
+	if !encryptBrain {
+		return fmt.Errorf("brain encryption isn't enabled")
+	}
+	if !initialized || len(userKey) == 0 {
+		return fmt.Errorf("encryption not initialized")
+	}
+	var js rotationState
+	var skip map[string]bool
+	if rr.op == rotateInternal || rr.op == rotateUser {
+		if _, err := os.Stat(journalPath()); err == nil {
+			return fmt.Errorf("a previous rotation was interrupted; resume or roll it back first")
+		}
+	}
+	if rr.op == rotateUser {
+		return reKey(rr.userKey)
+	}
+	if rr.op == rotateInternal {
+		newKey := make([]byte, 32)
+		if _, err := rand.Read(newKey); err != nil {
+			return fmt.Errorf("generating new internal key: %v", err)
+		}
+		// Nothing is changed yet, so refuse to start rather than lock
+		// the brain part way through.
+		bad, err := undecryptable(key, newKey)
+		if err != nil {
+			return fmt.Errorf("checking memories: %v", err)
+		}
+		if len(bad) > 0 {
+			return fmt.Errorf("memories that don't decrypt with the current internal key: %s; 'gopherbot fetch <key>' encrypts an unencrypted memory, or remove stray data with 'gopherbot delete <key>'", strings.Join(bad, ", "))
+		}
+		if err := writeJournal(key, newKey, userKey); err != nil {
+			return fmt.Errorf("writing rotation journal: %v", err)
+		}
+		js = rotationState{OldKey: key, NewKey: newKey}
+	} else {
+		var err error
+		if js, err = readJournal(userKey); err != nil {
+			return err
+		}
+	}
+	from, to := js.OldKey, js.NewKey
+	if rr.op == rotateRollback {
+		from, to = js.NewKey, js.OldKey
+	}
+	if rr.op != rotateInternal {
+		// The brain is already locked; memories that decrypt with
+		// neither key are left as-is, and as with getDatum, one that's
+		// unencrypted is encrypted when it's next read.
+		bad, err := undecryptable(from, to)
+		if err != nil {
+			lockInterruptedRotation()
+			return fmt.Errorf("checking memories: %v; %s", err, finishRotation)
+		}
+		if len(bad) > 0 {
+			Log(robot.Warn, "Leaving memories that decrypt with neither the old nor the new key as-is: %s", strings.Join(bad, ", "))
+			skip = make(map[string]bool)
+			for _, key := range bad {
+				skip[key] = true
+			}
+		}
+	}
+	converted, err := reEncryptMemories(from, to, skip)
+	if err != nil {
+		lockInterruptedRotation()
+		return fmt.Errorf("re-encrypting memories (%d done): %v; %s", converted, err, finishRotation)
+	}
+	if err := writeWrappedKey(to, userKey); err != nil {
+		lockInterruptedRotation()
+		return fmt.Errorf("storing new internal key: %v; %s", err, finishRotation)
+	}
+	cryptKey.Lock()
+	cryptKey.key = to
+	cryptKey.Unlock()
+	if err := os.Remove(journalPath()); err != nil {
+		return fmt.Errorf("removing rotation journal: %v", err)
+	}
+	switch rr.op {
+	case rotateRollback:
+		Log(robot.Audit, "Rolled back interrupted rotation of the internal encryption key; %d memories re-encrypted", converted)
+	default:
+		Log(robot.Audit, "Rotated the internal encryption key; %d memories re-encrypted", converted)
+	}
+	return nil
+}
+
+func writeJournal(oldKey, newKey, userKey []byte) error {
+	var js rotationState
+	var err error
+	js.Started = time.Now().UTC()
+	if js.OldKey, err = encrypt(oldKey, userKey); err != nil {
+		return err
+	}
+	if js.NewKey, err = encrypt(newKey, userKey); err != nil {
+		return err
+	}
+	jb, err := json.Marshal(js)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(journalPath(), jb, 0600)
+}
+
+func readJournal(userKey []byte) (rotationState, error) {
+	var js rotationState
+	jb, err := ioutil.ReadFile(journalPath())
+	if err != nil {
+		return js, fmt.Errorf("no interrupted rotation found: %v", err)
+	}
+	if err := json.Unmarshal(jb, &js); err != nil {
+		return js, fmt.Errorf("reading rotation journal: %v", err)
+	}
+	if js.OldKey, err = decrypt(js.OldKey, userKey); err != nil {
+		return js, fmt.Errorf("decrypting old key in rotation journal: %v", err)
+	}
+	if js.NewKey, err = decrypt(js.NewKey, userKey); err != nil {
+		return js, fmt.Errorf("decrypting new key in rotation journal: %v", err)
+	}
+	return js, nil
+}
+
+// undecryptable is a read-only pass over the brain, returning the keys of
+// memories that decrypt with neither from nor to.
+func undecryptable(from, to []byte) ([]string, error) {
+	brain := interfaces.brain
+	keys, err := brain.List()
+	if err != nil {
+		return nil, err
+	}
+	bad := make([]string, 0)
+	for _, key := range keys {
+		if key == botEncryptionKey {
+			continue
+		}
+		db, exists, err := brain.Retrieve(key)
+		if err != nil {
+			return nil, fmt.Errorf("retrieving '%s': %v", key, err)
+		}
+		if !exists {
+			continue
+		}
+		if _, err := decrypt(*db, to); err == nil {
+			continue
+		}
+		if _, err := decrypt(*db, from); err == nil {
+			continue
+		}
+		bad = append(bad, key)
+	}
+	sort.Strings(bad)
+	return bad, nil
+}
+
+// reEncryptMemories re-encrypts every memory encrypted with from; memories
+// already encrypted with to, and those in skip, are left alone. Unlike
+// getDatum, any other memory that decrypts with neither key stops the
+// rotation; with a wrong or stale from key, treating it as unencrypted
+// would encrypt every memory twice.
+func reEncryptMemories(from, to []byte, skip map[string]bool) (int, error) {
+	brain := interfaces.brain
+	keys, err := brain.List()
+	if err != nil {
+		return 0, err
+	}
+	converted := 0
+	for _, key := range keys {
+		if key == botEncryptionKey || skip[key] {
+			continue
+		}
+		db, exists, err := brain.Retrieve(key)
+		if err != nil {
+			return converted, fmt.Errorf("retrieving '%s': %v", key, err)
+		}
+		if !exists {
+			continue
+		}
+		if _, err := decrypt(*db, to); err == nil {
+			continue
+		}
+		plain, err := decrypt(*db, from)
+		if err != nil {
+			return converted, fmt.Errorf("'%s' decrypts with neither the old nor the new key (%v)", key, err)
+		}
+		enc, err := encrypt(plain, to)
+		if err != nil {
+			return converted, fmt.Errorf("encrypting '%s': %v", key, err)
+		}
+		// Native expirations are dropped here; the robot still
+		// removes expired memories itself.
+		if err := brain.Store(key, &enc); err != nil {
+			return converted, fmt.Errorf("storing '%s': %v", key, err)
+		}
+		converted++
+	}
+	return converted, nil
+}
+
+// writeWrappedKey stores the internal key encrypted with the user-supplied
+// key, wherever it was found on start-up.
+func writeWrappedKey(key, userKey []byte) error {
+	wrapped, err := encrypt(key, userKey)
+	if err != nil {
+		return err
+	}
+	cryptKey.RLock()
+	inBrain := cryptKey.inBrain
+	cryptKey.RUnlock()
+	if inBrain {
+		return interfaces.brain.Store(botEncryptionKey, &wrapped)
+	}
+	keyFile := filepath.Join(configPath, encryptedKeyFile)
+	mode := os.FileMode(0400)
+	if fi, err := os.Stat(keyFile); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	beks := base64.StdEncoding.EncodeToString(wrapped)
+	return writeFileAtomic(keyFile, []byte(beks), mode)
+}
+
+// writeFileAtomic writes to a temporary file and renames it in place
+func writeFileAtomic(file string, data []byte, mode os.FileMode) error {
+	tf, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tf.Name())
+	if _, err := tf.Write(data); err != nil {
+		tf.Close()
+		return err
+	}
+	if err := tf.Sync(); err != nil {
+		tf.Close()
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tf.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tf.Name(), file)
+}
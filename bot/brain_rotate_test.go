@@ -0,0 +1,278 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingBrain is a memBrain that starts failing stores after a number of
+// successful ones, to interrupt a rotation part way.
+type failingBrain struct {
+	*memBrain
+	stores int // successful stores left; < 0 never fails
+}
+
+func (fb *failingBrain) Store(k string, b *[]byte) error {
+	if fb.stores == 0 {
+		return fmt.Errorf("simulated failure storing '%s'", k)
+	}
+	fb.stores--
+	return fb.memBrain.Store(k, b)
+}
+
+var testUserKey = []byte("0123456789abcdef0123456789abcdef")
+var testInternalKey = []byte("fedcba9876543210fedcba9876543210")
+
+// setupRotation installs a brain with memories encrypted with
+// testInternalKey, and a config directory for the key file and journal.
+func setupRotation(t *testing.T, memories int) *failingBrain {
+	t.Helper()
+	fb := &failingBrain{provider(nil).(*memBrain), -1}
+	for i := 0; i < memories; i++ {
+		enc, err := encrypt([]byte(fmt.Sprintf("memory %d", i)), testInternalKey)
+		if err != nil {
+			t.Fatalf("encrypting test memory: %v", err)
+		}
+		fb.memories[fmt.Sprintf("memory%d", i)] = &enc
+	}
+	savedPath, savedEncrypt := configPath, encryptBrain
+	configPath = t.TempDir()
+	interfaces.brain = fb
+	encryptBrain = true
+	cryptKey.Lock()
+	cryptKey.key = testInternalKey
+	cryptKey.userKey = testUserKey
+	cryptKey.initialized = true
+	cryptKey.inBrain = false
+	cryptKey.Unlock()
+	t.Cleanup(func() {
+		configPath, encryptBrain = savedPath, savedEncrypt
+		interfaces.brain = nil
+		cryptKey.Lock()
+		cryptKey.key = nil
+		cryptKey.userKey = nil
+		cryptKey.initialized = false
+		cryptKey.Unlock()
+	})
+	return fb
+}
+
+func brainInitialized() bool {
+	cryptKey.RLock()
+	defer cryptKey.RUnlock()
+	return cryptKey.initialized
+}
+
+func currentInternalKey() []byte {
+	cryptKey.RLock()
+	defer cryptKey.RUnlock()
+	return cryptKey.key
+}
+
+// checkMemories verifies every memory decrypts with key, only once
+func checkMemories(t *testing.T, fb *failingBrain, key []byte) {
+	t.Helper()
+	for k, db := range fb.memories {
+		plain, err := decrypt(*db, key)
+		if err != nil {
+			t.Errorf("'%s' doesn't decrypt with the expected key: %v", k, err)
+			continue
+		}
+		if !strings.HasPrefix(string(plain), "memory ") {
+			t.Errorf("'%s' decrypted to %q; encrypted twice?", k, plain)
+		}
+	}
+}
+
+// checkKeyFile verifies the stored key file wraps key
+func checkKeyFile(t *testing.T, key []byte) {
+	t.Helper()
+	beks, err := ioutil.ReadFile(filepath.Join(configPath, encryptedKeyFile))
+	if err != nil {
+		t.Fatalf("reading key file: %v", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(string(beks))
+	if err != nil {
+		t.Fatalf("decoding key file: %v", err)
+	}
+	stored, err := decrypt(wrapped, testUserKey)
+	if err != nil {
+		t.Fatalf("decrypting key file: %v", err)
+	}
+	if !bytes.Equal(stored, key) {
+		t.Errorf("key file doesn't hold the expected internal key")
+	}
+}
+
+// interruptRotation starts a rotation that fails after two memories are
+// re-encrypted.
+func interruptRotation(t *testing.T, fb *failingBrain) {
+	t.Helper()
+	fb.stores = 2
+	if err := (rotateRequest{op: rotateInternal}).run(); err == nil {
+		t.Fatalf("rotation with failing stores succeeded")
+	}
+	if brainInitialized() {
+		t.Errorf("brain not locked after a partial rotation")
+	}
+	if _, err := os.Stat(journalPath()); err != nil {
+		t.Fatalf("journal missing after a partial rotation: %v", err)
+	}
+	if !bytes.Equal(currentInternalKey(), testInternalKey) {
+		t.Errorf("internal key replaced by a failed rotation")
+	}
+	// gopherbot rotate-key runs with the journal present
+	fb.stores = -1
+	cryptKey.Lock()
+	cryptKey.initialized = true
+	cryptKey.Unlock()
+}
+
+func TestRotateKey(t *testing.T) {
+	fb := setupRotation(t, 5)
+	if err := (rotateRequest{op: rotateInternal}).run(); err != nil {
+		t.Fatalf("rotation: %v", err)
+	}
+	newKey := currentInternalKey()
+	if bytes.Equal(newKey, testInternalKey) {
+		t.Fatalf("internal key unchanged after rotation")
+	}
+	checkMemories(t, fb, newKey)
+	checkKeyFile(t, newKey)
+	if _, err := os.Stat(journalPath()); err == nil {
+		t.Errorf("journal left after a completed rotation")
+	}
+}
+
+func TestRotateResume(t *testing.T) {
+	fb := setupRotation(t, 5)
+	interruptRotation(t, fb)
+	js, err := readJournal(testUserKey)
+	if err != nil {
+		t.Fatalf("reading journal: %v", err)
+	}
+	if err := (rotateRequest{op: rotateInternal}).run(); err == nil {
+		t.Errorf("new rotation started with an interrupted one pending")
+	}
+	if err := (rotateRequest{op: rotateResume}).run(); err != nil {
+		t.Fatalf("resuming rotation: %v", err)
+	}
+	if !bytes.Equal(currentInternalKey(), js.NewKey) {
+		t.Errorf("resumed rotation didn't switch to the journal's new key")
+	}
+	checkMemories(t, fb, js.NewKey)
+	checkKeyFile(t, js.NewKey)
+	if _, err := os.Stat(journalPath()); err == nil {
+		t.Errorf("journal left after resuming")
+	}
+}
+
+func TestRotateRollback(t *testing.T) {
+	fb := setupRotation(t, 5)
+	interruptRotation(t, fb)
+	if err := (rotateRequest{op: rotateRollback}).run(); err != nil {
+		t.Fatalf("rolling back rotation: %v", err)
+	}
+	if !bytes.Equal(currentInternalKey(), testInternalKey) {
+		t.Errorf("rollback didn't return to the old key")
+	}
+	checkMemories(t, fb, testInternalKey)
+	checkKeyFile(t, testInternalKey)
+	if _, err := os.Stat(journalPath()); err == nil {
+		t.Errorf("journal left after rolling back")
+	}
+}
+
+func TestRotateUndecryptable(t *testing.T) {
+	fb := setupRotation(t, 3)
+	stale, _ := encrypt([]byte("memory stale"), []byte("a stale key, from somewhere else"))
+	fb.memories["stale"] = &stale
+	plain := []byte("memory never read")
+	fb.memories["legacy"] = &plain
+	before := string(stale)
+
+	err := (rotateRequest{op: rotateInternal}).run()
+	if err == nil {
+		t.Fatalf("rotation succeeded with undecryptable memories")
+	}
+	if !strings.Contains(err.Error(), "legacy, stale") {
+		t.Errorf("error doesn't list the memories: %v", err)
+	}
+	if got := string(*fb.memories["stale"]); got != before {
+		t.Errorf("undecryptable memory was re-encrypted")
+	}
+	if !brainInitialized() {
+		t.Errorf("brain locked by a rotation that didn't start")
+	}
+	if _, err := os.Stat(journalPath()); err == nil {
+		t.Errorf("journal written for a rotation that didn't start")
+	}
+	if !bytes.Equal(currentInternalKey(), testInternalKey) {
+		t.Errorf("internal key replaced by a rotation that didn't start")
+	}
+
+	// once the memories are dealt with, the rotation runs
+	delete(fb.memories, "stale")
+	delete(fb.memories, "legacy")
+	checkMemories(t, fb, testInternalKey)
+	if err := (rotateRequest{op: rotateInternal}).run(); err != nil {
+		t.Fatalf("rotation after removing undecryptable memories: %v", err)
+	}
+	checkMemories(t, fb, currentInternalKey())
+}
+
+// TestRotateFinishUndecryptable checks that memories decrypting with
+// neither key, found after a rotation was interrupted, don't keep the brain
+// locked.
+func TestRotateFinishUndecryptable(t *testing.T) {
+	for _, op := range []rotateOp{rotateResume, rotateRollback} {
+		fb := setupRotation(t, 5)
+		interruptRotation(t, fb)
+		js, err := readJournal(testUserKey)
+		if err != nil {
+			t.Fatalf("reading journal: %v", err)
+		}
+		stale, _ := encrypt([]byte("memory stale"), []byte("a stale key, from somewhere else"))
+		fb.memories["stale"] = &stale
+		plain := []byte("memory never read")
+		fb.memories["legacy"] = &plain
+
+		if err := (rotateRequest{op: op}).run(); err != nil {
+			t.Fatalf("finishing rotation (op %d) with undecryptable memories: %v", op, err)
+		}
+		if !bytes.Equal(*fb.memories["stale"], stale) || !bytes.Equal(*fb.memories["legacy"], plain) {
+			t.Errorf("undecryptable memories changed (op %d)", op)
+		}
+		want := js.NewKey
+		if op == rotateRollback {
+			want = testInternalKey
+		}
+		if !bytes.Equal(currentInternalKey(), want) {
+			t.Errorf("wrong internal key after finishing (op %d)", op)
+		}
+		if _, err := os.Stat(journalPath()); err == nil {
+			t.Errorf("journal left after finishing (op %d)", op)
+		}
+		delete(fb.memories, "stale")
+		delete(fb.memories, "legacy")
+		checkMemories(t, fb, want)
+		checkKeyFile(t, want)
+	}
+}
+
+func TestRotateResumeWrongUserKey(t *testing.T) {
+	fb := setupRotation(t, 3)
+	interruptRotation(t, fb)
+	cryptKey.Lock()
+	cryptKey.userKey = []byte("not the key that wrote the journal")[:32]
+	cryptKey.Unlock()
+	if err := (rotateRequest{op: rotateResume}).run(); err == nil {
+		t.Errorf("resumed with a journal that doesn't decrypt")
+	}
+}
@@ -11,7 +11,7 @@ import (
 	"time"
 
 	"github.com/ghodss/yaml"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 	"golang.org/x/sys/unix"
 )
 
@@ -245,6 +245,87 @@ func dmadmin(m robot.Robot, command string, args ...string) (retval robot.TaskRe
 		if !found {
 			r.Say("Didn't find a plugin named " + args[0])
 		}
+	case "setwebhooksecret", "clearwebhooksecret":
+		name := args[0]
+		var job *Job
+		if t := r.tasks.getTaskByName(name); t != nil {
+			_, _, job = getTask(t)
+		}
+		if job == nil {
+			r.Say("I don't have a job configured with that name")
+			return
+		}
+		var secret string
+		if command == "setwebhooksecret" {
+			secret = args[1]
+			if !job.Webhook {
+				r.Say("Note: job '%s' doesn't have 'Webhook: true', webhooks will be ignored", name)
+			}
+		}
+		if ret := setWebhookSecret(name, secret); ret != robot.Ok {
+			r.Say("There was a problem updating the webhook secret: %s", ret)
+			return
+		}
+		if len(secret) > 0 {
+			r.Say("Webhook secret set for job '%s'", name)
+		} else {
+			r.Say("Webhook secret removed for job '%s'", name)
+		}
+	case "historywebtoken", "clearhistorywebtoken":
+		var token string
+		if command == "historywebtoken" {
+			var err error
+			if token, err = newHistoryWebToken(); err != nil {
+				Log(robot.Error, "Generating history web token: %v", err)
+				r.Say("There was a problem generating a token, check the log")
+				return
+			}
+		}
+		if ret := setHistoryWebToken(r.User, token); ret != robot.Ok {
+			r.Say("There was a problem updating your history web token: %s", ret)
+			return
+		}
+		if len(token) > 0 {
+			r.Say(historyWebHelp(r.User, token))
+		} else {
+			r.Say("History web token removed")
+		}
+	case "rotatekey", "reencryptbrain":
+		newKey := ""
+		reencrypt := command == "reencryptbrain"
+		if command == "rotatekey" {
+			newKey = args[0]
+			reencrypt = len(args[1]) > 0
+			if len(newKey) < 32 {
+				r.Say("The new encryption key needs to be at least 32 characters")
+				return
+			}
+		}
+		if reencrypt {
+			r.Say("Re-encrypting all memories with a new internal key, this could take a while...")
+			if err := rotateKeys(rotateInternal, ""); err != nil {
+				r.Say("Rotating the internal key failed: %v", err)
+				Log(robot.Error, "Rotating the internal encryption key, requested by %s: %v", r.User, err)
+				return
+			}
+			r.Say("All memories re-encrypted with a new internal key")
+		}
+		if len(newKey) == 0 {
+			return
+		}
+		if err := rotateKeys(rotateUser, newKey); err != nil {
+			r.Say("Rotating the encryption key failed: %v", err)
+			Log(robot.Error, "Rotating the user-supplied encryption key, requested by %s: %v", r.User, err)
+			return
+		}
+		cryptKey.RLock()
+		inBrain := cryptKey.inBrain
+		cryptKey.RUnlock()
+		where := keyEnv
+		if inBrain {
+			where = "EncryptionKey in " + robotConfigFileName
+		}
+		r.Say("Encryption key rotated; update %s with the new key before I restart, and delete your message with the key if you can", where)
 	case "listplugins":
 		joiner := ", "
 		message := "Here are the plugins I have configured:\n%s"
@@ -369,7 +450,7 @@ func admin(m robot.Robot, command string, args ...string) (retval robot.TaskRetV
 		// wid pwid pid Go|Ext plugin|task|job
 		psl := &psList{
 			pslines: []string{
-				"WID    PWID  PID   G/E TYPE   PIPENAME         TASK             PLUG-COMMAND ARGS",
+				"WID    PWID  PID   G/E TYPE   SOURCE      PIPENAME         TASK             TRY   PLUG-COMMAND ARGS",
 			},
 			wids: []int{-1},
 		}
@@ -381,6 +462,7 @@ func admin(m robot.Robot, command string, args ...string) (retval robot.TaskRetV
 		}
 		for widx, worker := range activePipelines.i {
 			pipename := worker.pipeName
+			source := worker.ptype.String()
 			worker.Lock()
 			wid := strconv.Itoa(widx)
 			pwid := ""
@@ -397,11 +479,15 @@ func admin(m robot.Robot, command string, args ...string) (retval robot.TaskRetV
 			tname := worker.taskName
 			command := worker.plugCommand
 			args := strings.Join(worker.taskArgs, " ")
+			try := ""
+			if worker.taskAttempts > 0 {
+				try = fmt.Sprintf("%d/%d", worker.taskAttempt, worker.taskAttempts)
+			}
 			worker.Unlock()
 			if pipename == "builtin-admin" && command == "ps" {
 				continue
 			}
-			psline := fmt.Sprintf("%6.6s %5.5s %5.5s %-3.3s %-6.6s %-16.16s %-16.16s %-12.12s %s", wid, pwid, pid, class, ttype, pipename, tname, command, args)
+			psline := fmt.Sprintf("%6.6s %5.5s %5.5s %-3.3s %-6.6s %-11.11s %-16.16s %-16.16s %-5.5s %-12.12s %s", wid, pwid, pid, class, ttype, source, pipename, tname, try, command, args)
 			psl.pslines = append(psl.pslines, psline)
 			psl.wids = append(psl.wids, widx)
 		}
@@ -423,13 +509,29 @@ func admin(m robot.Robot, command string, args ...string) (retval robot.TaskRetV
 			return
 		}
 		var pid int
+		var canceled string
 		worker.Lock()
+		// An external task waiting for approval is also killed
+		if worker.approvalAbort != nil {
+			close(worker.approvalAbort)
+			worker.approvalAbort = nil
+			canceled = "approval request"
+		}
 		if worker.osCmd != nil {
 			pid = worker.osCmd.Process.Pid
+		} else if worker.retryAbort != nil {
+			close(worker.retryAbort)
+			worker.retryAbort = nil
+			canceled = "retry"
 		}
 		worker.Unlock()
+		if len(canceled) > 0 {
+			r.Say("Canceled %s for pipeline %s", canceled, wid)
+		}
 		if pid == 0 {
-			r.Say("No active process found for pipeline")
+			if len(canceled) == 0 {
+				r.Say("No active process found for pipeline")
+			}
 			return
 		}
 		raiseThreadPriv(fmt.Sprintf("killing process %d", pid))
@@ -483,6 +585,89 @@ func admin(m robot.Robot, command string, args ...string) (retval robot.TaskRetV
 		}
 		sort.Strings(jl)
 		r.Say("These jobs are paused: %s", strings.Join(jl, ", "))
+	case "listlocks":
+		locks := getBrainLocks()
+		if len(locks) == 0 {
+			r.Say("No memories are checked out read-write")
+			return
+		}
+		r.Fixed().Say(formatLocks(locks))
+	case "releaselock":
+		key := args[0]
+		if !releaseBrainLock(key) {
+			r.Say("No lock is held on '%s'", key)
+			return
+		}
+		Log(robot.Audit, "Brain lock on '%s' force-released by user '%s'", key, r.User)
+		r.Say("Released the lock on '%s'", key)
+	case "lockstats":
+		stats := getLockStats()
+		if len(stats) == 0 {
+			r.Say("No memories have been checked out read-write")
+			return
+		}
+		r.Fixed().Say(formatLockStats(stats))
+	case "exportbrain":
+		name := "brain-export.jsonl.gz"
+		if len(args) > 0 && len(args[0]) > 0 {
+			name = args[0]
+		}
+		file, err := exportPath(name)
+		if err != nil {
+			r.Say("Unable to export the brain: %v", err)
+			return
+		}
+		ekey, err := getExportKey(&r)
+		if err != nil {
+			r.Say("Unable to export the brain: %v", err)
+			return
+		}
+		raiseThreadPriv("exporting brain")
+		if err := os.MkdirAll(exportDirectory, 0700); err != nil {
+			r.Say("Unable to create the export directory: %v", err)
+			return
+		}
+		count, err := exportBrain(file, ekey)
+		if err != nil {
+			r.Say("Error exporting the brain: %v", err)
+			Log(robot.Error, "Exporting brain to '%s', requested by %s: %v", file, r.User, err)
+			return
+		}
+		Log(robot.Audit, "Brain exported to '%s' by %s", file, r.User)
+		r.Say("Exported %d memories to '%s'", count, file)
+	case "importbrain":
+		replace := strings.ToLower(args[0]) == "replace"
+		file, err := exportPath(args[1])
+		if err != nil {
+			r.Say("Unable to import the brain: %v", err)
+			return
+		}
+		ekey, err := getExportKey(&r)
+		if err != nil {
+			r.Say("Unable to import the brain: %v", err)
+			return
+		}
+		if replace {
+			rep, ret := r.PromptForReply("YesNo", "Replacing deletes every memory not in '%s'; are you sure?", file)
+			if ret != robot.Ok {
+				r.Reply("Sorry, I didn't get an answer I understand")
+				return
+			}
+			switch strings.ToLower(rep) {
+			case "n", "no":
+				r.Say("Ok, I'll leave my memories alone")
+				return
+			}
+		}
+		raiseThreadPriv("importing brain")
+		stored, deleted, err := importBrain(file, ekey, replace)
+		if err != nil {
+			r.Say("Error importing the brain after storing %d and deleting %d memories: %v", stored, deleted, err)
+			Log(robot.Error, "Importing brain from '%s', requested by %s: %v", file, r.User, err)
+			return
+		}
+		Log(robot.Audit, "Brain imported from '%s' (replace: %t) by %s; stored %d, deleted %d", file, replace, r.User, stored, deleted)
+		r.Say("Imported %d memories from '%s', deleted %d", stored, file, deleted)
 	case "quit", "restart":
 		state.Lock()
 		if state.shuttingDown {
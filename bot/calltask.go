@@ -10,8 +10,9 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 	"golang.org/x/sys/unix"
 )
 
@@ -73,16 +74,22 @@ type taskReturn struct {
 	retval    robot.TaskRetVal
 }
 
+// How long a task that timed out has to exit after SIGTERM, before SIGKILL
+const taskKillGrace = 10 * time.Second
+
 // Maps populated by callTaskThread, so external tasks can get their Robot
 // from the eid (GOPHER_CALLER_ID), and Go tasks can get a handle to the
-// *worker from an incrementing tid (task id).
+// *worker from an incrementing tid (task id). The token for the running
+// external task (GOPHER_CALLER_TOKEN) is also stored by eid.
 var taskLookup = struct {
 	e map[string]Robot
 	i map[int]*worker
+	t map[string]string
 	sync.RWMutex
 }{
 	make(map[string]Robot),
 	make(map[int]*worker),
+	make(map[string]string),
 	sync.RWMutex{},
 }
 
@@ -126,13 +133,29 @@ func getLockedWorker(idx int) *worker {
 // arguments. Note that callTask(Thread) has to concern itself with locking of
 // the worker because it can be called within a task by the Elevate() method.
 func (w *worker) callTask(t interface{}, command string, args ...string) (errString string, retval robot.TaskRetVal) {
+	return w.callTaskTimeout(t, 0, command, args...)
+}
+
+// callTaskTimeout is callTask with a timeout for external tasks that
+// overrides the task's configured Timeout, when > 0.
+func (w *worker) callTaskTimeout(t interface{}, timeout time.Duration, command string, args ...string) (errString string, retval robot.TaskRetVal) {
+	// the finish record goes to the log the task started in; if the task
+	// extended the namespace, that log is closed and the record dropped,
+	// rather than starting the new log with a finish for an unseen task
+	w.Lock()
+	logger := w.logger
+	w.Unlock()
 	rc := make(chan taskReturn)
-	go w.callTaskThread(rc, t, command, args...)
+	go w.callTaskThread(rc, t, timeout, command, args...)
 	ret := <-rc
+	if logger != nil {
+		task, _, _ := getTask(t)
+		logRecord(logger, robot.HistoryRecord{Task: task.name, Stream: robot.StreamFinish, Text: ret.errString, Status: ret.retval})
+	}
 	return ret.errString, ret.retval
 }
 
-func (w *worker) callTaskThread(rchan chan<- taskReturn, t interface{}, command string, args ...string) {
+func (w *worker) callTaskThread(rchan chan<- taskReturn, t interface{}, timeout time.Duration, command string, args ...string) {
 	var errString string
 	var retval robot.TaskRetVal
 	task, plugin, job := getTask(t)
@@ -169,7 +192,9 @@ func (w *worker) callTaskThread(rchan chan<- taskReturn, t interface{}, command
 	} else {
 		desc = fmt.Sprintf("Starting task '%s'", task.name)
 	}
-	w.section(taskinfo, desc)
+	if logger != nil {
+		logRecord(logger, robot.HistoryRecord{Task: task.name, Stream: robot.StreamStart, Text: taskinfo + " - " + desc})
+	}
 
 	if !(task.name == "builtin-admin" && command == "abort") {
 		if w.directMsg {
@@ -212,18 +237,26 @@ func (w *worker) callTaskThread(rchan chan<- taskReturn, t interface{}, command
 	}
 
 	// Task lookup; add lookup for http.go
+	token, err := newCallerToken()
+	if err != nil {
+		deregisterWorker(r.tid)
+		Log(robot.Error, "Generating caller token for task '%s': %v", task.name, err)
+		rchan <- taskReturn{fmt.Sprintf("Unable to generate an api token for task '%s'", task.name), robot.MechanismFail}
+		return
+	}
 	taskLookup.Lock()
 	taskLookup.e[eid] = r
+	taskLookup.t[eid] = token
 	taskLookup.Unlock()
 	defer func() {
 		taskLookup.Lock()
 		delete(taskLookup.e, eid)
+		delete(taskLookup.t, eid)
 		taskLookup.Unlock()
 		deregisterWorker(r.tid)
 	}()
 
 	var taskPath string // full path to the executable
-	var err error
 	if task.Homed {
 		taskPath, err = getTaskPath(task, ".")
 	} else {
@@ -269,6 +302,9 @@ func (w *worker) callTaskThread(rchan chan<- taskReturn, t interface{}, command
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 		keys = append(keys, k)
 	}
+	// The token is only for this task, and isn't part of the pipeline
+	// environment
+	env = append(env, "GOPHER_CALLER_TOKEN="+token)
 	cmd.Env = env
 	Log(robot.Debug, "Running '%s' in '%s' with environment vars: '%s'", taskPath, cmd.Dir, strings.Join(keys, "', '"))
 	var stderr, stdout io.ReadCloser
@@ -313,6 +349,14 @@ func (w *worker) callTaskThread(rchan chan<- taskReturn, t interface{}, command
 	w.Lock()
 	w.osCmd = cmd
 	w.Unlock()
+	if timeout == 0 {
+		timeout = task.timeout
+	}
+	done := make(chan struct{})
+	killed := make(chan struct{})
+	if timeout > 0 {
+		go killOnTimeout(task.name, cmd.Process.Pid, timeout, done, killed)
+	}
 	defer func() {
 		w.Lock()
 		w.osCmd = nil
@@ -337,7 +381,7 @@ func (w *worker) callTaskThread(rchan chan<- taskReturn, t interface{}, command
 		for scanner.Scan() {
 			line := scanner.Text()
 			if logging {
-				logger.Log("OUT " + line)
+				logRecord(logger, robot.HistoryRecord{Task: task.name, Stream: robot.StreamOut, Text: line})
 			}
 			if localTerm || nullConn {
 				solog.Println(line)
@@ -351,7 +395,7 @@ func (w *worker) callTaskThread(rchan chan<- taskReturn, t interface{}, command
 		for scanner.Scan() {
 			line := scanner.Text()
 			if logging {
-				logger.Log("ERR " + line)
+				logRecord(logger, robot.HistoryRecord{Task: task.name, Stream: robot.StreamErr, Text: line})
 			}
 			if localTerm || nullConn {
 				selog.Println(line)
@@ -370,7 +414,17 @@ closeLoop:
 			halfClosed = true
 		}
 	}
-	if err = cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	close(done)
+	select {
+	case <-killed:
+		Log(robot.Error, "External command '%s' for task '%s' killed after timeout of %s", taskPath, task.name, timeout)
+		errString = fmt.Sprintf("Task '%s' timed out after %s and was killed", task.name, timeout)
+		rchan <- taskReturn{errString, robot.TaskTimeout}
+		return
+	default:
+	}
+	if err != nil {
 		retval = robot.Fail
 		success := false
 		if exitstatus, ok := err.(*exec.ExitError); ok {
@@ -389,3 +443,27 @@ closeLoop:
 	}
 	rchan <- taskReturn{errString, retval}
 }
+
+// killOnTimeout signals the task's process group when it runs longer than
+// timeout; first with SIGTERM, then SIGKILL if it's still running after
+// taskKillGrace. Closing done stops the timer, and killed is closed when
+// the task times out.
+func killOnTimeout(name string, pid int, timeout time.Duration, done <-chan struct{}, killed chan<- struct{}) {
+	select {
+	case <-done:
+		return
+	case <-time.After(timeout):
+	}
+	close(killed)
+	// the task may be running with the privileged uid
+	raiseThreadPriv(fmt.Sprintf("killing timed out task '%s'", name))
+	Log(robot.Warn, "Task '%s' running longer than %s, sending SIGTERM to process group %d", name, timeout, pid)
+	unix.Kill(-pid, unix.SIGTERM)
+	select {
+	case <-done:
+		return
+	case <-time.After(taskKillGrace):
+	}
+	Log(robot.Warn, "Task '%s' still running %s after SIGTERM, sending SIGKILL to process group %d", name, taskKillGrace, pid)
+	unix.Kill(-pid, unix.SIGKILL)
+}
@@ -7,8 +7,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 func processCLI(usage string) {
@@ -47,6 +49,36 @@ func processCLI(usage string) {
 		fetchFlags.PrintDefaults()
 	}
 
+	var migrateOpts migrateOptions
+	migrateFlags := flag.NewFlagSet("migrate-brain", flag.ExitOnError)
+	migrateFlags.BoolVar(&migrateOpts.dryRun, "dry-run", false, "list memories to copy without copying")
+	migrateFlags.BoolVar(&migrateOpts.dryRun, "n", false, "")
+	migrateFlags.BoolVar(&migrateOpts.rekey, "rekey", false, "re-encrypt memories with a new internal key")
+	migrateFlags.StringVar(&migrateOpts.keyFile, "keyfile", "", "file for the new encrypted internal key (default: <config dir>/"+encryptedKeyFile+".new)")
+	migrateFlags.StringVar(&migrateOpts.progress, "progress", "migrate-brain.progress", "progress log for resuming an interrupted migration")
+	migrateFlags.Usage = func() {
+		fmt.Println("Usage: gopherbot migrate-brain [options] <migration.yaml>\n\nOptions:")
+		migrateFlags.PrintDefaults()
+	}
+
+	var importReplace bool
+	importFlags := flag.NewFlagSet("import-brain", flag.ExitOnError)
+	importFlags.BoolVar(&importReplace, "replace", false, "delete memories not in the export (default is to merge)")
+	importFlags.Usage = func() {
+		fmt.Printf("Usage: gopherbot import-brain [options] <export file>\n\nThe export key is read from %s.\n\nOptions:\n", exportKeyEnv)
+		importFlags.PrintDefaults()
+	}
+
+	var rotateOpts struct{ reencrypt, resume, rollback bool }
+	rotateFlags := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	rotateFlags.BoolVar(&rotateOpts.reencrypt, "reencrypt", false, "re-encrypt every memory with a new internal key")
+	rotateFlags.BoolVar(&rotateOpts.resume, "resume", false, "finish an interrupted re-encryption")
+	rotateFlags.BoolVar(&rotateOpts.rollback, "rollback", false, "return to the old internal key after an interrupted re-encryption")
+	rotateFlags.Usage = func() {
+		fmt.Printf("Usage: gopherbot rotate-key [options]\n\nThe new user-supplied key, if any, is read from %s.\n\nOptions:\n", newKeyEnv)
+		rotateFlags.PrintDefaults()
+	}
+
 	switch command {
 	case "encrypt":
 		encFlags.Parse(cliArgs[1:])
@@ -117,6 +149,40 @@ func processCLI(usage string) {
 		cliStore(cliArgs[1], file)
 	case "list":
 		cliList()
+	case "export-brain":
+		if len(cliArgs) != 2 {
+			fmt.Printf("Usage: gopherbot export-brain <file>(.gz)\n\nThe export key is read from %s.\n", exportKeyEnv)
+			return
+		}
+		cliExportBrain(cliArgs[1])
+	case "import-brain":
+		importFlags.Parse(cliArgs[1:])
+		if len(importFlags.Args()) != 1 {
+			importFlags.Usage()
+			return
+		}
+		cliImportBrain(importFlags.Arg(0), importReplace)
+	case "migrate-brain":
+		migrateFlags.Parse(cliArgs[1:])
+		if len(migrateFlags.Args()) != 1 {
+			migrateFlags.Usage()
+			return
+		}
+		if len(migrateOpts.keyFile) == 0 {
+			migrateOpts.keyFile = filepath.Join(configPath, encryptedKeyFile+".new")
+		}
+		cliMigrateBrain(migrateFlags.Arg(0), migrateOpts)
+	case "brain-locks":
+		cliBrainLocks()
+	case "release-lock":
+		if len(cliArgs) != 2 {
+			fmt.Println("Usage: gopherbot release-lock <key>")
+			return
+		}
+		cliReleaseLock(cliArgs[1])
+	case "rotate-key":
+		rotateFlags.Parse(cliArgs[1:])
+		cliRotateKey(rotateOpts.reencrypt, rotateOpts.resume, rotateOpts.rollback)
 	case "delete":
 		if len(cliArgs) != 2 {
 			fmt.Println("Usage: gopherbot delete <key>")
@@ -269,6 +335,13 @@ func cliList() {
 	}
 	if len(list) > 0 {
 		for _, memory := range list {
+			if strings.HasPrefix(memory, expiryPrefix) {
+				continue
+			}
+			if expires, ok := getExpiration(memory); ok {
+				fmt.Printf("%s (expires %s)\n", memory, expires.Format(time.RFC3339))
+				continue
+			}
 			fmt.Println(memory)
 		}
 		return
@@ -283,5 +356,51 @@ func cliDelete(key string) {
 		fmt.Printf("Deleting memory: %v\n", err)
 		return
 	}
+	setExpiration(key, time.Time{})
 	fmt.Println("Deleted")
 }
+
+func cliRotateKey(reencrypt, resume, rollback bool) {
+	newKey := os.Getenv(newKeyEnv)
+	switch {
+	case resume && rollback:
+		fmt.Println("Only one of -resume and -rollback can be given")
+		os.Exit(1)
+	case resume || rollback:
+		op := rotateResume
+		if rollback {
+			op = rotateRollback
+		}
+		if err := rotateKeys(op, ""); err != nil {
+			fmt.Printf("Finishing interrupted rotation: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Interrupted rotation finished")
+		return
+	case !reencrypt && len(newKey) == 0:
+		fmt.Printf("Nothing to do; set %s and/or use -reencrypt\n", newKeyEnv)
+		os.Exit(1)
+	}
+	if reencrypt {
+		if err := rotateKeys(rotateInternal, ""); err != nil {
+			fmt.Printf("Rotating internal key: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("All memories re-encrypted with a new internal key")
+	}
+	if len(newKey) == 0 {
+		return
+	}
+	if err := rotateKeys(rotateUser, newKey); err != nil {
+		fmt.Printf("Rotating encryption key: %v\n", err)
+		os.Exit(1)
+	}
+	cryptKey.RLock()
+	inBrain := cryptKey.inBrain
+	cryptKey.RUnlock()
+	if inBrain {
+		fmt.Printf("Encryption key rotated; update EncryptionKey in %s before starting the robot\n", robotConfigFileName)
+		return
+	}
+	fmt.Printf("Encryption key rotated; set %s to the new key before starting the robot\n", keyEnv)
+}
@@ -0,0 +1,162 @@
+package bot
+
+/* cli_locks.go - 'gopherbot brain-locks' and 'gopherbot release-lock' for
+   a running robot. Brain locks only exist in the running robot's brain
+   loop, so on start-up the robot writes the address of it's api listener
+   and a random admin token to .gopherbot-admin (mode 0600) in it's home
+   directory. The CLI, run from the same directory as the same user, reads
+   the file and calls /admin on the api listener with the token.
+*/
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+const adminAccessFile = ".gopherbot-admin"
+
+// adminAccess is written to adminAccessFile for the CLI
+type adminAccess struct {
+	Address string // listenPort; "unix:<path>" with LocalSocket
+	Token   string
+}
+
+// adminrequest is sent by the CLI to /admin
+type adminrequest struct {
+	Command string // GetBrainLocks or ReleaseBrainLock
+	Key     string // memory key for ReleaseBrainLock
+}
+
+var adminToken string
+
+func adminAccessPath() string {
+	return filepath.Join(homePath, adminAccessFile)
+}
+
+// writeAdminAccess is called once the api listener is up
+func writeAdminAccess() {
+	token, err := newCallerToken()
+	if err != nil {
+		Log(robot.Error, "Generating admin token, CLI lock commands won't work: %v", err)
+		return
+	}
+	adminToken = token
+	ab, _ := json.Marshal(adminAccess{listenPort, adminToken})
+	if err := writeFileAtomic(adminAccessPath(), ab, 0600); err != nil {
+		Log(robot.Error, "Writing '%s', CLI lock commands won't work: %v", adminAccessFile, err)
+	}
+}
+
+// removeAdminAccess cleans up the admin file when the robot exits
+func removeAdminAccess() {
+	if len(adminToken) > 0 {
+		os.Remove(adminAccessPath())
+	}
+}
+
+// serveAdmin handles requests from the CLI lock commands
+func serveAdmin(rw http.ResponseWriter, req *http.Request) {
+	auth := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if len(adminToken) == 0 || subtle.ConstantTimeCompare([]byte(auth), []byte(adminToken)) != 1 {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var ar adminrequest
+	if err := json.NewDecoder(req.Body).Decode(&ar); err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch ar.Command {
+	case "GetBrainLocks":
+		sendReturn(rw, &brainlocksresponse{getBrainLocks(), getLockStats(), int(robot.Ok)})
+	case "ReleaseBrainLock":
+		released := releaseBrainLock(ar.Key)
+		if released {
+			Log(robot.Audit, "Brain lock on '%s' force-released from the command line", ar.Key)
+		}
+		sendReturn(rw, &boolretresponse{released, int(robot.Ok)})
+	default:
+		rw.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// callAdmin sends a request to the running robot for the CLI
+func callAdmin(ar adminrequest, reply interface{}) error {
+	ab, err := ioutil.ReadFile(adminAccessFile)
+	if err != nil {
+		return fmt.Errorf("reading '%s', is the robot running from this directory? (%v)", adminAccessFile, err)
+	}
+	var aa adminAccess
+	if err := json.Unmarshal(ab, &aa); err != nil {
+		return fmt.Errorf("reading '%s': %v", adminAccessFile, err)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	url := "http://" + aa.Address + "/admin"
+	if strings.HasPrefix(aa.Address, "unix:") {
+		sock := strings.TrimPrefix(aa.Address, "unix:")
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		}
+		url = "http://gopherbot/admin"
+	}
+	body, _ := json.Marshal(ar)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+aa.Token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("contacting the robot: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("robot replied: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+func cliBrainLocks() {
+	var bl brainlocksresponse
+	if err := callAdmin(adminrequest{Command: "GetBrainLocks"}, &bl); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(bl.Locks) == 0 {
+		fmt.Println("No memories are checked out read-write")
+	} else {
+		fmt.Println(formatLocks(bl.Locks))
+	}
+	if len(bl.Stats) > 0 {
+		fmt.Println()
+		fmt.Println(formatLockStats(bl.Stats))
+	}
+}
+
+func cliReleaseLock(key string) {
+	var br boolretresponse
+	if err := callAdmin(adminrequest{"ReleaseBrainLock", key}, &br); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if !br.Boolean {
+		fmt.Printf("No lock is held on '%s'\n", key)
+		os.Exit(1)
+	}
+	fmt.Printf("Released the lock on '%s'\n", key)
+}
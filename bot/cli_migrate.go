@@ -0,0 +1,295 @@
+package bot
+
+/* cli_migrate.go - 'gopherbot migrate-brain' copies every memory from one
+   brain provider to another, e.g. when moving from the file brain to dynamo.
+   Memories are normally copied as-is (still encrypted), but can optionally
+   be re-encrypted under a new internal key. Every copy is verified, and
+   verified keys are appended to a progress log so an interrupted migration
+   can be re-run and pick up where it left off.
+*/
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// migrateBrainSpec is a stanza in the migration file, mirroring Brain and
+// BrainConfig in robot.yaml
+type migrateBrainSpec struct {
+	Brain       string
+	BrainConfig json.RawMessage
+}
+
+type migrateConfig struct {
+	Source      migrateBrainSpec
+	Destination migrateBrainSpec
+}
+
+type migrateOptions struct {
+	dryRun   bool   // only report what would be copied
+	rekey    bool   // re-encrypt memories under a new internal key
+	keyFile  string // where to write the new internal key when rekeying
+	progress string // progress log for resuming
+}
+
+func cliMigrateBrain(cfgFile string, opts migrateOptions) {
+	mc := loadMigrateConfig(cfgFile)
+	if err := mc.check(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	src := openMigrateBrain("Source", mc.Source)
+	dst := openMigrateBrain("Destination", mc.Destination)
+
+	var oldKey, newKey []byte
+	if opts.rekey {
+		cryptKey.RLock()
+		initialized := cryptKey.initialized
+		oldKey = cryptKey.key
+		cryptKey.RUnlock()
+		if !initialized {
+			fmt.Println("Encryption not initialized; re-encrypting requires the current key")
+			os.Exit(1)
+		}
+		newKey = getMigrateKey(opts.keyFile, opts.dryRun)
+	}
+
+	copied, skipped, failed, err := migrateMemories(src, dst, opts, oldKey, newKey)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if opts.dryRun {
+		fmt.Printf("Dry run: %d memories would be copied, %d already done\n", copied, skipped)
+		return
+	}
+	fmt.Printf("Copied %d memories, skipped %d, %d failed\n", copied, skipped, failed)
+	if failed > 0 {
+		fmt.Println("Re-run the same command to retry failed memories")
+		os.Exit(1)
+	}
+	if opts.rekey {
+		fmt.Printf("Replace '%s' with '%s' when switching to the new brain\n", filepath.Join(configPath, encryptedKeyFile), opts.keyFile)
+	}
+}
+
+// check validates the migration file.
+func (mc migrateConfig) check() error {
+	// Brain providers keep their configuration and connections in package
+	// variables, so a provider can only be opened once per process.
+	if mc.Source.Brain == mc.Destination.Brain {
+		return fmt.Errorf("Source and Destination must use different brain providers; to move memories within one provider, migrate to another brain and back")
+	}
+	return nil
+}
+
+// migrateMemories copies every memory from src to dst, skipping memories
+// listed in the progress log with the same checksum, and re-encrypting
+// with newKey when opts.rekey is set. Memories that fail to copy are
+// reported and counted; an error is only returned when the migration
+// can't start.
+func migrateMemories(src, dst robot.SimpleBrain, opts migrateOptions, oldKey, newKey []byte) (copied, skipped, failed int, err error) {
+	done := readMigrateProgress(opts.progress)
+	keys, err := src.List()
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("Listing memories in source brain: %v", err)
+	}
+	sort.Strings(keys)
+
+	var plog *os.File
+	if !opts.dryRun {
+		plog, err = os.OpenFile(opts.progress, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("Opening progress log '%s': %v", opts.progress, err)
+		}
+		defer plog.Close()
+	}
+
+	for _, key := range keys {
+		datum, exists, err := src.Retrieve(key)
+		if err != nil {
+			fmt.Printf("Retrieving '%s': %v\n", key, err)
+			failed++
+			continue
+		}
+		if !exists {
+			continue
+		}
+		sum := checksum(*datum)
+		if done[key] == sum {
+			skipped++
+			continue
+		}
+		if opts.rekey && key == botEncryptionKey {
+			fmt.Printf("Skipping '%s'; with -rekey the new key is written to '%s'\n", key, opts.keyFile)
+			skipped++
+			continue
+		}
+		if opts.dryRun {
+			note := ""
+			if _, exists, _ := dst.Retrieve(key); exists {
+				note = ", replacing existing memory"
+			}
+			fmt.Printf("Would copy '%s' (%d bytes%s)\n", key, len(*datum), note)
+			copied++
+			continue
+		}
+		out := *datum
+		if opts.rekey {
+			out, err = reEncrypt(out, oldKey, newKey)
+			if err != nil {
+				fmt.Printf("Re-encrypting '%s': %v\n", key, err)
+				failed++
+				continue
+			}
+		}
+		if err := dst.Store(key, &out); err != nil {
+			fmt.Printf("Storing '%s': %v\n", key, err)
+			failed++
+			continue
+		}
+		stored, exists, err := dst.Retrieve(key)
+		if err != nil || !exists || checksum(*stored) != checksum(out) {
+			fmt.Printf("Verifying '%s': checksum mismatch or missing in destination\n", key)
+			failed++
+			continue
+		}
+		fmt.Fprintf(plog, "%s\t%s\n", key, sum)
+		copied++
+	}
+	return copied, skipped, failed, nil
+}
+
+// loadMigrateConfig reads and expands the migration file, which can use
+// the same template functions as robot.yaml, e.g. for decrypting secrets.
+func loadMigrateConfig(cfgFile string) migrateConfig {
+	var mc migrateConfig
+	raw, err := ioutil.ReadFile(cfgFile)
+	if err != nil {
+		fmt.Printf("Reading '%s': %v\n", cfgFile, err)
+		os.Exit(1)
+	}
+	expanded, err := expand(filepath.Dir(cfgFile), false, raw)
+	if err != nil {
+		fmt.Printf("Expanding '%s': %v\n", cfgFile, err)
+		os.Exit(1)
+	}
+	if err := yaml.Unmarshal(expanded, &mc); err != nil {
+		fmt.Printf("Unmarshalling '%s': %v\n", cfgFile, err)
+		os.Exit(1)
+	}
+	return mc
+}
+
+// openMigrateBrain initializes a brain provider with the BrainConfig from
+// the migration file instead of robot.yaml.
+func openMigrateBrain(which string, spec migrateBrainSpec) robot.SimpleBrain {
+	if len(spec.Brain) == 0 {
+		fmt.Printf("No Brain specified for %s in migration file\n", which)
+		os.Exit(1)
+	}
+	loadBrainModule(spec.Brain)
+	bprovider, ok := brains[spec.Brain]
+	if !ok {
+		fmt.Printf("No provider registered for %s brain: \"%s\"\n", which, spec.Brain)
+		os.Exit(1)
+	}
+	return bprovider(handler{brainConfig: spec.BrainConfig})
+}
+
+// getMigrateKey returns the new internal key for re-encrypting. When the
+// key file already exists (from an interrupted run), that key is re-used
+// so memories already copied stay readable.
+func getMigrateKey(keyFile string, dryRun bool) []byte {
+	ek := os.Getenv(keyEnv)
+	if len(ek) < 32 {
+		fmt.Printf("Re-encrypting requires a %s of at least 32 bytes\n", keyEnv)
+		os.Exit(1)
+	}
+	ik := []byte(ek)[0:32]
+	if bkf, err := ioutil.ReadFile(keyFile); err == nil {
+		bke, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(bkf)))
+		if err != nil {
+			fmt.Printf("Base64 decoding '%s': %v\n", keyFile, err)
+			os.Exit(1)
+		}
+		key, err := decrypt(bke, ik)
+		if err != nil {
+			fmt.Printf("Decrypting existing key file '%s': %v\n", keyFile, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Resuming with new key from '%s'\n", keyFile)
+		return key
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		fmt.Printf("Generating new random encryption key: %v\n", err)
+		os.Exit(1)
+	}
+	if dryRun {
+		return key
+	}
+	bek, err := encrypt(key, ik)
+	if err != nil {
+		fmt.Printf("Encrypting new random key: %v\n", err)
+		os.Exit(1)
+	}
+	beks := base64.StdEncoding.EncodeToString(bek)
+	if err := ioutil.WriteFile(keyFile, []byte(beks), 0400); err != nil {
+		fmt.Printf("Writing new key file '%s': %v\n", keyFile, err)
+		os.Exit(1)
+	}
+	return key
+}
+
+// reEncrypt decrypts a datum with the old key and encrypts it with the
+// new. Unlike getDatum, a datum that doesn't decrypt is an error rather
+// than assumed to be unencrypted; otherwise a wrong key for the source
+// would silently copy garbage.
+func reEncrypt(datum, oldKey, newKey []byte) ([]byte, error) {
+	plain, err := decrypt(datum, oldKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting with the current key failed, wrong %s for the source brain? (%v)", keyEnv, err)
+	}
+	return encrypt(plain, newKey)
+}
+
+// readMigrateProgress reads the keys and source checksums of memories
+// already copied.
+func readMigrateProgress(progress string) map[string]string {
+	done := make(map[string]string)
+	pf, err := os.Open(progress)
+	if err != nil {
+		return done
+	}
+	defer pf.Close()
+	scanner := bufio.NewScanner(pf)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) == 2 {
+			done[fields[0]] = fields[1]
+		}
+	}
+	if len(done) > 0 {
+		fmt.Printf("Resuming from '%s' with %d memories already copied\n", progress, len(done))
+	}
+	return done
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
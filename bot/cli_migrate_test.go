@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// migrateBrains returns a source brain with n encrypted memories and an
+// empty destination.
+func migrateBrains(t *testing.T, n int) (src, dst *memBrain) {
+	t.Helper()
+	src, dst = provider(nil).(*memBrain), provider(nil).(*memBrain)
+	for i := 0; i < n; i++ {
+		enc, err := encrypt([]byte(fmt.Sprintf("memory %d", i)), testInternalKey)
+		if err != nil {
+			t.Fatalf("encrypting test memory: %v", err)
+		}
+		src.memories[fmt.Sprintf("memory%d", i)] = &enc
+	}
+	return src, dst
+}
+
+func TestMigrateConfigCheck(t *testing.T) {
+	same := migrateConfig{Source: migrateBrainSpec{Brain: "file"}, Destination: migrateBrainSpec{Brain: "file"}}
+	if err := same.check(); err == nil {
+		t.Errorf("migrating between two brains with the same provider should fail")
+	}
+	different := migrateConfig{Source: migrateBrainSpec{Brain: "file"}, Destination: migrateBrainSpec{Brain: "dynamo"}}
+	if err := different.check(); err != nil {
+		t.Errorf("migrating from file to dynamo: %v", err)
+	}
+}
+
+func TestMigrateResume(t *testing.T) {
+	src, dst := migrateBrains(t, 4)
+	opts := migrateOptions{progress: filepath.Join(t.TempDir(), "migrate.log")}
+
+	// An earlier run copied memory0 and memory1; memory1 changed since
+	seed := fmt.Sprintf("memory0\t%s\nmemory1\t%s\ngarbage line\n", checksum(*src.memories["memory0"]), checksum([]byte("old value")))
+	if err := ioutil.WriteFile(opts.progress, []byte(seed), 0600); err != nil {
+		t.Fatal(err)
+	}
+	copied, skipped, failed, err := migrateMemories(src, dst, opts, nil, nil)
+	if err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	if copied != 3 || skipped != 1 || failed != 0 {
+		t.Errorf("want 3 copied, 1 skipped, 0 failed; got %d, %d, %d", copied, skipped, failed)
+	}
+	if _, ok := dst.memories["memory0"]; ok {
+		t.Errorf("memory0 was listed in the progress log, but copied again")
+	}
+	for _, key := range []string{"memory1", "memory2", "memory3"} {
+		got, ok := dst.memories[key]
+		if !ok || string(*got) != string(*src.memories[key]) {
+			t.Errorf("'%s' not copied as-is", key)
+		}
+	}
+
+	// Every copied key is appended to the log, so a re-run copies nothing
+	done := readMigrateProgress(opts.progress)
+	for key, datum := range src.memories {
+		if done[key] != checksum(*datum) {
+			t.Errorf("progress log: want checksum for '%s', got '%s'", key, done[key])
+		}
+	}
+	copied, skipped, failed, err = migrateMemories(src, dst, opts, nil, nil)
+	if err != nil || copied != 0 || skipped != 4 || failed != 0 {
+		t.Errorf("re-run: want 0 copied, 4 skipped; got %d, %d, %d (%v)", copied, skipped, failed, err)
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	src, dst := migrateBrains(t, 2)
+	opts := migrateOptions{dryRun: true, progress: filepath.Join(t.TempDir(), "migrate.log")}
+	copied, _, failed, err := migrateMemories(src, dst, opts, nil, nil)
+	if err != nil || copied != 2 || failed != 0 {
+		t.Errorf("dry run: want 2 to copy; got %d, %d failed (%v)", copied, failed, err)
+	}
+	if len(dst.memories) != 0 {
+		t.Errorf("dry run stored %d memories", len(dst.memories))
+	}
+	if done := readMigrateProgress(opts.progress); len(done) != 0 {
+		t.Errorf("dry run wrote the progress log")
+	}
+}
+
+func TestMigrateRekey(t *testing.T) {
+	src, dst := migrateBrains(t, 3)
+	newKey := []byte(strings.Repeat("n", 32))
+	opts := migrateOptions{rekey: true, progress: filepath.Join(t.TempDir(), "migrate.log")}
+	copied, _, failed, err := migrateMemories(src, dst, opts, testInternalKey, newKey)
+	if err != nil || copied != 3 || failed != 0 {
+		t.Fatalf("rekey: want 3 copied; got %d, %d failed (%v)", copied, failed, err)
+	}
+	for key, datum := range dst.memories {
+		plain, err := decrypt(*datum, newKey)
+		if err != nil {
+			t.Errorf("'%s' doesn't decrypt with the new key: %v", key, err)
+			continue
+		}
+		want := "memory " + strings.TrimPrefix(key, "memory")
+		if string(plain) != want {
+			t.Errorf("'%s': want '%s', got '%s'", key, want, plain)
+		}
+	}
+}
+
+func TestMigrateRekeyUndecryptable(t *testing.T) {
+	src, dst := migrateBrains(t, 3)
+	// memory1 is encrypted with some other key
+	other, err := encrypt([]byte("memory 1"), []byte(strings.Repeat("o", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.memories["memory1"] = &other
+	newKey := []byte(strings.Repeat("n", 32))
+	opts := migrateOptions{rekey: true, progress: filepath.Join(t.TempDir(), "migrate.log")}
+	copied, _, failed, err := migrateMemories(src, dst, opts, testInternalKey, newKey)
+	if err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	if copied != 2 || failed != 1 {
+		t.Errorf("want 2 copied, 1 failed; got %d, %d", copied, failed)
+	}
+	if _, ok := dst.memories["memory1"]; ok {
+		t.Errorf("undecryptable memory was copied")
+	}
+	if done := readMigrateProgress(opts.progress); len(done["memory1"]) > 0 {
+		t.Errorf("undecryptable memory was recorded in the progress log")
+	}
+}
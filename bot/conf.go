@@ -8,13 +8,16 @@ import (
 	"time"
 	"unicode/utf8"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 /* conf.go - methods and types for reading and storing json configuration */
 
 var protocolConfig, brainConfig, historyConfig json.RawMessage
 
+// ProtocolConfig for each secondary connector, indexed by protocol name
+var secondaryConfigs = make(map[string]json.RawMessage)
+
 var robotConfigFileName = "robot.yaml"
 
 // ConfigLoader defines 'bot configuration, and is read from conf/robot.yaml
@@ -27,6 +30,7 @@ type ConfigLoader struct {
 	BotInfo              *UserInfo                 // Information about the robot
 	UserRoster           []UserInfo                // List of users and related attributes
 	ChannelRoster        []ChannelInfo             // List of channels mapping names to IDs
+	SecondaryProtocols   []ProtocolInfo            // Additional connectors to run alongside the primary Protocol
 	Brain                string                    // Type of Brain to use
 	BrainConfig          json.RawMessage           // Brain-specific configuration, type for unmarshalling arbitrary config
 	EncryptBrain         bool                      // Whether the brain should be encrypted
@@ -56,6 +60,12 @@ type ConfigLoader struct {
 	AdminUsers           []string                  // List of users who can access administrative commands
 	Alias                string                    // One-character alias for commands directed at the 'bot, e.g. ';open the pod bay doors'
 	LocalPort            int                       // Port number for listening on localhost, for CLI plugins
+	WebhookListen        string                    // Address for the inbound webhook listener, e.g. ":8080"; disabled if empty
+	HistoryListen        string                    // Address for the built-in job history web UI, e.g. ":8881"; disabled if empty
+	HistoryURL           string                    // External base URL for the history web UI, if different from the listen address
+	HistoryTLSCert       string                    // PEM certificate file for serving the history web UI with TLS
+	HistoryTLSKey        string                    // PEM key file for HistoryTLSCert
+	LocalSocket          bool                      // Listen on a private unix socket instead of LocalPort, for external plugins
 	LogLevel             string                    // Initial log level, can be modified by plugins. One of "trace" "debug" "info" "warn" "error"
 }
 
@@ -75,6 +85,17 @@ type UserInfo struct {
 	BotUser             bool   // these users aren't checked against MessageMatchers / ambient messages, and never fall-through to "catchalls"
 }
 
+// ProtocolInfo is listed in SecondaryProtocols of robot.yaml, to configure
+// additional connectors that run alongside the primary Protocol. Each
+// connector has it's own ProtocolConfig, rosters and channels to join.
+type ProtocolInfo struct {
+	Protocol       string          // Name of the connector protocol, e.g. "rocket"
+	ProtocolConfig json.RawMessage // Protocol-specific configuration
+	UserRoster     []UserInfo      // List of users for this connector
+	ChannelRoster  []ChannelInfo   // List of channels for this connector
+	JoinChannels   []string        // Channels to join on this connector
+}
+
 // ChannelInfo maps channel IDs to channel names when the connector doesn't
 // provide a sensible name for use in configuration files.
 type ChannelInfo struct {
@@ -82,6 +103,7 @@ type ChannelInfo struct {
 }
 
 type userChanMaps struct {
+	protocol  robot.Protocol          // The connector protocol the users and channels belong to
 	userID    map[string]*UserInfo    // Current map of userID to UserInfo struct
 	user      map[string]*UserInfo    // Current map of username to UserInfo struct
 	channelID map[string]*ChannelInfo // Current map of channel ID to ChannelInfo struct
@@ -89,13 +111,59 @@ type userChanMaps struct {
 }
 
 var currentUCMaps = struct {
-	ucmap *userChanMaps // pointer to current struct
+	ucmap     *userChanMaps                    // pointer to current struct for the primary protocol
+	secondary map[robot.Protocol]*userChanMaps // maps for secondary protocols
 	sync.Mutex
 }{
+	nil,
 	nil,
 	sync.Mutex{},
 }
 
+// getUCMaps returns the current user / channel maps for the given
+// protocol, falling back to the primary protocol's maps.
+func getUCMaps(p robot.Protocol) *userChanMaps {
+	currentUCMaps.Lock()
+	defer currentUCMaps.Unlock()
+	if maps, ok := currentUCMaps.secondary[p]; ok {
+		return maps
+	}
+	return currentUCMaps.ucmap
+}
+
+// buildUCMaps builds the user / channel maps for a connector from it's
+// rosters, and returns a map of username to userID for the connector.
+func buildUCMaps(protocol string, users []UserInfo, channels []ChannelInfo) (*userChanMaps, map[string]string) {
+	ucmaps := &userChanMaps{
+		getProtocol(protocol),
+		make(map[string]*UserInfo),
+		make(map[string]*UserInfo),
+		make(map[string]*ChannelInfo),
+		make(map[string]*ChannelInfo),
+	}
+	usermap := make(map[string]string)
+	for i, user := range users {
+		if len(user.UserName) == 0 || len(user.UserID) == 0 {
+			Log(robot.Error, "one of Username/UserID empty (%s/%s) in %s UserRoster, ignoring", user.UserName, user.UserID, protocol)
+		} else {
+			u := &users[i]
+			ucmaps.user[u.UserName] = u
+			ucmaps.userID[u.UserID] = u
+			usermap[u.UserName] = u.UserID
+		}
+	}
+	for i, ch := range channels {
+		if len(ch.ChannelName) == 0 || len(ch.ChannelID) == 0 {
+			Log(robot.Error, "one of ChannelName/ChannelID empty (%s/%s) in %s ChannelRoster, ignoring", ch.ChannelName, ch.ChannelID, protocol)
+		} else {
+			c := &channels[i]
+			ucmaps.channel[c.ChannelName] = c
+			ucmaps.channelID[c.ChannelID] = c
+		}
+	}
+	return ucmaps, usermap
+}
+
 // Protects the bot config and list of repositories
 var confLock sync.RWMutex
 var config *ConfigLoader
@@ -128,6 +196,7 @@ func loadConfig(preConnect bool) error {
 			repolist[k] = repository
 		}
 	}
+	checkRepoDependencies(repolist)
 
 	explicitDefaultAllowDirect := false
 
@@ -137,6 +206,7 @@ func loadConfig(preConnect bool) error {
 		var urval []UserInfo
 		var bival *UserInfo
 		var crval []ChannelInfo
+		var pval []ProtocolInfo
 		var tval map[string]TaskSettings
 		var mval map[string]LoadableModule
 		var stval []ScheduledTask
@@ -146,9 +216,9 @@ func loadConfig(preConnect bool) error {
 		var val interface{}
 		skip := false
 		switch key {
-		case "AdminContact", "Email", "Protocol", "Brain", "EncryptionKey", "HistoryProvider", "WorkSpace", "DefaultJobChannel", "DefaultElevator", "DefaultAuthorizer", "DefaultMessageFormat", "Name", "Alias", "LogLevel", "TimeZone":
+		case "AdminContact", "Email", "Protocol", "Brain", "EncryptionKey", "HistoryProvider", "WorkSpace", "DefaultJobChannel", "DefaultElevator", "DefaultAuthorizer", "DefaultMessageFormat", "Name", "Alias", "LogLevel", "TimeZone", "WebhookListen", "HistoryListen", "HistoryURL", "HistoryTLSCert", "HistoryTLSKey":
 			val = &strval
-		case "DefaultAllowDirect", "EncryptBrain", "IgnoreUnlistedUsers":
+		case "DefaultAllowDirect", "EncryptBrain", "IgnoreUnlistedUsers", "LocalSocket":
 			val = &boolval
 		case "BotInfo":
 			val = &bival
@@ -156,6 +226,8 @@ func loadConfig(preConnect bool) error {
 			val = &urval
 		case "ChannelRoster":
 			val = &crval
+		case "SecondaryProtocols":
+			val = &pval
 		case "LocalPort":
 			val = &intval
 		case "ExternalJobs", "ExternalPlugins", "ExternalTasks", "GoJobs", "GoPlugins", "GoTasks", "NameSpaces":
@@ -217,6 +289,8 @@ func loadConfig(preConnect bool) error {
 			newconfig.UserRoster = *(val.(*[]UserInfo))
 		case "ChannelRoster":
 			newconfig.ChannelRoster = *(val.(*[]ChannelInfo))
+		case "SecondaryProtocols":
+			newconfig.SecondaryProtocols = *(val.(*[]ProtocolInfo))
 		case "DefaultAllowDirect":
 			newconfig.DefaultAllowDirect = *(val.(*bool))
 			explicitDefaultAllowDirect = true
@@ -230,6 +304,8 @@ func loadConfig(preConnect bool) error {
 			newconfig.EncryptBrain = *(val.(*bool))
 		case "IgnoreUnlistedUsers":
 			newconfig.IgnoreUnlistedUsers = *(val.(*bool))
+		case "LocalSocket":
+			newconfig.LocalSocket = *(val.(*bool))
 		case "ExternalPlugins":
 			newconfig.ExternalPlugins = *(val.(*map[string]TaskSettings))
 		case "ExternalJobs":
@@ -254,6 +330,16 @@ func loadConfig(preConnect bool) error {
 			newconfig.Alias = *(val.(*string))
 		case "LocalPort":
 			newconfig.LocalPort = *(val.(*int))
+		case "WebhookListen":
+			newconfig.WebhookListen = *(val.(*string))
+		case "HistoryListen":
+			newconfig.HistoryListen = *(val.(*string))
+		case "HistoryURL":
+			newconfig.HistoryURL = *(val.(*string))
+		case "HistoryTLSCert":
+			newconfig.HistoryTLSCert = *(val.(*string))
+		case "HistoryTLSKey":
+			newconfig.HistoryTLSKey = *(val.(*string))
 		case "LogLevel":
 			newconfig.LogLevel = *(val.(*string))
 		case "TimeZone":
@@ -273,6 +359,22 @@ func loadConfig(preConnect bool) error {
 	} else {
 		return fmt.Errorf("Protocol not specified in %s", robotConfigFileName)
 	}
+	seenProtocols := map[robot.Protocol]string{
+		getProtocol(processed.protocol): processed.protocol,
+	}
+	secondary := make([]ProtocolInfo, 0, len(newconfig.SecondaryProtocols))
+	for _, sp := range newconfig.SecondaryProtocols {
+		if len(sp.Protocol) == 0 {
+			Log(robot.Error, "Protocol not specified for SecondaryProtocols entry in %s, ignoring", robotConfigFileName)
+			continue
+		}
+		if seen, ok := seenProtocols[getProtocol(sp.Protocol)]; ok {
+			return fmt.Errorf("Secondary protocol '%s' duplicates protocol '%s' in %s", sp.Protocol, seen, robotConfigFileName)
+		}
+		seenProtocols[getProtocol(sp.Protocol)] = sp.Protocol
+		secondary = append(secondary, sp)
+	}
+	processed.secondaryProtocols = secondary
 	if newconfig.Brain != "" {
 		processed.brainProvider = newconfig.Brain
 	}
@@ -296,6 +398,9 @@ func loadConfig(preConnect bool) error {
 			processed.loadableModules = lm
 		}
 		loadModules(newconfig.Protocol, newconfig.Brain, newconfig.HistoryProvider, lm)
+		for _, sp := range secondary {
+			loadModules(sp.Protocol, "", "", nil)
+		}
 	}
 
 	if newconfig.Alias != "" {
@@ -456,41 +561,26 @@ func loadConfig(preConnect bool) error {
 		processed.joinChannels = newconfig.JoinChannels
 	}
 
-	ucmaps := userChanMaps{
-		make(map[string]*UserInfo),
-		make(map[string]*UserInfo),
-		make(map[string]*ChannelInfo),
-		make(map[string]*ChannelInfo),
-	}
-	usermap := make(map[string]string)
-	if len(newconfig.UserRoster) > 0 {
-		for i, user := range newconfig.UserRoster {
-			if len(user.UserName) == 0 || len(user.UserID) == 0 {
-				Log(robot.Error, "one of Username/UserID empty (%s/%s), ignoring", user.UserName, user.UserID)
-			} else {
-				u := &newconfig.UserRoster[i]
-				ucmaps.user[u.UserName] = u
-				ucmaps.userID[u.UserID] = u
-				usermap[u.UserName] = u.UserID
-			}
-		}
-		if len(processed.botinfo.UserName) > 0 && len(processed.botinfo.UserID) > 0 {
-			usermap[processed.botinfo.UserName] = processed.botinfo.UserID
-		}
+	ucmaps, usermap := buildUCMaps(processed.protocol, newconfig.UserRoster, newconfig.ChannelRoster)
+	if len(usermap) > 0 && len(processed.botinfo.UserName) > 0 && len(processed.botinfo.UserID) > 0 {
+		usermap[processed.botinfo.UserName] = processed.botinfo.UserID
 	}
-	if len(newconfig.ChannelRoster) > 0 {
-		for i, ch := range newconfig.ChannelRoster {
-			if len(ch.ChannelName) == 0 || len(ch.ChannelID) == 0 {
-				Log(robot.Error, "one of ChannelName/ChannelID empty (%s/%s), ignoring", ch.ChannelName, ch.ChannelID)
-			} else {
-				c := &newconfig.ChannelRoster[i]
-				ucmaps.channel[c.ChannelName] = c
-				ucmaps.channelID[c.ChannelID] = c
-			}
+	secondaryMaps := make(map[robot.Protocol]*userChanMaps)
+	secondaryUsers := make(map[robot.Protocol]map[string]string)
+	for _, sp := range secondary {
+		sm, su := buildUCMaps(sp.Protocol, sp.UserRoster, sp.ChannelRoster)
+		secondaryInfo.RLock()
+		botID := secondaryInfo.botID[sm.protocol]
+		secondaryInfo.RUnlock()
+		if len(su) > 0 && len(processed.botinfo.UserName) > 0 && len(botID) > 0 {
+			su[processed.botinfo.UserName] = botID
 		}
+		secondaryMaps[sm.protocol] = sm
+		secondaryUsers[sm.protocol] = su
 	}
 	currentUCMaps.Lock()
-	currentUCMaps.ucmap = &ucmaps
+	currentUCMaps.ucmap = ucmaps
+	currentUCMaps.secondary = secondaryMaps
 	currentUCMaps.Unlock()
 
 	h := handler{}
@@ -508,6 +598,9 @@ func loadConfig(preConnect bool) error {
 		if newconfig.ProtocolConfig != nil {
 			protocolConfig = newconfig.ProtocolConfig
 		}
+		for _, sp := range secondary {
+			secondaryConfigs[sp.Protocol] = sp.ProtocolConfig
+		}
 
 		if newconfig.EncryptBrain {
 			encryptBrain = true
@@ -521,6 +614,12 @@ func loadConfig(preConnect bool) error {
 		} else {
 			processed.port = "0"
 		}
+		processed.webhookListen = newconfig.WebhookListen
+		processed.historyListen = newconfig.HistoryListen
+		processed.historyURL = newconfig.HistoryURL
+		processed.historyTLSCert = newconfig.HistoryTLSCert
+		processed.historyTLSKey = newconfig.HistoryTLSKey
+		processed.localSocket = newconfig.LocalSocket
 		if len(newconfig.HistoryProvider) == 0 {
 			newconfig.HistoryProvider = "mem"
 		}
@@ -543,6 +642,11 @@ func loadConfig(preConnect bool) error {
 		if len(usermap) > 0 {
 			interfaces.SetUserMap(usermap)
 		}
+		for p, su := range secondaryUsers {
+			if conn, ok := interfaces.secondary[p]; ok && len(su) > 0 {
+				conn.SetUserMap(su)
+			}
+		}
 		// We should never dump the brain key
 		newconfig.EncryptionKey = "XXXXXX"
 	}
@@ -0,0 +1,115 @@
+package bot
+
+/* connectors.go - support for running secondary connectors alongside the
+primary connector. Each secondary connector gets a handler with it's protocol
+name, so callbacks can be attributed to the right connector; messages are
+routed back to a connector based on the robot.Protocol of the worker/Robot.
+*/
+
+import (
+	"log"
+	"sync"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// The bot ID and mention string supplied by each secondary connector
+var secondaryInfo = struct {
+	botID   map[robot.Protocol]string
+	mention map[robot.Protocol]string
+	sync.RWMutex
+}{
+	make(map[robot.Protocol]string),
+	make(map[robot.Protocol]string),
+	sync.RWMutex{},
+}
+
+var stopSecondary chan struct{}     // closed to stop all secondary connectors
+var secondaryRunning sync.WaitGroup // for waiting on secondary connectors to stop
+
+// initSecondaryConnectors initializes the connectors listed in
+// SecondaryProtocols; called after the primary connector is initialized.
+func initSecondaryConnectors(l *log.Logger) {
+	secondaryInfo.Lock()
+	secondaryInfo.botID = make(map[robot.Protocol]string)
+	secondaryInfo.mention = make(map[robot.Protocol]string)
+	secondaryInfo.Unlock()
+	interfaces.secondary = make(map[robot.Protocol]robot.Connector)
+	for _, sp := range currentCfg.secondaryProtocols {
+		initializeConnector, ok := connectors[sp.Protocol]
+		if !ok {
+			Log(robot.Fatal, "No connector registered with name: %s", sp.Protocol)
+		}
+		conn := initializeConnector(handler{protocol: sp.Protocol}, l)
+		if conn == nil {
+			Log(robot.Fatal, "Unable to initialize secondary connector: %s", sp.Protocol)
+		}
+		Log(robot.Info, "Initialized secondary connector: %s", sp.Protocol)
+		interfaces.secondary[getProtocol(sp.Protocol)] = conn
+	}
+}
+
+// runSecondaryConnectors joins the configured channels and starts the main
+// loop for each secondary connector.
+func runSecondaryConnectors() {
+	stopSecondary = make(chan struct{})
+	for _, sp := range currentCfg.secondaryProtocols {
+		conn := interfaces.secondary[getProtocol(sp.Protocol)]
+		for _, channel := range sp.JoinChannels {
+			conn.JoinChannel(channel)
+		}
+		secondaryRunning.Add(1)
+		go func(conn robot.Connector, protocol string) {
+			raiseThreadPriv("secondary connector loop")
+			conn.Run(stopSecondary)
+			Log(robot.Info, "Secondary connector '%s' stopped", protocol)
+			secondaryRunning.Done()
+		}(conn, sp.Protocol)
+	}
+}
+
+// stopSecondaryConnectors stops all the secondary connectors, and waits
+// for their main loops to exit.
+func stopSecondaryConnectors() {
+	if stopSecondary == nil {
+		return
+	}
+	close(stopSecondary)
+	secondaryRunning.Wait()
+}
+
+// taskProtocol checks the Protocol setting for a task; it returns "" for
+// the primary protocol, or the name of a configured secondary protocol.
+// Protocol names aren't case sensitive. Returns false for a protocol that
+// isn't configured.
+func (c *configuration) taskProtocol(protocol string) (string, bool) {
+	p := getProtocol(protocol)
+	if p == getProtocol(c.protocol) {
+		return "", true
+	}
+	for _, sp := range c.secondaryProtocols {
+		if p == getProtocol(sp.Protocol) {
+			return sp.Protocol, true
+		}
+	}
+	return "", false
+}
+
+// getConnector returns the connector for the given protocol, falling back
+// to the primary connector.
+func getConnector(p robot.Protocol) robot.Connector {
+	if conn, ok := interfaces.secondary[p]; ok {
+		return conn
+	}
+	return interfaces.Connector
+}
+
+// connector returns the connector the worker's messages are sent with
+func (w *worker) connector() robot.Connector {
+	return getConnector(w.Protocol)
+}
+
+// connector returns the connector the Robot's messages are sent with
+func (r Robot) connector() robot.Connector {
+	return getConnector(r.Protocol)
+}
@@ -0,0 +1,240 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// recordingConnector records the messages sent through it; other
+// Connector methods aren't implemented.
+type recordingConnector struct {
+	robot.Connector
+	sync.Mutex
+	sent []string
+}
+
+func (rc *recordingConnector) record(format string, v ...interface{}) robot.RetVal {
+	rc.Lock()
+	rc.sent = append(rc.sent, fmt.Sprintf(format, v...))
+	rc.Unlock()
+	return robot.Ok
+}
+
+func (rc *recordingConnector) messages() []string {
+	rc.Lock()
+	defer rc.Unlock()
+	return append([]string(nil), rc.sent...)
+}
+
+func (rc *recordingConnector) SendProtocolChannelMessage(ch, msg string, f robot.MessageFormat) robot.RetVal {
+	return rc.record("channel %s: %s", ch, msg)
+}
+
+func (rc *recordingConnector) SendProtocolUserChannelMessage(uid, uname, ch, msg string, f robot.MessageFormat) robot.RetVal {
+	return rc.record("user %s in channel %s: %s", uid, ch, msg)
+}
+
+func (rc *recordingConnector) SendProtocolUserMessage(u, msg string, f robot.MessageFormat) robot.RetVal {
+	return rc.record("user %s: %s", u, msg)
+}
+
+func (rc *recordingConnector) MessageHeard(u, c string) {}
+
+// setupSecondary installs a primary "test" connector and a secondary
+// "rocket" connector, each with a roster for alice and general.
+func setupSecondary(t *testing.T) (primary, rocket *recordingConnector) {
+	t.Helper()
+	primary, rocket = &recordingConnector{}, &recordingConnector{}
+	savedConn, savedSecondary := interfaces.Connector, interfaces.secondary
+	currentUCMaps.Lock()
+	savedMaps, savedSecondaryMaps := currentUCMaps.ucmap, currentUCMaps.secondary
+	currentUCMaps.Unlock()
+	currentCfg.Lock()
+	savedCfg := currentCfg.configuration
+	currentCfg.configuration = &configuration{
+		protocol:           "test",
+		secondaryProtocols: []ProtocolInfo{{Protocol: "rocket"}},
+	}
+	currentCfg.Unlock()
+	shortTermMemories.Lock()
+	savedShortTerm := shortTermMemories.m
+	shortTermMemories.m = make(map[memoryContext]shortTermMemory)
+	shortTermMemories.Unlock()
+
+	interfaces.Connector = primary
+	interfaces.secondary = map[robot.Protocol]robot.Connector{robot.Rocket: rocket}
+	pmaps, _ := buildUCMaps("test", []UserInfo{{UserName: "alice", UserID: "u0001"}}, []ChannelInfo{{ChannelName: "general", ChannelID: "c0001"}})
+	rmaps, _ := buildUCMaps("rocket", []UserInfo{{UserName: "alice", UserID: "R-alice"}}, []ChannelInfo{{ChannelName: "general", ChannelID: "R-general"}})
+	currentUCMaps.Lock()
+	currentUCMaps.ucmap = pmaps
+	currentUCMaps.secondary = map[robot.Protocol]*userChanMaps{robot.Rocket: rmaps}
+	currentUCMaps.Unlock()
+
+	t.Cleanup(func() {
+		interfaces.Connector, interfaces.secondary = savedConn, savedSecondary
+		currentUCMaps.Lock()
+		currentUCMaps.ucmap, currentUCMaps.secondary = savedMaps, savedSecondaryMaps
+		currentUCMaps.Unlock()
+		currentCfg.Lock()
+		currentCfg.configuration = savedCfg
+		currentCfg.Unlock()
+		shortTermMemories.Lock()
+		shortTermMemories.m = savedShortTerm
+		shortTermMemories.Unlock()
+	})
+	return primary, rocket
+}
+
+// protocolRobot returns a Robot for alice in general on the given protocol
+func protocolRobot(t *testing.T, p robot.Protocol) Robot {
+	t.Helper()
+	currentCfg.RLock()
+	cfg, tasks := currentCfg.configuration, currentCfg.taskList
+	currentCfg.RUnlock()
+	w := &worker{
+		User:     "alice",
+		Channel:  "general",
+		Protocol: p,
+		Incoming: &robot.ConnectorMessage{},
+		id:       getWorkerID(),
+		cfg:      cfg,
+		tasks:    tasks,
+		maps:     getUCMaps(p),
+	}
+	w.pipeContext = &pipeContext{environment: make(map[string]string)}
+	w.registerActive(nil)
+	r := w.makeRobot()
+	r.currentTask = &Task{name: "routing"}
+	w.registerWorker(r.tid)
+	t.Cleanup(func() {
+		deregisterWorker(r.tid)
+		w.deregister()
+	})
+	return r
+}
+
+func checkSent(t *testing.T, name string, rc *recordingConnector, want []string) {
+	t.Helper()
+	got := rc.messages()
+	if len(got) != len(want) {
+		t.Errorf("%s connector: want %q, got %q", name, want, got)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s connector message %d: want %q, got %q", name, i, want[i], got[i])
+		}
+	}
+}
+
+func TestSecondaryRouting(t *testing.T) {
+	primary, rocket := setupSecondary(t)
+
+	r := protocolRobot(t, robot.Rocket)
+	r.Say("Hello from rocket")
+	r.Reply("Hi alice")
+	p := protocolRobot(t, robot.Test)
+	p.Say("Hello from test")
+	// A protocol without a connector falls back to the primary connector
+	s := protocolRobot(t, robot.Slack)
+	s.Say("Hello from slack")
+
+	checkSent(t, "rocket", rocket, []string{
+		"channel <R-general>: Hello from rocket",
+		"user <R-alice> in channel general: Hi alice",
+	})
+	checkSent(t, "primary", primary, []string{
+		"channel <c0001>: Hello from test",
+		"channel <c0001>: Hello from slack",
+	})
+}
+
+func TestSecondaryReply(t *testing.T) {
+	primary, rocket := setupSecondary(t)
+	r := protocolRobot(t, robot.Rocket)
+
+	type answer struct {
+		reply string
+		ret   robot.RetVal
+	}
+	answered := make(chan answer)
+	go func() {
+		rep, ret := r.PromptForReply("SimpleString", "Deploy now?")
+		answered <- answer{rep, ret}
+	}()
+	matcher := replyMatcher{robot.Rocket, "alice", "general"}
+	deadline := time.Now().Add(time.Second)
+	for {
+		replies.Lock()
+		_, waiting := replies.m[matcher]
+		replies.Unlock()
+		if waiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("prompt never registered a reply waiter for %+v", matcher)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	checkSent(t, "rocket", rocket, []string{"user <R-alice> in channel general: Deploy now?"})
+	checkSent(t, "primary", primary, nil)
+
+	// The same user and channel on the primary protocol isn't the reply
+	handler{}.IncomingMessage(&robot.ConnectorMessage{UserID: "u0001", ChannelID: "c0001", MessageText: "no"})
+	handler{protocol: "rocket"}.IncomingMessage(&robot.ConnectorMessage{UserID: "R-alice", ChannelID: "R-general", MessageText: "yes"})
+	select {
+	case a := <-answered:
+		if a.ret != robot.Ok || a.reply != "yes" {
+			t.Errorf("want reply 'yes' from rocket, got '%s' (%s)", a.reply, a.ret)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no reply received through the secondary connector")
+	}
+}
+
+func TestTaskProtocol(t *testing.T) {
+	cfg := &configuration{
+		protocol:           "slack",
+		secondaryProtocols: []ProtocolInfo{{Protocol: "rocket"}, {Protocol: "irc"}},
+	}
+	cases := []struct {
+		protocol, want string
+		ok             bool
+	}{
+		{"slack", "", true},
+		{"Slack", "", true},
+		{"rocket", "rocket", true},
+		{"IRC", "irc", true},
+		{"terminal", "", false},
+		{"matrix", "", false},
+	}
+	for _, c := range cases {
+		got, ok := cfg.taskProtocol(c.protocol)
+		if got != c.want || ok != c.ok {
+			t.Errorf("taskProtocol(%q): want %q, %t; got %q, %t", c.protocol, c.want, c.ok, got, ok)
+		}
+	}
+}
+
+func TestUnknownProtocols(t *testing.T) {
+	a, b := getProtocol("matrix"), getProtocol("zulip")
+	if a == robot.Test || b == robot.Test {
+		t.Errorf("unknown protocols mapped to robot.Test")
+	}
+	if a == b || a <= robot.IRC || b <= robot.IRC {
+		t.Errorf("unknown protocols should get distinct ids after robot.IRC, got %d and %d", a, b)
+	}
+	if getProtocol("Matrix") != a {
+		t.Errorf("protocol names should be case insensitive")
+	}
+	if name := protocolName(a); name != "matrix" {
+		t.Errorf("protocolName: want 'matrix', got '%s'", name)
+	}
+	if name := protocolName(robot.Rocket); name != "Rocket" {
+		t.Errorf("protocolName: want 'Rocket', got '%s'", name)
+	}
+}
@@ -11,6 +11,7 @@ const (
 	flavorAdd
 	flavorFinal
 	flavorFail
+	flavorParallel
 )
 
 const (
@@ -36,6 +37,7 @@ const (
 	spawnedTask
 	scheduled
 	jobCommand // i.e. run job xx
+	webhook    // inbound webhook
 )
 
 //go:generate stringer -type=pipeAddFlavor constants.go
@@ -6,7 +6,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 const keepListeningDuration = 77 * time.Second
@@ -120,7 +120,7 @@ func (w *worker) checkPluginMatchersAndRun(pipelineType pipelineType) (messageMa
 									}
 								} else {
 									// Didn't match generic, store the value in short-term context memory
-									s := shortTermMemory{cmdArgs[i], ts}
+									s := shortTermMemory{cmdArgs[i], ts, 0}
 									shortTermMemories.m[ctx] = s
 								}
 							} else {
@@ -178,6 +178,13 @@ func (w *worker) checkPluginMatchersAndRun(pipelineType pipelineType) (messageMa
 func (w *worker) handleMessage() {
 	defer checkPanic(w, w.msg)
 
+	// Reactions to messages only trigger jobs
+	if len(w.Incoming.Reaction) > 0 {
+		Log(robot.Debug, "Reaction '%s' from user '%s' in channel '%s'", w.Incoming.Reaction, w.User, w.Channel)
+		w.checkJobMatchersAndRun()
+		return
+	}
+
 	if w.directMsg {
 		emit(BotDirectMessage)
 		Log(robot.Trace, "Bot received a direct message from %s: %s", w.User, w.msg)
@@ -191,7 +198,7 @@ func (w *worker) handleMessage() {
 	// user take precedence over everything else.
 	var waiters []replyWaiter
 	waitingForReply := false
-	matcher := replyMatcher{w.User, w.Channel}
+	matcher := replyMatcher{w.Protocol, w.User, w.Channel}
 	Log(robot.Trace, "Checking replies for matcher: %q", matcher)
 	replies.Lock()
 	waiters, waitingForReply = replies.m[matcher]
@@ -282,7 +289,7 @@ func (w *worker) handleMessage() {
 		delete(shortTermMemories.m, lastMsgContext)
 		shortTermMemories.Unlock()
 	} else {
-		last = shortTermMemory{w.msg, ts}
+		last = shortTermMemory{w.msg, ts, 0}
 		shortTermMemories.Lock()
 		shortTermMemories.m[lastMsgContext] = last
 		shortTermMemories.Unlock()
@@ -6,7 +6,7 @@ import (
 	"path"
 	"runtime"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var events = make(chan Event, 16)
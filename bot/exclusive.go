@@ -3,7 +3,7 @@ package bot
 import (
 	"sync"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var runQueues = struct {
@@ -41,6 +41,10 @@ func (r Robot) Exclusive(tag string, queueTask bool) (success bool) {
 		r.Log(robot.Error, "Exclusive called on pipeline with no job started")
 		return false
 	}
+	if r.parallel {
+		r.Log(robot.Error, "Exclusive called from a parallel task")
+		return false
+	}
 	if len(tag) > 0 {
 		tag = ":" + tag
 	}
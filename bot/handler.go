@@ -10,11 +10,18 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
-// an empty object type for passing a Handler to the connector.
-type handler struct{}
+// handler implements the robot.Handler interface for the connector, brain
+// and history provider. For secondary connectors, protocol is set to the name
+// of the connector's protocol; it's empty for everything else.
+type handler struct {
+	protocol string
+
+	// set for brains opened with a config other than BrainConfig
+	brainConfig json.RawMessage
+}
 
 // dummy var to pass a handler
 var handle = handler{}
@@ -77,6 +84,7 @@ type worker struct {
 	directMsg       bool                        // if the message was sent by DM
 	msg             string                      // the message text sent
 	automaticTask   bool                        // set for scheduled & triggers jobs, where user security restrictions don't apply
+	webhook         *webhookRequest             // set for jobs started by an inbound webhook
 	*pipeContext                                // pointer to the pipeline context
 	sync.Mutex                                  // Lock to protect the bot context when pipeline running
 }
@@ -124,9 +132,27 @@ func (h handler) IncomingMessage(inc *robot.ConnectorMessage) {
 		Log(robot.Error, "incoming message with no username or user ID")
 		return
 	}
-	currentUCMaps.Lock()
-	maps := currentUCMaps.ucmap
-	currentUCMaps.Unlock()
+	// Record which connector the message came from; replies are routed
+	// back to the connector based on the protocol.
+	protocol := getProtocol(inc.Protocol)
+	var maps *userChanMaps
+	if len(h.protocol) > 0 {
+		if len(inc.Protocol) == 0 {
+			inc.Protocol = h.protocol
+		}
+		protocol = getProtocol(h.protocol)
+		maps = getUCMaps(protocol)
+	} else {
+		if len(inc.Protocol) == 0 {
+			currentCfg.RLock()
+			inc.Protocol = currentCfg.protocol
+			currentCfg.RUnlock()
+			protocol = getProtocol(inc.Protocol)
+		}
+		currentUCMaps.Lock()
+		maps = currentUCMaps.ucmap
+		currentUCMaps.Unlock()
+	}
 	var channelName, userName, ProtocolChannel, ProtocolUser string
 	var BotUser bool
 
@@ -153,8 +179,6 @@ func (h handler) IncomingMessage(inc *robot.ConnectorMessage) {
 	} else {
 		userName = bracket(inc.UserID)
 	}
-	protocol := getProtocol(inc.Protocol)
-
 	messageFull := inc.MessageText
 
 	Log(robot.Trace, "Incoming message in channel '%s/%s' from user '%s/%s': %s", channelName, ProtocolChannel, userName, ProtocolUser, messageFull)
@@ -164,10 +188,16 @@ func (h handler) IncomingMessage(inc *robot.ConnectorMessage) {
 	var message string
 
 	regexes.RLock()
-	preRegex := regexes.preRegex
-	postRegex := regexes.postRegex
-	bareRegex := regexes.bareRegex
+	re := regexes.botRegexes
+	if len(h.protocol) > 0 {
+		if sr, ok := regexes.secondary[protocol]; ok {
+			re = *sr
+		}
+	}
 	regexes.RUnlock()
+	preRegex := re.preRegex
+	postRegex := re.postRegex
+	bareRegex := re.bareRegex
 	currentCfg.RLock()
 	ignoreUsers := currentCfg.ignoreUsers
 	ignoreUnlisted := currentCfg.ignoreUnlistedUsers
@@ -257,12 +287,18 @@ we don't need to worry about locking. When absolutely necessary, there's always
 
 // GetProtocolConfig unmarshals the connector's configuration data into a provided struct
 func (h handler) GetProtocolConfig(v interface{}) error {
+	if len(h.protocol) > 0 {
+		return json.Unmarshal(secondaryConfigs[h.protocol], v)
+	}
 	err := json.Unmarshal(protocolConfig, v)
 	return err
 }
 
 // GetBrainConfig unmarshals the brain's configuration data into a provided struct
 func (h handler) GetBrainConfig(v interface{}) error {
+	if h.brainConfig != nil {
+		return json.Unmarshal(h.brainConfig, v)
+	}
 	err := json.Unmarshal(brainConfig, v)
 	return err
 }
@@ -273,6 +309,12 @@ func (h handler) GetHistoryConfig(v interface{}) error {
 	return err
 }
 
+// GetHistoryURL implements robot.HistoryLinker, linking a log in the
+// built-in history web UI
+func (h handler) GetHistoryURL(tag string, index int) (string, bool) {
+	return historyLogURL(tag, index)
+}
+
 // Log logs a message to the robot's log file (or stderr)
 func (h handler) Log(l robot.LogLevel, m string, v ...interface{}) {
 	Log(l, m, v...)
@@ -305,6 +347,12 @@ func (h handler) GetDirectory(p string) error {
 
 // SetBotID let's the connector set the bot's internal ID
 func (h handler) SetBotID(id string) {
+	if len(h.protocol) > 0 {
+		secondaryInfo.Lock()
+		secondaryInfo.botID[getProtocol(h.protocol)] = id
+		secondaryInfo.Unlock()
+		return
+	}
 	currentCfg.Lock()
 	currentCfg.botinfo.UserID = id
 	currentCfg.Unlock()
@@ -315,6 +363,14 @@ func (h handler) SetBotMention(m string) {
 	if len(m) == 0 {
 		return
 	}
+	if len(h.protocol) > 0 {
+		Log(robot.Info, "protocol '%s' set bot mention string to: %s", h.protocol, m)
+		secondaryInfo.Lock()
+		secondaryInfo.mention[getProtocol(h.protocol)] = m
+		secondaryInfo.Unlock()
+		updateRegexes()
+		return
+	}
 	Log(robot.Info, "protocol set bot mention string to: %s", m)
 	currentCfg.Lock()
 	currentCfg.botinfo.protoMention = m
@@ -13,7 +13,7 @@ import (
 	"log"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 const histPrefix = "bot:histories:"
@@ -26,6 +26,9 @@ type historyLog struct {
 	Ref        string // 6 hex digits from worker ID
 	CreateTime string
 	Descriptor string // usually just the branch
+	Started    time.Time
+	Finished   time.Time // zero until the run finishes, see finishLog
+	Status     string    // TaskRetVal for the pipeline
 }
 
 type historyLookup struct {
@@ -104,6 +107,7 @@ func newLogger(tag, eid, descriptor string, wid, keep int) (logger robot.History
 				Ref:        ref,
 				Descriptor: descriptor,
 				CreateTime: start.Format("Jan 2 15:04:05"),
+				Started:    start,
 			}
 			ph.Histories = append(ph.Histories, hist)
 			l := len(ph.Histories)
@@ -142,6 +146,52 @@ func newLogger(tag, eid, descriptor string, wid, keep int) (logger robot.History
 	return
 }
 
+// logRecord writes a structured record to a history log, timestamping it
+// if needed; loggers that don't store records get a plain line.
+func logRecord(l robot.HistoryLogger, rec robot.HistoryRecord) {
+	if rec.Time.IsZero() {
+		currentCfg.RLock()
+		tz := currentCfg.timeZone
+		currentCfg.RUnlock()
+		rec.Time = time.Now()
+		if tz != nil {
+			rec.Time = rec.Time.In(tz)
+		}
+	}
+	if sl, ok := l.(robot.StructuredLogger); ok {
+		sl.Record(rec)
+		return
+	}
+	switch rec.Stream {
+	case robot.StreamOut, robot.StreamErr, robot.StreamLog:
+		l.Log(rec.Stream + " " + rec.Text)
+	default:
+		l.Line(rec.String())
+	}
+}
+
+// finishLog records the finish time and status of a kept log
+func finishLog(tag string, idx int, ret robot.TaskRetVal) {
+	var ph pipeHistory
+	key := histPrefix + tag
+	tok, _, mret := checkoutDatum(key, &ph, true)
+	if mret != robot.Ok {
+		Log(robot.Error, "Checking out '%s', unable to record status for run %d", tag, idx)
+		return
+	}
+	for i := range ph.Histories {
+		if ph.Histories[i].LogIndex == idx {
+			ph.Histories[i].Finished = time.Now()
+			ph.Histories[i].Status = ret.String()
+			if mret := updateDatum(key, tok, ph); mret != robot.Ok {
+				Log(robot.Error, "Updating '%s', unable to record status for run %d", tag, idx)
+			}
+			return
+		}
+	}
+	checkinDatum(key, tok)
+}
+
 // Map of registered history providers
 var historyProviders = make(map[string]func(robot.Handler) robot.HistoryProvider)
 
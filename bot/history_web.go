@@ -0,0 +1,427 @@
+package bot
+
+/* history_web.go - an optional built-in web server for browsing job
+   histories, so 'link log' works without running a separate web server.
+   Listing on the HistoryListen address, it shows jobs and their extended
+   namespaces, the kept runs for each with status, start time and duration,
+   and renders individual logs. Access is restricted to bot administrators,
+   who authenticate with their username and a token issued by the robot.
+   Since the token is sent with every request, the UI only listens on all
+   interfaces when it's served with TLS; otherwise a listen address without
+   a host is bound to localhost, for use behind a TLS reverse proxy.
+*/
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// Memory holding a map of username -> sha256 of the user's history web token
+const historyWebTokens = "bot:history-web-tokens"
+
+var historyWebListening bool
+
+// Timeouts for the history web server; logs can be long, so writes get a
+// while.
+const (
+	historyReadTimeout  = 10 * time.Second
+	historyWriteTimeout = 60 * time.Second
+	historyIdleTimeout  = 2 * time.Minute
+)
+
+// historyListenAddress returns the address to listen on; without TLS, a
+// listen address like ":8881" is bound to localhost.
+func historyListenAddress(listen string, useTLS bool) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil || len(host) > 0 || useTLS {
+		return listen
+	}
+	return net.JoinHostPort("localhost", port)
+}
+
+// historyWebURL returns the base URL for the history web UI, or "" if it's
+// not enabled.
+func historyWebURL() string {
+	currentCfg.RLock()
+	listen := currentCfg.historyListen
+	base := currentCfg.historyURL
+	useTLS := len(currentCfg.historyTLSCert) > 0
+	currentCfg.RUnlock()
+	if len(listen) == 0 {
+		return ""
+	}
+	if len(base) > 0 {
+		return strings.TrimRight(base, "/")
+	}
+	host, port, err := net.SplitHostPort(historyListenAddress(listen, useTLS))
+	if err != nil {
+		return ""
+	}
+	if len(host) == 0 {
+		if host, err = os.Hostname(); err != nil {
+			host = "localhost"
+		}
+	}
+	if useTLS {
+		return "https://" + net.JoinHostPort(host, port)
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// historyLogURL returns the link to a log in the history web UI
+func historyLogURL(tag string, index int) (string, bool) {
+	base := historyWebURL()
+	if len(base) == 0 {
+		return "", false
+	}
+	q := url.Values{}
+	q.Set("tag", tag)
+	q.Set("run", strconv.Itoa(index))
+	return base + "/history/log?" + q.Encode(), true
+}
+
+func serveHistoryWeb(listen, certFile, keyFile string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/history/", historyAuth(handleHistoryJobs))
+	mux.HandleFunc("/history/runs", historyAuth(handleHistoryRuns))
+	mux.HandleFunc("/history/log", historyAuth(handleHistoryLog))
+	useTLS := len(certFile) > 0
+	srv := &http.Server{
+		Addr:         historyListenAddress(listen, useTLS),
+		Handler:      mux,
+		ReadTimeout:  historyReadTimeout,
+		WriteTimeout: historyWriteTimeout,
+		IdleTimeout:  historyIdleTimeout,
+	}
+	if useTLS {
+		Log(robot.Info, "Serving job histories on https://%s/history/", srv.Addr)
+		Log(robot.Error, "Error serving job histories: %v", srv.ListenAndServeTLS(certFile, keyFile))
+		return
+	}
+	Log(robot.Info, "Serving job histories on http://%s/history/", srv.Addr)
+	Log(robot.Error, "Error serving job histories: %v", srv.ListenAndServe())
+}
+
+// historyAuth wraps a handler with HTTP basic authentication; the user must
+// be a current bot administrator with a valid token.
+func historyAuth(h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		user, token, ok := req.BasicAuth()
+		if ok && checkHistoryWebToken(user, token) {
+			h(rw, req)
+			return
+		}
+		if ok {
+			Log(robot.Warn, "Failed history web login for user '%s' from %s", user, req.RemoteAddr)
+		}
+		rw.Header().Set("WWW-Authenticate", `Basic realm="job histories"`)
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+	}
+}
+
+func hashHistoryToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func checkHistoryWebToken(user, token string) bool {
+	currentCfg.RLock()
+	admins := currentCfg.adminUsers
+	currentCfg.RUnlock()
+	admin := false
+	for _, a := range admins {
+		if a == user {
+			admin = true
+			break
+		}
+	}
+	if !admin || len(token) == 0 {
+		return false
+	}
+	tokens := make(map[string]string)
+	_, exists, ret := checkoutDatum(historyWebTokens, &tokens, false)
+	if ret != robot.Ok || !exists {
+		return false
+	}
+	hash, ok := tokens[user]
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashHistoryToken(token))) == 1
+}
+
+// newHistoryWebToken generates a random token for logging in
+func newHistoryWebToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// setHistoryWebToken stores the hash of a user's token, replacing any old
+// token, or removes the user's token when token is "".
+func setHistoryWebToken(user, token string) robot.RetVal {
+	tokens := make(map[string]string)
+	tok, _, ret := checkoutDatum(historyWebTokens, &tokens, true)
+	if ret != robot.Ok {
+		return ret
+	}
+	if len(token) > 0 {
+		tokens[user] = hashHistoryToken(token)
+	} else {
+		delete(tokens, user)
+	}
+	return updateDatum(historyWebTokens, tok, tokens)
+}
+
+type historyWebJob struct {
+	Tag        string
+	Extended   bool
+	Runs       int
+	LastStart  string
+	LastStatus string
+}
+
+type historyWebRun struct {
+	Index      int
+	Ref        string
+	Descriptor string
+	Started    string
+	Duration   string
+	Status     string
+}
+
+// runningLogs returns the logs of pipelines currently running
+func runningLogs() map[historyLookup]bool {
+	running := make(map[historyLookup]bool)
+	activePipelines.Lock()
+	workers := make([]*worker, 0, len(activePipelines.i))
+	for _, w := range activePipelines.i {
+		workers = append(workers, w)
+	}
+	activePipelines.Unlock()
+	for _, w := range workers {
+		w.Lock()
+		if len(w.histName) > 0 {
+			running[historyLookup{w.histName, w.runIndex}] = true
+		}
+		w.Unlock()
+	}
+	return running
+}
+
+func describeRun(tag string, h historyLog, running map[historyLookup]bool, tz *time.Location) historyWebRun {
+	run := historyWebRun{
+		Index:      h.LogIndex,
+		Ref:        h.Ref,
+		Descriptor: h.Descriptor,
+		Started:    h.CreateTime,
+		Duration:   "-",
+		Status:     h.Status,
+	}
+	if h.Started.IsZero() {
+		// recorded before run status was kept
+		run.Status = "-"
+		return run
+	}
+	start := h.Started
+	if tz != nil {
+		start = start.In(tz)
+	}
+	run.Started = start.Format("Jan 2 15:04:05")
+	switch {
+	case !h.Finished.IsZero():
+		run.Duration = h.Finished.Sub(h.Started).Round(time.Second).String()
+	case running[historyLookup{tag, h.LogIndex}]:
+		run.Duration = time.Since(h.Started).Round(time.Second).String()
+		run.Status = "running"
+	default:
+		run.Status = "unknown"
+	}
+	return run
+}
+
+func getPipeHistory(tag string) (pipeHistory, bool) {
+	var ph pipeHistory
+	_, exists, ret := checkoutDatum(histPrefix+tag, &ph, false)
+	return ph, ret == robot.Ok && exists
+}
+
+func handleHistoryJobs(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/history/" {
+		http.NotFound(rw, req)
+		return
+	}
+	currentCfg.RLock()
+	tasks := currentCfg.taskList
+	tz := currentCfg.timeZone
+	currentCfg.RUnlock()
+	running := runningLogs()
+	jobs := make([]historyWebJob, 0)
+	addJob := func(tag string, extended bool, ph pipeHistory) {
+		hj := historyWebJob{Tag: tag, Extended: extended, Runs: len(ph.Histories)}
+		if len(ph.Histories) > 0 {
+			last := describeRun(tag, ph.Histories[len(ph.Histories)-1], running, tz)
+			hj.LastStart = last.Started
+			hj.LastStatus = last.Status
+		}
+		jobs = append(jobs, hj)
+	}
+	names := make([]string, 0)
+	for _, t := range tasks.t[1:] {
+		if task, _, job := getTask(t); job != nil {
+			names = append(names, task.name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ph, ok := getPipeHistory(name)
+		if !ok {
+			continue
+		}
+		addJob(name, false, ph)
+		for _, tag := range extendedTags(name, ph) {
+			if eph, ok := getPipeHistory(tag); ok {
+				addJob(tag, true, eph)
+			}
+		}
+	}
+	renderHistoryPage(rw, "jobs", map[string]interface{}{"Jobs": jobs})
+}
+
+func handleHistoryRuns(rw http.ResponseWriter, req *http.Request) {
+	tag := req.URL.Query().Get("tag")
+	ph, ok := getPipeHistory(tag)
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+	currentCfg.RLock()
+	tz := currentCfg.timeZone
+	currentCfg.RUnlock()
+	running := runningLogs()
+	runs := make([]historyWebRun, 0, len(ph.Histories))
+	// newest first
+	for i := len(ph.Histories) - 1; i >= 0; i-- {
+		runs = append(runs, describeRun(tag, ph.Histories[i], running, tz))
+	}
+	renderHistoryPage(rw, "runs", map[string]interface{}{
+		"Tag":      tag,
+		"Extended": extendedTags(tag, ph),
+		"Runs":     runs,
+	})
+}
+
+func handleHistoryLog(rw http.ResponseWriter, req *http.Request) {
+	tag := req.URL.Query().Get("tag")
+	idx, err := strconv.Atoi(req.URL.Query().Get("run"))
+	if err != nil {
+		http.Error(rw, "invalid run", http.StatusBadRequest)
+		return
+	}
+	ph, ok := getPipeHistory(tag)
+	if !ok {
+		http.NotFound(rw, req)
+		return
+	}
+	found := false
+	for _, h := range ph.Histories {
+		if h.LogIndex == idx {
+			found = true
+			break
+		}
+	}
+	if !found {
+		http.NotFound(rw, req)
+		return
+	}
+	l, err := interfaces.history.GetLog(tag, idx)
+	if err != nil {
+		Log(robot.Error, "Reading log for '%s', run %d: %v", tag, idx, err)
+		http.NotFound(rw, req)
+		return
+	}
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(l)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	renderHistoryPage(rw, "log", map[string]interface{}{
+		"Tag":   tag,
+		"Run":   idx,
+		"Lines": lines,
+	})
+}
+
+func renderHistoryPage(rw http.ResponseWriter, page string, data map[string]interface{}) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := historyTemplates.ExecuteTemplate(rw, page, data); err != nil {
+		Log(robot.Error, "Rendering history page '%s': %v", page, err)
+	}
+}
+
+var historyTemplates = template.Must(template.New("history").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em; border-bottom: 1px solid #ddd; }
+td.extended { padding-left: 2.5em; }
+pre { background: #f6f6f6; padding: 1em; overflow-x: auto; }
+</style></head><body>
+{{end}}
+{{define "footer"}}</body></html>
+{{end}}
+{{define "jobs"}}{{template "header" "Job histories"}}
+<h1>Job histories</h1>
+{{if .Jobs}}<table>
+<tr><th>Job</th><th>Runs kept</th><th>Last started</th><th>Last status</th></tr>
+{{range .Jobs}}<tr><td{{if .Extended}} class="extended"{{end}}><a href="runs?tag={{.Tag}}">{{.Tag}}</a></td><td>{{.Runs}}</td><td>{{.LastStart}}</td><td>{{.LastStatus}}</td></tr>
+{{end}}</table>
+{{else}}<p>No job histories have been recorded.</p>{{end}}
+{{template "footer"}}{{end}}
+{{define "runs"}}{{template "header" .Tag}}
+<p><a href="./">Job histories</a></p>
+<h1>{{.Tag}}</h1>
+{{if .Extended}}<p>Extended namespaces: {{range .Extended}}<a href="runs?tag={{.}}">{{.}}</a> {{end}}</p>{{end}}
+{{if .Runs}}<table>
+<tr><th>Run</th><th>Ref</th><th>Branch</th><th>Started</th><th>Duration</th><th>Status</th></tr>
+{{range .Runs}}<tr><td><a href="log?tag={{$.Tag}}&amp;run={{.Index}}">{{.Index}}</a></td><td>{{.Ref}}</td><td>{{.Descriptor}}</td><td>{{.Started}}</td><td>{{.Duration}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>
+{{else}}<p>No runs have been kept.</p>{{end}}
+{{template "footer"}}{{end}}
+{{define "log"}}{{template "header" (printf "%s, run %d" .Tag .Run)}}
+<p><a href="./">Job histories</a> / <a href="runs?tag={{.Tag}}">{{.Tag}}</a></p>
+<h1>{{.Tag}}, run {{.Run}}</h1>
+<pre>{{range .Lines}}{{.}}
+{{end}}</pre>
+{{template "footer"}}{{end}}
+`))
+
+// historyWebHelp describes how to log in, for the token command
+func historyWebHelp(user, token string) string {
+	base := historyWebURL()
+	if len(base) == 0 {
+		return fmt.Sprintf("Your history web token is: %s\n(note: HistoryListen isn't set, so the history web UI isn't running)", token)
+	}
+	return fmt.Sprintf("Your history web token is: %s\nBrowse to %s/history/ and log in as '%s' with the token as the password", token, base, user)
+}
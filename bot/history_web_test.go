@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// setHistoryConfig installs a configuration for the history web UI
+func setHistoryConfig(t *testing.T, cfg *configuration) {
+	t.Helper()
+	currentCfg.Lock()
+	saved := currentCfg.configuration
+	currentCfg.configuration = cfg
+	currentCfg.Unlock()
+	t.Cleanup(func() {
+		currentCfg.Lock()
+		currentCfg.configuration = saved
+		currentCfg.Unlock()
+	})
+}
+
+func TestHistoryListenAddress(t *testing.T) {
+	cases := []struct {
+		listen string
+		useTLS bool
+		want   string
+	}{
+		{":8881", false, "localhost:8881"},
+		{":8881", true, ":8881"},
+		{"0.0.0.0:8881", false, "0.0.0.0:8881"},
+		{"127.0.0.1:8881", false, "127.0.0.1:8881"},
+		{"[::]:8881", false, "[::]:8881"},
+		{"bot.example.com:8881", false, "bot.example.com:8881"},
+		{"8881", false, "8881"},
+	}
+	for _, c := range cases {
+		if got := historyListenAddress(c.listen, c.useTLS); got != c.want {
+			t.Errorf("historyListenAddress(%q, %t): want %q, got %q", c.listen, c.useTLS, c.want, got)
+		}
+	}
+}
+
+func TestHistoryWebURL(t *testing.T) {
+	cases := []struct {
+		cfg  configuration
+		want string
+	}{
+		{configuration{}, ""},
+		{configuration{historyListen: ":8881"}, "http://localhost:8881"},
+		{configuration{historyListen: "10.0.0.5:8881"}, "http://10.0.0.5:8881"},
+		{configuration{historyListen: "bot.example.com:8443", historyTLSCert: "cert.pem"}, "https://bot.example.com:8443"},
+		{configuration{historyListen: ":8881", historyURL: "https://logs.example.com/"}, "https://logs.example.com"},
+	}
+	for _, c := range cases {
+		cfg := c.cfg
+		setHistoryConfig(t, &cfg)
+		if got := historyWebURL(); got != c.want {
+			t.Errorf("historyWebURL with listen %q: want %q, got %q", c.cfg.historyListen, c.want, got)
+		}
+	}
+}
+
+func TestCheckHistoryWebToken(t *testing.T) {
+	setupExpiryBrain(t)
+	go runBrain()
+	t.Cleanup(brainQuit)
+	setHistoryConfig(t, &configuration{adminUsers: []string{"alice", "carol"}})
+
+	token, err := newHistoryWebToken()
+	if err != nil {
+		t.Fatalf("generating token: %v", err)
+	}
+	if checkHistoryWebToken("alice", token) {
+		t.Errorf("token accepted with no tokens stored")
+	}
+	if ret := setHistoryWebToken("alice", token); ret != robot.Ok {
+		t.Fatalf("storing alice's token: %s", ret)
+	}
+	// bob was an admin when the token was issued
+	if ret := setHistoryWebToken("bob", token); ret != robot.Ok {
+		t.Fatalf("storing bob's token: %s", ret)
+	}
+	cases := []struct {
+		name  string
+		user  string
+		token string
+		want  bool
+	}{
+		{"valid", "alice", token, true},
+		{"wrong token", "alice", token + "x", false},
+		{"empty token", "alice", "", false},
+		{"no longer admin", "bob", token, false},
+		{"admin without token", "carol", token, false},
+		{"unknown user", "dave", token, false},
+	}
+	for _, c := range cases {
+		if got := checkHistoryWebToken(c.user, c.token); got != c.want {
+			t.Errorf("%s: want %t, got %t", c.name, c.want, got)
+		}
+	}
+	if ret := setHistoryWebToken("alice", ""); ret != robot.Ok {
+		t.Fatalf("removing alice's token: %s", ret)
+	}
+	if checkHistoryWebToken("alice", token) {
+		t.Errorf("removed token still accepted")
+	}
+}
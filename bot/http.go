@@ -5,12 +5,14 @@ package bot
 */
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 type jsonFunction struct {
@@ -53,6 +55,8 @@ type channelmessage struct {
 type taskcall struct {
 	Name    string
 	CmdArgs []string
+	Timeout string       // optional, e.g. "10m"
+	Retry   *RetryPolicy // optional
 }
 
 type cmdcall struct {
@@ -73,6 +77,7 @@ type wdcall struct {
 type shorttermmemory struct {
 	Key, Value string
 	Base64     bool
+	TTL        int // seconds, 0 for the default
 }
 
 // Something to be recalled from short-term memory
@@ -86,6 +91,7 @@ type memory struct {
 	Key   string
 	Token string
 	Datum json.RawMessage
+	TTL   int // seconds before the memory expires, 0 for never
 }
 
 // Something to be recalled from long term memory
@@ -113,6 +119,34 @@ type userchannelmessage struct {
 	Base64  bool
 }
 
+type threadmessage struct {
+	Message string
+	Base64  bool
+}
+
+type reaction struct {
+	Reaction string
+}
+
+type progressmessage struct {
+	Handle  string
+	Message string
+	Base64  bool
+}
+
+// Data is base64-encoded in JSON
+type filemessage struct {
+	User     string
+	Channel  string
+	Filename string
+	Title    string
+	Data     []byte
+}
+
+type fileid struct {
+	FileID string
+}
+
 type replyrequest struct {
 	RegexID string
 	User    string
@@ -121,6 +155,34 @@ type replyrequest struct {
 	Base64  bool
 }
 
+type choicerequest struct {
+	User    string
+	Channel string
+	Prompt  string
+	Choices []string
+	Base64  bool
+}
+
+// Timeout is a duration string, e.g. "30m"
+type approvalrequest struct {
+	AuthRequire string
+	Timeout     string
+	Request     string
+	Base64      bool
+}
+
+type datumprefix struct {
+	Prefix string
+}
+
+type datumkeys struct {
+	Keys []string
+}
+
+type brainlock struct {
+	Key string
+}
+
 type extns struct {
 	Extend    string
 	Histories int
@@ -151,11 +213,46 @@ type checkoutresponse struct {
 	RetVal    int
 }
 
+type listresponse struct {
+	Keys   []string
+	RetVal int
+}
+
+type dataresponse struct {
+	Data   map[string]json.RawMessage
+	RetVal int
+}
+
+type brainlocksresponse struct {
+	Locks  []lockInfo
+	Stats  []lockStat
+	RetVal int
+}
+
 type replyresponse struct {
 	Reply  string
 	RetVal int
 }
 
+type approvalresponse struct {
+	User   string
+	RetVal int
+}
+
+type progressresponse struct {
+	Handle string
+	RetVal int
+}
+
+type filesresponse struct {
+	Files []robot.FileInfo
+}
+
+type fileresponse struct {
+	Data   []byte
+	RetVal int
+}
+
 // decode decodes a base64 string, primarily for the bash library
 func decode(msg string) string {
 	decoded, err := base64.StdEncoding.DecodeString(msg)
@@ -201,8 +298,8 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	if f.CallerID == "" {
-		rw.WriteHeader(http.StatusBadRequest)
-		Log(robot.Error, "JSON function '%s' called with empty CallerID; args: %v", f.FuncName, f.FuncArgs)
+		rw.WriteHeader(http.StatusUnauthorized)
+		Log(robot.Audit, "Rejected JSON function '%s' called with empty CallerID", f.FuncName)
 		return
 	}
 
@@ -211,8 +308,14 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	r, ok := taskLookup.e[f.CallerID]
 	taskLookup.RUnlock()
 	if !ok {
-		rw.WriteHeader(http.StatusBadRequest)
-		Log(robot.Error, "JSON function '%s' called with invalid CallerID '%s'; args: %s", f.FuncName, f.CallerID, f.FuncArgs)
+		rw.WriteHeader(http.StatusUnauthorized)
+		Log(robot.Audit, "Rejected JSON function '%s' called with invalid CallerID '%s'", f.FuncName, f.CallerID)
+		return
+	}
+	if !checkCallerToken(f.CallerID, req) {
+		rw.WriteHeader(http.StatusUnauthorized)
+		task, _, _ := getTask(r.currentTask)
+		Log(robot.Audit, "Rejected JSON function '%s' for task '%s' with missing or invalid caller token", f.FuncName, task.name)
 		return
 	}
 	if len(f.Format) > 0 {
@@ -242,23 +345,46 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	case "GetRepoData":
 		sendReturn(rw, r.GetRepoData())
 		return
-	case "AddTask", "AddJob", "FinalTask", "FailTask", "SpawnJob":
+	case "AddTask", "AddParallelTask", "AddJob", "FinalTask", "FailTask", "SpawnJob":
 		var ts taskcall
 		if !getArgs(rw, &f.FuncArgs, &ts) {
 			return
 		}
 		var ret robot.RetVal
+		var tr robot.Robot = r
+		if len(ts.Timeout) > 0 {
+			d, err := time.ParseDuration(ts.Timeout)
+			if err != nil {
+				r.Log(robot.Error, "Invalid timeout '%s' adding task '%s': %v", ts.Timeout, ts.Name, err)
+				sendReturn(rw, &botretvalresponse{int(robot.DataFormatError)})
+				return
+			}
+			tr = tr.TaskTimeout(d)
+		}
+		if ts.Retry != nil {
+			retry, err := ts.Retry.parse()
+			if err != nil {
+				r.Log(robot.Error, "Invalid retry policy adding task '%s': %v", ts.Name, err)
+				sendReturn(rw, &botretvalresponse{int(robot.DataFormatError)})
+				return
+			}
+			if retry != nil {
+				tr = tr.TaskRetry(retry.attempts, retry.backoff, retry.retryOn...)
+			}
+		}
 		switch f.FuncName {
 		case "AddJob":
-			ret = r.AddJob(ts.Name, ts.CmdArgs...)
+			ret = tr.AddJob(ts.Name, ts.CmdArgs...)
 		case "AddTask":
-			ret = r.AddTask(ts.Name, ts.CmdArgs...)
+			ret = tr.AddTask(ts.Name, ts.CmdArgs...)
+		case "AddParallelTask":
+			ret = tr.AddParallelTask(ts.Name, ts.CmdArgs...)
 		case "FinalTask":
-			ret = r.FinalTask(ts.Name, ts.CmdArgs...)
+			ret = tr.FinalTask(ts.Name, ts.CmdArgs...)
 		case "FailTask":
-			ret = r.FailTask(ts.Name, ts.CmdArgs...)
+			ret = tr.FailTask(ts.Name, ts.CmdArgs...)
 		case "SpawnJob":
-			ret = r.SpawnJob(ts.Name, ts.CmdArgs...)
+			ret = tr.SpawnJob(ts.Name, ts.CmdArgs...)
 		default:
 			return
 		}
@@ -336,6 +462,22 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			RetVal:    int(brv),
 		})
 		return
+	case "ListDatum":
+		var p datumprefix
+		if !getArgs(rw, &f.FuncArgs, &p) {
+			return
+		}
+		keys, ret := r.ListDatum(p.Prefix)
+		sendReturn(rw, &listresponse{keys, int(ret)})
+		return
+	case "CheckoutData":
+		var k datumkeys
+		if !getArgs(rw, &f.FuncArgs, &k) {
+			return
+		}
+		data, ret := r.checkoutData(k.Keys)
+		sendReturn(rw, &dataresponse{data, int(ret)})
+		return
 	case "CheckinDatum":
 		var m memory
 		if !getArgs(rw, &f.FuncArgs, &m) {
@@ -354,7 +496,8 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		key = ns + ":" + m.Key
 		// Since we're getting raw JSON (=[]byte), we call update directly.
 		// See brain.go
-		ret = update(key, m.Token, (*[]byte)(&m.Datum))
+		expires := expiration(time.Duration(m.TTL) * time.Second)
+		ret = updateExpiring(key, m.Token, (*[]byte)(&m.Datum), expires)
 		sendReturn(rw, &botretvalresponse{int(ret)})
 		return
 	case "Remember":
@@ -366,7 +509,7 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			m.Key = decode(m.Key)
 			m.Value = decode(m.Value)
 		}
-		r.Remember(m.Key, m.Value)
+		r.RememberFor(m.Key, m.Value, time.Duration(m.TTL)*time.Second)
 		sendReturn(rw, &botretvalresponse{int(robot.Ok)})
 		return
 	case "Recall":
@@ -380,6 +523,28 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		s := r.Recall(m.Key)
 		sendReturn(rw, &stringresponse{s})
 		return
+	case "GetBrainLocks":
+		if !r.CheckAdmin() {
+			sendReturn(rw, &brainlocksresponse{RetVal: int(robot.PrivilegeViolation)})
+			return
+		}
+		sendReturn(rw, &brainlocksresponse{getBrainLocks(), getLockStats(), int(robot.Ok)})
+		return
+	case "ReleaseBrainLock":
+		var l brainlock
+		if !getArgs(rw, &f.FuncArgs, &l) {
+			return
+		}
+		if !r.CheckAdmin() {
+			sendReturn(rw, &boolretresponse{false, int(robot.PrivilegeViolation)})
+			return
+		}
+		released := releaseBrainLock(l.Key)
+		if released {
+			Log(robot.Audit, "Brain lock on '%s' force-released by user '%s' in task '%s'", l.Key, r.User, task.name)
+		}
+		sendReturn(rw, &boolretresponse{released, int(robot.Ok)})
+		return
 	case "GetTaskConfig":
 		if task.Config == nil {
 			Log(robot.Error, "GetTaskConfig called by external script '%s', but no config found.", task.name)
@@ -456,6 +621,88 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 			int(r.SendUserMessage(um.User, um.Message)),
 		})
 		return
+	case "SayThread", "ReplyThread":
+		var tm threadmessage
+		if !getArgs(rw, &f.FuncArgs, &tm) {
+			return
+		}
+		if tm.Base64 {
+			tm.Message = decode(tm.Message)
+		}
+		// Libraries clear the channel for direct messages
+		if len(f.Channel) == 0 {
+			ret = r.SendUserMessage(f.User, tm.Message)
+		} else if f.FuncName == "SayThread" {
+			ret = r.SayThread(tm.Message)
+		} else {
+			ret = r.ReplyThread(tm.Message)
+		}
+		sendReturn(rw, &botretvalresponse{int(ret)})
+		return
+	case "SayProgress", "UpdateProgress":
+		var pm progressmessage
+		if !getArgs(rw, &f.FuncArgs, &pm) {
+			return
+		}
+		if pm.Base64 {
+			pm.Message = decode(pm.Message)
+		}
+		// Libraries clear the channel for direct messages
+		if len(f.Channel) == 0 {
+			r.Channel = ""
+		}
+		handle := pm.Handle
+		if f.FuncName == "SayProgress" {
+			handle, ret = r.SayProgress(pm.Message)
+		} else {
+			ret = r.UpdateProgress(pm.Handle, pm.Message)
+		}
+		sendReturn(rw, &progressresponse{handle, int(ret)})
+		return
+	case "React", "Unreact":
+		var rc reaction
+		if !getArgs(rw, &f.FuncArgs, &rc) {
+			return
+		}
+		if f.FuncName == "React" {
+			ret = r.React(rc.Reaction)
+		} else {
+			ret = r.Unreact(rc.Reaction)
+		}
+		sendReturn(rw, &botretvalresponse{int(ret)})
+		return
+	case "SendFile", "SendChannelFile", "SendUserFile":
+		var fm filemessage
+		if !getArgs(rw, &f.FuncArgs, &fm) {
+			return
+		}
+		data := bytes.NewReader(fm.Data)
+		switch f.FuncName {
+		case "SendFile":
+			// Libraries clear the channel for direct messages
+			if len(f.Channel) == 0 {
+				r.Channel = ""
+			}
+			ret = r.SendFile(fm.Filename, fm.Title, data)
+		case "SendChannelFile":
+			ret = r.SendChannelFile(fm.Channel, fm.Filename, fm.Title, data)
+		case "SendUserFile":
+			ret = r.SendUserFile(fm.User, fm.Filename, fm.Title, data)
+		}
+		sendReturn(rw, &botretvalresponse{int(ret)})
+		return
+	case "GetAttachedFiles":
+		sendReturn(rw, &filesresponse{r.GetAttachedFiles()})
+		return
+	case "DownloadFile":
+		var fi fileid
+		if !getArgs(rw, &f.FuncArgs, &fi) {
+			return
+		}
+		var buf bytes.Buffer
+		ret = r.DownloadFile(fi.FileID, &buf)
+		sendReturn(rw, &fileresponse{buf.Bytes(), int(ret)})
+		return
 	case "PromptUserChannelForReply":
 		var rr replyrequest
 		if !getArgs(rw, &f.FuncArgs, &rr) {
@@ -464,11 +711,46 @@ func (h handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		if rr.Base64 {
 			rr.Prompt = decode(rr.Prompt)
 		}
-		reply, ret = r.promptInternal(rr.RegexID, rr.User, rr.Channel, rr.Prompt)
+		reply, ret = r.promptInternal(rr.RegexID, rr.User, rr.Channel, rr.Prompt, nil)
+		sendReturn(rw, &replyresponse{reply, int(ret)})
+		return
+	case "PromptUserChannelForChoice":
+		var cr choicerequest
+		if !getArgs(rw, &f.FuncArgs, &cr) {
+			return
+		}
+		if cr.Base64 {
+			cr.Prompt = decode(cr.Prompt)
+		}
+		if cr.Choices == nil {
+			cr.Choices = []string{}
+		}
+		reply, ret = r.promptInternal("", cr.User, cr.Channel, cr.Prompt, cr.Choices)
 		sendReturn(rw, &replyresponse{reply, int(ret)})
 		return
+	case "RequestApproval":
+		var ar approvalrequest
+		if !getArgs(rw, &f.FuncArgs, &ar) {
+			return
+		}
+		if ar.Base64 {
+			ar.Request = decode(ar.Request)
+		}
+		var timeout time.Duration
+		if len(ar.Timeout) > 0 {
+			d, err := time.ParseDuration(ar.Timeout)
+			if err != nil {
+				r.Log(robot.Error, "Invalid timeout '%s' requesting approval: %v", ar.Timeout, err)
+				sendReturn(rw, &approvalresponse{"", int(robot.ConfigurationError)})
+				return
+			}
+			timeout = d
+		}
+		user, tret := r.RequestApproval(ar.AuthRequire, timeout, ar.Request)
+		sendReturn(rw, &approvalresponse{user, int(tret)})
+		return
 	// NOTE: "Say", "Reply", PromptForReply and PromptUserForReply are implemented
-	// in the scripting libraries
+	// in the scripting libraries, as are PromptForChoice and PromptUserForChoice
 	default:
 		Log(robot.Error, "Bad function name: %s", f.FuncName)
 		rw.WriteHeader(http.StatusBadRequest)
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 /*
@@ -20,6 +22,13 @@ Job builtins are special:
 
 const histPageSize = 2048 // how much history to display at a time
 
+// limits for 'search logs', to keep the reply a reasonable size
+const (
+	searchContext    = 1   // lines of context before and after a match
+	searchMaxMatches = 10  // matches reported
+	searchMaxLine    = 160 // longer lines are truncated
+)
+
 func init() {
 	RegisterPlugin("builtin-history", robot.PluginHandler{Handler: jobhistory})
 	RegisterPlugin("builtin-jobcmd", robot.PluginHandler{Handler: jobcommands})
@@ -74,6 +83,10 @@ func jobcommands(m robot.Robot, command string, args ...string) (retval robot.Ta
 		} else {
 			r.Say("I don't have any repositories in my repositories.yaml")
 		}
+	case "approve":
+		decideApproval(r, true, args[0], "")
+	case "reject":
+		decideApproval(r, false, args[0], args[1])
 	}
 	return
 }
@@ -106,6 +119,94 @@ func emailhistory(r Robot, user, address, spec string, run int) (retval robot.Ta
 	return
 }
 
+// extendedTags returns the log tags for a build job's extended namespaces
+func extendedTags(job string, jh pipeHistory) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, ext := range jh.ExtendedNamespaces {
+		// extended namespaces are <repository>/<branch>
+		cmp := strings.Split(ext, "/")
+		tag := job + ":" + strings.Join(cmp[0:len(cmp)-1], "/")
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// searchlogs searches the kept logs for a job or repository; for a build
+// job, the logs for every repository it has built are searched.
+func searchlogs(r Robot, spec, pattern, histSpec string, jh pipeHistory) (retval robot.TaskRetVal) {
+	searcher, ok := interfaces.history.(robot.SearchableHistory)
+	if !ok {
+		r.Say("Sorry, the configured history provider doesn't support searching logs")
+		return
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		r.Say("Invalid regular expression '%s': %v", pattern, err)
+		return
+	}
+	tags := append([]string{histSpec}, extendedTags(histSpec, jh)...)
+	lines := []string{}
+	total := 0
+	for _, tag := range tags {
+		th := jh
+		if tag != histSpec {
+			th = pipeHistory{}
+			if _, _, ret := checkoutDatum(histPrefix+tag, &th, false); ret != robot.Ok {
+				continue
+			}
+		}
+		// search the newest logs first
+		logs := make(map[int]historyLog)
+		indexes := make([]int, 0, len(th.Histories))
+		for i := len(th.Histories) - 1; i >= 0; i-- {
+			logs[th.Histories[i].LogIndex] = th.Histories[i]
+			indexes = append(indexes, th.Histories[i].LogIndex)
+		}
+		matches, err := searcher.SearchLogs(tag, indexes, re, searchContext, searchMaxMatches-total)
+		if err != nil {
+			r.Log(robot.Error, "Searching logs for '%s': %v", tag, err)
+		}
+		for _, m := range matches {
+			log := logs[m.Index]
+			lines = append(lines, fmt.Sprintf("log %s - '%s' run #%d, %s:", log.Ref, tag, m.Index, log.CreateTime))
+			for i, l := range m.Before {
+				lines = append(lines, searchLine(" ", m.Line-len(m.Before)+i, l))
+			}
+			lines = append(lines, searchLine(">", m.Line, m.Text))
+			for i, l := range m.After {
+				lines = append(lines, searchLine(" ", m.Line+1+i, l))
+			}
+		}
+		total += len(matches)
+		if total >= searchMaxMatches {
+			break
+		}
+	}
+	if total == 0 {
+		r.Say("No lines matching '%s' found in the logs for '%s'", pattern, spec)
+		return
+	}
+	if total >= searchMaxMatches {
+		r.Say("Here are the first %d lines matching '%s' in the logs for '%s':", total, pattern, spec)
+	} else {
+		r.Say("Found %d lines matching '%s' in the logs for '%s':", total, pattern, spec)
+	}
+	r.Fixed().Say(strings.Join(lines, "\n"))
+	return
+}
+
+func searchLine(mark string, num int, line string) string {
+	if len(line) > searchMaxLine {
+		line = robot.TruncateString(line, searchMaxLine) + " ..."
+	}
+	return fmt.Sprintf("%s%6d: %s", mark, num, line)
+}
+
 func jobhistory(m robot.Robot, command string, args ...string) (retval robot.TaskRetVal) {
 	if command == "init" {
 		return
@@ -115,6 +216,7 @@ func jobhistory(m robot.Robot, command string, args ...string) (retval robot.Tas
 	w.Unlock()
 
 	var histRef, histSpec, jobName, buildSpec, branch, index, user, address string
+	var searchSpec, pattern string
 	var idx int
 
 	switch command {
@@ -129,6 +231,9 @@ func jobhistory(m robot.Robot, command string, args ...string) (retval robot.Tas
 	case "buildlogs":
 		buildSpec = args[0]
 		branch = args[1]
+	case "searchlogs":
+		searchSpec = args[0]
+		pattern = args[1]
 	}
 
 	if len(index) > 0 {
@@ -158,37 +263,19 @@ func jobhistory(m robot.Robot, command string, args ...string) (retval robot.Tas
 		idx = hl.Index
 	}
 
-	if len(buildSpec) > 0 {
-		found := false
-		var repospec robot.Repository
-		var reponame string
-		reponames := []string{}
-		for repo, spec := range r.repositories {
-			components := strings.Split(repo, "/")
-			if len(components) != 3 {
-				r.Log(robot.Warn, "Repository '%s' doesn't match <site>/<org>/<name>, skipping")
-				continue
-			}
-			org := components[1]
-			rname := components[2]
-			extname := strings.Join([]string{org, rname}, "/")
-			var compare string
-			switch len(strings.Split(buildSpec, "/")) {
-			case 1:
-				compare = rname
-			case 2:
-				compare = extname
-			case 3:
-				compare = repo
-			}
-			if buildSpec == compare {
-				found = true
-				repospec = spec
-				reponame = repo
-				reponames = append(reponames, reponame)
-			}
+	if command == "searchlogs" {
+		// the spec can be a job or a repository; jobs take precedence
+		_, isJob := r.tasks.nameMap[searchSpec]
+		if _, _, reponames := r.findRepository(searchSpec); !isJob && len(reponames) > 0 {
+			buildSpec = searchSpec
+		} else {
+			jobName = searchSpec
 		}
-		if !found {
+	}
+
+	if len(buildSpec) > 0 {
+		repospec, reponame, reponames := r.findRepository(buildSpec)
+		if len(reponames) == 0 {
 			r.Say("Repository matching '%s' not found", buildSpec)
 			return
 		}
@@ -222,6 +309,9 @@ func jobhistory(m robot.Robot, command string, args ...string) (retval robot.Tas
 		r.Say("No logs found for '%s'", histSpec)
 		return
 	}
+	if command == "searchlogs" {
+		return searchlogs(r, searchSpec, pattern, histSpec, jh)
+	}
 	if len(jh.ExtendedNamespaces) > 0 {
 		r.Say("Job '%s' is a build job, use 'buildlogs' instead", jobName)
 		return
@@ -285,6 +375,36 @@ func jobhistory(m robot.Robot, command string, args ...string) (retval robot.Tas
 	return
 }
 
+// findRepository looks up a repository from a build spec of <name>,
+// <org>/<name> or <site>/<org>/<name>, returning all matching repositories.
+func (r Robot) findRepository(buildSpec string) (repospec robot.Repository, reponame string, reponames []string) {
+	for repo, spec := range r.repositories {
+		components := strings.Split(repo, "/")
+		if len(components) != 3 {
+			r.Log(robot.Warn, "Repository '%s' doesn't match <site>/<org>/<name>, skipping", repo)
+			continue
+		}
+		org := components[1]
+		rname := components[2]
+		extname := strings.Join([]string{org, rname}, "/")
+		var compare string
+		switch len(strings.Split(buildSpec, "/")) {
+		case 1:
+			compare = rname
+		case 2:
+			compare = extname
+		case 3:
+			compare = repo
+		}
+		if buildSpec == compare {
+			repospec = spec
+			reponame = repo
+			reponames = append(reponames, reponame)
+		}
+	}
+	return
+}
+
 // jobSecurityCheck performs all security checks - RequireAdmin, Authorization
 // and Elevation - and returns true if passed. It will message the user and
 // return false if a check fails.
@@ -0,0 +1,23 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSearchLine(t *testing.T) {
+	if got := searchLine(">", 12, "short"); got != ">    12: short" {
+		t.Errorf("searchLine: want %q, got %q", ">    12: short", got)
+	}
+	// a multi-byte character straddles the searchMaxLine cut
+	line := strings.Repeat("a", searchMaxLine-1) + "é" + "tail"
+	got := searchLine(" ", 1, line)
+	if !utf8.ValidString(got) {
+		t.Errorf("searchLine split a multi-byte character: %q", got)
+	}
+	want := "      1: " + strings.Repeat("a", searchMaxLine-1) + " ..."
+	if got != want {
+		t.Errorf("searchLine: want %q, got %q", want, got)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 const runJobRegex = `run +job +(` + identifierRegex + `)(?: (.*))?`
@@ -21,6 +21,10 @@ func (w *worker) checkJobMatchersAndRun() (messageMatched bool) {
 	robots := []*worker{}
 	taskArgs := [][]string{}
 	var triggerArgs []string
+	var reaction string
+	if w.Incoming != nil {
+		reaction = w.Incoming.Reaction
+	}
 
 	// First, check triggers
 	for _, t := range w.tasks.t[1:] {
@@ -38,7 +42,12 @@ func (w *worker) checkJobMatchersAndRun() (messageMatched bool) {
 		triggers := job.Triggers
 		debugT(t, fmt.Sprintf("Checking %d JobTriggers against message: '%s' from user '%s' in channel '%s'", len(triggers), w.msg, w.User, w.Channel), false)
 		for _, trigger := range triggers {
-			Log(robot.Trace, "Checking '%s' against user '%s', channel '%s', regex: '%s'", w.msg, trigger.User, trigger.Channel, trigger.Regex)
+			// Reaction triggers only match reactions, and regex triggers
+			// only match messages
+			if trigger.Reaction != reaction {
+				continue
+			}
+			Log(robot.Trace, "Checking '%s' against user '%s', channel '%s', regex: '%s', reaction: '%s'", w.msg, trigger.User, trigger.Channel, trigger.Regex, trigger.Reaction)
 			if w.User != trigger.User {
 				debugT(t, fmt.Sprintf("User '%s' doesn't match trigger user '%s'", w.User, trigger.User), false)
 				continue
@@ -47,9 +56,13 @@ func (w *worker) checkJobMatchersAndRun() (messageMatched bool) {
 				debugT(t, fmt.Sprintf("Channel '%s' doesn't match trigger", w.Channel), false)
 				continue
 			}
-			matches := trigger.re.FindAllStringSubmatch(w.msg, -1)
 			matched := false
-			if matches != nil {
+			if len(reaction) > 0 {
+				debugT(t, fmt.Sprintf("Matched trigger reaction '%s'", trigger.Reaction), false)
+				Log(robot.Trace, "Reaction '%s' matches trigger for job '%s'", reaction, task.name)
+				matched = true
+				triggerArgs = []string{}
+			} else if matches := trigger.re.FindAllStringSubmatch(w.msg, -1); matches != nil {
 				debugT(t, fmt.Sprintf("Matched trigger regex '%s'", trigger.Regex), false)
 				Log(robot.Trace, "Message '%s' matches trigger for job '%s'", w.msg, task.name)
 				matched = true
@@ -128,7 +141,7 @@ func (w *worker) checkJobMatchersAndRun() (messageMatched bool) {
 			var args []string
 			// remember which job we're talking about
 			ctx := memoryContext{"context:task", w.User, w.Channel}
-			s := shortTermMemory{jname, time.Now()}
+			s := shortTermMemory{jname, time.Now(), 0}
 			shortTermMemories.Lock()
 			shortTermMemories.m[ctx] = s
 			shortTermMemories.Unlock()
@@ -159,7 +172,13 @@ func (w *worker) checkJobMatchersAndRun() (messageMatched bool) {
 					for i, argspec := range job.Arguments {
 						var t int
 						for t = 1; t < 3; t++ {
-							arg, ret := r.PromptForReply(argspec.Label, fmt.Sprintf("What's the value for '%s'?", argspec.Label))
+							var arg string
+							var ret robot.RetVal
+							if len(argspec.Choices) > 0 {
+								arg, ret = r.PromptForChoice(fmt.Sprintf("What's the value for '%s'?", argspec.Label), argspec.Choices)
+							} else {
+								arg, ret = r.PromptForReply(argspec.Label, fmt.Sprintf("What's the value for '%s'?", argspec.Label))
+							}
 							if ret == robot.ReplyNotMatched {
 								r.Say("That doesn't match the pattern for argument '%s'", argspec.Label)
 							} else {
@@ -4,13 +4,16 @@ package bot
 // active (un-Finalize()'d) histories in 64k buffers
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"sync"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 const logSize = 65536
@@ -52,6 +55,56 @@ func (m memlog) Line(line string) {
 	m.log.writeLine(line)
 }
 
+// Record writes a structured record to the buffer as a line of JSON; long
+// text is truncated until the encoded record fits in a line, so the record
+// is still valid JSON. Records are rendered as text when the log is read
+// with GetLog.
+func (m memlog) Record(rec robot.HistoryRecord) {
+	// the encoded record ends with a newline, which counts against the
+	// line length
+	b, err := encodeRecord(rec)
+	if err != nil {
+		Log(robot.Error, "Marshalling history record for '%s': %v", m.entry.tag, err)
+		return
+	}
+	if len(b) <= m.log.linesize {
+		m.log.writeLine(string(b))
+		return
+	}
+	// Escaping makes the encoded length depend on the text, so search for
+	// the longest prefix that fits.
+	text := rec.Text
+	var fits []byte
+	lo, hi := 0, len(text)
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		rec.Text = robot.TruncateString(text, mid) + mhc.Truncated
+		if b, err = encodeRecord(rec); err == nil && len(b) <= m.log.linesize {
+			fits = b
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	if fits == nil {
+		Log(robot.Error, "History record for '%s' doesn't fit in MaxLineLength %d, dropping", m.entry.tag, m.log.linesize)
+		return
+	}
+	m.log.writeLine(string(fits))
+}
+
+// encodeRecord marshals a record without escaping HTML characters, which
+// would otherwise take six bytes each in the log.
+func encodeRecord(rec robot.HistoryRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(rec); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // Close closes the log against further writes
 func (m memlog) Close() {
 	m.log.close()
@@ -85,8 +138,25 @@ func (h *memHistLog) MakeLogURL(tag string, index int) (string, bool) {
 	return "", false
 }
 
-// GetHistory returns a reader for the log if it exists
+// GetLog returns a reader for the log if it exists, with records rendered
+// as text
 func (h *memHistLog) GetLog(tag string, index int) (io.Reader, error) {
+	mr, err := h.GetRecords(tag, index)
+	if err != nil {
+		return nil, err
+	}
+	var text bytes.Buffer
+	scanner := bufio.NewScanner(mr)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text.WriteString(robot.FormatHistoryLine(scanner.Text()))
+		text.WriteByte('\n')
+	}
+	return &text, scanner.Err()
+}
+
+// GetRecords returns a reader for the log as stored, with records as JSON
+func (h *memHistLog) GetRecords(tag string, index int) (io.Reader, error) {
 	entry := memlogentry{tag, index}
 	memHistories.Lock()
 	defer memHistories.Unlock()
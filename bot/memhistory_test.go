@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+func TestMemlogRecordLength(t *testing.T) {
+	mhc = memHistoryConfig{BufferSize: 65536, MaxLineLength: 1024, Truncated: "<... truncated>"}
+	memHistories = &memHistLog{logs: make(map[memlogentry]memlog)}
+	hl, _ := memHistories.NewLog("test", 1, 1)
+	ml := hl.(memlog)
+
+	texts := []string{
+		"short line",
+		strings.Repeat("x", 2000),
+		// each escapes to six bytes with the default encoder
+		strings.Repeat("<&>", 700),
+		// control characters are always escaped
+		strings.Repeat("\x01", 900),
+		strings.Repeat("é世", 500),
+		strings.Repeat(`"\`, 600),
+	}
+	for _, text := range texts {
+		ml.Record(robot.HistoryRecord{Task: "test-task", Stream: robot.StreamOut, Text: text})
+	}
+
+	mr, err := memHistories.GetRecords("test", 1)
+	if err != nil {
+		t.Fatalf("GetRecords: %v", err)
+	}
+	scanner := bufio.NewScanner(mr)
+	n := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line)+1 > mhc.MaxLineLength {
+			t.Errorf("record %d is %d bytes, over MaxLineLength", n, len(line))
+		}
+		rec, ok := robot.ParseHistoryRecord(line)
+		if !ok {
+			t.Errorf("record %d isn't valid: %.60q", n, line)
+			n++
+			continue
+		}
+		if !utf8.ValidString(rec.Text) {
+			t.Errorf("record %d text has a split character", n)
+		}
+		want := texts[n]
+		if len(want)+200 > mhc.MaxLineLength {
+			if !strings.HasSuffix(rec.Text, mhc.Truncated) {
+				t.Errorf("record %d: long text not marked truncated", n)
+			}
+			want = strings.TrimSuffix(rec.Text, mhc.Truncated)
+			if !strings.HasPrefix(texts[n], want) || len(want) == 0 {
+				t.Errorf("record %d: truncated text isn't a prefix of the original", n)
+			}
+			// no more is cut than needed, give or take an escaped character
+			if len(line)+1 < mhc.MaxLineLength-6 {
+				t.Errorf("record %d: truncated to %d bytes, more than needed", n, len(line))
+			}
+		} else if rec.Text != want {
+			t.Errorf("record %d: want %q, got %q", n, want, rec.Text)
+		}
+		n++
+	}
+	if n != len(texts) {
+		t.Errorf("want %d records, got %d", len(texts), n)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"path/filepath"
 	"plugin"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // Loadable modules can still be compiled in to the binary. When
@@ -38,52 +38,79 @@ func loadModules(protocol, brain, history string, modules []LoadableModule) {
 	}
 }
 
+// loadBrainModule loads the module for a brain other than the configured
+// brain, after registrations have stopped; used by the migrate-brain CLI
+// command. Only the brain provider is registered.
+func loadBrainModule(brain string) {
+	path := filepath.Join("brains", brain+".so")
+	pm, ok := openModule(brain, path)
+	if !ok {
+		return
+	}
+	if len(pm.Brain.Name) > 0 && pm.Brain.Brain != nil {
+		if _, exists := brains[pm.Brain.Name]; !exists {
+			Log(robot.Info, "Registering brain '%s' from loadable module '%s'", brain, path)
+			brains[pm.Brain.Name] = pm.Brain.Brain
+		}
+	}
+}
+
 // loadModule loads a module and registers it's contents
 func loadModule(name, path string) {
+	pm, ok := openModule(name, path)
+	if !ok {
+		return
+	}
+	for _, tspec := range pm.Tasks {
+		Log(robot.Info, "Registering task '%s' from loadable module '%s'", tspec.Name, path)
+		RegisterTask(tspec.Name, tspec.RequiresPrivilege, tspec.Handler)
+	}
+	for _, pspec := range pm.Plugins {
+		Log(robot.Info, "Registering plugin '%s' from loadable module '%s'", pspec.Name, path)
+		RegisterPlugin(pspec.Name, pspec.Handler)
+	}
+	for _, jspec := range pm.Jobs {
+		Log(robot.Info, "Registering job '%s' from loadable module '%s'", jspec.Name, path)
+		RegisterJob(jspec.Name, jspec.Handler)
+	}
+	if len(pm.Connector.Name) > 0 && pm.Connector.Connector != nil {
+		Log(robot.Info, "Registering connector '%s' from loadable module '%s'", name, path)
+		RegisterConnector(pm.Connector.Name, pm.Connector.Connector)
+	}
+	if len(pm.Brain.Name) > 0 && pm.Brain.Brain != nil {
+		Log(robot.Info, "Registering brain '%s' from loadable module '%s'", name, path)
+		RegisterSimpleBrain(pm.Brain.Name, pm.Brain.Brain)
+	}
+	if len(pm.History.Name) > 0 && pm.History.Provider != nil {
+		Log(robot.Info, "Registering history '%s' from loadable module '%s'", name, path)
+		RegisterHistoryProvider(pm.History.Name, pm.History.Provider)
+	}
+}
+
+// openModule opens a loadable module and returns it's manifest; ok is false
+// if the module was already loaded or compiled in, or couldn't be loaded.
+func openModule(name, path string) (pm robot.Manifest, ok bool) {
 	if _, ok := preloaded[path]; ok {
 		Log(robot.Debug, "Skipping load of already loaded or compiled in module: %s", path)
-		return
+		return pm, false
 	}
 	preloaded[path] = struct{}{}
 	lp, err := getObjectPath(path)
 	if err != nil {
 		Log(robot.Warn, "Unable to locate loadable module '%s' from path '%s'", name, path)
-		return
+		return pm, false
 	}
-	if k, err := plugin.Open(lp); err == nil {
-		Log(robot.Info, "Loaded module '%s': %s", name, path)
-		// look for manifest and register everything
-		if gp, err := k.Lookup("GetManifest"); err == nil {
-			gf := gp.(func() robot.Manifest)
-			pm := gf()
-			for _, tspec := range pm.Tasks {
-				Log(robot.Info, "Registering task '%s' from loadable module '%s'", tspec.Name, path)
-				RegisterTask(tspec.Name, tspec.RequiresPrivilege, tspec.Handler)
-			}
-			for _, pspec := range pm.Plugins {
-				Log(robot.Info, "Registering plugin '%s' from loadable module '%s'", pspec.Name, path)
-				RegisterPlugin(pspec.Name, pspec.Handler)
-			}
-			for _, jspec := range pm.Jobs {
-				Log(robot.Info, "Registering job '%s' from loadable module '%s'", jspec.Name, path)
-				RegisterJob(jspec.Name, jspec.Handler)
-			}
-			if len(pm.Connector.Name) > 0 && pm.Connector.Connector != nil {
-				Log(robot.Info, "Registering connector '%s' from loadable module '%s'", name, path)
-				RegisterConnector(pm.Connector.Name, pm.Connector.Connector)
-			}
-			if len(pm.Brain.Name) > 0 && pm.Brain.Brain != nil {
-				Log(robot.Info, "Registering brain '%s' from loadable module '%s'", name, path)
-				RegisterSimpleBrain(pm.Brain.Name, pm.Brain.Brain)
-			}
-			if len(pm.History.Name) > 0 && pm.History.Provider != nil {
-				Log(robot.Info, "Registering history '%s' from loadable module '%s'", name, path)
-				RegisterHistoryProvider(pm.History.Name, pm.History.Provider)
-			}
-		} else {
-			Log(robot.Debug, "Symbol 'GetManifest' not found in loadable module '%s'", path)
-		}
-	} else {
+	k, err := plugin.Open(lp)
+	if err != nil {
 		Log(robot.Error, "Loading module '%s': %v", lp, err)
+		return pm, false
+	}
+	Log(robot.Info, "Loaded module '%s': %s", name, path)
+	gp, err := k.Lookup("GetManifest")
+	if err != nil {
+		Log(robot.Debug, "Symbol 'GetManifest' not found in loadable module '%s'", path)
+		return pm, false
 	}
+	gf := gp.(func() robot.Manifest)
+	return gf(), true
 }
@@ -0,0 +1,151 @@
+package bot
+
+/* parallel.go - parallel task groups, for running several tasks at the same
+   time within a single pipeline, e.g. building several targets or scanning
+   several hosts. Each member of a group runs in its own worker, so it shows
+   up in 'ps' and can be killed, with a snapshot of the pipeline environment.
+*/
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// groupLogger labels history written by a member of a parallel group; the
+// log belongs to the pipeline, so members can't close it.
+type groupLogger struct {
+	robot.HistoryLogger
+	label string
+}
+
+func (gl groupLogger) Log(line string) {
+	gl.HistoryLogger.Log("[" + gl.label + "] " + line)
+}
+
+func (gl groupLogger) Line(line string) {
+	gl.HistoryLogger.Line("[" + gl.label + "] " + line)
+}
+
+func (gl groupLogger) Record(rec robot.HistoryRecord) {
+	rec.Task = gl.label
+	switch rec.Stream {
+	case robot.StreamSection, robot.StreamStart:
+		rec.Text = "[" + gl.label + "] " + rec.Text
+	}
+	logRecord(gl.HistoryLogger, rec)
+}
+
+func (gl groupLogger) Close() {}
+
+func (gl groupLogger) Finalize() {}
+
+// parallelMember creates and registers the worker for a member of a
+// parallel group.
+func (w *worker) parallelMember(env map[string]string, label string) *worker {
+	m := w.clone()
+	w.Lock()
+	c := m.pipeContext
+	for k, v := range env {
+		c.environment[k] = v
+	}
+	c.workingDirectory = w.workingDirectory
+	c.baseDirectory = w.baseDirectory
+	c.runIndex = w.runIndex
+	c.histName = w.histName
+	c.verbose = w.verbose
+	c.privileged = w.privileged
+	c.timeZone = w.timeZone
+	if w.logger != nil {
+		c.logger = groupLogger{w.logger, label}
+	}
+	c.stage = w.stage
+	c.jobInitialized = w.jobInitialized
+	c.jobName = w.jobName
+	c.nameSpace = w.nameSpace
+	c.nsExtension = w.nsExtension
+	c.exclusive = w.exclusive
+	c.exclusiveTag = w.exclusiveTag
+	c.parallel = true
+	w.Unlock()
+	m.registerActive(w)
+	return m
+}
+
+// runParallel runs the members of a parallel group at the same time, and
+// waits for all of them to finish. The group fails with the first member
+// (in the order added) that failed.
+func (w *worker) runParallel(group []TaskSpec) (ret robot.TaskRetVal, errString string) {
+	labels := make([]string, len(group))
+	for i, ts := range group {
+		labels[i] = fmt.Sprintf("%s#%d", ts.Name, i+1)
+	}
+	w.Lock()
+	w.taskName = "parallel"
+	w.taskDesc = "parallel task group"
+	w.taskType = "group"
+	w.taskClass = ""
+	w.plugCommand = ""
+	w.taskArgs = labels
+	env := make(map[string]string)
+	for k, v := range w.environment {
+		env[k] = v
+	}
+	w.Unlock()
+	w.section("parallel", fmt.Sprintf("starting %d tasks in parallel: %s", len(group), strings.Join(labels, ", ")))
+
+	results := make([]taskReturn, len(group))
+	var wg sync.WaitGroup
+	for i, ts := range group {
+		m := w.parallelMember(env, labels[i])
+		wg.Add(1)
+		go func(i int, ts TaskSpec) {
+			defer wg.Done()
+			task, _, _ := getTask(ts.task)
+			m.Lock()
+			m.taskName = task.name
+			m.taskDesc = task.Description
+			m.taskType = "task"
+			m.taskArgs = ts.Arguments
+			if task.taskType == taskGo {
+				m.taskClass = "Go"
+			} else {
+				m.taskClass = "Ext"
+			}
+			m.Unlock()
+			es, r := m.callTaskRetry(ts)
+			results[i] = taskReturn{es, r}
+			m.deregister()
+		}(i, ts)
+	}
+	wg.Wait()
+
+	var failed []string
+	failedIdx := -1
+	for i, res := range results {
+		if res.retval != robot.Normal {
+			failed = append(failed, labels[i])
+			if failedIdx == -1 {
+				failedIdx = i
+			}
+		}
+	}
+	if failedIdx == -1 {
+		w.section("parallel", fmt.Sprintf("all %d parallel tasks finished normally", len(group)))
+		return
+	}
+	w.section("parallel", fmt.Sprintf("%d of %d parallel tasks failed: %s", len(failed), len(group), strings.Join(failed, ", ")))
+	ts := group[failedIdx]
+	task, _, _ := getTask(ts.task)
+	ret, errString = results[failedIdx].retval, results[failedIdx].errString
+	// Report the first failed member as the task the pipeline failed in
+	w.Lock()
+	w.taskName = task.name
+	w.taskDesc = task.Description
+	w.taskType = "task"
+	w.taskArgs = ts.Arguments
+	w.Unlock()
+	return
+}
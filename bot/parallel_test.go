@@ -0,0 +1,228 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// setupParallelTasks returns a task list with a Go task for each handler,
+// and a worker running a pipeline that can use them.
+func setupParallelTasks(t *testing.T, handlers map[string]robot.TaskHandler) *worker {
+	t.Helper()
+	tl := &taskList{
+		t:       []interface{}{&Task{name: "(namespaces)"}},
+		nameMap: make(map[string]int),
+		idMap:   make(map[string]int),
+	}
+	for name, handler := range handlers {
+		tl.nameMap[name] = len(tl.t)
+		tl.t = append(tl.t, &Task{name: name, taskType: taskGo})
+		taskHandlers[name] = handler
+	}
+	w := &worker{
+		id:    getWorkerID(),
+		cfg:   &configuration{},
+		tasks: tl,
+		maps:  &userChanMaps{},
+	}
+	w.pipeContext = &pipeContext{
+		environment: make(map[string]string),
+		pipeName:    "parallel-test",
+		jobName:     "parallel-test",
+		nameSpace:   "parallel-test",
+		stage:       primaryTasks,
+	}
+	w.registerActive(nil)
+	t.Cleanup(func() {
+		w.deregister()
+		for name := range handlers {
+			delete(taskHandlers, name)
+		}
+	})
+	return w
+}
+
+// pipelineRobot returns a Robot for a task running in the worker's pipeline
+func pipelineRobot(t *testing.T, w *worker) Robot {
+	t.Helper()
+	r := w.makeRobot()
+	w.registerWorker(r.tid)
+	t.Cleanup(func() { deregisterWorker(r.tid) })
+	return r
+}
+
+func normalTask(r robot.Robot, args ...string) robot.TaskRetVal {
+	return robot.Normal
+}
+
+func TestParallelGrouping(t *testing.T) {
+	w := setupParallelTasks(t, map[string]robot.TaskHandler{
+		"a": {Handler: normalTask},
+		"b": {Handler: normalTask},
+		"c": {Handler: normalTask},
+		"d": {Handler: normalTask},
+	})
+	r := pipelineRobot(t, w)
+	for _, add := range []struct {
+		parallel bool
+		name     string
+	}{
+		{true, "a"},
+		{true, "b"},
+		{false, "c"},
+		{true, "d"},
+		{true, "a"},
+		{false, "b"},
+	} {
+		var ret robot.RetVal
+		if add.parallel {
+			ret = r.AddParallelTask(add.name)
+		} else {
+			ret = r.AddTask(add.name)
+		}
+		if ret != robot.Ok {
+			t.Fatalf("adding '%s' (parallel %t): %s", add.name, add.parallel, ret)
+		}
+	}
+
+	want := [][]string{{"a", "b"}, {"c"}, {"d", "a"}, {"b"}}
+	w.Lock()
+	got := w.nextTasks
+	w.Unlock()
+	if len(got) != len(want) {
+		t.Fatalf("want %d pipeline entries, got %d", len(want), len(got))
+	}
+	for i, ts := range got {
+		if len(want[i]) == 1 {
+			if ts.group != nil || ts.Name != want[i][0] {
+				t.Errorf("entry %d: want task '%s', got %+v", i, want[i][0], ts)
+			}
+			continue
+		}
+		if len(ts.group) != len(want[i]) {
+			t.Errorf("entry %d: want group %v, got %+v", i, want[i], ts)
+			continue
+		}
+		for j, member := range ts.group {
+			if member.Name != want[i][j] {
+				t.Errorf("entry %d member %d: want '%s', got '%s'", i, j, want[i][j], member.Name)
+			}
+		}
+	}
+}
+
+func TestParallelFirstFailure(t *testing.T) {
+	// Every member waits until all of them are running, so the group only
+	// finishes if they run at the same time.
+	var started sync.WaitGroup
+	started.Add(4)
+	allStarted := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(allStarted)
+	}()
+	member := func(ret robot.TaskRetVal, delay time.Duration) robot.TaskHandler {
+		return robot.TaskHandler{Handler: func(r robot.Robot, args ...string) robot.TaskRetVal {
+			started.Done()
+			select {
+			case <-allStarted:
+			case <-time.After(5 * time.Second):
+				return robot.MechanismFail
+			}
+			time.Sleep(delay)
+			return ret
+		}}
+	}
+	w := setupParallelTasks(t, map[string]robot.TaskHandler{
+		"ok":       member(robot.Normal, 0),
+		"slowfail": member(robot.ConfigurationError, 50*time.Millisecond),
+		"fastfail": member(robot.Fail, 0),
+		"ok2":      member(robot.Normal, 0),
+	})
+	var group []TaskSpec
+	for _, name := range []string{"ok", "slowfail", "fastfail", "ok2"} {
+		group = append(group, TaskSpec{Name: name, Command: "run", task: w.tasks.getTaskByName(name)})
+	}
+
+	ret, _ := w.runParallel(group)
+	// slowfail finishes last, but was added before fastfail
+	if ret != robot.ConfigurationError {
+		t.Errorf("want the group to fail with ConfigurationError, got %s", ret)
+	}
+	w.Lock()
+	taskName := w.taskName
+	w.Unlock()
+	if taskName != "slowfail" {
+		t.Errorf("want the pipeline to fail in 'slowfail', got '%s'", taskName)
+	}
+
+	activePipelines.Lock()
+	for _, aw := range activePipelines.i {
+		if aw._parent == w {
+			t.Errorf("member worker %d still registered after the group finished", aw.id)
+		}
+	}
+	activePipelines.Unlock()
+
+}
+
+func TestParallelMemberRestrictions(t *testing.T) {
+	var mu sync.Mutex
+	results := make(map[string]interface{})
+	w := setupParallelTasks(t, map[string]robot.TaskHandler{
+		"ok": {Handler: normalTask},
+		"member": {Handler: func(r robot.Robot, args ...string) robot.TaskRetVal {
+			add := r.AddTask("ok")
+			addParallel := r.AddParallelTask("ok")
+			fail := r.FailTask("ok")
+			excl := r.(Robot).Exclusive("", false)
+			ext := r.(Robot).ExtendNamespace("branch", 1)
+			param := r.SetParameter("MEMBER_PARAM", "lost")
+			mu.Lock()
+			results["AddTask"] = add
+			results["AddParallelTask"] = addParallel
+			results["FailTask"] = fail
+			results["Exclusive"] = excl
+			results["ExtendNamespace"] = ext
+			results["SetParameter"] = param
+			mu.Unlock()
+			return robot.Normal
+		}},
+	})
+	group := []TaskSpec{{Name: "member", Command: "run", task: w.tasks.getTaskByName("member")}}
+	if ret, _ := w.runParallel(group); ret != robot.Normal {
+		t.Fatalf("member failed: %s", ret)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, call := range []string{"AddTask", "AddParallelTask", "FailTask"} {
+		if got := results[call]; got != robot.InvalidStage {
+			t.Errorf("%s in a member: want InvalidStage, got %v", call, got)
+		}
+	}
+	for _, call := range []string{"Exclusive", "ExtendNamespace"} {
+		if got := results[call]; got != false {
+			t.Errorf("%s in a member: want false, got %v", call, got)
+		}
+	}
+	w.Lock()
+	defer w.Unlock()
+	if len(w.nextTasks) != 0 || len(w.failTasks) != 0 {
+		t.Errorf("member modified the pipeline: next %+v, fail %+v", w.nextTasks, w.failTasks)
+	}
+	if w.exclusive {
+		t.Errorf("member took an exclusive lock for the pipeline")
+	}
+	// SetParameter succeeds in the member's copy of the environment, but
+	// doesn't reach the pipeline
+	if results["SetParameter"] != true {
+		t.Errorf("SetParameter in a member failed")
+	}
+	if _, ok := w.environment["MEMBER_PARAM"]; ok {
+		t.Errorf("parameter set in a member reached the pipeline environment")
+	}
+}
@@ -12,11 +12,12 @@ func _() {
 	_ = x[flavorAdd-1]
 	_ = x[flavorFinal-2]
 	_ = x[flavorFail-3]
+	_ = x[flavorParallel-4]
 }
 
-const _pipeAddFlavor_name = "flavorSpawnflavorAddflavorFinalflavorFail"
+const _pipeAddFlavor_name = "flavorSpawnflavorAddflavorFinalflavorFailflavorParallel"
 
-var _pipeAddFlavor_index = [...]uint8{0, 11, 20, 31, 41}
+var _pipeAddFlavor_index = [...]uint8{0, 11, 20, 31, 41, 55}
 
 func (i pipeAddFlavor) String() string {
 	if i < 0 || i >= pipeAddFlavor(len(_pipeAddFlavor_index)-1) {
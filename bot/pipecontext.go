@@ -7,7 +7,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 /* pipeContext.go - internal methods on pipeContexts
@@ -56,9 +56,7 @@ var activePipelines = struct {
 func (w *worker) registerActive(parent *worker) {
 	// Only needed for bots not created by IncomingMessage
 	if w.maps == nil {
-		currentUCMaps.Lock()
-		w.maps = currentUCMaps.ucmap
-		currentUCMaps.Unlock()
+		w.maps = getUCMaps(w.Protocol)
 	}
 	if len(w.ProtocolUser) == 0 && len(w.User) > 0 {
 		if idRegex.MatchString(w.User) {
@@ -140,10 +138,19 @@ type pipeContext struct {
 	taskClass        string            // one of Go, Ext
 	plugCommand      string            // plugin command if type=plugin, else blank
 	taskArgs         []string          // args for current task
+	taskAttempt      int               // attempt number for a task being retried
+	taskAttempts     int               // max attempts for same, 0 when not retrying
+	retryAbort       chan struct{}     // closed by 'kill' to stop waiting for a retry
+	approvalAbort    chan struct{}     // closed by 'kill' to cancel a pending approval request
 	osCmd            *exec.Cmd         // running Command, for aborting a pipeline
 	exclusiveTag     string            // tasks with the same exclusiveTag never run at the same time
 	queueTask        bool              // whether to queue up if Exclusive call failed
 	abortPipeline    bool              // Exclusive request failed w/o queueTask
+	threads          map[string]string // thread IDs for *Thread messages, by protocol channel
+	threadLock       sync.Mutex        // held while sending *Thread messages, so only one task starts a thread
+	// Progress messages, by handle, for UpdateProgress
+	progress     map[string]*progressMessage
+	lastProgress string // handle of the most recent progress message
 	// Stuff we want to copy in makeRobot
 	privileged         bool                // privileged jobs flip this flag, causing tasks in the pipeline to run in cfgdir
 	timeZone           *time.Location      // for history timestamping
@@ -158,10 +165,11 @@ type pipeContext struct {
 	nsExtension        string              // extended namespace
 	currentTask        interface{}         // pointer to currently executing task
 	exclusive          bool                // indicates task was running exclusively
+	parallel           bool                // member of a parallel group, can't modify the pipeline
 }
 
 func (c *pipeContext) section(name, info string) {
 	if c.logger != nil {
-		c.logger.Line("*** " + name + " - " + info)
+		logRecord(c.logger, robot.HistoryRecord{Stream: robot.StreamSection, Text: name + " - " + info})
 	}
 }
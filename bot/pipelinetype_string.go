@@ -16,11 +16,12 @@ func _() {
 	_ = x[spawnedTask-5]
 	_ = x[scheduled-6]
 	_ = x[jobCommand-7]
+	_ = x[webhook-8]
 }
 
-const _pipelineType_name = "unsetplugCommandplugMessagecatchAlljobTriggerspawnedTaskscheduledjobCommand"
+const _pipelineType_name = "unsetplugCommandplugMessagecatchAlljobTriggerspawnedTaskscheduledjobCommandwebhook"
 
-var _pipelineType_index = [...]uint8{0, 5, 16, 27, 35, 45, 56, 65, 75}
+var _pipelineType_index = [...]uint8{0, 5, 16, 27, 35, 45, 56, 65, 75, 82}
 
 func (i pipelineType) String() string {
 	if i < 0 || i >= pipelineType(len(_pipelineType_index)-1) {
@@ -3,10 +3,12 @@ package bot
 import (
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 /* Technical notes on the waiter implementation
@@ -50,7 +52,8 @@ type replyWaiter struct {
 
 // a reply matcher is used as the key in the replys map
 type replyMatcher struct {
-	user, channel string // Only one reply at a time can be requested for a given user/channel combination
+	protocol      robot.Protocol // The connector the user and channel belong to
+	user, channel string         // Only one reply at a time can be requested for a given user/channel combination
 }
 
 // a reply is sent over the replyWaiter channel when a user replies
@@ -126,7 +129,7 @@ func (r Robot) PromptForReply(regexID string, prompt string, v ...interface{}) (
 		prompt = fmt.Sprintf(prompt, v...)
 	}
 	for i := 0; i < 3; i++ {
-		rep, ret = r.promptInternal(regexID, r.User, r.Channel, prompt)
+		rep, ret = r.promptInternal(regexID, r.User, r.Channel, prompt, nil)
 		if ret == robot.RetryPrompt {
 			continue
 		}
@@ -147,7 +150,7 @@ func (r Robot) PromptUserForReply(regexID string, user string, prompt string, v
 		prompt = fmt.Sprintf(prompt, v...)
 	}
 	for i := 0; i < 3; i++ {
-		rep, ret = r.promptInternal(regexID, user, "", prompt)
+		rep, ret = r.promptInternal(regexID, user, "", prompt, nil)
 		if ret == robot.RetryPrompt {
 			continue
 		}
@@ -168,7 +171,7 @@ func (r Robot) PromptUserChannelForReply(regexID string, user string, channel st
 		prompt = fmt.Sprintf(prompt, v...)
 	}
 	for i := 0; i < 3; i++ {
-		rep, ret = r.promptInternal(regexID, user, channel, prompt)
+		rep, ret = r.promptInternal(regexID, user, channel, prompt, nil)
 		if ret == robot.RetryPrompt {
 			continue
 		}
@@ -180,16 +183,105 @@ func (r Robot) PromptUserChannelForReply(regexID string, user string, channel st
 	return rep, ret
 }
 
-// promptInternal can return 'RetryPrompt'
-func (r Robot) promptInternal(regexID string, user string, channel string, prompt string) (string, robot.RetVal) {
+// PromptForChoice is like PromptForReply, but offers the user a fixed set
+// of choices; connectors that support it show the choices as buttons or a
+// menu, otherwise the choices are listed with numbers. The user can reply
+// with the number or the text of a choice, and the text of the choice is
+// returned. Returns the same RetVals as PromptForReply.
+func (r Robot) PromptForChoice(prompt string, choices []string) (string, robot.RetVal) {
+	return r.promptChoice(r.User, r.Channel, prompt, choices)
+}
+
+// PromptUserForChoice is identical to PromptForChoice, but prompts a
+// specific user with a DM.
+func (r Robot) PromptUserForChoice(user string, prompt string, choices []string) (string, robot.RetVal) {
+	return r.promptChoice(user, "", prompt, choices)
+}
+
+// PromptUserChannelForChoice is identical to PromptForChoice, but prompts a
+// specific user in a given channel.
+func (r Robot) PromptUserChannelForChoice(user string, channel string, prompt string, choices []string) (string, robot.RetVal) {
+	return r.promptChoice(user, channel, prompt, choices)
+}
+
+func (r Robot) promptChoice(user string, channel string, prompt string, choices []string) (string, robot.RetVal) {
+	var rep string
+	var ret robot.RetVal
+	for i := 0; i < 3; i++ {
+		rep, ret = r.promptInternal("", user, channel, prompt, choices)
+		if ret == robot.RetryPrompt {
+			continue
+		}
+		return rep, ret
+	}
+	if ret == robot.RetryPrompt {
+		return rep, robot.Interrupted
+	}
+	return rep, ret
+}
+
+// choiceRegex returns a regex matching the text or number of any of the
+// choices.
+func choiceRegex(choices []string) (*regexp.Regexp, error) {
+	alts := make([]string, 0, 2*len(choices))
+	for i, choice := range choices {
+		alts = append(alts, strconv.Itoa(i+1), regexp.QuoteMeta(choice))
+	}
+	return regexp.Compile(`^\s*(?i:` + strings.Join(alts, "|") + `)\s*$`)
+}
+
+// getChoice returns the choice the user replied with; exact matches of the
+// text take precedence over numbers, in case choices are numbers.
+func getChoice(rep string, choices []string) string {
+	rep = strings.TrimSpace(rep)
+	for _, choice := range choices {
+		if strings.EqualFold(rep, choice) {
+			return choice
+		}
+	}
+	for i, choice := range choices {
+		if rep == strconv.Itoa(i+1) {
+			return choice
+		}
+	}
+	return rep
+}
+
+// choiceList formats a prompt with numbered choices, for connectors that
+// don't implement robot.ChoiceConnector
+func choiceList(prompt string, choices []string) string {
+	lines := make([]string, 0, len(choices)+1)
+	lines = append(lines, prompt)
+	for i, choice := range choices {
+		lines = append(lines, fmt.Sprintf("%d: %s", i+1, choice))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// promptInternal can return 'RetryPrompt'; when choices is non-nil, the
+// regexID is ignored and the reply must match one of the choices.
+func (r Robot) promptInternal(regexID string, user string, channel string, prompt string, choices []string) (string, robot.RetVal) {
 	matcher := replyMatcher{
-		user:    user,
-		channel: channel,
+		protocol: r.Protocol,
+		user:     user,
+		channel:  channel,
 	}
 	var rep replyWaiter
 	task, _, job := getTask(r.currentTask)
 	isJob := job != nil
-	if stockRepliesRe.MatchString(regexID) {
+	if choices != nil {
+		if len(choices) == 0 {
+			Log(robot.Error, "Empty list of choices for prompt in task %s", task.name)
+			return "", robot.MissingArguments
+		}
+		re, err := choiceRegex(choices)
+		if err != nil {
+			Log(robot.Error, "Unable to compile regex for choices %q in task %s: %v", choices, task.name, err)
+			return "", robot.MatcherNotFound
+		}
+		rep.re = re
+		regexID = "(choice)"
+	} else if stockRepliesRe.MatchString(regexID) {
 		rep.re = stockReplies[regexID]
 	} else {
 		var rm []InputMatcher
@@ -232,10 +324,20 @@ func (r Robot) promptInternal(regexID string, user string, channel string, promp
 			puser = user
 		}
 		var ret robot.RetVal
-		if channel == "" {
-			ret = interfaces.SendProtocolUserMessage(puser, prompt, r.Format)
-		} else {
-			ret = interfaces.SendProtocolUserChannelMessage(puser, user, channel, prompt, r.Format)
+		cc, hasChoices := r.connector().(robot.ChoiceConnector)
+		switch {
+		case choices != nil && hasChoices && channel == "":
+			ret = cc.SendProtocolUserChoiceMessage(puser, prompt, choices, r.Format)
+		case choices != nil && hasChoices:
+			ret = cc.SendProtocolUserChannelChoiceMessage(puser, user, channel, prompt, choices, r.Format)
+		case choices != nil && channel == "":
+			ret = r.connector().SendProtocolUserMessage(puser, choiceList(prompt, choices), r.Format)
+		case choices != nil:
+			ret = r.connector().SendProtocolUserChannelMessage(puser, user, channel, choiceList(prompt, choices), r.Format)
+		case channel == "":
+			ret = r.connector().SendProtocolUserMessage(puser, prompt, r.Format)
+		default:
+			ret = r.connector().SendProtocolUserChannelMessage(puser, user, channel, prompt, r.Format)
 		}
 		if ret != robot.Ok {
 			replies.Unlock()
@@ -290,5 +392,8 @@ func (r Robot) promptInternal(regexID string, user string, channel string, promp
 		}
 		return "", robot.ReplyNotMatched
 	}
+	if choices != nil {
+		return getChoice(replied.rep, choices), robot.Ok
+	}
 	return replied.rep, robot.Ok
 }
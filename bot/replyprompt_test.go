@@ -0,0 +1,62 @@
+package bot
+
+import "testing"
+
+func TestChoiceRegex(t *testing.T) {
+	choices := []string{"red", "Dark Blue", "1.5", "a+b"}
+	re, err := choiceRegex(choices)
+	if err != nil {
+		t.Fatalf("choiceRegex(%q): %v", choices, err)
+	}
+	cases := []struct {
+		reply string
+		match bool
+	}{
+		{"red", true},
+		{" RED ", true},
+		{"dark blue", true},
+		{"1.5", true},
+		{"1x5", false},
+		{"a+b", true},
+		{"aab", false},
+		{"1", true},
+		{"4", true},
+		{"5", false},
+		{"red green", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := re.MatchString(c.reply); got != c.match {
+			t.Errorf("reply %q: want match %t, got %t", c.reply, c.match, got)
+		}
+	}
+}
+
+func TestGetChoice(t *testing.T) {
+	choices := []string{"red", "Dark Blue", "2", "10"}
+	cases := []struct {
+		reply, want string
+	}{
+		{"red", "red"},
+		{"  dark BLUE ", "Dark Blue"},
+		{"1", "red"},
+		// The text of a choice takes precedence over its number
+		{"2", "2"},
+		{"4", "10"},
+		{"10", "10"},
+		{"green", "green"},
+	}
+	for _, c := range cases {
+		if got := getChoice(c.reply, choices); got != c.want {
+			t.Errorf("getChoice(%q): want %q, got %q", c.reply, c.want, got)
+		}
+	}
+}
+
+func TestChoiceList(t *testing.T) {
+	got := choiceList("Pick a color", []string{"red", "green"})
+	want := "Pick a color\n1: red\n2: green"
+	if got != want {
+		t.Errorf("choiceList: want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,356 @@
+package bot
+
+/* repodeps.go - the dependency graph of repositories in repositories.yaml,
+   for cascading builds of everything that depends on a repository that
+   changed. The graph is checked for cycles when the configuration loads,
+   and the build-dependents task builds dependents in dependency order.
+*/
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// Branch built for dependent repositories
+const dependencyBranch = "master"
+
+// checkRepoDependencies validates Dependencies in repositories.yaml, logging
+// errors and ignoring dependencies on unknown repositories, and the
+// dependencies of repositories in a cycle.
+func checkRepoDependencies(repos map[string]robot.Repository) {
+	names := make([]string, 0, len(repos))
+	for name := range repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		repo := repos[name]
+		if len(repo.Dependencies) == 0 {
+			continue
+		}
+		deps := make([]string, 0, len(repo.Dependencies))
+		for _, dep := range repo.Dependencies {
+			if _, ok := repos[dep]; !ok {
+				Log(robot.Error, "Repository '%s' depends on unknown repository '%s', ignoring", name, dep)
+				continue
+			}
+			deps = append(deps, dep)
+		}
+		repo.Dependencies = deps
+		repos[name] = repo
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	inCycle := make(map[string]bool)
+	var path []string
+	var visit func(name string)
+	visit = func(name string) {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range repos[name].Dependencies {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				start := len(path) - 1
+				for path[start] != dep {
+					start--
+				}
+				cycle := append(append([]string{}, path[start:]...), dep)
+				Log(robot.Error, "Dependency cycle in repositories.yaml: %s; ignoring Dependencies for these repositories", strings.Join(cycle, " depends on "))
+				for _, c := range path[start:] {
+					inCycle[c] = true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+	}
+	for _, name := range names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	for name := range inCycle {
+		repo := repos[name]
+		repo.Dependencies = nil
+		repos[name] = repo
+	}
+}
+
+// repoDependents returns a map of repository to the repositories that
+// directly depend on it.
+func repoDependents(repos map[string]robot.Repository) map[string][]string {
+	dependents := make(map[string][]string)
+	for name, repo := range repos {
+		for _, dep := range repo.Dependencies {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	for _, d := range dependents {
+		sort.Strings(d)
+	}
+	return dependents
+}
+
+// dependentBuilds returns every repository that depends, directly or
+// transitively, on repo, in build order; every repository comes after the
+// repositories it depends on. The upstream map has the repositories each one
+// needs built first, not counting repo itself.
+func dependentBuilds(repos map[string]robot.Repository, repo string) (order []string, upstream map[string][]string) {
+	dependents := repoDependents(repos)
+	affected := make(map[string]bool)
+	queue := []string{repo}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, d := range dependents[name] {
+			if d != repo && !affected[d] {
+				affected[d] = true
+				queue = append(queue, d)
+			}
+		}
+	}
+	upstream = make(map[string][]string)
+	for name := range affected {
+		for _, dep := range repos[name].Dependencies {
+			if affected[dep] {
+				upstream[name] = append(upstream[name], dep)
+			}
+		}
+	}
+	done := make(map[string]bool)
+	for len(order) < len(affected) {
+		var ready []string
+		for name := range affected {
+			if done[name] {
+				continue
+			}
+			blocked := false
+			for _, dep := range upstream[name] {
+				if !done[dep] {
+					blocked = true
+					break
+				}
+			}
+			if !blocked {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			// only possible with a cycle, removed by checkRepoDependencies
+			Log(robot.Error, "Unresolvable dependencies building dependents of '%s'", repo)
+			break
+		}
+		sort.Strings(ready)
+		for _, name := range ready {
+			done[name] = true
+		}
+		order = append(order, ready...)
+	}
+	return
+}
+
+type depStatus string
+
+const (
+	depSucceeded depStatus = "succeeded"
+	depFailed    depStatus = "failed"
+	depSkipped   depStatus = "skipped"
+	depNoBuild   depStatus = "no build type"
+)
+
+type depResult struct {
+	repo   string
+	status depStatus
+	detail string
+}
+
+// builddeps - task build-dependents; builds every repository that depends,
+// directly or transitively, on a repository, in dependency order. Builds that
+// don't depend on each other run in parallel, and builds downstream of a
+// failed build are skipped. Reports the whole tree when done.
+func builddeps(m robot.Robot, args ...string) (retval robot.TaskRetVal) {
+	r := m.(Robot)
+	if len(args) != 2 {
+		r.Log(robot.Error, "build-dependents requires a repository and branch, got: %q", args)
+		return robot.Fail
+	}
+	repo, branch := args[0], args[1]
+	if _, ok := r.repositories[repo]; !ok {
+		r.Log(robot.Error, "build-dependents called for repository '%s', not found in repositories.yaml", repo)
+		return robot.Fail
+	}
+	order, upstream := dependentBuilds(r.repositories, repo)
+	if len(order) == 0 {
+		r.Log(robot.Debug, "No repositories depend on '%s', nothing to build", repo)
+		return
+	}
+	w := getLockedWorker(r.tid)
+	ptype := w.ptype
+	privileged := w.privileged
+	w.Unlock()
+	w.section("dependencies", fmt.Sprintf("building %d repositories that depend on %s (branch %s): %s", len(order), repo, branch, strings.Join(order, ", ")))
+
+	results := make(map[string]depResult)
+	started := make(map[string]bool)
+	finished := make(chan depResult)
+	running := 0
+	for {
+		ready, skipped := scheduleBuilds(order, upstream, results, started)
+		for _, res := range skipped {
+			w.section("dependencies", fmt.Sprintf("%s: %s, %s", res.repo, res.status, res.detail))
+		}
+		// repositories with nothing to build count as finished at once, and
+		// their dependents can be scheduled right away
+		noBuild := false
+		for _, name := range ready {
+			btype := r.repositories[name].Type
+			if len(btype) == 0 || btype == "none" {
+				results[name] = depResult{name, depNoBuild, ""}
+				noBuild = true
+				continue
+			}
+			running++
+			w.section("dependencies", fmt.Sprintf("starting build of %s (branch %s) with job '%s'", name, dependencyBranch, btype))
+			go func(name string) {
+				finished <- w.buildDependent(r, ptype, privileged, name, repo, branch)
+			}(name)
+		}
+		if noBuild {
+			continue
+		}
+		if running == 0 {
+			break
+		}
+		res := <-finished
+		running--
+		results[res.repo] = res
+		w.section("dependencies", fmt.Sprintf("%s: %s, %s", res.repo, res.status, res.detail))
+	}
+
+	var failed int
+	for _, res := range results {
+		if res.status == depFailed || res.status == depSkipped {
+			failed++
+		}
+	}
+	report := []string{fmt.Sprintf("Dependency builds for %s (branch %s):", repo, branch)}
+	report = append(report, depTree(repo, repoDependents(r.repositories), results)...)
+	r.Fixed().Say(strings.Join(report, "\n"))
+	if failed > 0 {
+		return robot.Fail
+	}
+	return
+}
+
+// scheduleBuilds returns the builds in order that can start, because every
+// build they depend on has finished, and marks them started. Builds
+// downstream of a failed or skipped build are skipped, and returned with
+// their results.
+func scheduleBuilds(order []string, upstream map[string][]string, results map[string]depResult, started map[string]bool) (ready []string, skipped []depResult) {
+	for _, name := range order {
+		if started[name] {
+			continue
+		}
+		waiting := false
+		failedUp := ""
+		for _, dep := range upstream[name] {
+			res, ok := results[dep]
+			if !ok {
+				waiting = true
+				break
+			}
+			if res.status == depFailed || res.status == depSkipped {
+				failedUp = dep
+				break
+			}
+		}
+		if len(failedUp) > 0 {
+			started[name] = true
+			res := depResult{name, depSkipped, fmt.Sprintf("upstream '%s' didn't build", failedUp)}
+			results[name] = res
+			skipped = append(skipped, res)
+			continue
+		}
+		if waiting {
+			continue
+		}
+		started[name] = true
+		ready = append(ready, name)
+	}
+	return
+}
+
+// buildDependent runs the build job for a dependent repository as a child
+// pipeline, the same as AddJob.
+func (w *worker) buildDependent(r Robot, ptype pipelineType, privileged bool, name, trigger, branch string) depResult {
+	btype := r.repositories[name].Type
+	t := r.tasks.getTaskByName(btype)
+	if t == nil {
+		return depResult{name, depFailed, fmt.Sprintf("build job '%s' not found", btype)}
+	}
+	task, _, job := getTask(t)
+	if job == nil {
+		return depResult{name, depFailed, fmt.Sprintf("build type '%s' isn't a job", btype)}
+	}
+	if task.Disabled {
+		return depResult{name, depFailed, fmt.Sprintf("build job '%s' is disabled", btype)}
+	}
+	if job.Privileged && !privileged {
+		r.Log(robot.Error, "PrivilegeViolation building '%s' with privileged job '%s' in unprivileged pipeline", name, btype)
+		return depResult{name, depFailed, fmt.Sprintf("build job '%s' is privileged", btype)}
+	}
+	child := w.clone()
+	ret := child.startPipeline(w, t, ptype, "run", "depbuild", name, dependencyBranch, trigger, branch)
+	// the child is deregistered, no locking needed
+	detail := fmt.Sprintf("log '%s' run %d", child.histName, child.runIndex)
+	if ret != robot.Normal {
+		return depResult{name, depFailed, fmt.Sprintf("exit code %d (%s), %s", ret, ret, detail)}
+	}
+	return depResult{name, depSucceeded, detail}
+}
+
+// depTree renders the results of dependency builds as a tree rooted at the
+// repository that triggered them; repositories with more than one upstream
+// are only expanded the first time they appear.
+func depTree(root string, dependents map[string][]string, results map[string]depResult) []string {
+	lines := []string{root}
+	shown := make(map[string]bool)
+	var walk func(name, indent string)
+	walk = func(name, indent string) {
+		children := dependents[name]
+		for i, child := range children {
+			branch, next := "├─ ", "│  "
+			if i == len(children)-1 {
+				branch, next = "└─ ", "   "
+			}
+			res := results[child]
+			if shown[child] {
+				lines = append(lines, indent+branch+child+" (see above)")
+				continue
+			}
+			shown[child] = true
+			line := indent + branch + child + ": " + string(res.status)
+			if len(res.detail) > 0 {
+				line += " - " + res.detail
+			}
+			lines = append(lines, line)
+			walk(child, indent+next)
+		}
+	}
+	walk(root, "")
+	return lines
+}
+
+func init() {
+	RegisterTask("build-dependents", false, robot.TaskHandler{Handler: builddeps})
+}
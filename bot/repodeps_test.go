@@ -0,0 +1,155 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// testRepos builds repositories from a map of repository to dependencies
+func testRepos(deps map[string][]string) map[string]robot.Repository {
+	repos := make(map[string]robot.Repository)
+	for name, d := range deps {
+		repos[name] = robot.Repository{Type: "gopherci", Dependencies: d}
+	}
+	return repos
+}
+
+func TestCheckRepoDependencies(t *testing.T) {
+	cases := []struct {
+		name string
+		deps map[string][]string
+		want map[string][]string
+	}{
+		{"unknown dependency",
+			map[string][]string{"lib": nil, "app": {"lib", "missing"}},
+			map[string][]string{"lib": nil, "app": {"lib"}}},
+		{"self dependency",
+			map[string][]string{"lib": {"lib"}, "app": {"lib"}},
+			map[string][]string{"lib": nil, "app": {"lib"}}},
+		{"cycle",
+			map[string][]string{"a": {"b"}, "b": {"a"}, "app": {"a"}},
+			map[string][]string{"a": nil, "b": nil, "app": {"a"}}},
+		{"long cycle",
+			map[string][]string{"a": {"c"}, "b": {"a"}, "c": {"b"}, "lib": nil, "app": {"b", "lib"}},
+			map[string][]string{"a": nil, "b": nil, "c": nil, "lib": nil, "app": {"b", "lib"}}},
+		{"diamond",
+			map[string][]string{"base": nil, "left": {"base"}, "right": {"base"}, "top": {"left", "right"}},
+			map[string][]string{"base": nil, "left": {"base"}, "right": {"base"}, "top": {"left", "right"}}},
+	}
+	for _, c := range cases {
+		repos := testRepos(c.deps)
+		checkRepoDependencies(repos)
+		for name, want := range c.want {
+			if got := repos[name].Dependencies; len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+				t.Errorf("%s: '%s' dependencies want %v, got %v", c.name, name, want, got)
+			}
+		}
+	}
+}
+
+func TestDependentBuilds(t *testing.T) {
+	diamond := map[string][]string{"base": nil, "left": {"base"}, "right": {"base"}, "top": {"left", "right"}, "other": nil}
+	cases := []struct {
+		name     string
+		deps     map[string][]string
+		repo     string
+		order    []string
+		upstream map[string][]string
+	}{
+		{"no dependents", diamond, "other", nil, map[string][]string{}},
+		{"chain",
+			map[string][]string{"a": nil, "b": {"a"}, "c": {"b"}, "d": {"c"}},
+			"b", []string{"c", "d"}, map[string][]string{"d": {"c"}}},
+		{"diamond", diamond, "base",
+			[]string{"left", "right", "top"}, map[string][]string{"top": {"left", "right"}}},
+		{"diamond side", diamond, "left", []string{"top"}, map[string][]string{}},
+		{"shortcut",
+			// app depends on lib directly and through mid; it builds after mid
+			map[string][]string{"lib": nil, "mid": {"lib"}, "app": {"lib", "mid"}},
+			"lib", []string{"mid", "app"}, map[string][]string{"app": {"mid"}}},
+	}
+	for _, c := range cases {
+		repos := testRepos(c.deps)
+		checkRepoDependencies(repos)
+		order, upstream := dependentBuilds(repos, c.repo)
+		if !reflect.DeepEqual(order, c.order) {
+			t.Errorf("%s: build order want %v, got %v", c.name, c.order, order)
+		}
+		if !reflect.DeepEqual(upstream, c.upstream) {
+			t.Errorf("%s: upstream want %v, got %v", c.name, c.upstream, upstream)
+		}
+	}
+}
+
+func TestScheduleBuilds(t *testing.T) {
+	diamond := map[string][]string{"base": nil, "left": {"base"}, "right": {"base"}, "top": {"left", "right"}, "after": {"top"}}
+	cases := []struct {
+		name    string
+		running []string
+		results map[string]depStatus // finished builds
+		ready   []string
+		skipped []string
+	}{
+		{"start", nil, map[string]depStatus{}, []string{"left", "right"}, nil},
+		{"waiting on one side", []string{"right"}, map[string]depStatus{"left": depSucceeded}, nil, nil},
+		{"both sides built", nil, map[string]depStatus{"left": depSucceeded, "right": depNoBuild}, []string{"top"}, nil},
+		{"one side failed", nil, map[string]depStatus{"left": depFailed, "right": depSucceeded}, nil, []string{"top", "after"}},
+		{"failed before the other side finished", []string{"right"}, map[string]depStatus{"left": depFailed}, nil, []string{"top", "after"}},
+		{"top failed", nil, map[string]depStatus{"left": depSucceeded, "right": depSucceeded, "top": depFailed}, nil, []string{"after"}},
+	}
+	for _, c := range cases {
+		repos := testRepos(diamond)
+		order, upstream := dependentBuilds(repos, "base")
+		results := make(map[string]depResult)
+		started := make(map[string]bool)
+		for _, name := range c.running {
+			started[name] = true
+		}
+		for name, status := range c.results {
+			results[name] = depResult{name, status, ""}
+			started[name] = true
+		}
+		ready, skipped := scheduleBuilds(order, upstream, results, started)
+		if !reflect.DeepEqual(ready, c.ready) {
+			t.Errorf("%s: ready want %v, got %v", c.name, c.ready, ready)
+		}
+		var skippedNames []string
+		for _, res := range skipped {
+			skippedNames = append(skippedNames, res.repo)
+			if results[res.repo].status != depSkipped {
+				t.Errorf("%s: skipped '%s' not recorded in results", c.name, res.repo)
+			}
+		}
+		if !reflect.DeepEqual(skippedNames, c.skipped) {
+			t.Errorf("%s: skipped want %v, got %v", c.name, c.skipped, skippedNames)
+		}
+		for _, name := range append(ready, skippedNames...) {
+			if !started[name] {
+				t.Errorf("%s: '%s' not marked started", c.name, name)
+			}
+		}
+	}
+}
+
+func TestDepTree(t *testing.T) {
+	repos := testRepos(map[string][]string{"base": nil, "left": {"base"}, "right": {"base"}, "top": {"left", "right"}})
+	results := map[string]depResult{
+		"left":  {"left", depFailed, "exit code 1 (Fail), log 'gopherci:left' run 3"},
+		"right": {"right", depSucceeded, "log 'gopherci:right' run 7"},
+		"top":   {"top", depSkipped, "upstream 'left' didn't build"},
+	}
+	want := []string{
+		"base",
+		"├─ left: failed - exit code 1 (Fail), log 'gopherci:left' run 3",
+		"│  └─ top: skipped - upstream 'left' didn't build",
+		"└─ right: succeeded - log 'gopherci:right' run 7",
+		"   └─ top (see above)",
+	}
+	got := depTree("base", repoDependents(repos), results)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("depTree:\nwant:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,152 @@
+package bot
+
+/* retry.go - retry policies for re-running pipeline tasks that fail, e.g.
+   flaky network tasks like git-clone or ssh-scan. A policy can be set for
+   a task in robot.yaml, or when the task is added to the pipeline.
+*/
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// RetryPolicy for re-running a task that fails, set with Retry: for a task
+// in robot.yaml
+type RetryPolicy struct {
+	Attempts int    // maximum number of attempts, including the first
+	Backoff  string // wait before the first retry, e.g. "10s"; doubles for each retry after
+	RetryOn  []int  // TaskRetVals (exit codes) to retry; any failure when empty
+}
+
+// Longest wait between attempts
+const maxRetryBackoff = 10 * time.Minute
+
+// taskRetry is a parsed RetryPolicy
+type taskRetry struct {
+	attempts int
+	backoff  time.Duration
+	retryOn  []robot.TaskRetVal
+}
+
+// parse returns the taskRetry for a policy, or nil if the task shouldn't
+// be retried
+func (rp RetryPolicy) parse() (*taskRetry, error) {
+	if rp.Attempts <= 1 {
+		return nil, nil
+	}
+	tr := &taskRetry{attempts: rp.Attempts}
+	if len(rp.Backoff) > 0 {
+		d, err := time.ParseDuration(rp.Backoff)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid retry Backoff '%s', should be e.g. '10s'", rp.Backoff)
+		}
+		tr.backoff = d
+	}
+	for _, code := range rp.RetryOn {
+		tr.retryOn = append(tr.retryOn, robot.TaskRetVal(code))
+	}
+	return tr, nil
+}
+
+// setRetry parses the task's Retry policy
+func (t *Task) setRetry() error {
+	tr, err := t.Retry.parse()
+	if err != nil {
+		return fmt.Errorf("task '%s': %v", t.name, err)
+	}
+	t.retry = tr
+	return nil
+}
+
+func (tr *taskRetry) shouldRetry(ret robot.TaskRetVal) bool {
+	if ret == robot.Normal {
+		return false
+	}
+	if len(tr.retryOn) == 0 {
+		return true
+	}
+	for _, r := range tr.retryOn {
+		if r == ret {
+			return true
+		}
+	}
+	return false
+}
+
+// wait returns how long to wait after a failed attempt
+func (tr *taskRetry) wait(attempt int) time.Duration {
+	wait := tr.backoff
+	for i := 1; i < attempt && wait < maxRetryBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxRetryBackoff {
+		wait = maxRetryBackoff
+	}
+	return wait
+}
+
+// callTaskRetry calls a pipeline task, re-running it when it fails according
+// to the policy it was added with, or the task's configured policy. Tasks
+// added to the pipeline by a failed attempt are discarded before retrying.
+func (w *worker) callTaskRetry(ts TaskSpec) (errString string, ret robot.TaskRetVal) {
+	task, _, _ := getTask(ts.task)
+	retry := task.retry
+	if ts.retry != nil {
+		retry = ts.retry
+	}
+	if retry == nil {
+		return w.callTaskTimeout(ts.task, ts.timeout, ts.Command, ts.Arguments...)
+	}
+	defer func() {
+		w.Lock()
+		w.taskAttempt, w.taskAttempts = 0, 0
+		w.Unlock()
+	}()
+	for attempt := 1; ; attempt++ {
+		w.Lock()
+		w.taskAttempt, w.taskAttempts = attempt, retry.attempts
+		nextTasks, finalTasks, failTasks := w.nextTasks, w.finalTasks, w.failTasks
+		w.Unlock()
+		errString, ret = w.callTaskTimeout(ts.task, ts.timeout, ts.Command, ts.Arguments...)
+		if attempt >= retry.attempts || !retry.shouldRetry(ret) {
+			return
+		}
+		wait := retry.wait(attempt)
+		msg := fmt.Sprintf("task '%s' failed with status %s (attempt %d of %d), retrying in %s", task.name, ret, attempt, retry.attempts, wait)
+		Log(robot.Warn, "Pipeline '%s': %s", w.pipeName, msg)
+		abort := make(chan struct{})
+		w.Lock()
+		w.nextTasks, w.finalTasks, w.failTasks = nextTasks, finalTasks, failTasks
+		w.retryAbort = abort
+		w.Unlock()
+		w.section("retry", msg)
+		if stopped := w.retryWait(wait, abort); len(stopped) > 0 {
+			Log(robot.Warn, "Pipeline '%s': not retrying task '%s', %s", w.pipeName, task.name, stopped)
+			w.section("retry", fmt.Sprintf("not retrying task '%s', %s", task.name, stopped))
+			return
+		}
+	}
+}
+
+// retryWait waits before the next attempt, returning early with the reason
+// if the wait is killed or the robot starts shutting down.
+func (w *worker) retryWait(wait time.Duration, abort chan struct{}) (stopped string) {
+	state.RLock()
+	shutdown := shutdownStarted
+	state.RUnlock()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-abort:
+		stopped = "killed by an administrator"
+	case <-shutdown:
+		stopped = "robot shutting down"
+	}
+	w.Lock()
+	w.retryAbort = nil
+	w.Unlock()
+	return
+}
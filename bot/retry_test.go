@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+func TestRetryPolicyParse(t *testing.T) {
+	cases := []struct {
+		policy   RetryPolicy
+		retry    bool
+		backoff  time.Duration
+		retryOn  int
+		parseErr bool
+	}{
+		{RetryPolicy{}, false, 0, 0, false},
+		{RetryPolicy{Attempts: 1, Backoff: "10s"}, false, 0, 0, false},
+		{RetryPolicy{Attempts: 3}, true, 0, 0, false},
+		{RetryPolicy{Attempts: 3, Backoff: "10s", RetryOn: []int{1, 124}}, true, 10 * time.Second, 2, false},
+		{RetryPolicy{Attempts: 3, Backoff: "soon"}, false, 0, 0, true},
+		{RetryPolicy{Attempts: 3, Backoff: "-1s"}, false, 0, 0, true},
+	}
+	for _, c := range cases {
+		tr, err := c.policy.parse()
+		if (err != nil) != c.parseErr {
+			t.Errorf("%+v: want error %t, got %v", c.policy, c.parseErr, err)
+			continue
+		}
+		if (tr != nil) != c.retry {
+			t.Errorf("%+v: want retry %t, got %+v", c.policy, c.retry, tr)
+			continue
+		}
+		if tr != nil && (tr.attempts != c.policy.Attempts || tr.backoff != c.backoff || len(tr.retryOn) != c.retryOn) {
+			t.Errorf("%+v: got %+v", c.policy, tr)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tr := &taskRetry{attempts: 20, backoff: 10 * time.Second}
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{6, 320 * time.Second},
+		{7, maxRetryBackoff},
+		{19, maxRetryBackoff},
+	}
+	for _, c := range cases {
+		if got := tr.wait(c.attempt); got != c.want {
+			t.Errorf("wait after attempt %d: want %s, got %s", c.attempt, c.want, got)
+		}
+	}
+	if got := (&taskRetry{attempts: 3}).wait(2); got != 0 {
+		t.Errorf("wait with no backoff: want 0, got %s", got)
+	}
+	if got := (&taskRetry{attempts: 3, backoff: time.Hour}).wait(1); got != maxRetryBackoff {
+		t.Errorf("long backoff not capped: got %s", got)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	anyFail := &taskRetry{attempts: 3}
+	some := &taskRetry{attempts: 3, retryOn: []robot.TaskRetVal{robot.Fail, robot.TaskTimeout}}
+	cases := []struct {
+		tr   *taskRetry
+		ret  robot.TaskRetVal
+		want bool
+	}{
+		{anyFail, robot.Normal, false},
+		{anyFail, robot.Fail, true},
+		{anyFail, robot.MechanismFail, true},
+		{some, robot.Normal, false},
+		{some, robot.Fail, true},
+		{some, robot.TaskTimeout, true},
+		{some, robot.MechanismFail, false},
+	}
+	for _, c := range cases {
+		if got := c.tr.shouldRetry(c.ret); got != c.want {
+			t.Errorf("shouldRetry(%s) with retryOn %v: want %t, got %t", c.ret, c.tr.retryOn, c.want, got)
+		}
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	w := &worker{pipeContext: &pipeContext{}}
+	shutdownStarted = make(chan struct{})
+
+	if stopped := w.retryWait(time.Millisecond, make(chan struct{})); len(stopped) > 0 {
+		t.Errorf("wait ended early: %s", stopped)
+	}
+
+	abort := make(chan struct{})
+	w.retryAbort = abort
+	close(abort)
+	if stopped := w.retryWait(time.Hour, abort); stopped != "killed by an administrator" {
+		t.Errorf("killed wait: got %q", stopped)
+	}
+	if w.retryAbort != nil {
+		t.Errorf("abort channel not cleared after the wait")
+	}
+
+	close(shutdownStarted)
+	if stopped := w.retryWait(time.Hour, make(chan struct{})); stopped != "robot shutting down" {
+		t.Errorf("wait during shutdown: got %q", stopped)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 /* robot_methods.go defines some convenience functions on struct Robot to
@@ -26,6 +26,8 @@ type Robot struct {
 	tasks        *taskList                   // same
 	maps         *userChanMaps               // same
 	repositories map[string]robot.Repository // same
+	taskTimeout  time.Duration               // for tasks added to the pipeline, see TaskTimeout
+	taskRetry    *taskRetry                  // same, see TaskRetry
 }
 
 // Incrementing tid for individual tasks that run, so Go Robots
@@ -88,6 +90,7 @@ func (w *worker) makeRobot() Robot {
 			nsExtension:    w.nsExtension,
 			currentTask:    w.currentTask,
 			exclusive:      w.exclusive,
+			parallel:       w.parallel,
 		}
 	}
 	return r
@@ -243,6 +246,32 @@ func (r Robot) Direct() robot.Robot {
 	return nr
 }
 
+// TaskTimeout returns a robot object that adds tasks to the pipeline with
+// the given timeout, overriding the task's configured Timeout, e.g.:
+// r.TaskTimeout(10*time.Minute).AddTask("ssh-cmd", "make")
+// Timeouts only apply to external tasks and plugins; jobs added with
+// AddJob use their own Timeout.
+func (r Robot) TaskTimeout(d time.Duration) robot.Robot {
+	nr := r
+	nr.taskTimeout = d
+	return nr
+}
+
+// TaskRetry returns a robot object that adds tasks to the pipeline with a
+// retry policy, overriding the task's configured Retry. A task that fails
+// with one of the retryOn values (any failure when none are given) is run
+// up to attempts times, waiting backoff before the first retry and doubling
+// the wait for each retry after, e.g.:
+// r.TaskRetry(3, 10*time.Second).AddTask("git-clone", ...)
+func (r Robot) TaskRetry(attempts int, backoff time.Duration, retryOn ...robot.TaskRetVal) robot.Robot {
+	nr := r
+	nr.taskRetry = nil
+	if attempts > 1 {
+		nr.taskRetry = &taskRetry{attempts, backoff, retryOn}
+	}
+	return nr
+}
+
 // Pause is a convenience function to pause some fractional number of seconds.
 func (r Robot) Pause(s float64) {
 	ms := time.Duration(s * float64(1000))
@@ -283,7 +312,7 @@ func (r Robot) GetBotAttribute(a string) *robot.AttrRet {
 	case "contact", "admin", "admincontact":
 		attr = r.cfg.adminContact
 	case "protocol":
-		attr = r.Protocol.String()
+		attr = protocolName(r.Protocol)
 	default:
 		ret = robot.AttributeNotFound
 	}
@@ -357,8 +386,15 @@ func (r Robot) Log(l robot.LogLevel, msg string, v ...interface{}) (logged bool)
 	}
 	Log(l, msg)
 	if r.logger != nil {
-		line := "LOG " + logLevelToStr(l) + " " + msg
-		r.logger.Log(strings.TrimSpace(line))
+		var name string
+		if task, _, _ := getTask(r.currentTask); task != nil {
+			name = task.name
+		}
+		logRecord(r.logger, robot.HistoryRecord{
+			Task:   name,
+			Stream: robot.StreamLog,
+			Text:   strings.TrimSpace(logLevelToStr(l) + " " + msg),
+		})
 	}
 	return
 }
@@ -3,7 +3,7 @@ package bot
 import (
 	"strings"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // GetMessage returns a pointer to the message struct
@@ -50,7 +50,7 @@ func (r Robot) GetUserAttribute(u, a string) *robot.AttrRet {
 			return &robot.AttrRet{attr, robot.Ok}
 		}
 	}
-	attr, ret := interfaces.GetProtocolUserAttribute(user, a)
+	attr, ret := r.connector().GetProtocolUserAttribute(user, a)
 	return &robot.AttrRet{attr, ret}
 }
 
@@ -92,6 +92,39 @@ func (r Robot) GetSenderAttribute(a string) *robot.AttrRet {
 	if len(user) == 0 {
 		user = r.User
 	}
-	attr, ret := interfaces.GetProtocolUserAttribute(user, a)
+	attr, ret := r.connector().GetProtocolUserAttribute(user, a)
 	return &robot.AttrRet{attr, ret}
 }
+
+// React adds an emoji reaction, e.g. "thumbsup", to the message that
+// started the pipeline. Returns FailedMessageSend if the connector doesn't
+// support reactions, or there's no message to react to.
+func (r Robot) React(reaction string) robot.RetVal {
+	return r.react(reaction, true)
+}
+
+// Unreact removes a reaction added with React.
+func (r Robot) Unreact(reaction string) robot.RetVal {
+	return r.react(reaction, false)
+}
+
+func (r Robot) react(reaction string, add bool) robot.RetVal {
+	inc := r.Incoming
+	if inc == nil || len(inc.MessageID) == 0 {
+		r.Log(robot.Warn, "No incoming message to react to for reaction '%s'", reaction)
+		return robot.FailedMessageSend
+	}
+	reaction = strings.Trim(reaction, ":")
+	if len(reaction) == 0 {
+		return robot.MissingArguments
+	}
+	rc, ok := getConnector(getProtocol(inc.Protocol)).(robot.ReactionConnector)
+	if !ok {
+		r.Log(robot.Warn, "Connector for protocol '%s' doesn't support reactions", inc.Protocol)
+		return robot.FailedMessageSend
+	}
+	if add {
+		return rc.AddReaction(bracket(inc.ChannelID), inc.MessageID, reaction)
+	}
+	return rc.RemoveReaction(bracket(inc.ChannelID), inc.MessageID, reaction)
+}
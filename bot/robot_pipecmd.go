@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // GetRepoData returns the contents of configPath/conf/repodata.yaml, or an
@@ -67,6 +67,10 @@ func (r Robot) ExtendNamespace(ext string, histories int) bool {
 		r.Log(robot.Error, "ExtendNamespace called after namespace already extended")
 		return false
 	}
+	if r.parallel {
+		r.Log(robot.Error, "ExtendNamespace called from a parallel task")
+		return false
+	}
 	cmp := strings.Split(ext, "/")
 	repo := strings.Join(cmp[0:len(cmp)-1], "/")
 	branch := cmp[len(cmp)-1]
@@ -87,6 +91,7 @@ func (r Robot) ExtendNamespace(ext string, histories int) bool {
 	// new hotness
 	w.environment["GOPHER_REPOSITORY"] = repo
 	jobLogger := w.logger
+	jobHist, jobIdx := w.histName, w.runIndex
 	wid := w.id
 	eid := w.eid
 	w.Unlock()
@@ -136,6 +141,7 @@ func (r Robot) ExtendNamespace(ext string, histories int) bool {
 	w.section("close log", fmt.Sprintf("Job '%s' extended namespace: '%s'; starting new log on next task", r.jobName, ext))
 	jobLogger.Close()
 	jobLogger.Finalize()
+	finishLog(jobHist, jobIdx, robot.Normal)
 	w.Lock()
 	w.histName = tag
 	w.runIndex = idx
@@ -171,6 +177,11 @@ func (r Robot) pipeTask(pflavor pipeAddFlavor, ptype pipeAddType, name string, a
 		r.Log(robot.Error, "request to modify pipeline outside of initial pipeline in task '%s'", task.name)
 		return robot.InvalidStage
 	}
+	if r.parallel {
+		task, _, _ := getTask(r.currentTask)
+		r.Log(robot.Error, "request to modify pipeline from parallel task '%s'", task.name)
+		return robot.InvalidStage
+	}
 	t := r.tasks.getTaskByName(name)
 	if t == nil {
 		task, _, _ := getTask(r.currentTask)
@@ -251,6 +262,8 @@ func (r Robot) pipeTask(pflavor pipeAddFlavor, ptype pipeAddType, name string, a
 		Command:   command,
 		Arguments: cmdargs,
 		task:      t,
+		timeout:   r.taskTimeout,
+		retry:     r.taskRetry,
 	}
 	argstr := strings.Join(args, " ")
 	r.Log(robot.Debug, "Adding pipeline task %s/%s: %s %s", pflavor, ptype, name, argstr)
@@ -266,6 +279,15 @@ func (r Robot) pipeTask(pflavor pipeAddFlavor, ptype pipeAddType, name string, a
 	case flavorFail:
 		w.failTasks = append(w.failTasks, ts)
 		w.Unlock()
+	case flavorParallel:
+		// Consecutive parallel tasks are added to the same group
+		n := len(w.nextTasks)
+		if n > 0 && w.nextTasks[n-1].group != nil {
+			w.nextTasks[n-1].group = append(w.nextTasks[n-1].group, ts)
+		} else {
+			w.nextTasks = append(w.nextTasks, TaskSpec{Name: "parallel", Command: "run", group: []TaskSpec{ts}})
+		}
+		w.Unlock()
 	case flavorSpawn:
 		w.Unlock()
 		sb := w.clone()
@@ -292,6 +314,16 @@ func (r Robot) AddTask(name string, args ...string) robot.RetVal {
 	return r.pipeTask(flavorAdd, typeTask, name, args...)
 }
 
+// AddParallelTask adds a task to a parallel group in the pipeline.
+// Consecutive parallel tasks form a group that run at the same time, each
+// with a copy of the pipeline environment, and the pipeline continues when
+// they've all finished. The group fails if any of its tasks fail. Parallel
+// tasks can't modify the pipeline; a new group starts after any other task
+// is added.
+func (r Robot) AddParallelTask(name string, args ...string) robot.RetVal {
+	return r.pipeTask(flavorParallel, typeTask, name, args...)
+}
+
 // FinalTask adds a task that always runs when the pipeline ends, whether
 // it succeeded or failed. This can be used to ensure that cleanup tasks like
 // terminating a VM or stopping the ssh-agent will run, regardless of whether
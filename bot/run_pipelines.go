@@ -8,7 +8,7 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var envPassThrough = []string{
@@ -92,6 +92,9 @@ func (w *worker) startPipeline(parent *worker, t interface{}, ptype pipelineType
 	}()
 
 	initChannel := w.Channel
+	if w.webhook != nil {
+		w.webhook.setEnvironment(c.environment)
+	}
 	// A job or plugin is always the first task in a pipeline; a new
 	// sub-pipeline is created if a job is added in another pipeline.
 	if isJob {
@@ -125,6 +128,17 @@ func (w *worker) startPipeline(parent *worker, t interface{}, ptype pipelineType
 		// To change the channel to the job channel, we need to clear the ProcotolChannel
 		w.Channel = task.Channel
 		w.ProtocolChannel = ""
+		// The job channel may belong to a different connector than the
+		// one that started the job; if so, the ProtocolUser changes, too.
+		jobProtocol := w.cfg.protocol
+		if len(task.Protocol) > 0 {
+			jobProtocol = task.Protocol
+		}
+		if p := getProtocol(jobProtocol); p != w.Protocol {
+			w.Protocol = p
+			w.maps = getUCMaps(p)
+			w.ProtocolUser = ""
+		}
 	}
 	c.environment["GOPHER_PIPE_NAME"] = task.name
 	// Once Active, we need to use the Mutex for access to some fields; see
@@ -155,6 +169,9 @@ func (w *worker) startPipeline(parent *worker, t interface{}, ptype pipelineType
 		}
 	}
 	w.Unlock()
+	if w.webhook != nil {
+		c.section("webhook", "job triggered by "+w.webhook.describe())
+	}
 	if isJob && (!job.Quiet || c.verbose) {
 		r := w.makeRobot()
 		taskinfo := task.name
@@ -174,13 +191,15 @@ func (w *worker) startPipeline(parent *worker, t interface{}, ptype pipelineType
 			r.Say("Starting job '%s', run %d%s - spawned by pipeline '%s': %s", taskinfo, c.runIndex, logref, ppipeName, ppipeDesc)
 		case scheduled:
 			r.Say("Starting scheduled job '%s', run %d%s", taskinfo, c.runIndex, logref)
+		case webhook:
+			r.Say("Starting job '%s', run %d%s - triggered by %s", taskinfo, c.runIndex, logref, w.webhook.describe())
 		default:
 			r.Say("Starting job '%s', run %d%s", taskinfo, c.runIndex, logref)
 		}
 		c.verbose = true
 	}
 
-	ts := TaskSpec{task.name, command, args, t}
+	ts := TaskSpec{task.name, command, args, t, 0, nil, nil}
 	c.nextTasks = []TaskSpec{ts}
 
 	var errString string
@@ -219,7 +238,11 @@ func (w *worker) startPipeline(parent *worker, t interface{}, ptype pipelineType
 		c.section("failed", fmt.Sprintf("pipeline failed in task %s with exit code %d (%s)", c.taskName, ret, ret))
 		fc := int64(ret)
 		c.environment["GOPHER_FAIL_CODE"] = strconv.FormatInt(fc, 10)
-		c.environment["GOPHER_FAIL_STRING"] = ret.String()
+		if ret == robot.TaskTimeout && len(errString) > 0 {
+			c.environment["GOPHER_FAIL_STRING"] = ret.String() + " - " + errString
+		} else {
+			c.environment["GOPHER_FAIL_STRING"] = ret.String()
+		}
 	} else {
 		c.section("done", "primary pipeline has completed")
 	}
@@ -250,6 +273,9 @@ func (w *worker) startPipeline(parent *worker, t interface{}, ptype pipelineType
 			}
 		}
 	}
+	if isJob {
+		finishLog(c.histName, c.runIndex, ret)
+	}
 	// Release logs that shouldn't be saved
 	c.logger.Finalize()
 
@@ -323,6 +349,13 @@ func (w *worker) runPipeline(stage pipeStage, ptype pipelineType, initialRun boo
 	l := len(p)
 	for i := 0; i < l; i++ {
 		ts := p[i]
+		if ts.group != nil {
+			ret, errString = w.runParallel(ts.group)
+			if ret != robot.Normal {
+				break
+			}
+			continue
+		}
 		command := ts.Command
 		args := ts.Arguments
 		t := ts.task
@@ -415,7 +448,7 @@ func (w *worker) runPipeline(stage pipeStage, ptype pipelineType, initialRun boo
 			child := w.clone()
 			ret = child.startPipeline(w, t, ptype, command, args...)
 		} else {
-			errString, ret = w.callTask(t, command, args...)
+			errString, ret = w.callTaskRetry(ts)
 		}
 		if w.stage == finalTasks && ret != robot.Normal {
 			w.finalFailed = append(w.finalFailed, task.name)
@@ -515,11 +548,16 @@ func (w *worker) getEnvironment(t interface{}) map[string]string {
 	// These values are always fixed
 	envhash["GOPHER_CHANNEL"] = w.Channel
 	envhash["GOPHER_USER"] = w.User
-	envhash["GOPHER_PROTOCOL"] = strings.ToLower(fmt.Sprintf("%s", w.Protocol))
+	envhash["GOPHER_PROTOCOL"] = strings.ToLower(protocolName(w.Protocol))
 	envhash["GOPHER_TASK_NAME"] = c.taskName
 	envhash["GOPHER_PIPELINE_TYPE"] = c.ptype.String()
 	envhash["GOPHER_CALLER_ID"] = w.eid
-	envhash["GOPHER_HTTP_POST"] = "http://" + listenPort
+	if len(listenSocket) > 0 {
+		envhash["GOPHER_HTTP_POST"] = "http://localhost"
+		envhash["GOPHER_API_SOCKET"] = listenSocket
+	} else {
+		envhash["GOPHER_HTTP_POST"] = "http://" + listenPort
+	}
 	envhash["GOPHER_INSTALLDIR"] = installPath
 	// Configured parameters for a pipeline task don't apply if already set;
 	// task parameters are effectively default values if not otherwise
@@ -3,7 +3,7 @@ package bot
 import (
 	"sync"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 	"github.com/robfig/cron"
 )
 
@@ -70,9 +70,12 @@ func scheduleTasks() {
 
 func runScheduledTask(t interface{}, ts TaskSpec, cfg *configuration, tasks *taskList, repolist map[string]robot.Repository) {
 	task, _, _ := getTask(t)
-	currentCfg.RLock()
-	protocol := currentCfg.protocol
-	currentCfg.RUnlock()
+	protocol := task.Protocol
+	if len(protocol) == 0 {
+		currentCfg.RLock()
+		protocol = currentCfg.protocol
+		currentCfg.RUnlock()
+	}
 	pausedJobs.Lock()
 	if user, ok := pausedJobs.jobs[task.name]; ok {
 		Log(robot.Debug, "Skipping run of job '%s' paused by user '%s'", task.name, user)
@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"io"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+/* send_file.go - methods for uploading files to users and channels, and
+downloading files attached to the message that started a pipeline. Both
+require a connector implementing robot.FileConnector.
+*/
+
+// fileConnector returns the Robot's connector as a FileConnector, logging
+// a warning when the connector doesn't support files.
+func (r Robot) fileConnector() (robot.FileConnector, bool) {
+	fc, ok := r.connector().(robot.FileConnector)
+	if !ok {
+		r.Log(robot.Warn, "Connector for protocol '%s' doesn't support files", r.Protocol)
+	}
+	return fc, ok
+}
+
+// SendFile uploads a file to the Robot's channel, or to the user for
+// Direct(). The filename is the name shown for the file, and title is
+// optional. Returns FailedMessageSend if the connector doesn't support files.
+func (r Robot) SendFile(filename, title string, data io.Reader) robot.RetVal {
+	if r.Channel == "" {
+		user := r.ProtocolUser
+		if len(user) == 0 {
+			user = r.User
+		}
+		return r.sendUserFile(user, filename, title, data)
+	}
+	channel := r.ProtocolChannel
+	if len(channel) == 0 {
+		channel = r.Channel
+	}
+	return r.sendChannelFile(channel, filename, title, data)
+}
+
+// SendChannelFile uploads a file to an arbitrary channel.
+func (r Robot) SendChannelFile(ch, filename, title string, data io.Reader) robot.RetVal {
+	var channel string
+	if ci, ok := r.maps.channel[ch]; ok {
+		channel = bracket(ci.ChannelID)
+	} else {
+		channel = ch
+	}
+	return r.sendChannelFile(channel, filename, title, data)
+}
+
+// SendUserFile uploads a file to a user as a direct message.
+func (r Robot) SendUserFile(u, filename, title string, data io.Reader) robot.RetVal {
+	var user string
+	if ui, ok := r.maps.user[u]; ok {
+		user = bracket(ui.UserID)
+	} else {
+		user = u
+	}
+	return r.sendUserFile(user, filename, title, data)
+}
+
+func (r Robot) sendChannelFile(channel, filename, title string, data io.Reader) robot.RetVal {
+	if len(filename) == 0 || data == nil {
+		return robot.MissingArguments
+	}
+	fc, ok := r.fileConnector()
+	if !ok {
+		return robot.FailedMessageSend
+	}
+	return fc.SendProtocolChannelFile(channel, filename, title, data)
+}
+
+func (r Robot) sendUserFile(user, filename, title string, data io.Reader) robot.RetVal {
+	if len(filename) == 0 || data == nil {
+		return robot.MissingArguments
+	}
+	fc, ok := r.fileConnector()
+	if !ok {
+		return robot.FailedMessageSend
+	}
+	return fc.SendProtocolUserFile(user, filename, title, data)
+}
+
+// GetAttachedFiles returns information about any files the user attached
+// to the message that started the pipeline, for use with DownloadFile.
+func (r Robot) GetAttachedFiles() []robot.FileInfo {
+	if r.Incoming == nil {
+		return []robot.FileInfo{}
+	}
+	files := make([]robot.FileInfo, len(r.Incoming.Files))
+	copy(files, r.Incoming.Files)
+	return files
+}
+
+// DownloadFile writes the contents of an attached file, given by the ID
+// from GetAttachedFiles, to data. Returns FailedMessageSend if the file
+// can't be retrieved.
+func (r Robot) DownloadFile(fileid string, data io.Writer) robot.RetVal {
+	if len(fileid) == 0 || data == nil {
+		return robot.MissingArguments
+	}
+	inc := r.Incoming
+	if inc == nil {
+		r.Log(robot.Warn, "No incoming message for DownloadFile")
+		return robot.FailedMessageSend
+	}
+	found := false
+	for _, f := range inc.Files {
+		if f.ID == fileid {
+			found = true
+			break
+		}
+	}
+	if !found {
+		r.Log(robot.Error, "DownloadFile called with file ID '%s' not attached to the incoming message", fileid)
+		return robot.FailedMessageSend
+	}
+	fc, ok := getConnector(getProtocol(inc.Protocol)).(robot.FileConnector)
+	if !ok {
+		r.Log(robot.Warn, "Connector for protocol '%s' doesn't support files", inc.Protocol)
+		return robot.FailedMessageSend
+	}
+	return fc.GetProtocolFile(fileid, data)
+}
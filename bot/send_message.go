@@ -3,7 +3,7 @@ package bot
 import (
 	"fmt"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 /* send_message.go - all the message sending methods for a worker or a Robot.
@@ -23,7 +23,7 @@ func (r Robot) messageHeard() {
 	if len(channel) == 0 {
 		channel = r.Channel
 	}
-	interfaces.MessageHeard(user, channel)
+	r.connector().MessageHeard(user, channel)
 }
 
 func (w *worker) messageHeard() {
@@ -35,7 +35,7 @@ func (w *worker) messageHeard() {
 	if len(channel) == 0 {
 		channel = w.Channel
 	}
-	interfaces.MessageHeard(user, channel)
+	w.connector().MessageHeard(user, channel)
 }
 
 // SendChannelMessage lets a plugin easily send a message to an arbitrary
@@ -55,7 +55,7 @@ func (r Robot) SendChannelMessage(ch, msg string, v ...interface{}) robot.RetVal
 	} else {
 		channel = ch
 	}
-	return interfaces.SendProtocolChannelMessage(channel, msg, r.Format)
+	return r.connector().SendProtocolChannelMessage(channel, msg, r.Format)
 }
 
 func (w *worker) SendChannelMessage(ch, msg string, v ...interface{}) robot.RetVal {
@@ -68,7 +68,7 @@ func (w *worker) SendChannelMessage(ch, msg string, v ...interface{}) robot.RetV
 	} else {
 		channel = ch
 	}
-	return interfaces.SendProtocolChannelMessage(channel, msg, w.Format)
+	return w.connector().SendProtocolChannelMessage(channel, msg, w.Format)
 }
 
 // SendUserChannelMessage lets a plugin easily send a message directed to
@@ -96,7 +96,7 @@ func (r Robot) SendUserChannelMessage(u, ch, msg string, v ...interface{}) robot
 	} else {
 		channel = ch
 	}
-	return interfaces.SendProtocolUserChannelMessage(user, u, channel, msg, r.Format)
+	return r.connector().SendProtocolUserChannelMessage(user, u, channel, msg, r.Format)
 }
 
 func (w *worker) SendUserChannelMessage(u, ch, msg string, v ...interface{}) robot.RetVal {
@@ -115,7 +115,7 @@ func (w *worker) SendUserChannelMessage(u, ch, msg string, v ...interface{}) rob
 	} else {
 		channel = ch
 	}
-	return interfaces.SendProtocolUserChannelMessage(user, u, channel, msg, w.Format)
+	return w.connector().SendProtocolUserChannelMessage(user, u, channel, msg, w.Format)
 }
 
 // SendUserMessage lets a plugin easily send a DM to a user. If a DM
@@ -135,7 +135,7 @@ func (r Robot) SendUserMessage(u, msg string, v ...interface{}) robot.RetVal {
 	} else {
 		user = u
 	}
-	return interfaces.SendProtocolUserMessage(user, msg, r.Format)
+	return r.connector().SendProtocolUserMessage(user, msg, r.Format)
 }
 
 func (w *worker) SendUserMessage(u, msg string, v ...interface{}) robot.RetVal {
@@ -148,7 +148,7 @@ func (w *worker) SendUserMessage(u, msg string, v ...interface{}) robot.RetVal {
 	} else {
 		user = u
 	}
-	return interfaces.SendProtocolUserMessage(user, msg, w.Format)
+	return w.connector().SendProtocolUserMessage(user, msg, w.Format)
 }
 
 // Reply directs a message to the user
@@ -166,7 +166,7 @@ func (r Robot) Reply(msg string, v ...interface{}) robot.RetVal {
 	}
 	// Support for Direct()
 	if r.Channel == "" {
-		return interfaces.SendProtocolUserMessage(user, msg, r.Format)
+		return r.connector().SendProtocolUserMessage(user, msg, r.Format)
 	}
 	channel := r.ProtocolChannel
 	if len(channel) == 0 {
@@ -175,9 +175,9 @@ func (r Robot) Reply(msg string, v ...interface{}) robot.RetVal {
 	w := getLockedWorker(r.tid)
 	w.Unlock()
 	if w.BotUser {
-		return interfaces.SendProtocolChannelMessage(r.Channel, r.User+": "+msg, r.Format)
+		return r.connector().SendProtocolChannelMessage(r.Channel, r.User+": "+msg, r.Format)
 	}
-	return interfaces.SendProtocolUserChannelMessage(user, r.User, r.Channel, msg, r.Format)
+	return r.connector().SendProtocolUserChannelMessage(user, r.User, r.Channel, msg, r.Format)
 }
 
 func (w *worker) Reply(msg string, v ...interface{}) robot.RetVal {
@@ -190,16 +190,16 @@ func (w *worker) Reply(msg string, v ...interface{}) robot.RetVal {
 	}
 	// Support for Direct()
 	if w.Channel == "" {
-		return interfaces.SendProtocolUserMessage(user, msg, w.Format)
+		return w.connector().SendProtocolUserMessage(user, msg, w.Format)
 	}
 	channel := w.ProtocolChannel
 	if len(channel) == 0 {
 		channel = w.Channel
 	}
 	if w.BotUser {
-		return interfaces.SendProtocolChannelMessage(w.Channel, w.User+": "+msg, w.Format)
+		return w.connector().SendProtocolChannelMessage(w.Channel, w.User+": "+msg, w.Format)
 	}
-	return interfaces.SendProtocolUserChannelMessage(user, w.User, w.Channel, msg, w.Format)
+	return w.connector().SendProtocolUserChannelMessage(user, w.User, w.Channel, msg, w.Format)
 }
 
 // Say just sends a message to the user or channel
@@ -217,13 +217,13 @@ func (r Robot) Say(msg string, v ...interface{}) robot.RetVal {
 		if len(user) == 0 {
 			user = r.User
 		}
-		return interfaces.SendProtocolUserMessage(user, msg, r.Format)
+		return r.connector().SendProtocolUserMessage(user, msg, r.Format)
 	}
 	channel := r.ProtocolChannel
 	if len(channel) == 0 {
 		channel = r.Channel
 	}
-	return interfaces.SendProtocolChannelMessage(channel, msg, r.Format)
+	return r.connector().SendProtocolChannelMessage(channel, msg, r.Format)
 }
 
 func (w *worker) Say(msg string, v ...interface{}) robot.RetVal {
@@ -236,11 +236,214 @@ func (w *worker) Say(msg string, v ...interface{}) robot.RetVal {
 		if len(user) == 0 {
 			user = w.User
 		}
-		return interfaces.SendProtocolUserMessage(user, msg, w.Format)
+		return w.connector().SendProtocolUserMessage(user, msg, w.Format)
 	}
 	channel := w.ProtocolChannel
 	if len(channel) == 0 {
 		channel = w.Channel
 	}
-	return interfaces.SendProtocolChannelMessage(channel, msg, w.Format)
+	return w.connector().SendProtocolChannelMessage(channel, msg, w.Format)
+}
+
+// ReplyThread is like Reply, but sends the message in a thread. The first
+// threaded message a pipeline sends in a channel goes to the thread of the
+// message that started the pipeline (starting one if needed), and all further
+// threaded messages from the pipeline to that channel go to the same thread.
+// For connectors without threads, this is the same as Reply.
+func (r Robot) ReplyThread(msg string, v ...interface{}) robot.RetVal {
+	if len(msg) == 0 {
+		r.Log(robot.Warn, "Ignoring zero-length message in ReplyThread")
+		return robot.Ok
+	}
+	if len(v) > 0 {
+		msg = fmt.Sprintf(msg, v...)
+	}
+	// Support for Direct()
+	if r.Channel == "" {
+		return r.Reply(msg)
+	}
+	return r.sendThread(true, msg)
+}
+
+// SayThread is like Say, but sends the message in the pipeline's thread;
+// see ReplyThread.
+func (r Robot) SayThread(msg string, v ...interface{}) robot.RetVal {
+	if len(msg) == 0 {
+		r.Log(robot.Warn, "Ignoring zero-length message in SayThread")
+		return robot.Ok
+	}
+	if len(v) > 0 {
+		msg = fmt.Sprintf(msg, v...)
+	}
+	// Support for Direct()
+	if r.Channel == "" {
+		return r.Say(msg)
+	}
+	return r.sendThread(false, msg)
+}
+
+// sendThread sends a message to the pipeline's thread for the Robot's
+// channel, directed at the user when reply is true.
+func (r Robot) sendThread(reply bool, msg string) robot.RetVal {
+	tc, ok := r.connector().(robot.ThreadConnector)
+	if !ok {
+		if reply {
+			return r.Reply(msg)
+		}
+		return r.Say(msg)
+	}
+	user := r.ProtocolUser
+	if len(user) == 0 {
+		user = r.User
+	}
+	channel := r.ProtocolChannel
+	if len(channel) == 0 {
+		channel = r.Channel
+	}
+	// The thread lock is held while sending, so concurrent tasks in the
+	// pipeline don't start separate threads; the worker itself is only
+	// locked to read and store the thread, since sends can block.
+	w := getLockedWorker(r.tid)
+	w.Unlock()
+	w.threadLock.Lock()
+	defer w.threadLock.Unlock()
+	w.Lock()
+	thread, ok := w.threads[channel]
+	w.Unlock()
+	if !ok {
+		thread = r.incomingThread(channel)
+	}
+	var ret robot.RetVal
+	switch {
+	case !reply:
+		thread, ret = tc.SendProtocolChannelThreadMessage(channel, thread, msg, r.Format)
+	case w.BotUser:
+		thread, ret = tc.SendProtocolChannelThreadMessage(channel, thread, r.User+": "+msg, r.Format)
+	default:
+		thread, ret = tc.SendProtocolUserChannelThreadMessage(user, r.User, channel, thread, msg, r.Format)
+	}
+	if ret == robot.Ok && len(thread) > 0 {
+		w.Lock()
+		if w.threads == nil {
+			w.threads = make(map[string]string)
+		}
+		w.threads[channel] = thread
+		w.Unlock()
+	}
+	return ret
+}
+
+// incomingThread returns the thread for the first threaded message sent to
+// a channel; when the message that started the pipeline came from the same
+// channel, that's the message's thread, or a new thread started from the
+// message. Otherwise it returns "", for starting a new thread.
+func (r Robot) incomingThread(channel string) string {
+	inc := r.Incoming
+	if inc == nil || inc.DirectMessage || getProtocol(inc.Protocol) != r.Protocol {
+		return ""
+	}
+	if channel != bracket(inc.ChannelID) && r.Channel != inc.ChannelName {
+		return ""
+	}
+	if len(inc.ThreadID) > 0 {
+		return inc.ThreadID
+	}
+	return inc.MessageID
+}
+
+// progressMessage is a message sent with SayProgress, for updating with
+// UpdateProgress.
+type progressMessage struct {
+	protocol      robot.Protocol
+	messageID     string // connector message ID, "" if the connector can't edit messages
+	user, channel string // where to send updates when the message can't be edited
+	format        robot.MessageFormat
+}
+
+// SayProgress sends a message to the Robot's channel (or user, for Direct())
+// that any task in the pipeline can update with UpdateProgress, e.g. to show
+// the status of a long-running job. Returns a handle for UpdateProgress.
+func (r Robot) SayProgress(msg string, v ...interface{}) (string, robot.RetVal) {
+	if len(msg) == 0 {
+		r.Log(robot.Warn, "Ignoring zero-length message in SayProgress")
+		return "", robot.Ok
+	}
+	if len(v) > 0 {
+		msg = fmt.Sprintf(msg, v...)
+	}
+	pm := &progressMessage{
+		protocol: r.Protocol,
+		user:     r.ProtocolUser,
+		channel:  r.ProtocolChannel,
+		format:   r.Format,
+	}
+	if len(pm.user) == 0 {
+		pm.user = r.User
+	}
+	// Support for Direct()
+	if r.Channel == "" {
+		pm.channel = ""
+	} else if len(pm.channel) == 0 {
+		pm.channel = r.Channel
+	}
+	var ret robot.RetVal
+	if ec, ok := r.connector().(robot.EditConnector); ok {
+		if pm.channel == "" {
+			pm.messageID, ret = ec.SendProtocolUserEditableMessage(pm.user, msg, pm.format)
+		} else {
+			pm.messageID, ret = ec.SendProtocolChannelEditableMessage(pm.channel, msg, pm.format)
+		}
+	} else {
+		ret = r.Say(msg)
+	}
+	if ret != robot.Ok {
+		return "", ret
+	}
+	w := getLockedWorker(r.tid)
+	if w.progress == nil {
+		w.progress = make(map[string]*progressMessage)
+	}
+	handle := fmt.Sprintf("progress%d", len(w.progress)+1)
+	w.progress[handle] = pm
+	w.lastProgress = handle
+	w.Unlock()
+	return handle, robot.Ok
+}
+
+// UpdateProgress replaces the text of a message sent with SayProgress; when
+// handle is "", the pipeline's most recent progress message is updated, or
+// a new one is sent. For connectors that can't edit messages, the update is
+// sent as a new message.
+func (r Robot) UpdateProgress(handle, msg string, v ...interface{}) robot.RetVal {
+	if len(msg) == 0 {
+		r.Log(robot.Warn, "Ignoring zero-length message in UpdateProgress")
+		return robot.Ok
+	}
+	if len(v) > 0 {
+		msg = fmt.Sprintf(msg, v...)
+	}
+	w := getLockedWorker(r.tid)
+	if len(handle) == 0 {
+		handle = w.lastProgress
+	}
+	pm, ok := w.progress[handle]
+	w.Unlock()
+	if !ok {
+		if len(handle) == 0 {
+			_, ret := r.SayProgress(msg)
+			return ret
+		}
+		r.Log(robot.Error, "UpdateProgress called with unknown handle '%s'", handle)
+		return robot.FailedMessageSend
+	}
+	conn := getConnector(pm.protocol)
+	if len(pm.messageID) > 0 {
+		if ec, ok := conn.(robot.EditConnector); ok {
+			return ec.UpdateProtocolMessage(pm.messageID, msg, pm.format)
+		}
+	}
+	if pm.channel == "" {
+		return conn.SendProtocolUserMessage(pm.user, msg, pm.format)
+	}
+	return conn.SendProtocolChannelMessage(pm.channel, msg, pm.format)
 }
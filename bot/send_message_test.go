@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+func TestThreadFallback(t *testing.T) {
+	primary, _ := setupSecondary(t)
+	r := protocolRobot(t, robot.Test)
+
+	if ret := r.SayThread("Starting the build"); ret != robot.Ok {
+		t.Errorf("SayThread: %s", ret)
+	}
+	if ret := r.ReplyThread("Build finished"); ret != robot.Ok {
+		t.Errorf("ReplyThread: %s", ret)
+	}
+	r.Direct().SayThread("Sent directly")
+	checkSent(t, "primary", primary, []string{
+		"channel <c0001>: Starting the build",
+		"user <u0001> in channel general: Build finished",
+		"user <u0001>: Sent directly",
+	})
+	w := getLockedWorker(r.tid)
+	threads := len(w.threads)
+	w.Unlock()
+	if threads != 0 {
+		t.Errorf("thread recorded for a connector without threads")
+	}
+}
+
+func TestProgressFallback(t *testing.T) {
+	primary, _ := setupSecondary(t)
+	r := protocolRobot(t, robot.Test)
+
+	handle, ret := r.SayProgress("Build 1/3")
+	if ret != robot.Ok || len(handle) == 0 {
+		t.Fatalf("SayProgress: %s, handle %q", ret, handle)
+	}
+	if ret := r.UpdateProgress(handle, "Build 2/3"); ret != robot.Ok {
+		t.Errorf("UpdateProgress with handle: %s", ret)
+	}
+	if ret := r.UpdateProgress("", "Build 3/3"); ret != robot.Ok {
+		t.Errorf("UpdateProgress with empty handle: %s", ret)
+	}
+	if ret := r.UpdateProgress("progress99", "Lost update"); ret != robot.FailedMessageSend {
+		t.Errorf("UpdateProgress with unknown handle: want FailedMessageSend, got %s", ret)
+	}
+	d := r.Direct()
+	dhandle, _ := d.SayProgress("Deploying")
+	d.UpdateProgress(dhandle, "Deployed")
+	checkSent(t, "primary", primary, []string{
+		"channel <c0001>: Build 1/3",
+		"channel <c0001>: Build 2/3",
+		"channel <c0001>: Build 3/3",
+		"user <u0001>: Deploying",
+		"user <u0001>: Deployed",
+	})
+}
@@ -7,7 +7,7 @@ import (
 	"os/signal"
 	"runtime"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 	"golang.org/x/sys/unix"
 )
 
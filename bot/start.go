@@ -13,7 +13,7 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 	"golang.org/x/sys/unix"
 )
 
@@ -105,14 +105,20 @@ func Start(v VersionInfo) {
 
 	usage := `Usage: gopherbot [options] [command [command options] [command args]]
   "command" can be one of:
+	brain-locks - list brain locks and lock statistics for the running robot
 	decrypt - decrypt a string or file
 	encrypt - encrypt a string or file
 	delete - delete a memory
 	dump (installed|configured) [path/to/file.yaml] -
 	  read and dump a raw config file, for yaml troubleshooting
+	export-brain - export all memories to a portable, encrypted file
 	fetch - fetch the contents of a memory
+	import-brain - import memories from an export
 	init (protocol) - create a new robot in currect directory
 	list - list robot memories
+	migrate-brain - copy all memories to a different brain provider
+	release-lock - force-release a brain lock in the running robot
+	rotate-key - rotate encryption keys and re-encrypt memories
 	run - run the robot (default)
 	store - store a memory
 	version - display the gopherbot version
@@ -377,12 +383,14 @@ func Start(v VersionInfo) {
 	// NOTE: we use setConnector instead of passing the connector to run()
 	// because of the way Windows services were run. Maybe remove eventually?
 	setConnector(conn)
+	initSecondaryConnectors(logger)
 
 	// Start the robot loops
 	run()
 	// ... and wait for the robot to stop
 	restart := <-done
 	raiseThreadPrivExternal("Exiting")
+	removeAPISocket()
 	time.Sleep(time.Second)
 	if restart {
 		if defaultProto {
@@ -13,7 +13,7 @@ import (
 	"path/filepath"
 	"testing"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var testInstallPath string
@@ -63,6 +63,7 @@ func StartTest(v VersionInfo, cfgdir, logfile string, t *testing.T) (chan bool,
 	// NOTE: we use setConnector instead of passing the connector to run()
 	// because of the way Windows services were run. Maybe remove eventually?
 	setConnector(conn)
+	initSecondaryConnectors(botLogger.l)
 
 	run()
 
@@ -11,3 +11,7 @@ func RegisterPreload(s string) {
 func loadModules(p, b, h string, m []LoadableModule) {
 
 }
+
+func loadBrainModule(b string) {
+
+}
@@ -5,9 +5,10 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/ghodss/yaml"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // loadTaskConfig() updates task/job/plugin configuration and namespaces
@@ -72,6 +73,10 @@ func loadTaskConfig(processed *configuration) (*taskList, error) {
 		}
 		task.Description = ts.Description
 		task.Parameters = ts.Parameters
+		task.Retry = ts.Retry
+		if err := task.setRetry(); err != nil {
+			return false, err
+		}
 		return false, nil
 	}
 
@@ -128,12 +133,16 @@ func loadTaskConfig(processed *configuration) (*taskList, error) {
 			taskType:    taskExternal,
 			Description: ts.Description,
 			Parameters:  ts.Parameters,
+			Timeout:     ts.Timeout,
 		}
 		// Note that disabled external tasks are skipped in conf.go
 		_, err := checkTaskSettings(ts, task)
 		if err != nil {
 			return nil, err
 		}
+		if err := task.setTimeout(); err != nil {
+			return nil, err
+		}
 		if len(ts.Path) == 0 {
 			return nil, fmt.Errorf("zero-length path for external task '%s'", ts.Name)
 		}
@@ -284,10 +293,11 @@ LoadLoop:
 			var hval []PluginHelp
 			var mval []InputMatcher
 			var tval []JobTrigger
+			var rval RetryPolicy
 			var val interface{}
 			skip := false
 			switch key {
-			case "Elevator", "Authorizer", "AuthRequire", "NameSpace", "Channel":
+			case "Elevator", "Authorizer", "AuthRequire", "NameSpace", "Channel", "Protocol", "Timeout":
 				val = &strval
 			case "KeepLogs":
 				val = &intval
@@ -303,6 +313,8 @@ LoadLoop:
 				val = &mval
 			case "Triggers":
 				val = &tval
+			case "Retry":
+				val = &rval
 			case "Config":
 				skip = true
 			case "Privileged":
@@ -336,6 +348,14 @@ LoadLoop:
 			// plugins can be scheduled, so Channel applies to both
 			case "Channel":
 				task.Channel = *(val.(*string))
+			// the connector protocol Channel belongs to, if not the primary
+			case "Protocol":
+				protocol := *(val.(*string))
+				if tp, ok := processed.taskProtocol(protocol); ok {
+					task.Protocol = tp
+				} else {
+					Log(robot.Error, "Task '%s' specifies Protocol '%s' that isn't configured, using '%s'", task.name, protocol, processed.protocol)
+				}
 			// Channels are only used for plugin visibility
 			case "Channels":
 				if isPlugin {
@@ -372,6 +392,10 @@ LoadLoop:
 				}
 			case "Users":
 				task.Users = *(val.(*[]string))
+			case "Timeout":
+				task.Timeout = *(val.(*string))
+			case "Retry":
+				task.Retry = *(val.(*RetryPolicy))
 			case "KeepLogs":
 				if isPlugin {
 					mismatch = true
@@ -467,6 +491,20 @@ LoadLoop:
 		// End of reading configuration keys
 
 		// Start sanity checking of configuration
+		if err := task.setTimeout(); err != nil {
+			msg := fmt.Sprintf("Disabling task '%s' - %v", task.name, err)
+			Log(robot.Error, msg)
+			task.Disabled = true
+			task.reason = msg
+			continue
+		}
+		if err := task.setRetry(); err != nil {
+			msg := fmt.Sprintf("Disabling task '%s' - %v", task.name, err)
+			Log(robot.Error, msg)
+			task.Disabled = true
+			task.reason = msg
+			continue
+		}
 		if task.DirectOnly {
 			if explicitAllowDirect {
 				if !task.AllowDirect {
@@ -576,6 +614,17 @@ LoadLoop:
 					task.reason = msg
 					continue LoadLoop
 				}
+				if len(trigger.Reaction) > 0 {
+					if len(trigger.Regex) > 0 {
+						msg := fmt.Sprintf("Disabling '%s', trigger #%d specifies both Regex and Reaction", task.name, i+1)
+						Log(robot.Error, msg)
+						task.Disabled = true
+						task.reason = msg
+						continue LoadLoop
+					}
+					trigger.Reaction = strings.Trim(trigger.Reaction, ":")
+					continue
+				}
 				re, err := regexp.Compile(trigger.Regex)
 				if err != nil {
 					msg := fmt.Sprintf("Disabling '%s', couldn't compile trigger regular expression '%s': %v", task.name, trigger.Regex, err)
@@ -597,6 +646,13 @@ LoadLoop:
 					task.reason = msg
 					continue LoadLoop
 				}
+				if len(argument.Choices) > 0 && len(argument.Regex) == 0 {
+					choices := make([]string, len(argument.Choices))
+					for i, choice := range argument.Choices {
+						choices[i] = regexp.QuoteMeta(choice)
+					}
+					argument.Regex = `(?:` + strings.Join(choices, "|") + `)`
+				}
 				regex := `^\s*` + argument.Regex + `\s*$`
 				re, err := regexp.Compile(regex)
 				if err != nil {
@@ -2,12 +2,14 @@ package bot
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"regexp"
 	"runtime"
 	"sync"
+	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // Regex for task/job/plugin/NameSpace names. NOTE: if this changes,
@@ -79,7 +81,10 @@ type TaskSpec struct {
 	Name      string // name of the job or plugin
 	Command   string // plugins only
 	Arguments []string
-	task      interface{} // populated in AddTask
+	task      interface{}   // populated in AddTask
+	timeout   time.Duration // overrides the task's Timeout, from AddTask
+	retry     *taskRetry    // overrides the task's Retry, from AddTask
+	group     []TaskSpec    // members of a parallel group, see AddParallelTask
 }
 
 // TaskSettings struct used for configuration of: ExternalPlugins, ExternalJobs,
@@ -87,6 +92,8 @@ type TaskSpec struct {
 // Not every field is used in every case.
 type TaskSettings struct {
 	Name, Path, Description, NameSpace string
+	Timeout                            string      // e.g. "30m"; external tasks running longer are killed
+	Retry                              RetryPolicy // for re-running the task when it fails
 	Disabled                           bool
 	Homed                              bool
 	Privileged                         *bool
@@ -117,15 +124,17 @@ type InputMatcher struct {
 	Command  string         // The name of the command to pass to the plugin with it's arguments
 	Label    string         // ReplyMatchers use "Label" instead of "Command"
 	Contexts []string       // label the contexts corresponding to capture groups, for supporting "it" & optional args
+	Choices  []string       // for job Arguments, a fixed set of values to prompt with; the default Regex matches any of them
 	re       *regexp.Regexp // The compiled regular expression. If the regex doesn't compile, the 'bot will log an error
 }
 
-// JobTrigger specifies a user and message to trigger a job
+// JobTrigger specifies a user and message or reaction to trigger a job
 type JobTrigger struct {
-	Regex   string         // The regular expression string to match - bot adds ^\w* & \w*$
-	User    string         // required user to trigger this job, normally git-activated webhook or integration
-	Channel string         // required channel for the trigger
-	re      *regexp.Regexp // The compiled regular expression. If the regex doesn't compile, the 'bot will log an error
+	Regex    string         // The regular expression string to match - bot adds ^\w* & \w*$
+	Reaction string         // reaction (emoji) name to match instead of a message, e.g. "rocket"
+	User     string         // required user to trigger this job, normally git-activated webhook or integration
+	Channel  string         // required channel for the trigger
+	re       *regexp.Regexp // The compiled regular expression. If the regex doesn't compile, the 'bot will log an error
 }
 
 // NameSpace just stores a name, description, and parameters - they cannot be run.
@@ -147,6 +156,7 @@ type Task struct {
 	AllowDirect  bool              // Set this true if this plugin can be accessed via direct message
 	DirectOnly   bool              // Set this true if this plugin ONLY accepts direct messages
 	Channel      string            // channel where a job can be interracted with, channel where a scheduled task (job or plugin) runs
+	Protocol     string            // secondary connector protocol the Channel belongs to; "" for the primary protocol
 	Channels     []string          // plugins only; Channels where the plugin is available - rifraf like "memes" should probably only be in random, but it's configurable. If empty uses DefaultChannels
 	AllChannels  bool              // If the Channels list is empty and AllChannels is true, the plugin should be active in all the channels the bot is in
 	RequireAdmin bool              // Set to only allow administrators to access a plugin / run job
@@ -166,6 +176,30 @@ type Task struct {
 	// Homed for jobs/plugins starts the pipeline with c.basePath = ".", Homed tasks
 	// always run in ".", e.g. "ssh-init"
 	Homed bool
+	// Timeout for external tasks, e.g. "30m"; when a task runs longer, its
+	// process group is killed and the task fails with TaskTimeout
+	Timeout string
+	timeout time.Duration
+	// Retry policy for re-running the task when it fails in a pipeline
+	Retry RetryPolicy
+	retry *taskRetry
+}
+
+// setTimeout parses the task's Timeout
+func (t *Task) setTimeout() error {
+	t.timeout = 0
+	if len(t.Timeout) == 0 {
+		return nil
+	}
+	d, err := time.ParseDuration(t.Timeout)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid Timeout '%s' for task '%s', should be e.g. '30m'", t.Timeout, t.name)
+	}
+	if t.taskType == taskGo {
+		Log(robot.Warn, "Timeout for Go task '%s' ignored, only external tasks can be killed", t.name)
+	}
+	t.timeout = d
+	return nil
 }
 
 // Job - configuration only applicable to jobs. Read in from conf/jobs/<job>.yaml, which can also include anything from a Task.
@@ -174,6 +208,7 @@ type Job struct {
 	KeepLogs  int            // how many runs of this job/plugin to keep history for
 	Triggers  []JobTrigger   // user/regex that triggers a job, e.g. a git-activated webhook or integration
 	Arguments []InputMatcher // list of arguments to prompt the user for
+	Webhook   bool           // accept webhooks at /webhook/<jobname> on the WebhookListen address
 	*Task
 }
 
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+func TestSetTimeout(t *testing.T) {
+	cases := []struct {
+		timeout string
+		want    time.Duration
+		err     bool
+	}{
+		{"", 0, false},
+		{"30m", 30 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"0s", 0, false},
+		{"30", 0, true},
+		{"soon", 0, true},
+		{"-5m", 0, true},
+	}
+	for _, c := range cases {
+		task := &Task{name: "timed", taskType: taskExternal, Timeout: c.timeout, timeout: time.Hour}
+		err := task.setTimeout()
+		if (err != nil) != c.err {
+			t.Errorf("Timeout '%s': want error %t, got %v", c.timeout, c.err, err)
+			continue
+		}
+		if task.timeout != c.want {
+			t.Errorf("Timeout '%s': want %s, got %s", c.timeout, c.want, task.timeout)
+		}
+	}
+}
+
+func TestAddTaskTimeout(t *testing.T) {
+	w := setupParallelTasks(t, map[string]robot.TaskHandler{
+		"a": {Handler: normalTask},
+		"b": {Handler: normalTask},
+	})
+	r := pipelineRobot(t, w)
+	if ret := r.TaskTimeout(10 * time.Minute).AddTask("a"); ret != robot.Ok {
+		t.Fatalf("AddTask with a timeout: %s", ret)
+	}
+	// the timeout only applies to the task it was added with
+	if ret := r.AddTask("b"); ret != robot.Ok {
+		t.Fatalf("AddTask: %s", ret)
+	}
+	w.Lock()
+	defer w.Unlock()
+	if len(w.nextTasks) != 2 {
+		t.Fatalf("want 2 tasks in the pipeline, got %d", len(w.nextTasks))
+	}
+	if got := w.nextTasks[0].timeout; got != 10*time.Minute {
+		t.Errorf("want a 10m timeout for 'a', got %s", got)
+	}
+	if got := w.nextTasks[1].timeout; got != 0 {
+		t.Errorf("want no timeout override for 'b', got %s", got)
+	}
+}
@@ -10,8 +10,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/lnxjedi/gopherbot/robot"
 	"github.com/lnxjedi/readline"
-	"github.com/lnxjedi/robot"
 )
 
 func init() {
@@ -50,6 +50,7 @@ type termConnector struct {
 	channels       []string           // the channels the robot is in
 	heard          chan string        // when the user speaks
 	reader         *readline.Instance // readline for speaking
+	msgCount       int                // for generating IDs of editable messages
 	robot.Handler                     // bot API for connectors
 	sync.RWMutex                      // shared mutex for locking connector data structures
 }
@@ -420,6 +421,46 @@ func (tc *termConnector) SendProtocolUserMessage(u string, msg string, f robot.M
 	return tc.sendMessage(fmt.Sprintf("(dm:%s)", user.Name), msg, f)
 }
 
+// SendProtocolChannelEditableMessage sends a message to a channel, returning
+// "<channel>:<message number>" for updates
+func (tc *termConnector) SendProtocolChannelEditableMessage(ch, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	channel := tc.getChannel(ch)
+	return tc.sendEditableMessage(channel, msg, f)
+}
+
+// SendProtocolUserEditableMessage sends a direct message to a user,
+// returning an ID for updates
+func (tc *termConnector) SendProtocolUserEditableMessage(u, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	var user *termUser
+	var exists bool
+	if user, exists = tc.getUserInfo(u); !exists {
+		return "", robot.UserNotFound
+	}
+	return tc.sendEditableMessage(fmt.Sprintf("(dm:%s)", user.Name), msg, f)
+}
+
+func (tc *termConnector) sendEditableMessage(ch, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	if ret := tc.sendMessage(ch, msg, f); ret != robot.Ok {
+		return "", ret
+	}
+	tc.Lock()
+	tc.msgCount++
+	id := fmt.Sprintf("%s:%d", ch, tc.msgCount)
+	tc.Unlock()
+	return id, robot.Ok
+}
+
+// UpdateProtocolMessage can't edit terminal output, so it writes the updated
+// message as a new line marked "(updated)"
+func (tc *termConnector) UpdateProtocolMessage(msgID, msg string, f robot.MessageFormat) robot.RetVal {
+	i := strings.LastIndex(msgID, ":")
+	if i < 0 {
+		tc.Log(robot.Error, "invalid terminal message ID for update: %s", msgID)
+		return robot.FailedMessageSend
+	}
+	return tc.sendMessage(msgID[:i], "(updated) "+msg, f)
+}
+
 // JoinChannel joins a channel given it's human-readable name, e.g. "general"
 // Only useful for connectors that require it, a noop otherwise
 func (tc *termConnector) JoinChannel(c string) (ret robot.RetVal) {
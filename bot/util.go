@@ -7,9 +7,10 @@ import (
 	"regexp"
 	godebug "runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var idRegex = regexp.MustCompile(`^<(.*)>$`)
@@ -124,6 +125,15 @@ func setFormat(format string) robot.MessageFormat {
 	}
 }
 
+// otherProtocols assigns a distinct id to each protocol without a constant
+// in robot, so two unknown secondary protocols never share an id.
+var otherProtocols = struct {
+	ids map[string]robot.Protocol
+	sync.Mutex
+}{
+	ids: make(map[string]robot.Protocol),
+}
+
 // getProtocol takes a string name of the protocol and returns the constant and
 // the name of the loadable module, if any.
 func getProtocol(proto string) robot.Protocol {
@@ -137,17 +147,61 @@ func getProtocol(proto string) robot.Protocol {
 		return robot.Null
 	case "rocket":
 		return robot.Rocket
-	default:
+	case "irc":
+		return robot.IRC
+	case "test":
 		return robot.Test
+	default:
+		otherProtocols.Lock()
+		defer otherProtocols.Unlock()
+		if p, ok := otherProtocols.ids[proto]; ok {
+			return p
+		}
+		p := robot.IRC + 1 + robot.Protocol(len(otherProtocols.ids))
+		otherProtocols.ids[proto] = p
+		return p
 	}
 }
 
+// protocolName returns the name for a protocol id, including ids assigned
+// by getProtocol to protocols unknown to robot.
+func protocolName(p robot.Protocol) string {
+	if p <= robot.IRC {
+		return p.String()
+	}
+	otherProtocols.Lock()
+	defer otherProtocols.Unlock()
+	for name, id := range otherProtocols.ids {
+		if id == p {
+			return name
+		}
+	}
+	return p.String()
+}
+
 func updateRegexes() {
 	currentCfg.RLock()
 	name := currentCfg.botinfo.UserName
 	protoMention := currentCfg.botinfo.protoMention
 	alias := currentCfg.alias
+	secondaryProtocols := currentCfg.secondaryProtocols
 	currentCfg.RUnlock()
+	primary := compileRegexes(name, protoMention, alias)
+	secondary := make(map[robot.Protocol]*botRegexes)
+	secondaryInfo.RLock()
+	for _, sp := range secondaryProtocols {
+		p := getProtocol(sp.Protocol)
+		secondary[p] = compileRegexes(name, secondaryInfo.mention[p], alias)
+	}
+	secondaryInfo.RUnlock()
+	regexes.Lock()
+	regexes.botRegexes = *primary
+	regexes.secondary = secondary
+	regexes.Unlock()
+}
+
+// compileRegexes compiles and logs the regexes for a given mention string
+func compileRegexes(name, protoMention string, alias rune) *botRegexes {
 	pre, post, bare, errpre, errpost, errbare := updateRegexesWrapped(name, protoMention, alias)
 	if errpre != nil {
 		Log(robot.Error, "Compiling pre regex: %s", errpre)
@@ -167,11 +221,7 @@ func updateRegexes() {
 	if bare != nil {
 		Log(robot.Debug, "Setting bare regex to: %s", bare)
 	}
-	regexes.Lock()
-	regexes.preRegex = pre
-	regexes.postRegex = post
-	regexes.bareRegex = bare
-	regexes.Unlock()
+	return &botRegexes{pre, post, bare}
 }
 
 // TODO: write unit test. The regexes produced shouldn't be checked, but rather
@@ -0,0 +1,260 @@
+package bot
+
+/* webhook.go - an optional inbound HTTP listener for starting jobs from
+   webhooks, e.g. from GitHub or GitLab. Jobs with Webhook: true accept
+   POSTs to /webhook/<jobname> on the WebhookListen address. Requests are
+   verified with a per-job secret stored in the brain, and the payload is
+   made available to the job as parameters and a file.
+*/
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// Memory holding a map of job name -> webhook secret
+const webhookSecrets = "bot:webhook-secrets"
+
+// Largest payload accepted by the listener
+const maxWebhookPayload = 10 * 1024 * 1024
+
+// Payloads up to this size are also provided in GOPHER_WEBHOOK_PAYLOAD
+const maxWebhookParameter = 32 * 1024
+
+// Timeouts for the webhook server, which is usually reachable from the
+// internet; a slow or idle client can't hold a connection open forever.
+const (
+	webhookReadHeaderTimeout = 10 * time.Second
+	webhookReadTimeout       = 30 * time.Second
+	webhookWriteTimeout      = 30 * time.Second
+	webhookIdleTimeout       = 2 * time.Minute
+)
+
+var webhookListening bool
+
+// webhookRequest carries a verified webhook in to the job's pipeline
+type webhookRequest struct {
+	source      string // "github" or "gitlab"
+	event       string // event type from the request headers, e.g. "push"
+	delivery    string // unique ID for the delivery, if provided
+	payload     []byte // raw request body
+	payloadFile string // path to a file with the request body
+}
+
+// setEnvironment exposes the webhook to the pipeline as parameters
+func (wr *webhookRequest) setEnvironment(env map[string]string) {
+	env["GOPHER_WEBHOOK_SOURCE"] = wr.source
+	env["GOPHER_WEBHOOK_EVENT"] = wr.event
+	env["GOPHER_WEBHOOK_DELIVERY"] = wr.delivery
+	env["GOPHER_WEBHOOK_PAYLOAD_FILE"] = wr.payloadFile
+	if len(wr.payload) <= maxWebhookParameter {
+		env["GOPHER_WEBHOOK_PAYLOAD"] = string(wr.payload)
+	}
+}
+
+// describe returns a short description for messages and logs
+func (wr *webhookRequest) describe() string {
+	desc := wr.source + " webhook"
+	if len(wr.event) > 0 {
+		desc += ", event '" + wr.event + "'"
+	}
+	if len(wr.delivery) > 0 {
+		desc += ", delivery " + wr.delivery
+	}
+	return desc
+}
+
+func serveWebhooks(listen string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/", handleWebhook)
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: webhookReadHeaderTimeout,
+		ReadTimeout:       webhookReadTimeout,
+		WriteTimeout:      webhookWriteTimeout,
+		IdleTimeout:       webhookIdleTimeout,
+	}
+	Log(robot.Info, "Listening for webhooks on http://%s/webhook/<job>", listen)
+	Log(robot.Error, "Error serving webhooks: %v", srv.ListenAndServe())
+}
+
+func handleWebhook(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(req.URL.Path, "/webhook/")
+	currentCfg.RLock()
+	cfg := currentCfg.configuration
+	tasks := currentCfg.taskList
+	currentCfg.RUnlock()
+	t := tasks.getTaskByName(name)
+	if t == nil {
+		http.NotFound(rw, req)
+		return
+	}
+	task, _, job := getTask(t)
+	if job == nil || !job.Webhook {
+		Log(robot.Warn, "Webhook received for '%s', which isn't a job accepting webhooks", name)
+		http.NotFound(rw, req)
+		return
+	}
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, maxWebhookPayload))
+	if err != nil {
+		Log(robot.Error, "Reading webhook payload for job '%s': %v", name, err)
+		http.Error(rw, "unable to read payload", http.StatusBadRequest)
+		return
+	}
+	secret, ok := getWebhookSecret(name)
+	if !ok {
+		Log(robot.Error, "Webhook received for job '%s' with no secret set; use 'set webhook secret %s <secret>'", name, name)
+		http.Error(rw, "forbidden", http.StatusForbidden)
+		return
+	}
+	wr, ok := verifyWebhook(req.Header, payload, secret)
+	if !ok {
+		Log(robot.Warn, "Webhook signature verification failed for job '%s' from %s", name, req.RemoteAddr)
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if len(task.Channel) == 0 {
+		Log(robot.Error, "Not starting job '%s' from %s; zero-length Channel", name, wr.describe())
+		http.Error(rw, "job has no channel", http.StatusServiceUnavailable)
+		return
+	}
+	if task.Disabled {
+		Log(robot.Error, "Not starting disabled job '%s' from %s; reason: %s", name, wr.describe(), task.reason)
+		http.Error(rw, "job disabled", http.StatusServiceUnavailable)
+		return
+	}
+	pausedJobs.Lock()
+	if user, ok := pausedJobs.jobs[name]; ok {
+		pausedJobs.Unlock()
+		Log(robot.Debug, "Skipping webhook run of job '%s' paused by user '%s'", name, user)
+		http.Error(rw, "job paused", http.StatusServiceUnavailable)
+		return
+	}
+	pausedJobs.Unlock()
+
+	pf, err := ioutil.TempFile("", "gopherbot-webhook-")
+	if err == nil {
+		_, err = pf.Write(payload)
+		pf.Close()
+	}
+	if err != nil {
+		Log(robot.Error, "Writing webhook payload file for job '%s': %v", name, err)
+		http.Error(rw, "internal error", http.StatusInternalServerError)
+		return
+	}
+	wr.payload = payload
+	wr.payloadFile = pf.Name()
+
+	protocol := task.Protocol
+	if len(protocol) == 0 {
+		protocol = cfg.protocol
+	}
+	confLock.RLock()
+	repolist := repositories
+	confLock.RUnlock()
+	w := &worker{
+		Channel:       task.Channel,
+		Protocol:      getProtocol(protocol),
+		cfg:           cfg,
+		tasks:         tasks,
+		repositories:  repolist,
+		directMsg:     false,
+		automaticTask: true, // webhooks are verified by signature, not user
+		webhook:       wr,
+	}
+	Log(robot.Info, "Starting job '%s' from %s", name, wr.describe())
+	go func() {
+		w.startPipeline(nil, t, webhook, "run")
+		os.Remove(wr.payloadFile)
+	}()
+	rw.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(rw, "started job '%s'\n", name)
+}
+
+// verifyWebhook checks the signature headers for the supported webhook
+// styles; GitHub sends an HMAC of the payload in X-Hub-Signature-256 (or
+// the older sha1 X-Hub-Signature), and GitLab sends the secret itself in
+// X-Gitlab-Token.
+func verifyWebhook(h http.Header, payload []byte, secret string) (*webhookRequest, bool) {
+	if sig := h.Get("X-Hub-Signature-256"); len(sig) > 0 {
+		wr := &webhookRequest{
+			source:   "github",
+			event:    h.Get("X-GitHub-Event"),
+			delivery: h.Get("X-GitHub-Delivery"),
+		}
+		return wr, checkHMAC(sha256.New, "sha256=", sig, payload, secret)
+	}
+	if sig := h.Get("X-Hub-Signature"); len(sig) > 0 {
+		wr := &webhookRequest{
+			source:   "github",
+			event:    h.Get("X-GitHub-Event"),
+			delivery: h.Get("X-GitHub-Delivery"),
+		}
+		return wr, checkHMAC(sha1.New, "sha1=", sig, payload, secret)
+	}
+	if token := h.Get("X-Gitlab-Token"); len(token) > 0 {
+		wr := &webhookRequest{
+			source:   "gitlab",
+			event:    h.Get("X-Gitlab-Event"),
+			delivery: h.Get("X-Gitlab-Event-UUID"),
+		}
+		return wr, subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	return nil, false
+}
+
+func checkHMAC(hf func() hash.Hash, prefix, sig string, payload []byte, secret string) bool {
+	if !strings.HasPrefix(sig, prefix) {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, prefix))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(hf, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func getWebhookSecret(job string) (string, bool) {
+	secrets := make(map[string]string)
+	_, exists, ret := checkoutDatum(webhookSecrets, &secrets, false)
+	if ret != robot.Ok || !exists {
+		return "", false
+	}
+	secret, ok := secrets[job]
+	return secret, ok && len(secret) > 0
+}
+
+// setWebhookSecret sets or, when secret is "", removes the secret for a job
+func setWebhookSecret(job, secret string) robot.RetVal {
+	secrets := make(map[string]string)
+	tok, _, ret := checkoutDatum(webhookSecrets, &secrets, true)
+	if ret != robot.Ok {
+		return ret
+	}
+	if len(secret) > 0 {
+		secrets[job] = secret
+	} else {
+		delete(secrets, job)
+	}
+	return updateDatum(webhookSecrets, tok, secrets)
+}
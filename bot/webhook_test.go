@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"testing"
+)
+
+func testSignature(hf func() hash.Hash, secret string, payload []byte) string {
+	mac := hmac.New(hf, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	payload := []byte(`{"ref":"refs/heads/main"}`)
+	secret := "s3cr3t"
+	good256 := "sha256=" + testSignature(sha256.New, secret, payload)
+	bad256 := "sha256=" + testSignature(sha256.New, "wrong", payload)
+	good1 := "sha1=" + testSignature(sha1.New, secret, payload)
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		ok      bool
+		source  string
+	}{
+		{"github sha256", map[string]string{"X-Hub-Signature-256": good256, "X-GitHub-Event": "push"}, true, "github"},
+		{"github sha1", map[string]string{"X-Hub-Signature": good1}, true, "github"},
+		{"wrong secret", map[string]string{"X-Hub-Signature-256": bad256}, false, "github"},
+		{"wrong prefix", map[string]string{"X-Hub-Signature-256": "sha1=" + testSignature(sha256.New, secret, payload)}, false, "github"},
+		{"malformed hex", map[string]string{"X-Hub-Signature-256": "sha256=zz" + good256[9:]}, false, "github"},
+		{"truncated signature", map[string]string{"X-Hub-Signature-256": good256[:len(good256)-2]}, false, "github"},
+		{"gitlab token", map[string]string{"X-Gitlab-Token": secret, "X-Gitlab-Event": "Push Hook"}, true, "gitlab"},
+		{"gitlab wrong token", map[string]string{"X-Gitlab-Token": "wrong"}, false, "gitlab"},
+		{"missing header", map[string]string{"X-GitHub-Event": "push"}, false, ""},
+	}
+	for _, c := range cases {
+		h := make(http.Header)
+		for k, v := range c.headers {
+			h.Set(k, v)
+		}
+		wr, ok := verifyWebhook(h, payload, secret)
+		if ok != c.ok {
+			t.Errorf("%s: want verified %t, got %t", c.name, c.ok, ok)
+		}
+		if len(c.source) == 0 {
+			if wr != nil {
+				t.Errorf("%s: want no request, got %+v", c.name, wr)
+			}
+			continue
+		}
+		if wr == nil || wr.source != c.source {
+			t.Errorf("%s: want source %q, got %+v", c.name, c.source, wr)
+		}
+	}
+}
+
+func TestCheckHMACPayload(t *testing.T) {
+	secret := "s3cr3t"
+	sig := "sha256=" + testSignature(sha256.New, secret, []byte("payload"))
+	if !checkHMAC(sha256.New, "sha256=", sig, []byte("payload"), secret) {
+		t.Errorf("valid signature rejected")
+	}
+	if checkHMAC(sha256.New, "sha256=", sig, []byte("payload2"), secret) {
+		t.Errorf("signature accepted for a modified payload")
+	}
+	if checkHMAC(sha256.New, "sha256=", "", []byte("payload"), secret) {
+		t.Errorf("empty signature accepted")
+	}
+}
@@ -4,7 +4,7 @@ package main
 
 import (
 	dynamobrain "github.com/lnxjedi/gopherbot/brains/dynamodb"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // GetManifest just wraps the function from the module
@@ -3,13 +3,16 @@
 package dynamobrain
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var handler robot.Handler
@@ -17,6 +20,7 @@ var svc *dynamodb.DynamoDB
 
 type brainConfig struct {
 	TableName, Region, AccessKeyID, SecretAccessKey string
+	TTLAttribute                                    string // attribute for DynamoDB TTL, default "Expires"
 }
 
 type dynaMemory struct {
@@ -27,15 +31,34 @@ type dynaMemory struct {
 var dynamocfg brainConfig
 
 func (db *brainConfig) Store(k string, b *[]byte) error {
-	input := &dynamodb.PutItemInput{
-		Item: map[string]*dynamodb.AttributeValue{
-			"Memory": {
-				S: aws.String(k),
-			},
-			"Content": {
-				B: *b,
-			},
+	return putMemory(memoryItem(k, b))
+}
+
+// StoreExpiring stores a memory with a TTL attribute; when TTL is enabled
+// on the table for the attribute, DynamoDB deletes the memory some time
+// after it expires.
+func (db *brainConfig) StoreExpiring(k string, b *[]byte, expires time.Time) error {
+	item := memoryItem(k, b)
+	item[dynamocfg.TTLAttribute] = &dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(expires.Unix(), 10)),
+	}
+	return putMemory(item)
+}
+
+func memoryItem(k string, b *[]byte) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"Memory": {
+			S: aws.String(k),
 		},
+		"Content": {
+			B: *b,
+		},
+	}
+}
+
+func putMemory(item map[string]*dynamodb.AttributeValue) error {
+	input := &dynamodb.PutItemInput{
+		Item:      item,
 		TableName: aws.String(dynamocfg.TableName),
 	}
 
@@ -153,6 +176,9 @@ func (db *brainConfig) List() ([]string, error) {
 func provider(r robot.Handler) robot.SimpleBrain {
 	handler = r
 	handler.GetBrainConfig(&dynamocfg)
+	if len(dynamocfg.TTLAttribute) == 0 {
+		dynamocfg.TTLAttribute = "Expires"
+	}
 	var sess *session.Session
 	var err error
 	AccessKeyID := dynamocfg.AccessKeyID
@@ -194,6 +220,16 @@ func provider(r robot.Handler) robot.SimpleBrain {
 			handler.Log(robot.Fatal, "Error describing table '%s': %v", dynamocfg.TableName, err.Error())
 		}
 	}
+	ttl, err := svc.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(dynamocfg.TableName),
+	})
+	if err == nil && ttl.TimeToLiveDescription != nil &&
+		aws.StringValue(ttl.TimeToLiveDescription.TimeToLiveStatus) == dynamodb.TimeToLiveStatusEnabled &&
+		aws.StringValue(ttl.TimeToLiveDescription.AttributeName) == dynamocfg.TTLAttribute {
+		handler.Log(robot.Info, "DynamoDB TTL enabled for table '%s' with attribute '%s'", dynamocfg.TableName, dynamocfg.TTLAttribute)
+	} else {
+		handler.Log(robot.Info, "DynamoDB TTL not enabled for table '%s' with attribute '%s'; expired memories will be removed by the robot", dynamocfg.TableName, dynamocfg.TTLAttribute)
+	}
 
 	return &dynamocfg
 }
@@ -0,0 +1,13 @@
+// +build module
+
+package main
+
+import (
+	redisbrain "github.com/lnxjedi/gopherbot/brains/redis"
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// GetManifest just wraps the function from the module
+func GetManifest() robot.Manifest {
+	return redisbrain.GetManifest()
+}
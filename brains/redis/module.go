@@ -0,0 +1,20 @@
+// Common symbols needed when being built as a module
+// +build module
+
+package redisbrain
+
+import (
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+var manifest = robot.Manifest{
+	Brain: robot.BrainSpec{
+		Name:  "redis",
+		Brain: provider,
+	},
+}
+
+// GetManifest returns all the handlers available in this plugin
+func GetManifest() robot.Manifest {
+	return manifest
+}
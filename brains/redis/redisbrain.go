@@ -0,0 +1,215 @@
+// Package redisbrain is a Redis implementation of the bot.SimpleBrain
+// interface, giving robots a shared brain for HA deployments. Keys can be
+// prefixed, so several robots can share one Redis server and database.
+package redisbrain
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+var handler robot.Handler
+var pool *redis.Pool
+
+type brainConfig struct {
+	Address       string // host:port of the server, default "localhost:6379"
+	DB            int    // database number
+	Username      string // for Redis 6 ACLs; leave empty to authenticate with just the password
+	Password      string // use the decrypt template function
+	KeyPrefix     string // prepended to every key, e.g. "<robot>:" when robots share a server
+	NativeTTL     bool   // also give expiring memories a Redis TTL
+	TLS           bool   // connect with TLS
+	TLSServerName string // server name to verify, defaults to the host in Address
+	TLSCAFile     string // PEM file with CA certificates for verifying the server
+	TLSSkipVerify bool   // don't verify the server certificate - testing only
+}
+
+var rediscfg brainConfig
+
+// scanCount is the COUNT hint for SCAN in List
+const scanCount = 1000
+
+func (rb *brainConfig) Store(k string, b *[]byte) error {
+	conn := pool.Get()
+	defer conn.Close()
+	// SET without options also clears any TTL
+	if _, err := conn.Do("SET", rb.KeyPrefix+k, *b); err != nil {
+		handler.Log(robot.Error, "Error storing memory '%s': %v", k, err)
+		return err
+	}
+	return nil
+}
+
+// StoreExpiring sets a Redis TTL on the memory when NativeTTL is
+// configured; otherwise the robot deletes the memory when it expires.
+func (rb *brainConfig) StoreExpiring(k string, b *[]byte, expires time.Time) error {
+	if !rb.NativeTTL {
+		return rb.Store(k, b)
+	}
+	ttl := time.Until(expires).Milliseconds()
+	if ttl < 1 {
+		ttl = 1
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("SET", rb.KeyPrefix+k, *b, "PX", ttl); err != nil {
+		handler.Log(robot.Error, "Error storing memory '%s': %v", k, err)
+		return err
+	}
+	return nil
+}
+
+func (rb *brainConfig) Retrieve(k string) (datum *[]byte, exists bool, err error) {
+	conn := pool.Get()
+	defer conn.Close()
+	content, err := redis.Bytes(conn.Do("GET", rb.KeyPrefix+k))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		handler.Log(robot.Error, "Error retrieving memory '%s': %v", k, err)
+		return nil, false, err
+	}
+	return &content, true, nil
+}
+
+func (rb *brainConfig) Delete(key string) error {
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", rb.KeyPrefix+key)
+	return err
+}
+
+// List uses SCAN, so it doesn't block the server; SCAN can return a key
+// more than once, so keys are de-duplicated.
+func (rb *brainConfig) List() ([]string, error) {
+	conn := pool.Get()
+	defer conn.Close()
+	match := globEscape(rb.KeyPrefix) + "*"
+	seen := make(map[string]struct{})
+	cursor := 0
+	for {
+		vals, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", match, "COUNT", scanCount))
+		if err != nil {
+			return nil, err
+		}
+		var batch []string
+		if _, err := redis.Scan(vals, &cursor, &batch); err != nil {
+			return nil, err
+		}
+		for _, k := range batch {
+			seen[strings.TrimPrefix(k, rb.KeyPrefix)] = struct{}{}
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// globEscape escapes the prefix for a SCAN MATCH pattern
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func dialOptions(rb *brainConfig) ([]redis.DialOption, error) {
+	opts := []redis.DialOption{
+		redis.DialDatabase(rb.DB),
+		redis.DialConnectTimeout(10 * time.Second),
+		redis.DialReadTimeout(10 * time.Second),
+		redis.DialWriteTimeout(10 * time.Second),
+	}
+	if len(rb.Password) > 0 {
+		opts = append(opts, redis.DialPassword(rb.Password))
+	}
+	if len(rb.Username) > 0 {
+		opts = append(opts, redis.DialUsername(rb.Username))
+	}
+	if !rb.TLS {
+		return opts, nil
+	}
+	tc := &tls.Config{
+		ServerName:         rb.TLSServerName,
+		InsecureSkipVerify: rb.TLSSkipVerify,
+	}
+	if len(tc.ServerName) == 0 {
+		if host, _, err := net.SplitHostPort(rb.Address); err == nil {
+			tc.ServerName = host
+		}
+	}
+	if len(rb.TLSCAFile) > 0 {
+		pem, err := ioutil.ReadFile(rb.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading TLSCAFile: %v", err)
+		}
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLSCAFile '%s'", rb.TLSCAFile)
+		}
+	}
+	opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(tc))
+	return opts, nil
+}
+
+func newPool(rb *brainConfig) (*redis.Pool, error) {
+	opts, err := dialOptions(rb)
+	if err != nil {
+		return nil, err
+	}
+	return &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 4 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", rb.Address, opts...)
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}, nil
+}
+
+func provider(r robot.Handler) robot.SimpleBrain {
+	handler = r
+	handler.GetBrainConfig(&rediscfg)
+	if len(rediscfg.Address) == 0 {
+		rediscfg.Address = "localhost:6379"
+	}
+	var err error
+	if pool, err = newPool(&rediscfg); err != nil {
+		handler.Log(robot.Fatal, "Configuring redis brain: %v", err)
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		handler.Log(robot.Fatal, "Connecting to redis brain at '%s': %v", rediscfg.Address, err)
+	}
+	handler.Log(robot.Info, "Initialized redis brain at '%s', database %d, key prefix '%s'", rediscfg.Address, rediscfg.DB, rediscfg.KeyPrefix)
+
+	return &rediscfg
+}
@@ -0,0 +1,289 @@
+package redisbrain
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// standIn is a minimal in-process server speaking enough of the Redis
+// protocol for the brain: PING, AUTH, SELECT, SET (with PX), GET, DEL and
+// SCAN (with MATCH and COUNT).
+type standIn struct {
+	password string
+	l        net.Listener
+	sync.Mutex
+	data    map[string][]byte
+	expires map[string]time.Time
+	db      int
+	scans   int
+}
+
+func newStandIn(t *testing.T, password string) *standIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	s := &standIn{
+		password: password,
+		l:        l,
+		data:     make(map[string][]byte),
+		expires:  make(map[string]time.Time),
+	}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected array, got %q", line)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, l+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:l])
+	}
+	return args, nil
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func (s *standIn) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := len(s.password) == 0
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		if !authed && cmd != "AUTH" {
+			io.WriteString(c, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		s.Lock()
+		s.expire()
+		var reply string
+		switch cmd {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "AUTH":
+			if args[len(args)-1] == s.password {
+				authed = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case "SELECT":
+			s.db, _ = strconv.Atoi(args[1])
+			reply = "+OK\r\n"
+		case "SET":
+			s.data[args[1]] = []byte(args[2])
+			delete(s.expires, args[1])
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			reply = "+OK\r\n"
+		case "GET":
+			if d, ok := s.data[args[1]]; ok {
+				reply = bulk(string(d))
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "DEL":
+			_, ok := s.data[args[1]]
+			delete(s.data, args[1])
+			delete(s.expires, args[1])
+			if ok {
+				reply = ":1\r\n"
+			} else {
+				reply = ":0\r\n"
+			}
+		case "SCAN":
+			reply = s.scan(args[1:])
+		default:
+			reply = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		s.Unlock()
+		io.WriteString(c, reply)
+	}
+}
+
+func (s *standIn) expire() {
+	now := time.Now()
+	for k, e := range s.expires {
+		if now.After(e) {
+			delete(s.data, k)
+			delete(s.expires, k)
+		}
+	}
+}
+
+// scan pages through the sorted keys; the cursor is an index
+func (s *standIn) scan(args []string) string {
+	s.scans++
+	cursor, _ := strconv.Atoi(args[0])
+	match, count := "*", 10
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			count, _ = strconv.Atoi(args[i+1])
+		}
+	}
+	keys := make([]string, 0, len(s.data))
+	for k := range s.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	end := cursor + count
+	next := end
+	if end >= len(keys) {
+		end, next = len(keys), 0
+	}
+	matched := make([]string, 0)
+	for _, k := range keys[cursor:end] {
+		if ok, _ := path.Match(match, k); ok {
+			matched = append(matched, bulk(k))
+		}
+	}
+	return fmt.Sprintf("*2\r\n%s*%d\r\n%s", bulk(strconv.Itoa(next)), len(matched), strings.Join(matched, ""))
+}
+
+type testHandler struct {
+	robot.Handler
+	t   *testing.T
+	cfg brainConfig
+}
+
+func (h testHandler) GetBrainConfig(c interface{}) error {
+	*(c.(*brainConfig)) = h.cfg
+	return nil
+}
+
+func (h testHandler) Log(l robot.LogLevel, m string, v ...interface{}) {
+	if l == robot.Fatal {
+		h.t.Fatalf(m, v...)
+	}
+	h.t.Logf(m, v...)
+}
+
+func newTestBrain(t *testing.T, s *standIn, cfg brainConfig) robot.SimpleBrain {
+	cfg.Address = s.l.Addr().String()
+	rediscfg = brainConfig{}
+	return provider(testHandler{t: t, cfg: cfg})
+}
+
+func TestStoreRetrieveDelete(t *testing.T) {
+	s := newStandIn(t, "secret")
+	b := newTestBrain(t, s, brainConfig{DB: 2, Password: "secret", KeyPrefix: "bot1:"})
+	if s.db != 2 {
+		t.Errorf("expected database 2, got %d", s.db)
+	}
+	datum := []byte("hello")
+	if err := b.Store("greeting", &datum); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	if _, ok := s.data["bot1:greeting"]; !ok {
+		t.Errorf("memory not stored with key prefix")
+	}
+	d, exists, err := b.Retrieve("greeting")
+	if err != nil || !exists || string(*d) != "hello" {
+		t.Errorf("Retrieve: got %v, %t, %v", d, exists, err)
+	}
+	if err := b.Delete("greeting"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, exists, err = b.Retrieve("greeting"); exists || err != nil {
+		t.Errorf("Retrieve after Delete: got %t, %v", exists, err)
+	}
+}
+
+func TestListPrefix(t *testing.T) {
+	s := newStandIn(t, "")
+	b := newTestBrain(t, s, brainConfig{KeyPrefix: "bot[1]:"})
+	// another robot sharing the server
+	s.data["bot2:other"] = []byte("x")
+	s.data["bot1:other"] = []byte("x")
+	want := make([]string, 0)
+	for i := 0; i < scanCount+5; i++ {
+		k := fmt.Sprintf("links:%04d", i)
+		want = append(want, k)
+		datum := []byte("x")
+		b.Store(k, &datum)
+	}
+	keys, err := b.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("List returned %d keys, expected %d", len(keys), len(want))
+	}
+	if s.scans < 2 {
+		t.Errorf("expected List to follow the SCAN cursor, got %d scans", s.scans)
+	}
+}
+
+func TestNativeTTL(t *testing.T) {
+	s := newStandIn(t, "")
+	datum := []byte("cached")
+	expires := time.Now().Add(time.Hour)
+
+	b := newTestBrain(t, s, brainConfig{})
+	b.(robot.ExpiringBrain).StoreExpiring("cache", &datum, expires)
+	if _, ok := s.expires["cache"]; ok {
+		t.Errorf("TTL set without NativeTTL")
+	}
+
+	b = newTestBrain(t, s, brainConfig{NativeTTL: true})
+	b.(robot.ExpiringBrain).StoreExpiring("cache", &datum, expires)
+	if e, ok := s.expires["cache"]; !ok || e.Sub(expires) > time.Second || expires.Sub(e) > time.Second {
+		t.Errorf("expected TTL near %v, got %v", expires, e)
+	}
+	b.Store("cache", &datum)
+	if _, ok := s.expires["cache"]; ok {
+		t.Errorf("Store didn't clear the TTL")
+	}
+	b.(robot.ExpiringBrain).StoreExpiring("cache", &datum, time.Now().Add(-time.Second))
+	time.Sleep(10 * time.Millisecond)
+	if _, exists, _ := b.Retrieve("cache"); exists {
+		t.Errorf("memory past its expiration still exists")
+	}
+}
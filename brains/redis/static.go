@@ -0,0 +1,11 @@
+// Only needed when built as part of the gopherbot binary
+// +build !module
+
+package redisbrain
+
+import "github.com/lnxjedi/gopherbot/bot"
+
+func init() {
+	bot.RegisterPreload("brains/redis.so")
+	bot.RegisterSimpleBrain("redis", provider)
+}
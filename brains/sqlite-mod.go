@@ -0,0 +1,13 @@
+// +build module
+
+package main
+
+import (
+	sqlitebrain "github.com/lnxjedi/gopherbot/brains/sqlite"
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// GetManifest just wraps the function from the module
+func GetManifest() robot.Manifest {
+	return sqlitebrain.GetManifest()
+}
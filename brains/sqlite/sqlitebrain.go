@@ -0,0 +1,110 @@
+// Package sqlitebrain is a simple SQLite implementation of the bot.SimpleBrain
+// interface, storing all of the robot's memories in a single database file.
+// It uses a pure-Go driver, so it works with static builds.
+package sqlitebrain
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/lnxjedi/gopherbot/robot"
+	_ "github.com/ncruces/go-sqlite3/driver" // registers the "sqlite3" driver
+	_ "github.com/ncruces/go-sqlite3/embed"  // embeds the sqlite library
+)
+
+var handler robot.Handler
+
+type brainConfig struct {
+	DatabaseFile string // path to the database file, created if missing
+}
+
+// sqliteBrain holds the open database for the configured file
+type sqliteBrain struct {
+	db *sql.DB
+}
+
+const createTable = `CREATE TABLE IF NOT EXISTS memories (
+	key TEXT PRIMARY KEY NOT NULL,
+	datum BLOB NOT NULL
+)`
+
+func (sb *sqliteBrain) Store(k string, b *[]byte) error {
+	_, err := sb.db.Exec(`INSERT INTO memories (key, datum) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET datum = excluded.datum`, k, *b)
+	if err != nil {
+		handler.Log(robot.Error, "Error storing memory '%s': %v", k, err)
+		return err
+	}
+	return nil
+}
+
+func (sb *sqliteBrain) Retrieve(k string) (datum *[]byte, exists bool, err error) {
+	var content []byte
+	err = sb.db.QueryRow(`SELECT datum FROM memories WHERE key = ?`, k).Scan(&content)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		handler.Log(robot.Error, "Error retrieving memory '%s': %v", k, err)
+		return nil, false, err
+	}
+	return &content, true, nil
+}
+
+func (sb *sqliteBrain) Delete(key string) error {
+	_, err := sb.db.Exec(`DELETE FROM memories WHERE key = ?`, key)
+	return err
+}
+
+func (sb *sqliteBrain) List() ([]string, error) {
+	keys := make([]string, 0)
+	rows, err := sb.db.Query(`SELECT key FROM memories ORDER BY key`)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return keys, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func provider(r robot.Handler) robot.SimpleBrain {
+	handler = r
+	var sqlitecfg brainConfig
+	handler.GetBrainConfig(&sqlitecfg)
+	if len(sqlitecfg.DatabaseFile) == 0 {
+		handler.Log(robot.Fatal, "BrainConfig missing value for DatabaseFile required by 'sqlite' brain")
+	}
+	dbPath := sqlitecfg.DatabaseFile
+	if dir := filepath.Dir(dbPath); dir != "." {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			handler.Log(robot.Fatal, "Creating directory '%s' for sqlite brain: %v", dir, err)
+		}
+	}
+	// busy_timeout covers other processes (e.g. the CLI) briefly holding a
+	// lock. The default rollback journal is used, since the brain is never
+	// closed and WAL recovery with the wasm build isn't reliable.
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", url.PathEscape(dbPath))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		handler.Log(robot.Fatal, "Opening sqlite brain '%s': %v", dbPath, err)
+	}
+	// The brain is only used from the brain loop; one connection avoids
+	// SQLITE_BUSY between connections in the same process.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(createTable); err != nil {
+		handler.Log(robot.Fatal, "Initializing sqlite brain '%s': %v", dbPath, err)
+	}
+	os.Chmod(dbPath, 0600)
+	handler.Log(robot.Info, "Initialized sqlite brain with database: %s", dbPath)
+
+	return &sqliteBrain{db}
+}
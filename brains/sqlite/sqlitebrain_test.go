@@ -0,0 +1,105 @@
+package sqlitebrain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+type testHandler struct {
+	robot.Handler
+	t   *testing.T
+	cfg brainConfig
+}
+
+func (h testHandler) GetBrainConfig(c interface{}) error {
+	*(c.(*brainConfig)) = h.cfg
+	return nil
+}
+
+func (h testHandler) Log(l robot.LogLevel, m string, v ...interface{}) {
+	if l == robot.Fatal {
+		h.t.Fatalf(m, v...)
+	}
+	h.t.Logf(m, v...)
+}
+
+func newTestBrain(t *testing.T, dbFile string) robot.SimpleBrain {
+	b := provider(testHandler{t: t, cfg: brainConfig{DatabaseFile: dbFile}})
+	t.Cleanup(func() { b.(*sqliteBrain).db.Close() })
+	return b
+}
+
+func TestStoreRetrieveDelete(t *testing.T) {
+	b := newTestBrain(t, filepath.Join(t.TempDir(), "brain.db"))
+	datum := []byte("hello")
+	if err := b.Store("greeting", &datum); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	d, exists, err := b.Retrieve("greeting")
+	if err != nil || !exists || string(*d) != "hello" {
+		t.Errorf("Retrieve: got %v, %t, %v", d, exists, err)
+	}
+	datum = []byte("goodbye")
+	if err := b.Store("greeting", &datum); err != nil {
+		t.Fatalf("Store over existing memory: %v", err)
+	}
+	if d, _, _ = b.Retrieve("greeting"); string(*d) != "goodbye" {
+		t.Errorf("Retrieve after update: got %q", *d)
+	}
+	if err := b.Delete("greeting"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, exists, err = b.Retrieve("greeting"); exists || err != nil {
+		t.Errorf("Retrieve after Delete: got %t, %v", exists, err)
+	}
+	if err := b.Delete("greeting"); err != nil {
+		t.Errorf("Delete of missing memory: %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	b := newTestBrain(t, filepath.Join(t.TempDir(), "brain.db"))
+	keys, err := b.List()
+	if err != nil || keys == nil || len(keys) != 0 {
+		t.Fatalf("List of empty brain: got %v, %v", keys, err)
+	}
+	for _, k := range []string{"lists:lists", "bot:encryptionKey", "links:links"} {
+		datum := []byte("x")
+		b.Store(k, &datum)
+	}
+	keys, err = b.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := strings.Join(keys, ","); got != "bot:encryptionKey,links:links,lists:lists" {
+		t.Errorf("List: got %s", got)
+	}
+}
+
+func TestDatabaseFile(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "state", "brain.db")
+	b := newTestBrain(t, dbFile)
+	datum := []byte{0, 1, 2, 255}
+	if err := b.Store("binary", &datum); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+	info, err := os.Stat(dbFile)
+	if err != nil {
+		t.Fatalf("database file not created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("database file mode: want 0600, got %o", info.Mode().Perm())
+	}
+
+	// Memories survive re-opening the database
+	b.(*sqliteBrain).db.Close()
+	b = newTestBrain(t, dbFile)
+	d, exists, err := b.Retrieve("binary")
+	if err != nil || !exists || string(*d) != string(datum) {
+		t.Errorf("Retrieve after re-open: got %v, %t, %v", d, exists, err)
+	}
+}
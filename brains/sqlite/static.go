@@ -0,0 +1,11 @@
+// Only needed when built as part of the gopherbot binary
+// +build !module
+
+package sqlitebrain
+
+import "github.com/lnxjedi/gopherbot/bot"
+
+func init() {
+	bot.RegisterPreload("brains/sqlite.so")
+	bot.RegisterSimpleBrain("sqlite", provider)
+}
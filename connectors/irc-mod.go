@@ -0,0 +1,13 @@
+// +build module
+
+package main
+
+import (
+	"github.com/lnxjedi/gopherbot/connectors/irc"
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// GetManifest just wraps the function from the module
+func GetManifest() robot.Manifest {
+	return irc.GetManifest()
+}
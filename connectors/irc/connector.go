@@ -0,0 +1,203 @@
+package irc
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+type whoisReply struct {
+	realName string
+	found    bool
+}
+
+// readLoop feeds lines from the server to the Run loop until the connection
+// fails or done is closed.
+func (ic *ircConnector) readLoop(reader *bufio.Reader, lines chan<- string, failed chan<- error, done <-chan struct{}) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			select {
+			case failed <- err:
+			case <-done:
+			}
+			return
+		}
+		select {
+		case lines <- line:
+		case <-done:
+			return
+		}
+	}
+}
+
+// Run starts the main loop for the irc connector
+func (ic *ircConnector) Run(stop <-chan struct{}) {
+	ic.Lock()
+	// This should never happen, just a bit of defensive coding
+	if ic.running {
+		ic.Unlock()
+		return
+	}
+	ic.running = true
+	reader := ic.reader
+	ic.Unlock()
+
+	lines := make(chan string)
+	failed := make(chan error)
+	done := make(chan struct{})
+	defer close(done)
+	go ic.readLoop(reader, lines, failed, done)
+
+loop:
+	for {
+		select {
+		case <-stop:
+			ic.Log(robot.Debug, "Received stop in connector")
+			ic.write("QUIT :Gopherbot shutting down")
+			ic.RLock()
+			ic.conn.Close()
+			ic.RUnlock()
+			break loop
+		case err := <-failed:
+			ic.Log(robot.Error, "Lost connection to irc server %s: %v", ic.Server, err)
+			ic.RLock()
+			ic.conn.Close()
+			ic.RUnlock()
+			if !ic.reconnect(stop) {
+				break loop
+			}
+			ic.RLock()
+			reader = ic.reader
+			ic.RUnlock()
+			go ic.readLoop(reader, lines, failed, done)
+		case line := <-lines:
+			ic.Log(robot.Trace, "irc received: %s", strings.TrimRight(line, "\r\n"))
+			if m := parseMessage(line); m != nil {
+				ic.processMessage(m)
+			}
+		}
+	}
+}
+
+// processMessage handles a single message from the server
+func (ic *ircConnector) processMessage(m *ircMessage) {
+	switch m.command {
+	case "PING":
+		ic.write("PONG :" + m.trailing())
+	case "PRIVMSG":
+		if len(m.params) < 2 {
+			return
+		}
+		ic.processPrivmsg(m.nick(), m.params[0], m.params[1], m)
+	case "NICK":
+		ic.nickChange(m.nick(), m.trailing())
+	case "JOIN":
+		if strings.EqualFold(m.nick(), ic.getNick()) && len(m.params) > 0 {
+			ic.Lock()
+			ic.channels[strings.ToLower(m.params[0])] = struct{}{}
+			ic.Unlock()
+			ic.Log(robot.Debug, "Joined irc channel %s", m.params[0])
+		}
+	case "KICK":
+		if len(m.params) > 1 && strings.EqualFold(m.params[1], ic.getNick()) {
+			ic.Lock()
+			delete(ic.channels, strings.ToLower(m.params[0]))
+			ic.Unlock()
+			ic.Log(robot.Warn, "Kicked from irc channel %s by %s: %s", m.params[0], m.nick(), m.trailing())
+		}
+	case "311": // RPL_WHOISUSER <me> <nick> <user> <host> * :<real name>
+		if len(m.params) > 5 {
+			ic.whoisDone(m.params[1], &whoisReply{realName: m.params[5], found: true})
+		}
+	case "401", "318": // ERR_NOSUCHNICK, RPL_ENDOFWHOIS
+		if len(m.params) > 1 {
+			ic.whoisDone(m.params[1], &whoisReply{})
+		}
+	case "ERROR":
+		ic.Log(robot.Error, "irc server error: %s", m.trailing())
+	}
+}
+
+// processPrivmsg creates a robot.ConnectorMessage and calls
+// robot.IncomingMessage
+func (ic *ircConnector) processPrivmsg(nick, target, text string, m *ircMessage) {
+	if len(nick) == 0 || strings.EqualFold(nick, ic.getNick()) {
+		return
+	}
+	// Only ACTION is treated as a message, other CTCP requests are ignored
+	if strings.HasPrefix(text, "\x01") {
+		text = strings.Trim(text, "\x01")
+		if !strings.HasPrefix(text, "ACTION ") {
+			ic.Log(robot.Debug, "Ignoring CTCP request from %s: %s", nick, text)
+			return
+		}
+		text = strings.TrimPrefix(text, "ACTION ")
+	}
+	text = stripFormatting(text)
+	// IRC users address the robot with "nick: ..." rather than "@nick"; the
+	// robot's own nick is set as the bot mention.
+	botNick := ic.getNick()
+	if len(text) > len(botNick) && strings.EqualFold(text[:len(botNick)], botNick) {
+		switch text[len(botNick)] {
+		case ':', ',':
+			text = "@" + botNick + " " + strings.TrimLeft(text[len(botNick)+1:], " ")
+		}
+	}
+	userID := ic.userID(nick)
+	botMsg := &robot.ConnectorMessage{
+		Protocol:      "irc",
+		UserID:        userID,
+		UserName:      nick,
+		MessageText:   text,
+		MessageObject: m,
+		Client:        ic,
+	}
+	if isChannel(target) {
+		botMsg.ChannelID = target
+		botMsg.ChannelName = strings.TrimPrefix(target, "#")
+	} else {
+		botMsg.DirectMessage = true
+	}
+	ic.IncomingMessage(botMsg)
+}
+
+// nickChange keeps the user's stable internal ID when they change nicks,
+// so the robot still sees the username configured in the UserRoster.
+// The old nick is released; since IRC doesn't identify users, a different
+// user who later takes the old nick is mapped to the same ID (see userID).
+func (ic *ircConnector) nickChange(oldNick, newNick string) {
+	if len(newNick) == 0 {
+		return
+	}
+	ic.Lock()
+	renamed := strings.EqualFold(oldNick, ic.nick)
+	if renamed {
+		ic.nick = newNick
+	}
+	lcOld := strings.ToLower(oldNick)
+	id, ok := ic.nickToID[lcOld]
+	if !ok {
+		id = oldNick
+	}
+	delete(ic.nickToID, lcOld)
+	ic.nickToID[strings.ToLower(newNick)] = id
+	ic.idToNick[id] = newNick
+	ic.Unlock()
+	if renamed {
+		ic.SetBotMention(newNick)
+	}
+	ic.Log(robot.Debug, "irc nick change %s -> %s (user ID %s)", oldNick, newNick, id)
+}
+
+func (ic *ircConnector) whoisDone(nick string, r *whoisReply) {
+	lcNick := strings.ToLower(nick)
+	ic.Lock()
+	reply, ok := ic.whois[lcNick]
+	delete(ic.whois, lcNick)
+	ic.Unlock()
+	if ok {
+		reply <- r
+	}
+}
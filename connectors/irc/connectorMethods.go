@@ -0,0 +1,115 @@
+package irc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// How long to wait for a WHOIS reply
+const whoisTimeout = 5 * time.Second
+
+// MessageHeard indicates to the user a message was heard;
+// for irc it's a noop.
+func (ic *ircConnector) MessageHeard(u, c string) {
+	return
+}
+
+// SetUserMap takes a map of username to userID mappings, built from the
+// UserRoster of robot.yaml. For IRC, the UserID is the nick the user is
+// normally known by; the connector tracks nick changes so the user keeps
+// the same ID.
+func (ic *ircConnector) SetUserMap(umap map[string]string) {
+	ic.Lock()
+	ic.botUserMap = umap
+	for _, id := range umap {
+		if _, ok := ic.idToNick[id]; !ok {
+			ic.idToNick[id] = id
+			ic.nickToID[strings.ToLower(id)] = id
+		}
+	}
+	ic.Unlock()
+}
+
+// GetProtocolUserAttribute returns a string attribute or "" if irc doesn't
+// have that information
+func (ic *ircConnector) GetProtocolUserAttribute(u, attr string) (value string, ret robot.RetVal) {
+	nick, id := ic.userNick(u)
+	switch attr {
+	case "internalid":
+		return id, robot.Ok
+	case "nick":
+		return nick, robot.Ok
+	case "realname", "fullname", "real name", "full name":
+		reply := make(chan *whoisReply, 1)
+		lcNick := strings.ToLower(nick)
+		ic.Lock()
+		ic.whois[lcNick] = reply
+		ic.Unlock()
+		ic.write("WHOIS " + nick)
+		select {
+		case r := <-reply:
+			if !r.found {
+				return "", robot.UserNotFound
+			}
+			return r.realName, robot.Ok
+		case <-time.After(whoisTimeout):
+			ic.Lock()
+			delete(ic.whois, lcNick)
+			ic.Unlock()
+			ic.Log(robot.Warn, "Timed out waiting for irc WHOIS reply for %s", nick)
+			return "", robot.AttributeNotFound
+		}
+	// that's all the attributes we can currently get from irc
+	default:
+		return "", robot.AttributeNotFound
+	}
+}
+
+// SendProtocolChannelMessage sends a message to a channel
+func (ic *ircConnector) SendProtocolChannelMessage(ch string, msg string, f robot.MessageFormat) (ret robot.RetVal) {
+	msgs := ic.ircifyMessage("", msg, f)
+	ic.sendMessages(msgs, ic.channelTarget(ch))
+	return robot.Ok
+}
+
+// SendProtocolUserChannelMessage sends a message to a user in a channel
+func (ic *ircConnector) SendProtocolUserChannelMessage(uid, u, ch, msg string, f robot.MessageFormat) (ret robot.RetVal) {
+	user := uid
+	if len(user) == 0 {
+		user = u
+	}
+	nick, _ := ic.userNick(user)
+	msgs := ic.ircifyMessage(nick+": ", msg, f)
+	ic.sendMessages(msgs, ic.channelTarget(ch))
+	return robot.Ok
+}
+
+// SendProtocolUserMessage sends a direct message to a user
+func (ic *ircConnector) SendProtocolUserMessage(u string, msg string, f robot.MessageFormat) (ret robot.RetVal) {
+	nick, _ := ic.userNick(u)
+	if len(nick) == 0 || isChannel(nick) {
+		ic.Log(robot.Error, "invalid irc nick for user: %s", u)
+		return robot.UserNotFound
+	}
+	msgs := ic.ircifyMessage("", msg, f)
+	ic.sendMessages(msgs, nick)
+	return robot.Ok
+}
+
+// JoinChannel joins a channel given it's human-readable name, e.g. "general"
+func (ic *ircConnector) JoinChannel(c string) (ret robot.RetVal) {
+	if len(c) == 0 {
+		return robot.ChannelNotFound
+	}
+	channel := ic.channelTarget(c)
+	ic.Lock()
+	ic.channels[strings.ToLower(channel)] = struct{}{}
+	ic.Unlock()
+	if err := ic.write("JOIN " + channel); err != nil {
+		ic.Log(robot.Error, "joining irc channel %s: %v", channel, err)
+		return robot.FailedChannelJoin
+	}
+	return robot.Ok
+}
@@ -0,0 +1,289 @@
+// Package irc implements a connector for IRC networks
+package irc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+var lock sync.Mutex // package var lock
+var started bool    // set when connector is started
+
+type config struct {
+	Server          string // host:port of the IRC server to connect to
+	TLS             bool   // connect using TLS
+	InsecureTLS     bool   // skip certificate verification, for internal servers with self-signed certs
+	Password        string // optional server password, sent with PASS
+	Nick            string // the robot's nick
+	UserName        string // user name sent with USER, defaults to Nick
+	RealName        string // real name sent with USER, defaults to Nick
+	MaxMessageSplit int    // the maximum # of lines to split a large message into
+}
+
+// Timeouts for connecting and registering with the server
+const dialTimeout = 30 * time.Second
+const registerTimeout = 1 * time.Minute
+
+// How long to wait before trying to reconnect after losing the connection
+const reconnectDelay = 10 * time.Second
+
+// ircConnector holds all the relevant data about a connection
+type ircConnector struct {
+	config
+	conn            net.Conn            // the current connection to the server
+	reader          *bufio.Reader       // reader for conn
+	nick            string              // the robot's current nick
+	botID           string              // the robot's stable internal ID, the configured nick
+	maxMessageSplit int                 // the maximum # of lines to send before truncating
+	running         bool                // set on call to Run
+	send            chan *sendLine      // outgoing PRIVMSG lines, rate limited
+	robot.Handler                       // bot API for connectors
+	sync.RWMutex                        // shared mutex for locking connector data structures
+	wlock           sync.Mutex          // serializes writes to conn
+	channels        map[string]struct{} // channels the robot has joined, lower-case
+	nickToID        map[string]string   // map from lower-cased current nick to stable user ID
+	idToNick        map[string]string   // map from stable user ID to current nick
+	botUserMap      map[string]string   // gopherbot-engine provided mappings of username to userID
+	whois           map[string]chan *whoisReply
+}
+
+// Initialize connects to the server, sets up and returns the connector object
+func Initialize(handler robot.Handler, l *log.Logger) robot.Connector {
+	lock.Lock()
+	if started {
+		lock.Unlock()
+		return nil
+	}
+	started = true
+	lock.Unlock()
+
+	var c config
+
+	err := handler.GetProtocolConfig(&c)
+	if err != nil {
+		handler.Log(robot.Fatal, "Unable to retrieve irc protocol configuration: %v", err)
+	}
+	if len(c.Server) == 0 {
+		handler.Log(robot.Fatal, "No irc Server found in config")
+	}
+	if len(c.Nick) == 0 {
+		handler.Log(robot.Fatal, "No irc Nick found in config")
+	}
+	if len(c.UserName) == 0 {
+		c.UserName = c.Nick
+	}
+	if len(c.RealName) == 0 {
+		c.RealName = c.Nick
+	}
+	if c.MaxMessageSplit == 0 {
+		c.MaxMessageSplit = 20
+	}
+
+	ic := &ircConnector{
+		config:          c,
+		nick:            c.Nick,
+		botID:           c.Nick,
+		maxMessageSplit: c.MaxMessageSplit,
+		send:            make(chan *sendLine),
+		Handler:         handler,
+		channels:        make(map[string]struct{}),
+		nickToID:        make(map[string]string),
+		idToNick:        make(map[string]string),
+		whois:           make(map[string]chan *whoisReply),
+	}
+
+	if err := ic.connect(); err != nil {
+		ic.Log(robot.Fatal, "Unable to connect to irc server %s: %v", c.Server, err)
+	}
+	ic.SetBotID(ic.botID)
+	ic.SetBotMention(ic.getNick())
+	ic.Log(robot.Info, "Connected to irc server %s as %s", c.Server, ic.getNick())
+	go ic.startSendLoop()
+
+	return robot.Connector(ic)
+}
+
+// connect dials the server and registers, returning after the server
+// welcomes the robot.
+func (ic *ircConnector) connect() error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if ic.TLS {
+		host, _, _ := net.SplitHostPort(ic.Server)
+		conn, err = tls.DialWithDialer(dialer, "tcp", ic.Server, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: ic.InsecureTLS,
+		})
+	} else {
+		conn, err = dialer.Dial("tcp", ic.Server)
+	}
+	if err != nil {
+		return err
+	}
+	ic.Lock()
+	ic.conn = conn
+	ic.reader = bufio.NewReader(conn)
+	ic.nick = ic.Nick
+	ic.Unlock()
+
+	if len(ic.Password) > 0 {
+		ic.write("PASS " + ic.Password)
+	}
+	ic.write("NICK " + ic.Nick)
+	ic.write(fmt.Sprintf("USER %s 0 * :%s", ic.UserName, ic.RealName))
+
+	conn.SetReadDeadline(time.Now().Add(registerTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	for {
+		line, err := ic.reader.ReadString('\n')
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		m := parseMessage(line)
+		if m == nil {
+			continue
+		}
+		switch m.command {
+		case "PING":
+			ic.write("PONG :" + m.trailing())
+		case "001": // RPL_WELCOME
+			if len(m.params) > 0 {
+				ic.Lock()
+				ic.nick = m.params[0]
+				ic.Unlock()
+			}
+			return nil
+		case "432", "433", "436": // bad nick, nick in use, nick collision
+			ic.Lock()
+			ic.nick += "_"
+			nick := ic.nick
+			ic.Unlock()
+			ic.Log(robot.Warn, "irc nick unavailable (%s), trying %s", m.trailing(), nick)
+			ic.write("NICK " + nick)
+		case "ERROR":
+			conn.Close()
+			return fmt.Errorf("server error: %s", m.trailing())
+		}
+	}
+}
+
+// reconnect tries to re-establish a lost connection until it succeeds or
+// the connector is stopped, then re-joins channels.
+func (ic *ircConnector) reconnect(stop <-chan struct{}) bool {
+	for {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(reconnectDelay):
+		}
+		if err := ic.connect(); err != nil {
+			ic.Log(robot.Error, "Reconnecting to irc server %s: %v", ic.Server, err)
+			continue
+		}
+		ic.Log(robot.Info, "Reconnected to irc server %s as %s", ic.Server, ic.getNick())
+		ic.SetBotMention(ic.getNick())
+		ic.RLock()
+		channels := make([]string, 0, len(ic.channels))
+		for channel := range ic.channels {
+			channels = append(channels, channel)
+		}
+		ic.RUnlock()
+		for _, channel := range channels {
+			ic.write("JOIN " + channel)
+		}
+		return true
+	}
+}
+
+// write sends a single raw protocol line to the server
+func (ic *ircConnector) write(line string) error {
+	ic.RLock()
+	conn := ic.conn
+	ic.RUnlock()
+	ic.wlock.Lock()
+	defer ic.wlock.Unlock()
+	ic.Log(robot.Trace, "irc sending: %s", line)
+	_, err := conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+func (ic *ircConnector) getNick() string {
+	ic.RLock()
+	nick := ic.nick
+	ic.RUnlock()
+	return nick
+}
+
+// ircMessage is a parsed protocol line
+type ircMessage struct {
+	prefix, command string
+	params          []string
+}
+
+// nick returns the nick portion of a nick!user@host prefix
+func (m *ircMessage) nick() string {
+	if i := strings.IndexByte(m.prefix, '!'); i != -1 {
+		return m.prefix[:i]
+	}
+	return m.prefix
+}
+
+// trailing returns the last parameter, or "" if there are none
+func (m *ircMessage) trailing() string {
+	if len(m.params) == 0 {
+		return ""
+	}
+	return m.params[len(m.params)-1]
+}
+
+// parseMessage parses a raw line from the server, returning nil for
+// empty lines. IRCv3 message tags are discarded.
+func parseMessage(line string) *ircMessage {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "@") {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return nil
+		}
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+	m := &ircMessage{}
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i == -1 {
+			return nil
+		}
+		m.prefix = line[1:i]
+		line = strings.TrimLeft(line[i+1:], " ")
+	}
+	if len(line) == 0 {
+		return nil
+	}
+	var trailing string
+	hasTrailing := false
+	if i := strings.Index(line, " :"); i != -1 {
+		trailing = line[i+2:]
+		hasTrailing = true
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	m.command = strings.ToUpper(fields[0])
+	m.params = fields[1:]
+	if hasTrailing {
+		m.params = append(m.params, trailing)
+	}
+	return m
+}
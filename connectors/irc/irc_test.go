@@ -0,0 +1,275 @@
+package irc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// testServer is a minimal in-process IRC server that registers a single
+// client and records everything it sends.
+type testServer struct {
+	listener net.Listener
+	conn     net.Conn
+	received chan string
+	t        *testing.T
+}
+
+func newTestServer(t *testing.T) *testServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	ts := &testServer{
+		listener: l,
+		received: make(chan string, 100),
+		t:        t,
+	}
+	go ts.serve()
+	return ts
+}
+
+func (ts *testServer) serve() {
+	conn, err := ts.listener.Accept()
+	if err != nil {
+		return
+	}
+	ts.conn = conn
+	reader := bufio.NewReader(conn)
+	nick := ""
+	user, registered := false, false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			close(ts.received)
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		m := parseMessage(line)
+		switch m.command {
+		case "NICK":
+			if m.params[0] == "taken" {
+				ts.send(":irc.test 433 * taken :Nickname is already in use")
+				break
+			}
+			nick = m.params[0]
+		case "USER":
+			user = true
+		case "WHOIS":
+			if m.params[0] == "alice" {
+				ts.send(":irc.test 311 %s alice ~alice host.test * :Alice Liddell", nick)
+				ts.send(":irc.test 318 %s alice :End of /WHOIS list.", nick)
+			} else {
+				ts.send(":irc.test 401 %s %s :No such nick/channel", nick, m.params[0])
+			}
+		}
+		if !registered && user && len(nick) > 0 {
+			registered = true
+			ts.send(":irc.test 001 %s :Welcome to the test network", nick)
+		}
+		ts.received <- line
+	}
+}
+
+func (ts *testServer) send(format string, v ...interface{}) {
+	fmt.Fprintf(ts.conn, format+"\r\n", v...)
+}
+
+// expect waits for the client to send a line with the given prefix
+func (ts *testServer) expect(prefix string) string {
+	ts.t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case line, ok := <-ts.received:
+			if !ok {
+				ts.t.Fatalf("connection closed waiting for '%s'", prefix)
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		case <-timeout:
+			ts.t.Fatalf("timed out waiting for '%s'", prefix)
+		}
+	}
+}
+
+// testHandler implements the robot.Handler methods used by the connector
+type testHandler struct {
+	cfg      config
+	incoming chan *robot.ConnectorMessage
+	mention  string
+}
+
+func (h *testHandler) IncomingMessage(m *robot.ConnectorMessage) { h.incoming <- m }
+func (h *testHandler) GetProtocolConfig(v interface{}) error {
+	*(v.(*config)) = h.cfg
+	return nil
+}
+func (h *testHandler) GetBrainConfig(interface{}) error   { return nil }
+func (h *testHandler) GetEventStrings() *[]string         { return &[]string{} }
+func (h *testHandler) GetHistoryConfig(interface{}) error { return nil }
+func (h *testHandler) SetBotID(id string)                 {}
+func (h *testHandler) SetTerminalWriter(io.Writer)        {}
+func (h *testHandler) SetBotMention(mention string)       { h.mention = mention }
+func (h *testHandler) GetLogLevel() robot.LogLevel        { return robot.Debug }
+func (h *testHandler) GetInstallPath() string             { return "" }
+func (h *testHandler) GetConfigPath() string              { return "" }
+func (h *testHandler) Log(l robot.LogLevel, m string, v ...interface{}) {
+	if l == robot.Fatal {
+		panic(fmt.Sprintf(m, v...))
+	}
+}
+func (h *testHandler) GetDirectory(path string) error { return nil }
+func (h *testHandler) ExtractID(u string) (string, bool) {
+	if strings.HasPrefix(u, "<") && strings.HasSuffix(u, ">") {
+		return u[1 : len(u)-1], true
+	}
+	return u, false
+}
+func (h *testHandler) RaisePriv(reason string) {}
+
+func startTest(t *testing.T, nick string) (*ircConnector, *testServer, *testHandler) {
+	ts := newTestServer(t)
+	h := &testHandler{
+		cfg: config{
+			Server: ts.listener.Addr().String(),
+			Nick:   nick,
+		},
+		incoming: make(chan *robot.ConnectorMessage, 10),
+	}
+	lock.Lock()
+	started = false
+	lock.Unlock()
+	ic := Initialize(h, nil).(*ircConnector)
+	stop := make(chan struct{})
+	go ic.Run(stop)
+	ts.expect("USER ")
+	t.Cleanup(func() {
+		close(stop)
+		ts.listener.Close()
+	})
+	return ic, ts, h
+}
+
+func (h *testHandler) expectMessage(t *testing.T) *robot.ConnectorMessage {
+	t.Helper()
+	select {
+	case m := <-h.incoming:
+		return m
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for incoming message")
+	}
+	return nil
+}
+
+func TestMessages(t *testing.T) {
+	ic, ts, h := startTest(t, "gopher")
+
+	if ret := ic.JoinChannel("ops"); ret != robot.Ok {
+		t.Errorf("JoinChannel returned %s", ret)
+	}
+	ts.expect("JOIN #ops")
+
+	ts.send(":alice!~alice@host.test PRIVMSG #ops :gopher: ping")
+	m := h.expectMessage(t)
+	if m.UserID != "alice" || m.ChannelName != "ops" || m.ChannelID != "#ops" || m.DirectMessage {
+		t.Errorf("unexpected channel message: %+v", m)
+	}
+	if m.MessageText != "@gopher ping" {
+		t.Errorf("expected addressed message to be rewritten to '@gopher ping', got '%s'", m.MessageText)
+	}
+
+	ts.send(":alice!~alice@host.test PRIVMSG gopher :\x02hello\x02 there")
+	m = h.expectMessage(t)
+	if !m.DirectMessage || m.MessageText != "hello there" {
+		t.Errorf("unexpected direct message: %+v", m)
+	}
+
+	ic.SendProtocolChannelMessage("ops", "hi everyone", robot.Variable)
+	ts.expect("PRIVMSG #ops :hi everyone")
+	ic.SendProtocolUserChannelMessage("<alice>", "alice", "<#ops>", "pong", robot.Variable)
+	ts.expect("PRIVMSG #ops :alice: pong")
+	ic.SendProtocolUserMessage("alice", "secret\n\nstuff", robot.Fixed)
+	ts.expect("PRIVMSG alice :secret")
+	ts.expect("PRIVMSG alice : ")
+	ts.expect("PRIVMSG alice :stuff")
+
+	ts.send("PING :irc.test")
+	ts.expect("PONG :irc.test")
+}
+
+func TestNickChange(t *testing.T) {
+	ic, ts, h := startTest(t, "taken")
+	if nick := ic.getNick(); nick != "taken_" {
+		t.Errorf("expected nick 'taken_' after collision, got '%s'", nick)
+	}
+	ic.SetUserMap(map[string]string{"alice": "alice"})
+
+	ts.send(":alice!~alice@host.test NICK :alice_afk")
+	ts.send(":alice_afk!~alice@host.test PRIVMSG #ops :still me")
+	m := h.expectMessage(t)
+	if m.UserID != "alice" || m.UserName != "alice_afk" {
+		t.Errorf("expected user ID 'alice' to follow nick change, got: %+v", m)
+	}
+
+	ic.SendProtocolUserMessage("<alice>", "by ID", robot.Variable)
+	ts.expect("PRIVMSG alice_afk :by ID")
+	ic.SendProtocolUserMessage("alice", "by username", robot.Variable)
+	ts.expect("PRIVMSG alice_afk :by username")
+	ic.SendProtocolChannelMessage("ops", "ping @alice", robot.Fixed)
+	ts.expect("PRIVMSG #ops :ping alice_afk")
+
+	ts.send(":taken_!~gopher@host.test NICK :gopher")
+	ts.send(":bob!~bob@host.test PRIVMSG #ops :gopher, hi")
+	m = h.expectMessage(t)
+	if m.MessageText != "@gopher hi" || h.mention != "gopher" {
+		t.Errorf("expected robot nick change to update the mention, got '%s'/'%s'", m.MessageText, h.mention)
+	}
+}
+
+func TestUserAttributes(t *testing.T) {
+	ic, _, _ := startTest(t, "gopher")
+	if name, ret := ic.GetProtocolUserAttribute("alice", "realname"); ret != robot.Ok || name != "Alice Liddell" {
+		t.Errorf("expected realname 'Alice Liddell', got '%s'/%s", name, ret)
+	}
+	if _, ret := ic.GetProtocolUserAttribute("nobody", "realname"); ret != robot.UserNotFound {
+		t.Errorf("expected UserNotFound for unknown nick, got %s", ret)
+	}
+	if id, ret := ic.GetProtocolUserAttribute("alice", "internalid"); ret != robot.Ok || id != "alice" {
+		t.Errorf("expected internalid 'alice', got '%s'/%s", id, ret)
+	}
+}
+
+func TestIrcifyMessage(t *testing.T) {
+	ic := &ircConnector{
+		Handler:         &testHandler{},
+		maxMessageSplit: 3,
+		nickToID:        make(map[string]string),
+		idToNick:        make(map[string]string),
+	}
+	long := strings.Repeat("word ", 100)
+	msgs := ic.ircifyMessage("", long, robot.Variable)
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(msgs))
+	}
+	for _, msg := range msgs {
+		if len(msg) > maxLineLength {
+			t.Errorf("line too long: %d bytes", len(msg))
+		}
+	}
+	msgs = ic.ircifyMessage("", strings.Repeat(long+"\n", 3), robot.Variable)
+	if len(msgs) != 4 || msgs[3] != "(message too long, truncated)" {
+		t.Errorf("expected message truncated after 3 lines, got %d: %q", len(msgs), msgs)
+	}
+	msgs = ic.ircifyMessage("", strings.Repeat("é", 300), robot.Variable)
+	if len(msgs) != 2 || !strings.HasPrefix(msgs[1], "é") {
+		t.Errorf("expected multi-byte characters to be split cleanly, got %q", msgs)
+	}
+}
@@ -0,0 +1,20 @@
+// Common symbols needed when being built as a module
+// +build module
+
+package irc
+
+import (
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+var manifest = robot.Manifest{
+	Connector: robot.ConnectorSpec{
+		Name:      "irc",
+		Connector: Initialize,
+	},
+}
+
+// GetManifest returns all the handlers available in this plugin
+func GetManifest() robot.Manifest {
+	return manifest
+}
@@ -0,0 +1,11 @@
+// Only needed when built as part of the gopherbot binary
+// +build !module
+
+package irc
+
+import "github.com/lnxjedi/gopherbot/bot"
+
+func init() {
+	bot.RegisterPreload("connectors/irc.so")
+	bot.RegisterConnector("irc", Initialize)
+}
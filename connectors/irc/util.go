@@ -0,0 +1,176 @@
+package irc
+
+/* util has the internal methods for mapping users and channels, formatting
+and rate-limiting outgoing messages. */
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// maxLineLength is the maximum number of bytes of text sent in a single
+// PRIVMSG; servers limit lines to 512 bytes including the command, target,
+// and the prefix relayed to other clients.
+const maxLineLength = 400
+
+// Flood control constants; the robot can send a burst of `burstLines`,
+// after which lines are sent at most once every `lineDelay`.
+const burstLines = 5
+const lineDelay = 1 * time.Second
+
+type sendLine struct {
+	target, text string
+}
+
+// userID returns the stable internal ID for a nick; the first time a nick
+// is seen, the nick itself is used. Note that after "alice" changes nick to
+// "alice_away", whoever connects as "alice" next also gets the ID "alice",
+// and is seen as the same user - with the same UserRoster name and any
+// admin rights - as long as the network doesn't protect registered nicks.
+func (ic *ircConnector) userID(nick string) string {
+	lcNick := strings.ToLower(nick)
+	ic.RLock()
+	id, ok := ic.nickToID[lcNick]
+	ic.RUnlock()
+	if ok {
+		return id
+	}
+	ic.Lock()
+	if id, ok = ic.nickToID[lcNick]; !ok {
+		id = nick
+		ic.nickToID[lcNick] = id
+		ic.idToNick[id] = nick
+	}
+	ic.Unlock()
+	return id
+}
+
+// userNick takes "<userID>" or a username and returns the user's current
+// nick, and the user ID.
+func (ic *ircConnector) userNick(u string) (nick, id string) {
+	ic.RLock()
+	defer ic.RUnlock()
+	var ok bool
+	if id, ok = ic.ExtractID(u); !ok {
+		if id, ok = ic.botUserMap[u]; !ok {
+			if id, ok = ic.nickToID[strings.ToLower(u)]; !ok {
+				return u, u
+			}
+		}
+	}
+	if nick, ok = ic.idToNick[id]; ok {
+		return nick, id
+	}
+	return id, id
+}
+
+// isChannel reports whether a PRIVMSG target is a channel
+func isChannel(target string) bool {
+	return len(target) > 0 && strings.ContainsRune("#&+!", rune(target[0]))
+}
+
+// channelTarget takes "<#channel>" or a channel name with or without the
+// leading '#' and returns the protocol channel name.
+func (ic *ircConnector) channelTarget(ch string) string {
+	if id, ok := ic.ExtractID(ch); ok {
+		ch = id
+	}
+	if isChannel(ch) {
+		return ch
+	}
+	return "#" + ch
+}
+
+var formatRe = regexp.MustCompile("\x03[0-9]{0,2}(,[0-9]{1,2})?|[\x02\x0f\x11\x16\x1d\x1e\x1f]")
+
+// stripFormatting removes mIRC color and formatting codes
+func stripFormatting(s string) string {
+	return formatRe.ReplaceAllString(s, "")
+}
+
+var mentionRe = regexp.MustCompile(`@[0-9a-z]{1,21}\b`)
+
+// ircifyMessage replaces @username with the user's current nick, and splits
+// the message in to lines that fit in a PRIVMSG, sending at most
+// maxMessageSplit lines.
+func (ic *ircConnector) ircifyMessage(prefix, msg string, f robot.MessageFormat) []string {
+	if f != robot.Variable {
+		msg = mentionRe.ReplaceAllStringFunc(msg, func(mention string) string {
+			ic.RLock()
+			_, ok := ic.botUserMap[mention[1:]]
+			ic.RUnlock()
+			if !ok {
+				return mention
+			}
+			nick, _ := ic.userNick(mention[1:])
+			return nick
+		})
+	}
+	msg = strings.Replace(msg, "\r", "", -1)
+	msg = prefix + msg
+	msgs := make([]string, 0, ic.maxMessageSplit+1)
+	for _, line := range strings.Split(msg, "\n") {
+		if len(line) == 0 {
+			// servers drop empty messages; keep the spacing
+			line = " "
+		}
+		for len(line) > maxLineLength {
+			if len(msgs) == ic.maxMessageSplit {
+				break
+			}
+			cut := strings.LastIndexByte(line[:maxLineLength], ' ')
+			if cut <= 0 {
+				// don't split a multi-byte character
+				cut = maxLineLength
+				for cut > 0 && !utf8.RuneStart(line[cut]) {
+					cut--
+				}
+			}
+			msgs = append(msgs, line[:cut])
+			line = strings.TrimLeft(line[cut:], " ")
+		}
+		if len(msgs) == ic.maxMessageSplit {
+			ic.Log(robot.Info, "Message too long, truncating to %d lines", ic.maxMessageSplit)
+			msgs = append(msgs, "(message too long, truncated)")
+			break
+		}
+		msgs = append(msgs, line)
+	}
+	return msgs
+}
+
+func (ic *ircConnector) sendMessages(msgs []string, target string) {
+	for _, msg := range msgs {
+		ic.send <- &sendLine{
+			target: target,
+			text:   msg,
+		}
+	}
+}
+
+func (ic *ircConnector) startSendLoop() {
+	// See flood control constants above.
+	credit := burstLines
+	last := time.Now()
+	for send := range ic.send {
+		now := time.Now()
+		credit += int(now.Sub(last) / lineDelay)
+		if credit > burstLines {
+			credit = burstLines
+		}
+		if credit == 0 {
+			time.Sleep(lineDelay)
+			now = time.Now()
+		} else {
+			credit--
+		}
+		last = now
+		if err := ic.write("PRIVMSG " + send.target + " :" + send.text); err != nil {
+			ic.Log(robot.Error, "failed sending irc message to '%s': %v", send.target, err)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package rocket
 
 import (
 	"crypto/md5"
+	"sort"
+	"strings"
 	"time"
 
 	models "github.com/lnxjedi/gopherbot/connectors/rocket/models"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var incoming chan models.Message
@@ -75,6 +77,12 @@ loop:
 	for {
 		select {
 		case pmsg := <-incoming:
+			// Edits and reaction changes come as updates to the original
+			// message, and shouldn't be heard as new messages.
+			if update, added := trackMessage(&pmsg, time.Now()); update {
+				rc.processReactions(&pmsg, added)
+				continue
+			}
 			rc.processMessage(&pmsg)
 		case <-stop:
 			rc.Log(robot.Debug, "Received stop in connector")
@@ -86,7 +94,7 @@ loop:
 // processMessage creates a robot.ConnectorMessage and calls
 // robot.IncomingMessage
 func (rc *rocketConnector) processMessage(msg *models.Message) {
-	if len(msg.Msg) == 0 {
+	if len(msg.Msg) == 0 && len(msg.Files) == 0 {
 		return
 	}
 	if msg.User.ID == userID {
@@ -95,21 +103,9 @@ func (rc *rocketConnector) processMessage(msg *models.Message) {
 	if msg.User.UserName == userName {
 		return
 	}
-	hearIt := false
-	directMsg := false
 	mapUser := false
+	chName, directMsg, hearIt := rc.roomInfo(msg.RoomID)
 	rc.RLock()
-	chName := rc.channelNames[msg.RoomID]
-	if _, ok := rc.dmChannels[msg.RoomID]; ok {
-		hearIt = true
-		directMsg = true
-	}
-	if _, ok := rc.privChannels[msg.RoomID]; ok {
-		hearIt = true
-	}
-	if _, ok := rc.joinedChannels[msg.RoomID]; ok {
-		hearIt = true
-	}
 	if _, ok := rc.userNameIDMap[msg.User.UserName]; !ok {
 		mapUser = true
 	}
@@ -139,6 +135,9 @@ func (rc *rocketConnector) processMessage(msg *models.Message) {
 		ChannelID:     msg.RoomID,
 		ChannelName:   chName,
 		MessageText:   msg.Msg,
+		ThreadID:      msg.ThreadID,
+		MessageID:     msg.ID,
+		Files:         getFiles(msg),
 		MessageObject: msg,
 		Client:        rc.rt,
 		DirectMessage: directMsg,
@@ -146,6 +145,96 @@ func (rc *rocketConnector) processMessage(msg *models.Message) {
 	rc.IncomingMessage(botMsg)
 }
 
+// roomInfo returns the channel name for a room, whether it's a direct
+// message channel, and whether the robot hears messages in the room.
+func (rc *rocketConnector) roomInfo(roomID string) (chName string, directMsg, hearIt bool) {
+	rc.RLock()
+	defer rc.RUnlock()
+	chName = rc.channelNames[roomID]
+	if _, ok := rc.dmChannels[roomID]; ok {
+		hearIt = true
+		directMsg = true
+	}
+	if _, ok := rc.privChannels[roomID]; ok {
+		hearIt = true
+	}
+	if _, ok := rc.joinedChannels[roomID]; ok {
+		hearIt = true
+	}
+	return
+}
+
+// trackMessage records an incoming message with its reactions, and returns
+// whether it's an update to an earlier message - an edit or a change in
+// reactions - along with the "<emoji> <username>" reactions added since the
+// message was last seen. Updates to messages the connector never saw arrive,
+// e.g. from before a restart, never return reactions, since there's no way
+// to tell which are new.
+func trackMessage(msg *models.Message, now time.Time) (update bool, added []string) {
+	if now.Sub(reactionSweep) > reactionExpire/24 {
+		reactionSweep = now
+		for id, r := range knownReactions {
+			if now.Sub(r.seen) > reactionExpire {
+				delete(knownReactions, id)
+			}
+		}
+	}
+	current := make(map[string]struct{})
+	for emoji, r := range msg.Reactions {
+		for _, u := range r.Usernames {
+			current[emoji+" "+u] = struct{}{}
+		}
+	}
+	known, ok := knownReactions[msg.ID]
+	knownReactions[msg.ID] = &msgReactions{current, now}
+	if !ok {
+		// _updatedAt can be later than ts on a new message, so only
+		// editedAt marks an edit
+		return msg.EditedAt != nil || len(msg.Reactions) > 0, nil
+	}
+	for r := range current {
+		if _, seen := known.reactions[r]; !seen {
+			added = append(added, r)
+		}
+	}
+	sort.Strings(added)
+	return true, added
+}
+
+// processReactions sends reactions added to a message to the robot.
+func (rc *rocketConnector) processReactions(msg *models.Message, added []string) {
+	if len(added) == 0 {
+		return
+	}
+	chName, directMsg, hearIt := rc.roomInfo(msg.RoomID)
+	if !hearIt {
+		return
+	}
+	for _, r := range added {
+		reaction := strings.SplitN(r, " ", 2)
+		emoji, u := reaction[0], reaction[1]
+		if u == userName {
+			continue
+		}
+		rc.RLock()
+		uid := rc.userNameIDMap[u]
+		rc.RUnlock()
+		rc.IncomingMessage(&robot.ConnectorMessage{
+			Protocol:      "rocket",
+			UserID:        uid,
+			UserName:      u,
+			ChannelID:     msg.RoomID,
+			ChannelName:   chName,
+			ThreadID:      msg.ThreadID,
+			MessageID:     msg.ID,
+			Reaction:      strings.Trim(emoji, ":"),
+			MessageObject: msg,
+			Client:        rc.rt,
+			DirectMessage: directMsg,
+		})
+	}
+}
+
 func (rc *rocketConnector) updateChannels() {
 	inChannels, ierr := rc.rt.GetChannelsIn()
 	if ierr != nil {
@@ -180,21 +269,63 @@ func formatMessage(msg string, f robot.MessageFormat) string {
 // sendMessage takes "channel" or "<chanID>" and sends the pre-formatted
 // message.
 func (rc *rocketConnector) sendMessage(ch, msg string) (ret robot.RetVal) {
-	var chanID string
-	found := false
-	chanID, found = rc.ExtractID(ch)
+	_, ret = rc.sendThreadMessage(ch, "", msg)
+	return
+}
+
+// sendThreadMessage sends a message to a thread, or starts a new thread
+// when thread is "", returning the thread ID.
+func (rc *rocketConnector) sendThreadMessage(ch, thread, msg string) (string, robot.RetVal) {
+	chanID, found := rc.roomID(ch)
 	if !found {
-		rc.RLock()
-		chanID, found = rc.channelIDs[ch]
-		rc.RUnlock()
+		return thread, robot.ChannelNotFound
 	}
+	sendChan := models.Channel{ID: chanID}
+	m := rc.rt.NewMessage(&sendChan, msg)
+	m.ThreadID = thread
+	if _, err := rc.rt.SendMessage(m); err != nil {
+		return thread, robot.FailedMessageSend
+	}
+	if len(thread) == 0 {
+		thread = m.ID
+	}
+	return thread, robot.Ok
+}
+
+// sendChoiceMessage sends a prompt with an action button for each choice;
+// clicking a button sends the choice as a message from the user.
+func (rc *rocketConnector) sendChoiceMessage(ch, msg string, choices []string) robot.RetVal {
+	chanID, found := rc.roomID(ch)
 	if !found {
 		return robot.ChannelNotFound
 	}
 	sendChan := models.Channel{ID: chanID}
 	m := rc.rt.NewMessage(&sendChan, msg)
+	actions := make([]models.AttachmentAction, len(choices))
+	for i, choice := range choices {
+		actions[i] = models.AttachmentAction{
+			Type:              models.AttachmentActionTypeButton,
+			Text:              choice,
+			Msg:               choice,
+			MsgInChatWindow:   true,
+			MsgProcessingType: models.ProcessingTypeSendMessage,
+		}
+	}
+	m.Attachments = []models.Attachment{{Actions: actions}}
 	if _, err := rc.rt.SendMessage(m); err != nil {
+		rc.Log(robot.Error, "rocket sending choices: %v", err)
 		return robot.FailedMessageSend
 	}
 	return robot.Ok
 }
+
+// roomID takes "channel" or "<chanID>" and returns the room ID
+func (rc *rocketConnector) roomID(ch string) (string, bool) {
+	if chanID, found := rc.ExtractID(ch); found {
+		return chanID, true
+	}
+	rc.RLock()
+	chanID, found := rc.channelIDs[ch]
+	rc.RUnlock()
+	return chanID, found
+}
@@ -1,6 +1,11 @@
 package rocket
 
-import "github.com/lnxjedi/robot"
+import (
+	"strings"
+
+	models "github.com/lnxjedi/gopherbot/connectors/rocket/models"
+	"github.com/lnxjedi/gopherbot/robot"
+)
 
 func (rc *rocketConnector) MessageHeard(u, c string) {
 	return
@@ -32,6 +37,56 @@ func (rc *rocketConnector) SendProtocolChannelMessage(ch string, msg string, f r
 
 // SendProtocolChannelMessage sends a message to a channel
 func (rc *rocketConnector) SendProtocolUserChannelMessage(uid, uname, ch, msg string, f robot.MessageFormat) (ret robot.RetVal) {
+	return rc.sendMessage(ch, rc.userChannelMessage(uid, uname, msg, f))
+}
+
+// SendProtocolChannelThreadMessage sends a message to a thread in a channel
+func (rc *rocketConnector) SendProtocolChannelThreadMessage(ch, thr, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	return rc.sendThreadMessage(ch, thr, formatMessage(msg, f))
+}
+
+// SendProtocolUserChannelThreadMessage sends a message to a user in a
+// channel thread
+func (rc *rocketConnector) SendProtocolUserChannelThreadMessage(uid, uname, ch, thr, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	return rc.sendThreadMessage(ch, thr, rc.userChannelMessage(uid, uname, msg, f))
+}
+
+// AddReaction adds a reaction to a message
+func (rc *rocketConnector) AddReaction(ch, msgID, reaction string) robot.RetVal {
+	return rc.setReaction(msgID, reaction, true)
+}
+
+// RemoveReaction removes a reaction from a message
+func (rc *rocketConnector) RemoveReaction(ch, msgID, reaction string) robot.RetVal {
+	return rc.setReaction(msgID, reaction, false)
+}
+
+func (rc *rocketConnector) setReaction(msgID, reaction string, add bool) robot.RetVal {
+	if err := rc.rt.SetReaction(msgID, ":"+reaction+":", add); err != nil {
+		rc.Log(robot.Error, "rocket updating reaction '%s' on message %s: %v", reaction, msgID, err)
+		return robot.FailedMessageSend
+	}
+	return robot.Ok
+}
+
+// SendProtocolUserChannelChoiceMessage directs a prompt with choice
+// buttons to a user in a channel
+func (rc *rocketConnector) SendProtocolUserChannelChoiceMessage(uid, uname, ch, msg string, choices []string, f robot.MessageFormat) robot.RetVal {
+	return rc.sendChoiceMessage(ch, rc.userChannelMessage(uid, uname, msg, f), choices)
+}
+
+// SendProtocolUserChoiceMessage sends a prompt with choice buttons to a
+// user as a direct message
+func (rc *rocketConnector) SendProtocolUserChoiceMessage(u, msg string, choices []string, f robot.MessageFormat) robot.RetVal {
+	dchan, ret := rc.userDMChannel(u)
+	if ret != robot.Ok {
+		return ret
+	}
+	return rc.sendChoiceMessage("<"+dchan+">", formatMessage(msg, f), choices)
+}
+
+// userChannelMessage formats a message directed at a user in a channel
+func (rc *rocketConnector) userChannelMessage(uid, uname, msg string, f robot.MessageFormat) string {
 	var user string
 	// We prefer to use @(rocketchat username), looked up from
 	// the user ID.
@@ -53,11 +108,22 @@ func (rc *rocketConnector) SendProtocolUserChannelMessage(uid, uname, ch, msg st
 	if len(user) > 0 {
 		msg = "@" + uname + " " + msg
 	}
-	return rc.sendMessage(ch, msg)
+	return msg
 }
 
 // SendProtocolUserMessage sends a direct message to a user
 func (rc *rocketConnector) SendProtocolUserMessage(u string, msg string, f robot.MessageFormat) (ret robot.RetVal) {
+	var dchan string
+	if dchan, ret = rc.userDMChannel(u); ret != robot.Ok {
+		return
+	}
+	// sendMessage expects internal channels IDs to be bracketed
+	return rc.sendMessage("<"+dchan+">", formatMessage(msg, f))
+}
+
+// userDMChannel returns the direct message room ID for a user, creating
+// the room if needed
+func (rc *rocketConnector) userDMChannel(u string) (string, robot.RetVal) {
 	var uid, dchan, user string
 	var ok bool
 	var err error
@@ -66,7 +132,7 @@ func (rc *rocketConnector) SendProtocolUserMessage(u string, msg string, f robot
 		user, ok = rc.userIDNameMap[uid]
 		rc.RUnlock()
 		if !ok {
-			return robot.UserNotFound
+			return "", robot.UserNotFound
 		}
 	} else {
 		user = u
@@ -77,14 +143,64 @@ func (rc *rocketConnector) SendProtocolUserMessage(u string, msg string, f robot
 	if !ok {
 		if dchan, err = rc.rt.CreateDirectMessage(user); err != nil {
 			rc.Log(robot.Error, "creating direct message for %s: %v", user, err)
-			return robot.FailedMessageSend
+			return "", robot.FailedMessageSend
 		}
 		rc.Lock()
 		rc.userDM[user] = dchan
 		rc.Unlock()
 	}
-	// sendMessage expects internal channels IDs to be bracketed
-	return rc.sendMessage("<"+dchan+">", formatMessage(msg, f))
+	return dchan, robot.Ok
+}
+
+// SendProtocolChannelEditableMessage sends a message to a channel that can
+// be updated with UpdateProtocolMessage
+func (rc *rocketConnector) SendProtocolChannelEditableMessage(ch, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	chanID, found := rc.roomID(ch)
+	if !found {
+		return "", robot.ChannelNotFound
+	}
+	return rc.sendEditableMessage(chanID, formatMessage(msg, f))
+}
+
+// SendProtocolUserEditableMessage sends a direct message to a user that can
+// be updated with UpdateProtocolMessage
+func (rc *rocketConnector) SendProtocolUserEditableMessage(u, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	dchan, ret := rc.userDMChannel(u)
+	if ret != robot.Ok {
+		return "", ret
+	}
+	return rc.sendEditableMessage(dchan, formatMessage(msg, f))
+}
+
+// sendEditableMessage sends a message to a room, returning the ID for
+// updating the message, "<room ID>:<message ID>".
+func (rc *rocketConnector) sendEditableMessage(roomID, msg string) (string, robot.RetVal) {
+	// Sending without a thread returns the ID of the message
+	msgID, ret := rc.sendThreadMessage("<"+roomID+">", "", msg)
+	if ret != robot.Ok {
+		return "", ret
+	}
+	return roomID + ":" + msgID, robot.Ok
+}
+
+// UpdateProtocolMessage updates the text of a message sent with one of the
+// editable send methods
+func (rc *rocketConnector) UpdateProtocolMessage(msgID, msg string, f robot.MessageFormat) robot.RetVal {
+	parts := strings.SplitN(msgID, ":", 2)
+	if len(parts) != 2 {
+		rc.Log(robot.Error, "invalid rocket message ID for update: %s", msgID)
+		return robot.FailedMessageSend
+	}
+	m := &models.Message{
+		ID:     parts[1],
+		RoomID: parts[0],
+		Msg:    formatMessage(msg, f),
+	}
+	if err := rc.rt.EditMessage(m); err != nil {
+		rc.Log(robot.Error, "rocket updating message %s: %v", msgID, err)
+		return robot.FailedMessageSend
+	}
+	return robot.Ok
 }
 
 // JoinChannel joins a channel given it's human-readable name, e.g. "general"
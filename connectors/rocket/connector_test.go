@@ -0,0 +1,91 @@
+package rocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/connectors/rocket/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func reacted(id string, ts time.Time, reactions map[string][]string) *models.Message {
+	msg := &models.Message{ID: id, RoomID: "GENERAL", Msg: "bender, build gopherbot", Timestamp: &ts, UpdatedAt: &ts}
+	if len(reactions) > 0 {
+		updated := ts.Add(time.Minute)
+		msg.UpdatedAt = &updated
+		msg.Reactions = make(map[string]models.Reaction)
+		for emoji, users := range reactions {
+			msg.Reactions[emoji] = models.Reaction{Usernames: users}
+		}
+	}
+	return msg
+}
+
+func TestTrackMessage(t *testing.T) {
+	knownReactions = make(map[string]*msgReactions)
+	now := time.Now()
+
+	update, added := trackMessage(reacted("m1", now, nil), now)
+	assert.False(t, update, "new message treated as an update")
+	assert.Empty(t, added)
+
+	update, added = trackMessage(reacted("m1", now, map[string][]string{":eyes:": {"alice"}}), now)
+	assert.True(t, update, "reaction not treated as an update")
+	assert.Equal(t, []string{":eyes: alice"}, added)
+
+	update, added = trackMessage(reacted("m1", now, map[string][]string{":eyes:": {"alice", "bob"}, ":rocket:": {"alice"}}), now)
+	assert.True(t, update)
+	assert.Equal(t, []string{":eyes: bob", ":rocket: alice"}, added, "only new reactions should be returned")
+
+	update, added = trackMessage(reacted("m1", now, map[string][]string{":rocket:": {"alice"}}), now)
+	assert.True(t, update, "removed reaction not treated as an update")
+	assert.Empty(t, added)
+
+	edited := reacted("m1", now, map[string][]string{":rocket:": {"alice"}})
+	edited.EditedAt = edited.UpdatedAt
+	edited.Msg = "bender, build gopherbot again"
+	update, added = trackMessage(edited, now)
+	assert.True(t, update, "edit not treated as an update")
+	assert.Empty(t, added)
+}
+
+func TestTrackMessageUnseen(t *testing.T) {
+	knownReactions = make(map[string]*msgReactions)
+	now := time.Now()
+	old := now.Add(-time.Hour)
+
+	update, added := trackMessage(reacted("m2", old, map[string][]string{":rocket:": {"alice"}}), now)
+	assert.True(t, update, "reaction to an unseen message not treated as an update")
+	assert.Empty(t, added, "reactions on an unseen message should never be new")
+
+	update, added = trackMessage(reacted("m2", old, map[string][]string{":rocket:": {"alice", "bob"}}), now)
+	assert.True(t, update)
+	assert.Equal(t, []string{":rocket: bob"}, added)
+
+	edited := reacted("m3", old, nil)
+	updated := now
+	edited.EditedAt, edited.UpdatedAt = &updated, &updated
+	update, added = trackMessage(edited, now)
+	assert.True(t, update, "edit of an unseen message not treated as an update")
+	assert.Empty(t, added)
+
+	// the server can set _updatedAt after ts on a new message
+	fresh := reacted("m6", now, nil)
+	later := now.Add(time.Second)
+	fresh.UpdatedAt = &later
+	update, _ = trackMessage(fresh, now)
+	assert.False(t, update, "new message with a later _updatedAt treated as an update")
+}
+
+func TestTrackMessageExpire(t *testing.T) {
+	knownReactions = make(map[string]*msgReactions)
+	reactionSweep = time.Time{}
+	then := time.Now().Add(-2 * reactionExpire)
+
+	trackMessage(reacted("m4", then, nil), then)
+	trackMessage(reacted("m5", time.Now(), nil), time.Now())
+	_, ok := knownReactions["m4"]
+	assert.False(t, ok, "expired message not swept")
+	_, ok = knownReactions["m5"]
+	assert.True(t, ok)
+}
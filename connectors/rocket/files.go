@@ -0,0 +1,69 @@
+package rocket
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	models "github.com/lnxjedi/gopherbot/connectors/rocket/models"
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+// getFiles returns FileInfo for files uploaded with a message; the ID is
+// "<file ID>/<name>", the path to the file under /file-upload.
+func getFiles(msg *models.Message) []robot.FileInfo {
+	if len(msg.Files) == 0 {
+		return nil
+	}
+	files := make([]robot.FileInfo, 0, len(msg.Files))
+	for _, f := range msg.Files {
+		files = append(files, robot.FileInfo{
+			ID:       f.ID + "/" + f.Name,
+			Name:     f.Name,
+			MimeType: f.Type,
+		})
+	}
+	return files
+}
+
+// SendProtocolChannelFile uploads a file to a channel
+func (rc *rocketConnector) SendProtocolChannelFile(ch, filename, title string, data io.Reader) robot.RetVal {
+	chanID, found := rc.roomID(ch)
+	if !found {
+		rc.Log(robot.Error, "rocket channel ID not found for: %s", ch)
+		return robot.ChannelNotFound
+	}
+	return rc.uploadFile(chanID, filename, title, data)
+}
+
+// SendProtocolUserFile uploads a file to a user's direct message channel
+func (rc *rocketConnector) SendProtocolUserFile(u, filename, title string, data io.Reader) robot.RetVal {
+	dchan, ret := rc.userDMChannel(u)
+	if ret != robot.Ok {
+		return ret
+	}
+	return rc.uploadFile(dchan, filename, title, data)
+}
+
+func (rc *rocketConnector) uploadFile(roomID, filename, title string, data io.Reader) robot.RetVal {
+	if _, err := rc.rest.UploadFile(roomID, filename, title, data); err != nil {
+		rc.Log(robot.Error, "rocket uploading file '%s' to room '%s': %v", filename, roomID, err)
+		return robot.FailedMessageSend
+	}
+	return robot.Ok
+}
+
+// GetProtocolFile downloads a file uploaded with a message
+func (rc *rocketConnector) GetProtocolFile(fileID string, data io.Writer) robot.RetVal {
+	parts := strings.SplitN(fileID, "/", 2)
+	if len(parts) != 2 {
+		rc.Log(robot.Error, "invalid rocket file ID: %s", fileID)
+		return robot.FailedMessageSend
+	}
+	path := "/file-upload/" + parts[0] + "/" + url.PathEscape(parts[1])
+	if err := rc.rest.DownloadFile(path, data); err != nil {
+		rc.Log(robot.Error, "rocket downloading file '%s': %v", fileID, err)
+		return robot.FailedMessageSend
+	}
+	return robot.Ok
+}
@@ -7,6 +7,7 @@ type Message struct {
 	RoomID   string `json:"rid"`
 	Msg      string `json:"msg"`
 	EditedBy string `json:"editedBy,omitempty"`
+	ThreadID string `json:"tmid,omitempty"`
 
 	Groupable bool `json:"groupable,omitempty"`
 
@@ -14,8 +15,10 @@ type Message struct {
 	Timestamp *time.Time `json:"ts,omitempty"`
 	UpdatedAt *time.Time `json:"_updatedAt,omitempty"`
 
-	Mentions []User `json:"mentions,omitempty"`
-	User     *User  `json:"u,omitempty"`
+	Mentions  []User              `json:"mentions,omitempty"`
+	User      *User               `json:"u,omitempty"`
+	Reactions map[string]Reaction `json:"reactions,omitempty"`
+	Files     []File              `json:"files,omitempty"`
 	PostMessage
 
 	// Bot         interface{}  `json:"bot"`
@@ -24,6 +27,18 @@ type Message struct {
 	// SandstormSessionID interface{} `json:"sandstormSessionId"`
 }
 
+// Reaction lists the users that reacted to a message with a given emoji
+type Reaction struct {
+	Usernames []string `json:"usernames"`
+}
+
+// File is a file uploaded with a message
+type File struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
 // PostMessage Payload for postmessage rest API
 //
 // https://rocket.chat/docs/developer-guides/rest-api/chat/postmessage/
@@ -4,7 +4,7 @@
 package rocket
 
 import (
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var manifest = robot.Manifest{
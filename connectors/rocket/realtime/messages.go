@@ -106,6 +106,15 @@ func (c *Client) ReactToMessage(message *models.Message, reaction string) error
 	return nil
 }
 
+// SetReaction adds or removes a reaction on a message, given the message
+// ID and emoji, e.g. ":thumbsup:"
+//
+// https://rocket.chat/docs/developer-guides/realtime-api/method-calls/set-reaction
+func (c *Client) SetReaction(messageID, reaction string, shouldReact bool) error {
+	_, err := c.ddp.Call("setReaction", reaction, messageID, shouldReact)
+	return err
+}
+
 // StarMessage stars message
 // takes a message object
 //
@@ -236,20 +245,54 @@ func getMessageFromData(data interface{}) *models.Message {
 	return getMessageFromDocument(document)
 }
 
+// getDateFromDocument returns the time from an EJSON date, in
+// milliseconds, or nil if the field is missing.
+func getDateFromDocument(arg *gabs.Container, path string) *time.Time {
+	date := stringOrZero(arg.Path(path + ".$date").Data())
+	if len(date) == 0 {
+		return nil
+	}
+	ti, err := strconv.ParseFloat(date, 64)
+	if err != nil {
+		return nil
+	}
+	t := time.Unix(int64(ti)/1e3, (int64(ti)%1e3)*1e6)
+	return &t
+}
+
 func getMessageFromDocument(arg *gabs.Container) *models.Message {
-	var ts *time.Time
-	date := stringOrZero(arg.Path("ts.$date").Data())
-	if len(date) > 0 {
-		if ti, err := strconv.ParseFloat(date, 64); err == nil {
-			t := time.Unix(int64(ti)/1e3, int64(ti)%1e3)
-			ts = &t
+	var reactions map[string]models.Reaction
+	if rmap, err := arg.Path("reactions").ChildrenMap(); err == nil && len(rmap) > 0 {
+		reactions = make(map[string]models.Reaction)
+		for emoji, r := range rmap {
+			var usernames []string
+			if users, err := r.Path("usernames").Children(); err == nil {
+				for _, u := range users {
+					usernames = append(usernames, stringOrZero(u.Data()))
+				}
+			}
+			reactions[emoji] = models.Reaction{Usernames: usernames}
+		}
+	}
+	// Older servers only send "file", newer servers send both
+	var files []models.File
+	if fl, err := arg.Path("files").Children(); err == nil && len(fl) > 0 {
+		for _, f := range fl {
+			files = append(files, getFileFromDocument(f))
 		}
+	} else if arg.ExistsP("file._id") {
+		files = append(files, getFileFromDocument(arg.Path("file")))
 	}
 	return &models.Message{
 		ID:        stringOrZero(arg.Path("_id").Data()),
 		RoomID:    stringOrZero(arg.Path("rid").Data()),
 		Msg:       stringOrZero(arg.Path("msg").Data()),
-		Timestamp: ts,
+		ThreadID:  stringOrZero(arg.Path("tmid").Data()),
+		Timestamp: getDateFromDocument(arg, "ts"),
+		EditedAt:  getDateFromDocument(arg, "editedAt"),
+		UpdatedAt: getDateFromDocument(arg, "_updatedAt"),
+		Reactions: reactions,
+		Files:     files,
 		User: &models.User{
 			ID:       stringOrZero(arg.Path("u._id").Data()),
 			UserName: stringOrZero(arg.Path("u.username").Data()),
@@ -257,6 +300,14 @@ func getMessageFromDocument(arg *gabs.Container) *models.Message {
 	}
 }
 
+func getFileFromDocument(arg *gabs.Container) models.File {
+	return models.File{
+		ID:   stringOrZero(arg.Path("_id").Data()),
+		Name: stringOrZero(arg.Path("name").Data()),
+		Type: stringOrZero(arg.Path("type").Data()),
+	}
+}
+
 func stringOrZero(i interface{}) string {
 	if i == nil {
 		return ""
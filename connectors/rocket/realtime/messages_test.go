@@ -1,7 +1,9 @@
 package realtime
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/lnxjedi/gopherbot/connectors/rocket/models"
 	"github.com/stretchr/testify/assert"
@@ -65,3 +67,38 @@ func TestClient_SubscribeToMessageStream_UnknownChannel(t *testing.T) {
 
 	assert.NotNil(t, err, "Function didn't return error")
 }
+
+func TestGetMessageFromData(t *testing.T) {
+	cases := []struct {
+		name   string
+		doc    string
+		edited *time.Time
+	}{
+		{"new message", `{"_id": "m1", "rid": "GENERAL", "msg": "bender, build gopherbot", "ts": {"$date": 1700000000123}, "_updatedAt": {"$date": 1700000000456}, "u": {"_id": "u1", "username": "alice"}}`, nil},
+		{"edited message", `{"_id": "m2", "rid": "GENERAL", "msg": "bender, build gopherbot again", "ts": {"$date": 1700000000123}, "editedAt": {"$date": 1700000060000}, "editedBy": {"_id": "u1", "username": "alice"}, "_updatedAt": {"$date": 1700000060000}, "u": {"_id": "u1", "username": "alice"}}`, timePtr(time.Unix(1700000060, 0))},
+	}
+	for _, c := range cases {
+		var data interface{}
+		if err := json.Unmarshal([]byte(c.doc), &data); err != nil {
+			t.Fatalf("%s: unmarshalling test document: %v", c.name, err)
+		}
+		msg := getMessageFromData(data)
+		assert.Equal(t, "GENERAL", msg.RoomID, c.name)
+		assert.Equal(t, "alice", msg.User.UserName, c.name)
+		if assert.NotNil(t, msg.Timestamp, c.name) {
+			assert.True(t, msg.Timestamp.Equal(time.Unix(1700000000, 123e6)), "%s: wrong timestamp %s", c.name, msg.Timestamp)
+		}
+		assert.NotNil(t, msg.UpdatedAt, c.name)
+		if c.edited == nil {
+			assert.Nil(t, msg.EditedAt, "%s: EditedAt set", c.name)
+			continue
+		}
+		if assert.NotNil(t, msg.EditedAt, "%s: EditedAt not parsed", c.name) {
+			assert.True(t, msg.EditedAt.Equal(*c.edited), "%s: wrong EditedAt %s", c.name, msg.EditedAt)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// UploadFile uploads a file to a room, with an optional description.
+//
+// https://rocket.chat/docs/developer-guides/rest-api/rooms/upload
+func (c *Client) UploadFile(roomID, filename, description string, data io.Reader) (*MessageResponse, error) {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return nil, err
+	}
+	if len(description) > 0 {
+		if err := writer.WriteField("description", description); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, c.getUrl()+"/rooms.upload/"+roomID, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	c.setAuth(request)
+
+	if c.Debug {
+		log.Println(request)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Debug {
+		log.Println(string(bodyBytes))
+	}
+
+	response := new(MessageResponse)
+	if e := json.Unmarshal(bodyBytes, response); e != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New("Request error: " + resp.Status)
+		}
+		return nil, e
+	}
+	return response, response.OK()
+}
+
+// DownloadFile downloads an uploaded file, given it's path on the server,
+// e.g. "/file-upload/<id>/<name>", writing the contents to data.
+func (c *Client) DownloadFile(path string, data io.Writer) error {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	request, err := http.NewRequest(http.MethodGet, c.getServerUrl()+path, nil)
+	if err != nil {
+		return err
+	}
+	c.setAuth(request)
+
+	if c.Debug {
+		log.Println(request)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("Request error: " + resp.Status)
+	}
+	_, err = io.Copy(data, resp.Body)
+	return err
+}
+
+func (c *Client) getServerUrl() string {
+	return fmt.Sprintf("%v://%v:%v%s", c.Protocol, c.Host, c.Port, c.Path)
+}
+
+func (c *Client) setAuth(request *http.Request) {
+	if c.auth != nil {
+		request.Header.Set("X-Auth-Token", c.auth.token)
+		request.Header.Set("X-User-Id", c.auth.id)
+	}
+}
@@ -9,7 +9,8 @@ import (
 
 	models "github.com/lnxjedi/gopherbot/connectors/rocket/models"
 	api "github.com/lnxjedi/gopherbot/connectors/rocket/realtime"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/connectors/rocket/rest"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var lock sync.Mutex  // package var lock
@@ -38,10 +39,25 @@ const msgExpire = 7 * time.Second
 var trackedMsgs = make(map[msgTrack]time.Time)
 var check = make(chan msgQuery)
 
+// reactions last seen on a message received, for telling message updates
+// from new messages and detecting new reactions; only accessed from the
+// connector's main loop
+type msgReactions struct {
+	reactions map[string]struct{} // "<emoji> <username>"
+	seen      time.Time
+}
+
+// How long to remember the reactions on a message
+const reactionExpire = 24 * time.Hour
+
+var knownReactions = make(map[string]*msgReactions)
+var reactionSweep time.Time
+
 var userName, userID string
 
 type rocketConnector struct {
 	rt      *api.Client
+	rest    *rest.Client // for file uploads and downloads
 	running bool
 	robot.Handler
 	sync.RWMutex
@@ -113,6 +129,11 @@ func Initialize(handler robot.Handler, l *log.Logger) robot.Connector {
 		handler.SetBotID(user.ID)
 		//robot.SetBotMention(user.UserName)
 	}
+	// The REST client re-uses the token from the realtime login
+	rc.rest = rest.NewClient(u, false)
+	if err := rc.rest.Login(cred); err != nil {
+		rc.Log(robot.Error, "unable to log in to rocket chat REST API, file uploads will fail: %v", err)
+	}
 	incoming = client.GetMessageStreamUpdateChannel()
 	return robot.Connector(rc)
 }
@@ -6,7 +6,7 @@ import (
 	"log"
 	"sync"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 	"github.com/slack-go/slack"
 )
 
@@ -15,8 +15,10 @@ type botDefinition struct {
 }
 
 type config struct {
-	SlackToken      string // the 'bot token for connecting to Slack
-	MaxMessageSplit int    // the maximum # of ~4000 byte messages to split a large message into
+	SlackToken        string // the 'bot token for connecting to Slack
+	MaxMessageSplit   int    // the maximum # of ~4000 byte messages to split a large message into
+	InteractionListen string // address to listen on for interactive callbacks (button clicks), e.g. ":3001"
+	SigningSecret     string // the app's signing secret, for verifying interactive callbacks
 }
 
 var lock sync.Mutex // package var lock
@@ -99,6 +101,14 @@ Loop:
 	sc.botFullName, _ = sc.GetProtocolUserAttribute(sc.botName, "realname")
 	go sc.startSendLoop()
 
+	if len(c.InteractionListen) > 0 {
+		if len(c.SigningSecret) == 0 {
+			r.Log(robot.Error, "slack InteractionListen configured without SigningSecret, not offering interactive choices")
+		} else {
+			sc.startInteractionListener(c.InteractionListen, c.SigningSecret)
+			return robot.Connector(&slackChoiceConnector{sc})
+		}
+	}
 	return robot.Connector(sc)
 }
 
@@ -134,6 +144,9 @@ loop:
 				// Message processing is done concurrently
 				go sc.processMessage(ev)
 
+			case *slack.ReactionAddedEvent:
+				go sc.processReaction(ev)
+
 			case *slack.PresenceChangeEvent:
 				sc.Log(robot.Debug, "Presence Change: %v", ev)
 
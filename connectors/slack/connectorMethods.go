@@ -1,9 +1,10 @@
 package slack
 
 import (
+	"strings"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 	"github.com/slack-go/slack"
 )
 
@@ -57,6 +58,10 @@ func (s *slackConnector) GetProtocolUserAttribute(u, attr string) (value string,
 
 type sendMessage struct {
 	message, channel string
+	thread           string        // thread timestamp for threaded messages
+	update           string        // timestamp of a message to update, instead of posting
+	blocks           []slack.Block // Block Kit blocks for interactive messages
+	sent             chan string   // when non-nil, receives the timestamp of the posted message
 	format           robot.MessageFormat
 }
 
@@ -98,11 +103,23 @@ func (s *slackConnector) startSendLoop() {
 		} else {
 			opts = append(opts, slack.MsgOptionEnableLinkUnfurl())
 		}
+		if len(send.thread) > 0 {
+			opts = append(opts, slack.MsgOptionTS(send.thread))
+		}
+		if len(send.blocks) > 0 {
+			opts = append(opts, slack.MsgOptionBlocks(send.blocks...))
+		}
 		s.Log(robot.Trace, "bot message in slack send loop for channel %s, size: %d", send.channel, len(send.message))
 		time.Sleep(typingDelay)
 		sent := false
+		var ts string
 		for p := range []int{1, 2, 4} {
-			_, _, err := s.api.PostMessage(send.channel, opts...)
+			var err error
+			if len(send.update) > 0 {
+				_, ts, _, err = s.api.UpdateMessage(send.channel, send.update, opts...)
+			} else {
+				_, ts, err = s.api.PostMessage(send.channel, opts...)
+			}
 			if err != nil && p == 1 {
 				s.Log(robot.Warn, "sending slack message '%s' initiating backoff: %v", send.message, err)
 			}
@@ -113,10 +130,15 @@ func (s *slackConnector) startSendLoop() {
 				break
 			}
 		}
-		if !sent {
+		if !sent && len(send.update) > 0 {
+			s.Log(robot.Error, "failed updating slack message '%s' in channel '%s' after 3 tries", send.update, send.channel)
+		} else if !sent {
 			s.Log(robot.Error, "failed sending slack message '%s' to channel '%s' after 3 tries, attempting fallback to RTM", send.message, send.channel)
 			s.conn.SendMessage(s.conn.NewOutgoingMessage(send.message, send.channel))
 		}
+		if send.sent != nil {
+			send.sent <- ts
+		}
 		timeSinceBurst := msgTime.Sub(burstTime)
 		if msgTime.Sub(mtimes[windowStartMsg]) < burstWindow || timeSinceBurst < coolDown {
 			if timeSinceBurst > coolDown {
@@ -140,6 +162,52 @@ func (s *slackConnector) sendMessages(msgs []string, chanID string, f robot.Mess
 	}
 }
 
+// sendThreadMessages sends messages to a thread, starting a new thread with
+// the first message if thread is "", and returns the thread timestamp.
+func (s *slackConnector) sendThreadMessages(msgs []string, chanID, thread string, f robot.MessageFormat) string {
+	for _, msg := range msgs {
+		if len(thread) == 0 {
+			sent := make(chan string, 1)
+			messages <- &sendMessage{
+				message: msg,
+				channel: chanID,
+				sent:    sent,
+				format:  f,
+			}
+			thread = <-sent
+			continue
+		}
+		messages <- &sendMessage{
+			message: msg,
+			channel: chanID,
+			thread:  thread,
+			format:  f,
+		}
+	}
+	return thread
+}
+
+// sendEditableMessage sends a message and returns an ID for updating it,
+// "<channel ID>:<timestamp>". Editable messages should be short; only the
+// first part of a long message can be updated.
+func (s *slackConnector) sendEditableMessage(msgs []string, chanID string, f robot.MessageFormat) (string, robot.RetVal) {
+	sent := make(chan string, 1)
+	messages <- &sendMessage{
+		message: msgs[0],
+		channel: chanID,
+		sent:    sent,
+		format:  f,
+	}
+	ts := <-sent
+	if len(msgs) > 1 {
+		s.sendMessages(msgs[1:], chanID, f)
+	}
+	if len(ts) == 0 {
+		return "", robot.FailedMessageSend
+	}
+	return chanID + ":" + ts, robot.Ok
+}
+
 // SetUserMap takes a map of username to userID mappings, built from the UserRoster
 // of robot.yaml
 func (s *slackConnector) SetUserMap(umap map[string]string) {
@@ -189,8 +257,93 @@ func (s *slackConnector) SendProtocolUserChannelMessage(uid, u, ch, msg string,
 	return
 }
 
+// SendProtocolChannelThreadMessage sends a message to a thread in a channel
+func (s *slackConnector) SendProtocolChannelThreadMessage(ch, thr, msg string, f robot.MessageFormat) (thread string, ret robot.RetVal) {
+	var chanID string
+	var ok bool
+	if chanID, ok = s.ExtractID(ch); !ok {
+		chanID, ok = s.chanID(ch)
+	}
+	if !ok {
+		s.Log(robot.Error, "slack channel ID not found for: %s", ch)
+		return thr, robot.ChannelNotFound
+	}
+	msgs := s.slackifyMessage("", msg, f)
+	return s.sendThreadMessages(msgs, chanID, thr, f), robot.Ok
+}
+
+// SendProtocolUserChannelThreadMessage sends a message to a user in a
+// channel thread
+func (s *slackConnector) SendProtocolUserChannelThreadMessage(uid, u, ch, thr, msg string, f robot.MessageFormat) (thread string, ret robot.RetVal) {
+	var userID, chanID string
+	var ok bool
+	if chanID, ok = s.ExtractID(ch); !ok {
+		chanID, ok = s.chanID(ch)
+	}
+	if !ok {
+		s.Log(robot.Error, "slack channel ID not found for: %s", ch)
+		return thr, robot.ChannelNotFound
+	}
+	if userID, ok = s.ExtractID(uid); !ok {
+		userID, ok = s.userID(u)
+	}
+	if !ok {
+		s.Log(robot.Error, "slack user ID not found for: %s", uid)
+		return thr, robot.UserNotFound
+	}
+	// This gets converted to <@userID> in slackifyMessage
+	prefix := "<@" + userID + ">: "
+	msgs := s.slackifyMessage(prefix, msg, f)
+	return s.sendThreadMessages(msgs, chanID, thr, f), robot.Ok
+}
+
+// AddReaction adds a reaction to a message
+func (s *slackConnector) AddReaction(ch, msgID, reaction string) (ret robot.RetVal) {
+	return s.reaction(ch, msgID, reaction, true)
+}
+
+// RemoveReaction removes a reaction from a message
+func (s *slackConnector) RemoveReaction(ch, msgID, reaction string) (ret robot.RetVal) {
+	return s.reaction(ch, msgID, reaction, false)
+}
+
+func (s *slackConnector) reaction(ch, msgID, reaction string, add bool) (ret robot.RetVal) {
+	var chanID string
+	var ok bool
+	if chanID, ok = s.ExtractID(ch); !ok {
+		chanID, ok = s.chanID(ch)
+	}
+	if !ok {
+		s.Log(robot.Error, "slack channel ID not found for: %s", ch)
+		return robot.ChannelNotFound
+	}
+	ref := slack.NewRefToMessage(chanID, msgID)
+	var err error
+	if add {
+		err = s.api.AddReaction(reaction, ref)
+	} else {
+		err = s.api.RemoveReaction(reaction, ref)
+	}
+	if err != nil {
+		s.Log(robot.Error, "slack updating reaction '%s' on message %s: %v", reaction, msgID, err)
+		return robot.FailedMessageSend
+	}
+	return robot.Ok
+}
+
 // SendProtocolUserMessage sends a direct message to a user
 func (s *slackConnector) SendProtocolUserMessage(u string, msg string, f robot.MessageFormat) (ret robot.RetVal) {
+	var userIMchan string
+	if userIMchan, ret = s.userIMChannel(u); ret != robot.Ok {
+		return
+	}
+	msgs := s.slackifyMessage("", msg, f)
+	s.sendMessages(msgs, userIMchan, f)
+	return robot.Ok
+}
+
+// userIMChannel returns the IM channel for a user, opening one if needed
+func (s *slackConnector) userIMChannel(u string) (userIMchan string, ret robot.RetVal) {
 	var userID string
 	var ok bool
 	if userID, ok = s.ExtractID(u); !ok {
@@ -200,7 +353,6 @@ func (s *slackConnector) SendProtocolUserMessage(u string, msg string, f robot.M
 		s.Log(robot.Error, "no slack user ID found for user: %s", u)
 		ret = robot.UserNotFound
 	}
-	var userIMchan string
 	var err error
 	userIMchan, ok = s.userIMID(userID)
 	if !ok {
@@ -211,11 +363,51 @@ func (s *slackConnector) SendProtocolUserMessage(u string, msg string, f robot.M
 			ret = robot.FailedMessageSend
 		}
 	}
+	return
+}
+
+// SendProtocolChannelEditableMessage sends a message to a channel that can
+// be updated with UpdateProtocolMessage
+func (s *slackConnector) SendProtocolChannelEditableMessage(ch, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	var chanID string
+	var ok bool
+	if chanID, ok = s.ExtractID(ch); !ok {
+		chanID, ok = s.chanID(ch)
+	}
+	if !ok {
+		s.Log(robot.Error, "slack channel ID not found for: %s", ch)
+		return "", robot.ChannelNotFound
+	}
+	msgs := s.slackifyMessage("", msg, f)
+	return s.sendEditableMessage(msgs, chanID, f)
+}
+
+// SendProtocolUserEditableMessage sends a direct message to a user that can
+// be updated with UpdateProtocolMessage
+func (s *slackConnector) SendProtocolUserEditableMessage(u, msg string, f robot.MessageFormat) (string, robot.RetVal) {
+	userIMchan, ret := s.userIMChannel(u)
 	if ret != robot.Ok {
-		return
+		return "", ret
 	}
 	msgs := s.slackifyMessage("", msg, f)
-	s.sendMessages(msgs, userIMchan, f)
+	return s.sendEditableMessage(msgs, userIMchan, f)
+}
+
+// UpdateProtocolMessage updates the text of a message sent with one of the
+// editable send methods
+func (s *slackConnector) UpdateProtocolMessage(msgID, msg string, f robot.MessageFormat) robot.RetVal {
+	parts := strings.SplitN(msgID, ":", 2)
+	if len(parts) != 2 {
+		s.Log(robot.Error, "invalid slack message ID for update: %s", msgID)
+		return robot.FailedMessageSend
+	}
+	msgs := s.slackifyMessage("", msg, f)
+	messages <- &sendMessage{
+		message: msgs[0],
+		channel: parts[0],
+		update:  parts[1],
+		format:  f,
+	}
 	return robot.Ok
 }
 
@@ -0,0 +1,80 @@
+package slack
+
+import (
+	"io"
+
+	"github.com/lnxjedi/gopherbot/robot"
+	"github.com/slack-go/slack"
+)
+
+// getFiles returns FileInfo for files attached to a slack message
+func getFiles(message slack.Msg) []robot.FileInfo {
+	if len(message.Files) == 0 {
+		return nil
+	}
+	files := make([]robot.FileInfo, 0, len(message.Files))
+	for _, f := range message.Files {
+		files = append(files, robot.FileInfo{
+			ID:       f.ID,
+			Name:     f.Name,
+			Title:    f.Title,
+			MimeType: f.Mimetype,
+			Size:     int64(f.Size),
+		})
+	}
+	return files
+}
+
+// SendProtocolChannelFile uploads a file to a channel
+func (s *slackConnector) SendProtocolChannelFile(ch, filename, title string, data io.Reader) robot.RetVal {
+	var chanID string
+	var ok bool
+	if chanID, ok = s.ExtractID(ch); !ok {
+		chanID, ok = s.chanID(ch)
+	}
+	if !ok {
+		s.Log(robot.Error, "slack channel ID not found for: %s", ch)
+		return robot.ChannelNotFound
+	}
+	return s.uploadFile(chanID, filename, title, data)
+}
+
+// SendProtocolUserFile uploads a file to a user's IM channel
+func (s *slackConnector) SendProtocolUserFile(u, filename, title string, data io.Reader) robot.RetVal {
+	userIMchan, ret := s.userIMChannel(u)
+	if ret != robot.Ok {
+		return ret
+	}
+	return s.uploadFile(userIMchan, filename, title, data)
+}
+
+// uploadFile uploads directly rather than through the send loop; files
+// are rate-limited separately by slack.
+func (s *slackConnector) uploadFile(chanID, filename, title string, data io.Reader) robot.RetVal {
+	params := slack.FileUploadParameters{
+		Reader:   data,
+		Filename: filename,
+		Title:    title,
+		Channels: []string{chanID},
+	}
+	if _, err := s.api.UploadFile(params); err != nil {
+		s.Log(robot.Error, "slack uploading file '%s' to channel '%s': %v", filename, chanID, err)
+		return robot.FailedMessageSend
+	}
+	return robot.Ok
+}
+
+// GetProtocolFile downloads a file attached to a message, given the slack
+// file ID
+func (s *slackConnector) GetProtocolFile(fileID string, data io.Writer) robot.RetVal {
+	f, _, _, err := s.api.GetFileInfo(fileID, 0, 0)
+	if err != nil {
+		s.Log(robot.Error, "slack getting info for file '%s': %v", fileID, err)
+		return robot.FailedMessageSend
+	}
+	if err := s.api.GetFile(f.URLPrivateDownload, data); err != nil {
+		s.Log(robot.Error, "slack downloading file '%s': %v", fileID, err)
+		return robot.FailedMessageSend
+	}
+	return robot.Ok
+}
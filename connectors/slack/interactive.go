@@ -0,0 +1,209 @@
+package slack
+
+/* interactive.go - support for prompting with Block Kit buttons. Slack sends
+button clicks to the app's interactivity Request URL, so the connector only
+offers choices when InteractionListen and SigningSecret are configured; the
+listener needs to be reachable from Slack, normally behind a reverse proxy.
+*/
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
+	"github.com/slack-go/slack"
+)
+
+// prefix for action IDs of choice buttons
+const choiceActionPrefix = "gopherbot-choice-"
+
+// slack limits on the length of button text, and the number of elements in
+// an actions block
+const maxButtonText = 75
+const maxBlockElements = 25
+
+// timeouts for the interaction listener, which has to be reachable from
+// Slack; clicks are small posts that get an immediate reply.
+const (
+	interactionReadHeaderTimeout = 10 * time.Second
+	interactionReadTimeout       = 15 * time.Second
+	interactionWriteTimeout      = 15 * time.Second
+	interactionIdleTimeout       = 2 * time.Minute
+)
+
+// slackChoiceConnector is the slack connector with robot.ChoiceConnector
+// methods, used when the interaction listener is configured.
+type slackChoiceConnector struct {
+	*slackConnector
+}
+
+// startInteractionListener starts the http listener for interactive
+// callbacks.
+func (s *slackConnector) startInteractionListener(listen, secret string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(rw http.ResponseWriter, req *http.Request) {
+		s.handleInteraction(rw, req, secret)
+	})
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: interactionReadHeaderTimeout,
+		ReadTimeout:       interactionReadTimeout,
+		WriteTimeout:      interactionWriteTimeout,
+		IdleTimeout:       interactionIdleTimeout,
+	}
+	go func() {
+		err := srv.ListenAndServe()
+		s.Log(robot.Error, "slack interaction listener on '%s' exited: %v", listen, err)
+	}()
+	s.Log(robot.Info, "slack listening for interactions on: %s", listen)
+}
+
+// handleInteraction verifies an interactive callback from slack, and sends
+// clicked choices to the robot as messages from the user.
+func (s *slackConnector) handleInteraction(rw http.ResponseWriter, req *http.Request, secret string) {
+	if req.Method != http.MethodPost {
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, 1<<20))
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	sv, err := slack.NewSecretsVerifier(req.Header, secret)
+	if err == nil {
+		sv.Write(body)
+		err = sv.Ensure()
+	}
+	if err != nil {
+		s.Log(robot.Warn, "slack interaction failed verification from %s: %v", req.RemoteAddr, err)
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var cb slack.InteractionCallback
+	if err := json.Unmarshal([]byte(values.Get("payload")), &cb); err != nil {
+		s.Log(robot.Error, "slack unmarshalling interaction payload: %v", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// Slack expects a reply within 3 seconds
+	rw.WriteHeader(http.StatusOK)
+	if cb.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+	for _, action := range cb.ActionCallback.BlockActions {
+		if strings.HasPrefix(action.ActionID, choiceActionPrefix) {
+			go s.processChoice(cb.User.ID, cb.Channel.ID, action.Value)
+		}
+	}
+}
+
+// processChoice sends a clicked choice to the robot, as if the user had
+// typed it.
+func (s *slackConnector) processChoice(userID, chanID, choice string) {
+	ci, ok := s.getChannelInfo(chanID)
+	if !ok {
+		s.Log(robot.Error, "Couldn't find channel info for channel ID %s", chanID)
+		return
+	}
+	botMsg := &robot.ConnectorMessage{
+		Protocol:      "slack",
+		UserID:        userID,
+		ChannelID:     chanID,
+		DirectMessage: ci.IsIM,
+		MessageText:   choice,
+		Client:        s.api,
+	}
+	if userName, ok := s.userName(userID); ok {
+		botMsg.UserName = userName
+	}
+	if !ci.IsIM {
+		botMsg.ChannelName = ci.Name
+	}
+	s.IncomingMessage(botMsg)
+}
+
+// choiceBlocks returns a section with the prompt, followed by actions
+// blocks with a button for each choice.
+func choiceBlocks(prompt string, choices []string) []slack.Block {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", prompt, false, false), nil, nil),
+	}
+	var elements []slack.BlockElement
+	for i, choice := range choices {
+		label := choice
+		if len(label) > maxButtonText {
+			label = robot.TruncateString(label, maxButtonText-3) + "..."
+		}
+		text := slack.NewTextBlockObject("plain_text", label, false, false)
+		elements = append(elements, slack.NewButtonBlockElement(choiceActionPrefix+strconv.Itoa(i+1), choice, text))
+		if len(elements) == maxBlockElements || i == len(choices)-1 {
+			blocks = append(blocks, slack.NewActionBlock("", elements...))
+			elements = nil
+		}
+	}
+	return blocks
+}
+
+// choiceText is the plain text version of a choice prompt, used for
+// notifications and clients that can't show blocks.
+func choiceText(prompt string, choices []string) string {
+	return prompt + " (" + strings.Join(choices, " | ") + ")"
+}
+
+// SendProtocolUserChannelChoiceMessage directs a prompt with choice buttons
+// to a user in a channel
+func (s *slackChoiceConnector) SendProtocolUserChannelChoiceMessage(uid, u, ch, msg string, choices []string, f robot.MessageFormat) (ret robot.RetVal) {
+	var userID, chanID string
+	var ok bool
+	if chanID, ok = s.ExtractID(ch); !ok {
+		chanID, ok = s.chanID(ch)
+	}
+	if !ok {
+		s.Log(robot.Error, "slack channel ID not found for: %s", ch)
+		return robot.ChannelNotFound
+	}
+	if userID, ok = s.ExtractID(uid); !ok {
+		userID, ok = s.userID(u)
+	}
+	if !ok {
+		s.Log(robot.Error, "slack user ID not found for: %s", uid)
+		return robot.UserNotFound
+	}
+	// This gets converted to <@userID> in slackifyMessage
+	prefix := "<@" + userID + ">: "
+	s.sendChoices(s.slackifyMessage(prefix, msg, f)[0], chanID, choices, f)
+	return robot.Ok
+}
+
+// SendProtocolUserChoiceMessage sends a prompt with choice buttons to a user
+// as a direct message
+func (s *slackChoiceConnector) SendProtocolUserChoiceMessage(u, msg string, choices []string, f robot.MessageFormat) (ret robot.RetVal) {
+	var userIMchan string
+	if userIMchan, ret = s.userIMChannel(u); ret != robot.Ok {
+		return
+	}
+	s.sendChoices(s.slackifyMessage("", msg, f)[0], userIMchan, choices, f)
+	return robot.Ok
+}
+
+func (s *slackConnector) sendChoices(prompt, chanID string, choices []string, f robot.MessageFormat) {
+	messages <- &sendMessage{
+		message: choiceText(prompt, choices),
+		channel: chanID,
+		blocks:  choiceBlocks(prompt, choices),
+		format:  f,
+	}
+}
@@ -0,0 +1,33 @@
+package slack
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/slack-go/slack"
+)
+
+func TestChoiceButtonLabels(t *testing.T) {
+	// a multi-byte character straddles the cut
+	long := strings.Repeat("a", maxButtonText-4) + "é" + "tail"
+	blocks := choiceBlocks("Which one?", []string{"short", long})
+	if len(blocks) != 2 {
+		t.Fatalf("want a section and an actions block, got %d blocks", len(blocks))
+	}
+	actions, ok := blocks[1].(*slack.ActionBlock)
+	if !ok {
+		t.Fatalf("second block isn't an actions block: %T", blocks[1])
+	}
+	want := []string{"short", strings.Repeat("a", maxButtonText-4) + "..."}
+	for i, e := range actions.Elements.ElementSet {
+		button := e.(*slack.ButtonBlockElement)
+		label := button.Text.Text
+		if !utf8.ValidString(label) {
+			t.Errorf("button %d label split a multi-byte character: %q", i, label)
+		}
+		if label != want[i] {
+			t.Errorf("button %d label: want %q, got %q", i, want[i], label)
+		}
+	}
+}
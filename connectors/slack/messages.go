@@ -10,7 +10,7 @@ import (
 	"sync"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 	"github.com/slack-go/slack"
 )
 
@@ -207,6 +207,9 @@ func (s *slackConnector) processMessage(msg *slack.MessageEvent) {
 		ChannelID:     chanID,
 		DirectMessage: ci.IsIM,
 		MessageText:   text,
+		ThreadID:      message.ThreadTimestamp,
+		MessageID:     message.Timestamp,
+		Files:         getFiles(message),
 		MessageObject: msg,
 		Client:        s.api,
 	}
@@ -221,3 +224,39 @@ func (s *slackConnector) processMessage(msg *slack.MessageEvent) {
 	}
 	s.IncomingMessage(botMsg)
 }
+
+// processReaction sends reactions to messages to the robot, for matching
+// against job triggers.
+func (s *slackConnector) processReaction(ev *slack.ReactionAddedEvent) {
+	s.Log(robot.Trace, "Reaction received: %v", ev)
+	if ev.Item.Type != "message" {
+		return
+	}
+	if ev.User == s.botID {
+		s.Log(robot.Debug, "Ignoring reaction from self")
+		return
+	}
+	chanID := ev.Item.Channel
+	ci, ok := s.getChannelInfo(chanID)
+	if !ok {
+		s.Log(robot.Error, "Couldn't find channel info for channel ID %s", chanID)
+		return
+	}
+	botMsg := &robot.ConnectorMessage{
+		Protocol:      "slack",
+		UserID:        ev.User,
+		ChannelID:     chanID,
+		DirectMessage: ci.IsIM,
+		MessageID:     ev.Item.Timestamp,
+		Reaction:      ev.Reaction,
+		MessageObject: ev,
+		Client:        s.api,
+	}
+	if userName, ok := s.userName(ev.User); ok {
+		botMsg.UserName = userName
+	}
+	if !ci.IsIM {
+		botMsg.ChannelName = ci.Name
+	}
+	s.IncomingMessage(botMsg)
+}
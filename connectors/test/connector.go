@@ -3,12 +3,13 @@
 package test
 
 import (
+	"fmt"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // TestMessage is for sending messages to the robot
@@ -16,18 +17,42 @@ type TestMessage struct {
 	User, Channel, Message string
 }
 
+// TestReaction is for sending reactions to the robot; when MessageID is
+// "", the reaction is to the last message sent in the channel.
+type TestReaction struct {
+	User, Channel, Reaction, MessageID string
+}
+
+// TestFile is a file uploaded by the robot, or attached to a message sent
+// with SendBotFileMessage
+type TestFile struct {
+	User, Channel, Filename, Title string
+	Data                           []byte
+}
+
 // TestConnector holds all the relevant data about a connection
 type TestConnector struct {
-	botName       string            // human-readable name of bot
-	botFullName   string            // human-readble full name of the bot
-	botID         string            // slack internal bot ID
-	users         []testUser        // configured users
-	channels      []string          // the channels the robot is in
-	listener      chan *TestMessage // input channel for test functions to send messages from a user
-	speaking      chan *TestMessage // output channel for test functions to get messages from the bot
-	test          *testing.T        // for the connector to log
-	robot.Handler                   // bot API for connectors
-	sync.RWMutex                    // shared mutex for locking connector data structures
+	botName       string             // human-readable name of bot
+	botFullName   string             // human-readble full name of the bot
+	botID         string             // slack internal bot ID
+	users         []testUser         // configured users
+	channels      []string           // the channels the robot is in
+	listener      chan *TestMessage  // input channel for test functions to send messages from a user
+	reactions     chan *TestReaction // input channel for test functions to send reactions from a user
+	lastMsgID     map[string]string  // last message ID sent in each channel
+	msgUser       map[string]string  // user that sent each message, for reactions in DMs
+	msgCount      int                // for generating message IDs
+	speaking      chan *TestMessage  // output channel for test functions to get messages from the bot
+	test          *testing.T         // for the connector to log
+	robot.Handler                    // bot API for connectors
+	sync.RWMutex                     // shared mutex for locking connector data structures
+
+	// Files uploaded by the robot, and files attached to test messages
+	uploads     chan *TestFile                    // output channel for test functions to get files from the bot
+	files       map[string]*TestFile              // attached files by ID, for GetProtocolFile
+	attachments map[*TestMessage][]robot.FileInfo // files attached to messages not yet sent to the robot
+
+	threads map[*TestMessage]string // thread IDs for messages not yet sent to the robot
 }
 
 // Run starts the main loop for the test connector
@@ -52,6 +77,16 @@ loop:
 			} else {
 				direct = true
 			}
+			tc.Lock()
+			tc.msgCount++
+			msgID := fmt.Sprintf("m%04d", tc.msgCount)
+			tc.lastMsgID[msg.Channel] = msgID
+			tc.msgUser[msgID] = userName
+			files := tc.attachments[msg]
+			delete(tc.attachments, msg)
+			thread := tc.threads[msg]
+			delete(tc.threads, msg)
+			tc.Unlock()
 			botMsg := &robot.ConnectorMessage{
 				Protocol:      "test",
 				UserName:      userName,
@@ -60,12 +95,73 @@ loop:
 				ChannelID:     channelID,
 				DirectMessage: direct,
 				MessageText:   msg.Message,
+				MessageID:     msgID,
+				ThreadID:      thread,
+				Files:         files,
 				MessageObject: msg,
 				Client:        tc,
 			}
 			tc.IncomingMessage(botMsg)
+		case r := <-tc.reactions:
+			var userName, channelID string
+			i, exists := userIDMap[r.User]
+			if exists {
+				userName = tc.users[i].Name
+			}
+			if len(r.Channel) > 0 {
+				channelID = "#" + r.Channel
+			}
+			msgID := r.MessageID
+			if len(msgID) == 0 {
+				tc.RLock()
+				msgID = tc.lastMsgID[r.Channel]
+				tc.RUnlock()
+			}
+			botMsg := &robot.ConnectorMessage{
+				Protocol:      "test",
+				UserName:      userName,
+				UserID:        r.User,
+				ChannelName:   r.Channel,
+				ChannelID:     channelID,
+				DirectMessage: len(r.Channel) == 0,
+				MessageID:     msgID,
+				Reaction:      r.Reaction,
+				MessageObject: r,
+				Client:        tc,
+			}
+			tc.IncomingMessage(botMsg)
+		}
+	}
+}
+
+// sendFile checks the channel or user, and sends an uploaded file to the
+// uploads channel
+func (tc *TestConnector) sendFile(file *TestFile) (ret robot.RetVal) {
+	if file.Channel == "" && file.User == "" {
+		tc.test.Errorf("Invalid empty user and channel for file upload")
+		return robot.ChannelNotFound
+	}
+	if file.Channel != "" {
+		found := false
+		tc.RLock()
+		for _, channel := range tc.channels {
+			if channel == file.Channel {
+				found = true
+				break
+			}
+		}
+		tc.RUnlock()
+		if !found {
+			tc.test.Errorf("Channel not found for file upload: %s", file.Channel)
+			return robot.ChannelNotFound
 		}
 	}
+	select {
+	case tc.uploads <- file:
+	case <-time.After(200 * time.Millisecond):
+		return robot.TimeoutExpired
+	}
+	return robot.Ok
 }
 
 // Public 'bot methods all call sendMessage to send a message to a user/channel
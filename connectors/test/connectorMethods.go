@@ -1,9 +1,12 @@
 package test
 
 import (
+	"fmt"
+	"io"
+	"io/ioutil"
 	"strings"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // BotMessage is for receiving messages from the robot
@@ -111,6 +114,193 @@ func (tc *TestConnector) SendProtocolUserMessage(u string, mesg string, f robot.
 	return tc.sendMessage(msg)
 }
 
+// SendProtocolChannelEditableMessage sends a message to a channel,
+// returning an ID for updates
+func (tc *TestConnector) SendProtocolChannelEditableMessage(ch, mesg string, f robot.MessageFormat) (string, robot.RetVal) {
+	channel := tc.getChannel(ch)
+	msg := &BotMessage{
+		User:    "",
+		Channel: channel,
+		Message: mesg,
+		Format:  f,
+	}
+	return tc.sendEditableMessage(msg)
+}
+
+// SendProtocolUserEditableMessage sends a direct message to a user,
+// returning an ID for updates
+func (tc *TestConnector) SendProtocolUserEditableMessage(u, mesg string, f robot.MessageFormat) (string, robot.RetVal) {
+	var user *testUser
+	var exists bool
+	if user, exists = tc.getUserInfo(u); !exists {
+		return "", robot.UserNotFound
+	}
+	msg := &BotMessage{
+		User:    user.Name,
+		Channel: "",
+		Message: mesg,
+		Format:  f,
+	}
+	return tc.sendEditableMessage(msg)
+}
+
+// sendEditableMessage sends a message, returning an ID of the form
+// "e<number>:<channel>:<user>"
+func (tc *TestConnector) sendEditableMessage(msg *BotMessage) (string, robot.RetVal) {
+	if ret := tc.sendMessage(msg); ret != robot.Ok {
+		return "", ret
+	}
+	tc.Lock()
+	tc.msgCount++
+	id := fmt.Sprintf("e%04d:%s:%s", tc.msgCount, msg.Channel, msg.User)
+	tc.Unlock()
+	return id, robot.Ok
+}
+
+// UpdateProtocolMessage sends the updated message as a new message,
+// prefixed with "(updated <id>) ", e.g. "(updated e0002) "
+func (tc *TestConnector) UpdateProtocolMessage(msgID, mesg string, f robot.MessageFormat) (ret robot.RetVal) {
+	parts := strings.Split(msgID, ":")
+	if len(parts) != 3 {
+		tc.test.Errorf("Invalid message ID for update: %s", msgID)
+		return robot.FailedMessageSend
+	}
+	msg := &BotMessage{
+		User:    parts[2],
+		Channel: parts[1],
+		Message: "(updated " + parts[0] + ") " + mesg,
+		Format:  f,
+	}
+	return tc.sendMessage(msg)
+}
+
+// SendProtocolChannelThreadMessage sends a message to a thread in a
+// channel, prefixed with "(thread <id>) "; when thread is "", the message
+// starts a new thread with an ID of the form "t<number>".
+func (tc *TestConnector) SendProtocolChannelThreadMessage(ch, thread, mesg string, f robot.MessageFormat) (string, robot.RetVal) {
+	channel := tc.getChannel(ch)
+	msg := &BotMessage{
+		User:    "",
+		Channel: channel,
+		Message: mesg,
+		Format:  f,
+	}
+	return tc.sendThreadMessage(thread, msg)
+}
+
+// SendProtocolUserChannelThreadMessage sends a message to a user in a
+// channel thread
+func (tc *TestConnector) SendProtocolUserChannelThreadMessage(uid, uname, ch, thread, mesg string, f robot.MessageFormat) (string, robot.RetVal) {
+	channel := tc.getChannel(ch)
+	msg := &BotMessage{
+		User:    uname,
+		Channel: channel,
+		Message: mesg,
+		Format:  f,
+	}
+	return tc.sendThreadMessage(thread, msg)
+}
+
+func (tc *TestConnector) sendThreadMessage(thread string, msg *BotMessage) (string, robot.RetVal) {
+	if len(thread) == 0 {
+		tc.Lock()
+		tc.msgCount++
+		thread = fmt.Sprintf("t%04d", tc.msgCount)
+		tc.Unlock()
+	}
+	msg.Message = "(thread " + thread + ") " + msg.Message
+	if ret := tc.sendMessage(msg); ret != robot.Ok {
+		return "", ret
+	}
+	return thread, robot.Ok
+}
+
+// SendProtocolUserChannelChoiceMessage sends a prompt with the choices
+// appended in brackets, e.g. "Which one? [red|green|blue]"
+func (tc *TestConnector) SendProtocolUserChannelChoiceMessage(uid, uname, ch, mesg string, choices []string, f robot.MessageFormat) (ret robot.RetVal) {
+	return tc.SendProtocolUserChannelMessage(uid, uname, ch, mesg+" ["+strings.Join(choices, "|")+"]", f)
+}
+
+// SendProtocolUserChoiceMessage sends a direct message prompt with the
+// choices appended in brackets
+func (tc *TestConnector) SendProtocolUserChoiceMessage(u, mesg string, choices []string, f robot.MessageFormat) (ret robot.RetVal) {
+	return tc.SendProtocolUserMessage(u, mesg+" ["+strings.Join(choices, "|")+"]", f)
+}
+
+// AddReaction sends the robot's reaction as a message, e.g. "+:thumbsup:"
+func (tc *TestConnector) AddReaction(ch, msgID, reaction string) (ret robot.RetVal) {
+	return tc.sendReaction(ch, msgID, "+:"+reaction+":")
+}
+
+// RemoveReaction sends the robot's removed reaction as a message, e.g.
+// "-:thumbsup:"
+func (tc *TestConnector) RemoveReaction(ch, msgID, reaction string) (ret robot.RetVal) {
+	return tc.sendReaction(ch, msgID, "-:"+reaction+":")
+}
+
+func (tc *TestConnector) sendReaction(ch, msgID, reaction string) (ret robot.RetVal) {
+	channel := tc.getChannel(ch)
+	var user string
+	if len(channel) == 0 {
+		tc.RLock()
+		user = tc.msgUser[msgID]
+		tc.RUnlock()
+	}
+	msg := &BotMessage{
+		User:    user,
+		Channel: channel,
+		Message: reaction,
+		Format:  robot.Raw,
+	}
+	return tc.sendMessage(msg)
+}
+
+// SendProtocolChannelFile uploads a file to a channel
+func (tc *TestConnector) SendProtocolChannelFile(ch, filename, title string, data io.Reader) (ret robot.RetVal) {
+	return tc.uploadFile("", tc.getChannel(ch), filename, title, data)
+}
+
+// SendProtocolUserFile uploads a file to a user
+func (tc *TestConnector) SendProtocolUserFile(u, filename, title string, data io.Reader) (ret robot.RetVal) {
+	var user *testUser
+	var exists bool
+	if user, exists = tc.getUserInfo(u); !exists {
+		return robot.UserNotFound
+	}
+	return tc.uploadFile(user.Name, "", filename, title, data)
+}
+
+func (tc *TestConnector) uploadFile(user, channel, filename, title string, data io.Reader) (ret robot.RetVal) {
+	contents, err := ioutil.ReadAll(data)
+	if err != nil {
+		tc.test.Errorf("Reading uploaded file '%s': %v", filename, err)
+		return robot.FailedMessageSend
+	}
+	file := &TestFile{
+		User:     user,
+		Channel:  channel,
+		Filename: filename,
+		Title:    title,
+		Data:     contents,
+	}
+	return tc.sendFile(file)
+}
+
+// GetProtocolFile writes the contents of a file attached with
+// SendBotFileMessage
+func (tc *TestConnector) GetProtocolFile(fileID string, data io.Writer) (ret robot.RetVal) {
+	tc.RLock()
+	file, ok := tc.files[fileID]
+	tc.RUnlock()
+	if !ok {
+		return robot.FailedMessageSend
+	}
+	if _, err := data.Write(file.Data); err != nil {
+		return robot.FailedMessageSend
+	}
+	return robot.Ok
+}
+
 // JoinChannel joins a channel given it's human-readable name, e.g. "general"
 // Only useful for connectors that require it, a noop otherwise
 func (tc *TestConnector) JoinChannel(c string) (ret robot.RetVal) {
@@ -6,7 +6,7 @@ import (
 	"testing"
 
 	"github.com/lnxjedi/gopherbot/bot"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // Global persistent map of user name to user index
@@ -61,8 +61,15 @@ func Initialize(handler robot.Handler, l *log.Logger) robot.Connector {
 		users:       c.Users,
 		channels:    c.Channels,
 		listener:    make(chan *TestMessage),
+		reactions:   make(chan *TestReaction),
+		lastMsgID:   make(map[string]string),
+		msgUser:     make(map[string]string),
 		speaking:    make(chan *TestMessage),
 		test:        t,
+		uploads:     make(chan *TestFile),
+		files:       make(map[string]*TestFile),
+		attachments: make(map[*TestMessage][]robot.FileInfo),
+		threads:     make(map[*TestMessage]string),
 	}
 
 	tc.Handler = handler
@@ -2,7 +2,10 @@ package test
 
 import (
 	"errors"
+	"fmt"
 	"time"
+
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 /* testMethods.go - methods specific to the test connector */
@@ -44,6 +47,44 @@ func (tc *TestConnector) SendBotMessage(msg *TestMessage) {
 	}
 }
 
+// SendBotFileMessage sends a message to the 'bot with attached files; only
+// the Filename, Title and Data of each file are used.
+func (tc *TestConnector) SendBotFileMessage(msg *TestMessage, files ...*TestFile) {
+	info := make([]robot.FileInfo, 0, len(files))
+	tc.Lock()
+	for _, f := range files {
+		id := fmt.Sprintf("f%04d", len(tc.files)+1)
+		tc.files[id] = f
+		info = append(info, robot.FileInfo{
+			ID:    id,
+			Name:  f.Filename,
+			Title: f.Title,
+			Size:  int64(len(f.Data)),
+		})
+	}
+	tc.attachments[msg] = info
+	tc.Unlock()
+	tc.SendBotMessage(msg)
+}
+
+// SendBotThreadMessage sends a message to the 'bot in an existing thread
+func (tc *TestConnector) SendBotThreadMessage(msg *TestMessage, thread string) {
+	tc.Lock()
+	tc.threads[msg] = thread
+	tc.Unlock()
+	tc.SendBotMessage(msg)
+}
+
+// SendBotReaction for tests to send reactions to the 'bot
+func (tc *TestConnector) SendBotReaction(r *TestReaction) {
+	select {
+	case tc.reactions <- r:
+		tc.test.Logf("Reaction sent to robot: %v", r)
+	case <-time.After(200 * time.Millisecond):
+		tc.test.Errorf("Timed out sending; user: \"%s\", channel: \"%s\", reaction: \"%s\"", r.User, r.Channel, r.Reaction)
+	}
+}
+
 // GetBotMessage for tests to get replies
 func (tc *TestConnector) GetBotMessage() (*TestMessage, error) {
 	select {
@@ -58,3 +99,14 @@ func (tc *TestConnector) GetBotMessage() (*TestMessage, error) {
 		return nil, errors.New("Timeout waiting for reply from robot")
 	}
 }
+
+// GetBotFile for tests to get files uploaded by the robot
+func (tc *TestConnector) GetBotFile() (*TestFile, error) {
+	select {
+	case file := <-tc.uploads:
+		tc.test.Logf("File received from robot: u:%s, c:%s, f:%s, %d bytes", file.User, file.Channel, file.Filename, len(file.Data))
+		return file, nil
+	case <-time.After(4 * time.Second):
+		return nil, errors.New("Timeout waiting for file from robot")
+	}
+}
@@ -1,25 +1,38 @@
 module github.com/lnxjedi/gopherbot
 
-go 1.13
+go 1.21
 
 require (
 	github.com/Jeffail/gabs v1.4.0
 	github.com/aws/aws-sdk-go v1.29.18
-	github.com/chzyer/logex v1.1.10 // indirect
-	github.com/chzyer/test v0.0.0-20180213035817-a1ea475d72b1 // indirect
 	github.com/dgryski/dgoogauth v0.0.0-20190221195224-5a805980a5f3
 	github.com/duosecurity/duo_api_golang v0.0.0-20200206192355-a9725220d6ca
 	github.com/emersion/go-textwrapper v0.0.0-20160606182133-d0e65e56babe
 	github.com/ghodss/yaml v1.0.0
+	github.com/gomodule/redigo v1.8.5
 	github.com/gopackage/ddp v0.0.0-20170117053602-652027933df4
 	github.com/joho/godotenv v1.3.0
 	github.com/jordan-wright/email v0.0.0-20200121133829-a0b5c5b58bb6
 	github.com/lnxjedi/readline v0.0.0-20200213173224-cdfc6ee4b159
-	github.com/lnxjedi/robot v0.1.7
-	github.com/onsi/ginkgo v1.12.0 // indirect
-	github.com/onsi/gomega v1.9.0 // indirect
+	github.com/ncruces/go-sqlite3 v0.22.0
 	github.com/robfig/cron v1.2.0
 	github.com/slack-go/slack v0.6.2
 	github.com/stretchr/testify v1.5.1
-	golang.org/x/sys v0.0.0-20200302150141-5c8b2ff67527
+	golang.org/x/sys v0.29.0
+)
+
+require (
+	github.com/chzyer/logex v1.1.10 // indirect
+	github.com/chzyer/test v0.0.0-20180213035817-a1ea475d72b1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/gorilla/websocket v1.2.0 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/ncruces/julianday v1.0.0 // indirect
+	github.com/onsi/ginkgo v1.12.0 // indirect
+	github.com/onsi/gomega v1.9.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/tetratelabs/wazero v1.8.2 // indirect
+	golang.org/x/net v0.25.0 // indirect
+	gopkg.in/yaml.v2 v2.2.4 // indirect
 )
@@ -4,7 +4,7 @@ package main
 
 import (
 	"github.com/lnxjedi/gopherbot/goplugins/duo"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 // GetManifest just wraps the function from the module
@@ -2,7 +2,7 @@
 
 package duo
 
-import "github.com/lnxjedi/robot"
+import "github.com/lnxjedi/gopherbot/robot"
 
 var duospec = robot.PluginSpec{
 	Name:    "duo",
@@ -2,7 +2,7 @@
 
 package knock
 
-import "github.com/lnxjedi/robot"
+import "github.com/lnxjedi/gopherbot/robot"
 
 var knockspec = robot.PluginSpec{
 	Name:    "knock",
@@ -9,7 +9,7 @@ import (
 	"strings"
 
 	"github.com/lnxjedi/gopherbot/bot"
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 const datumName = "listmap"
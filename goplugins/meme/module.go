@@ -2,7 +2,7 @@
 
 package meme
 
-import "github.com/lnxjedi/robot"
+import "github.com/lnxjedi/gopherbot/robot"
 
 var memespec = robot.PluginSpec{
 	Name:    "memes",
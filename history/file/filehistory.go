@@ -3,6 +3,8 @@
 package filehistory
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,10 +12,11 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"regexp"
 	"strings"
 	"sync"
 
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var historyPath string
@@ -44,7 +47,10 @@ var current = struct {
 
 type historyFile struct {
 	l    *log.Logger
+	tl   *log.Logger // for rendered records, which carry their own timestamp
+	rl   *log.Logger // records as JSON, in the .records file
 	f    *os.File
+	rf   *os.File
 	name string
 	idx  int
 	path string
@@ -64,10 +70,26 @@ func (hf *historyFile) Line(line string) {
 	hf.l.SetFlags(logFlags)
 }
 
-// Close sets the logger output to discard and closes the log file
+// Record writes the record as text to the log file, so the log stays
+// readable for anyone following a URLPrefix link, and stores it as a line
+// of JSON in the records file.
+func (hf *historyFile) Record(rec robot.HistoryRecord) {
+	hf.tl.Println(rec.String())
+	b, err := json.Marshal(rec)
+	if err != nil {
+		handler.Log(robot.Error, "Marshalling history record for '%s': %v", hf.name, err)
+		return
+	}
+	hf.rl.Println(string(b))
+}
+
+// Close sets the logger output to discard and closes the log files
 func (hf *historyFile) Close() {
 	hf.l.SetOutput(ioutil.Discard)
+	hf.tl.SetOutput(ioutil.Discard)
+	hf.rl.SetOutput(ioutil.Discard)
 	hf.f.Close()
+	hf.rf.Close()
 }
 
 // Finalize removes the log if needed
@@ -82,6 +104,14 @@ func (hf *historyFile) Finalize() {
 	if rerr := os.Remove(hf.path); rerr != nil {
 		handler.Log(robot.Error, "Removing %s: %v", hf.path, rerr)
 	}
+	if rerr := os.Remove(recordsPath(hf.path)); rerr != nil {
+		handler.Log(robot.Error, "Removing %s: %v", recordsPath(hf.path), rerr)
+	}
+}
+
+// recordsPath returns the path to the records stored alongside a log file
+func recordsPath(logPath string) string {
+	return strings.TrimSuffix(logPath, ".log") + ".records"
 }
 
 var fhc historyConfig
@@ -101,6 +131,11 @@ func (fhc *historyConfig) NewLog(tag string, index, maxHistories int) (robot.His
 	if err != nil {
 		return nil, fmt.Errorf("Error creating history file '%s': %v", filePath, err)
 	}
+	rfile, err := os.Create(recordsPath(filePath))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Error creating history records file '%s': %v", recordsPath(filePath), err)
+	}
 	keep := maxHistories != 0
 	hl := log.New(file, "", logFlags)
 	hr := histref{tag, index}
@@ -109,7 +144,10 @@ func (fhc *historyConfig) NewLog(tag string, index, maxHistories int) (robot.His
 	current.Unlock()
 	hf := &historyFile{
 		hl,
+		log.New(file, "", 0),
+		log.New(rfile, "", 0),
 		file,
+		rfile,
 		tag,
 		index,
 		filePath,
@@ -128,25 +166,102 @@ func (fhc *historyConfig) NewLog(tag string, index, maxHistories int) (robot.His
 				// assume it's pointless to keep trying to delete files
 				break
 			}
+			// logs from before records were stored have no records file
+			os.Remove(recordsPath(rmPath))
 		}
 	}
 	return hf, nil
 }
 
-// GetLog returns an io.Reader
-func (fhc *historyConfig) GetLog(tag string, index int) (io.Reader, error) {
+// logPath returns the path to the log file for tag / index
+func (fhc *historyConfig) logPath(tag string, index int) string {
 	tag = strings.Replace(tag, `\`, ":", -1)
 	tag = strings.Replace(tag, `/`, ":", -1)
 	dirPath := path.Join(fhc.Directory, tag)
-	filePath := path.Join(dirPath, fmt.Sprintf("run-%d.log", index))
-	return os.Open(filePath)
+	return path.Join(dirPath, fmt.Sprintf("run-%d.log", index))
 }
 
-// GetLogURL returns the permanent link to the history
-func (fhc *historyConfig) GetLogURL(tag string, index int) (string, bool) {
-	if len(fhc.URLPrefix) == 0 {
-		return "", false
+// GetLog returns an io.Reader
+func (fhc *historyConfig) GetLog(tag string, index int) (io.Reader, error) {
+	return os.Open(fhc.logPath(tag, index))
+}
+
+// GetRecords returns an io.Reader for the records stored with a log
+func (fhc *historyConfig) GetRecords(tag string, index int) (io.Reader, error) {
+	return os.Open(recordsPath(fhc.logPath(tag, index)))
+}
+
+// SearchLogs scans each log file for lines matching re
+func (fhc *historyConfig) SearchLogs(tag string, indexes []int, re *regexp.Regexp, context, maxMatches int) ([]robot.LogMatch, error) {
+	matches := make([]robot.LogMatch, 0)
+	for _, idx := range indexes {
+		if len(matches) >= maxMatches {
+			break
+		}
+		f, err := os.Open(fhc.logPath(tag, idx))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return matches, err
+		}
+		found, err := searchLog(f, idx, re, context, maxMatches-len(matches))
+		f.Close()
+		matches = append(matches, found...)
+		if err != nil {
+			return matches, fmt.Errorf("searching '%s', run %d: %v", tag, idx, err)
+		}
 	}
+	return matches, nil
+}
+
+// searchLog scans a single log, keeping the last context lines for each
+// match, and filling in the lines after as they're read.
+func searchLog(r io.Reader, idx int, re *regexp.Regexp, context, maxMatches int) ([]robot.LogMatch, error) {
+	matches := make([]robot.LogMatch, 0)
+	before := make([]string, 0, context+1)
+	pending := make([]int, 0) // matches still needing lines after
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		waiting := pending[:0]
+		for _, m := range pending {
+			matches[m].After = append(matches[m].After, text)
+			if len(matches[m].After) < context {
+				waiting = append(waiting, m)
+			}
+		}
+		pending = waiting
+		if len(matches) < maxMatches && re.MatchString(text) {
+			matches = append(matches, robot.LogMatch{
+				Index:  idx,
+				Line:   line,
+				Text:   text,
+				Before: append([]string{}, before...),
+			})
+			if context > 0 {
+				pending = append(pending, len(matches)-1)
+			}
+		}
+		if context > 0 {
+			before = append(before, text)
+			if len(before) > context {
+				before = before[1:]
+			}
+		}
+		if len(matches) >= maxMatches && len(pending) == 0 {
+			break
+		}
+	}
+	return matches, scanner.Err()
+}
+
+// GetLogURL returns the permanent link to the history; without a
+// URLPrefix, the link is to the robot's built-in history web UI, if enabled.
+func (fhc *historyConfig) GetLogURL(tag string, index int) (string, bool) {
 	hr := histref{tag, index}
 	current.Lock()
 	keep, ok := current.running[hr]
@@ -154,6 +269,12 @@ func (fhc *historyConfig) GetLogURL(tag string, index int) (string, bool) {
 	if ok && !keep {
 		return "", false
 	}
+	if len(fhc.URLPrefix) == 0 {
+		if hl, ok := handler.(robot.HistoryLinker); ok {
+			return hl.GetHistoryURL(tag, index)
+		}
+		return "", false
+	}
 	tag = strings.Replace(tag, `\`, ":", -1)
 	tag = strings.Replace(tag, `/`, ":", -1)
 	prefix := strings.TrimRight(fhc.URLPrefix, "/")
@@ -0,0 +1,68 @@
+package filehistory
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/lnxjedi/gopherbot/robot"
+)
+
+func TestSearchLog(t *testing.T) {
+	cases := []struct {
+		name       string
+		log        []string
+		context    int
+		maxMatches int
+		want       []robot.LogMatch
+	}{
+		{"first line", []string{"error a", "ok b", "ok c", "ok d"}, 2, 10, []robot.LogMatch{
+			{Line: 1, Text: "error a", After: []string{"ok b", "ok c"}},
+		}},
+		{"last line", []string{"ok a", "ok b", "ok c", "error d"}, 2, 10, []robot.LogMatch{
+			{Line: 4, Text: "error d", Before: []string{"ok b", "ok c"}},
+		}},
+		{"short after", []string{"ok a", "error b", "ok c"}, 2, 10, []robot.LogMatch{
+			{Line: 2, Text: "error b", Before: []string{"ok a"}, After: []string{"ok c"}},
+		}},
+		{"overlapping", []string{"ok a", "error b", "error c", "ok d"}, 1, 10, []robot.LogMatch{
+			{Line: 2, Text: "error b", Before: []string{"ok a"}, After: []string{"error c"}},
+			{Line: 3, Text: "error c", Before: []string{"error b"}, After: []string{"ok d"}},
+		}},
+		{"no context", []string{"error a", "ok b", "error c"}, 0, 10, []robot.LogMatch{
+			{Line: 1, Text: "error a"},
+			{Line: 3, Text: "error c"},
+		}},
+		{"max matches", []string{"error a", "error b", "error c"}, 0, 2, []robot.LogMatch{
+			{Line: 1, Text: "error a"},
+			{Line: 2, Text: "error b"},
+		}},
+		{"max matches keeps after", []string{"error a", "error b", "ok c", "ok d"}, 2, 1, []robot.LogMatch{
+			{Line: 1, Text: "error a", After: []string{"error b", "ok c"}},
+		}},
+		{"max matches zero", []string{"error a"}, 1, 0, nil},
+		{"no match", []string{"ok a", "ok b"}, 1, 10, nil},
+	}
+	re := regexp.MustCompile("error")
+	for _, c := range cases {
+		got, err := searchLog(strings.NewReader(strings.Join(c.log, "\n")+"\n"), 3, re, c.context, c.maxMatches)
+		if err != nil {
+			t.Errorf("%s: searchLog returned error: %v", c.name, err)
+			continue
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s: want %d matches, got %d: %+v", c.name, len(c.want), len(got), got)
+			continue
+		}
+		for i, m := range got {
+			w := c.want[i]
+			w.Index = 3
+			if m.Index != w.Index || m.Line != w.Line || m.Text != w.Text ||
+				fmt.Sprintf("%q", m.Before) != fmt.Sprintf("%q", w.Before) ||
+				fmt.Sprintf("%q", m.After) != fmt.Sprintf("%q", w.After) {
+				t.Errorf("%s: match %d: want %+v, got %+v", c.name, i, w, m)
+			}
+		}
+	}
+}
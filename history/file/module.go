@@ -3,7 +3,7 @@
 package filehistory
 
 import (
-	"github.com/lnxjedi/robot"
+	"github.com/lnxjedi/gopherbot/robot"
 )
 
 var fhspec = robot.HistorySpec{
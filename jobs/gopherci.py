@@ -9,16 +9,11 @@
 # name and branch (two arguments).
 # - If the repository is listed in "repositories.yaml" with
 #   type != none, a build task is added.
-# - The the repository is listed as a dependency for another repository whose
-#   type != none, another gopherci task is added with a third argument of "true"
-# When the gopherci job runs with three arguments, each dependendent build
-# is spawned.
-#
-# The result is if the initial build succeeds, all dependent builds will run
-# in parallel with no further interdependencies.
-#
-# NOTE: current gopherci does not cascade dependent builds; if a dependency
-# build is itself a de
+# - If other repositories depend on the repository, the build-dependents
+#   task is added, which builds everything that depends on it - directly or
+#   transitively - in dependency order. Builds that don't depend on each
+#   other run in parallel, and builds downstream of a failed build are
+#   skipped.
 
 import os
 import sys
@@ -38,25 +33,12 @@ build_triggered = False
 # Pop off the executable path
 sys.argv.pop(0)
 
-def get_deps(repository, recurse, all_deps = []):
-    deps = []
+def has_deps(repository):
     for reponame in repodata.keys():
         if repodata[reponame]["Dependencies"] != None:
             if repository in repodata[reponame]["Dependencies"]:
-                repoconf = repodata[reponame]
-                repotype = repoconf["Type"]
-                if len(repotype) != 0 and repotype != "none":
-                    if reponame in all_deps:
-                        raise Exception("Found duplicate dependency %s while walking the dependency tree" % reponame)
-                    deps.append(reponame)
-                    all_deps.append(reponame)
-    if recurse:
-        if not deps:
-            return deps
-        for dep in deps:
-            get_deps(dep, True, all_deps)
-
-    return deps
+                return True
+    return False
 
 if len(sys.argv) == 2:
     command = "build"
@@ -80,17 +62,10 @@ if command == "build":
                 build_triggered = True
                 bot.Log("Debug", "Adding primary build for %s / %s to the pipeline" % (repository, branch))
                 bot.AddJob(repotype, [ "build", repository, branch ])
-    try:
-        deps = get_deps(repository, True)
-    except Exception as e:
-        err = "Resolving dependencies for %s / %s: %s" % (repository, branch, e)
-        bot.Log("Error", err)
-        bot.AddTask("status", [ err ])
-        exit(0)
-    if deps:
+    if has_deps(repository):
         build_triggered = True
-        bot.Log("Debug", "Starting builds for everything that depends on %s / %s" % (repository, branch))
-        bot.AddJob("gopherci", [ "builddeps", repository, branch ])
+        bot.Log("Debug", "Adding builds for everything that depends on %s / %s" % (repository, branch))
+        bot.AddTask("build-dependents", [ repository, branch ])
 
 if command == "job":
     # Run a custom pipeline
@@ -107,38 +82,9 @@ if command == "job":
     exit()
 
 if command == "builddeps":
-    # build depdencies for a repository
+    # build dependencies for a repository
     build_triggered = True
-    for reponame in repodata.keys():
-        if repodata[reponame]["Dependencies"] != None:
-            if repository in repodata[reponame]["Dependencies"]:
-                repoconf = repodata[reponame]
-                repotype = repoconf["Type"]
-                if len(repotype) != 0 and repotype != "none":
-                    if "default_branch" in repoconf:
-                        repobranch = repoconf["default_branch"]
-                    else:
-                        repobranch = "master"
-                    bot.Log("Debug", "Spawning dependency build of %s / %s for primary build of %s / %s" % (reponame, repobranch, repository, branch))
-                    bot.SpawnJob("gopherci", [ "depbuild", reponame, repobranch, repository, branch ])
-
-if command == "depbuild":
-    # Inital build of dependency
-    # build repo + deps
-    build_triggered = True
-    deprepo = sys.argv.pop(0)
-    depbranch = sys.argv.pop(0)
-    if repository in repodata:
-        repoconf = repodata[repository]
-        repotype = repoconf["Type"]
-        if len(repotype) != 0 and repotype != "none":
-            build_triggered = True
-            bot.Log("Debug", "Adding primary dependency build for %s / %s to the pipeline, triggered by %s / %s" % (repository, branch, deprepo, depbranch))
-            bot.AddJob(repotype, [ "depbuild", repository, branch, deprepo, depbranch ])
-    deps = get_deps(repository, False)
-    if deps:
-        bot.Log("Debug", "Starting builds for everything that depends on %s / %s (initially triggered by %s / %s" % (repository, branch, deprepo, depbranch))
-        bot.AddJob("gopherci", [ "builddeps", repository, branch ])
+    bot.AddTask("build-dependents", [ repository, branch ])
 
 if not build_triggered:
     bot.Log("Debug", "Ignoring update on '%s', no builds triggered" % repository)
@@ -1,6 +1,9 @@
 import os
+import base64
+import httplib
 import json
 import random
+import socket
 import subprocess
 import sys
 import time
@@ -8,6 +11,16 @@ import urllib2
 
 # python 2 version
 
+class UnixHTTPConnection(httplib.HTTPConnection):
+    "An HTTPConnection to the robot's api socket, for GOPHER_API_SOCKET"
+    def __init__(self, path):
+        httplib.HTTPConnection.__init__(self, "localhost")
+        self.socket_path = path
+
+    def connect(self):
+        self.sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        self.sock.connect(self.socket_path)
+
 class Attribute:
     "A Gopherbot Attribute return object"
     def __init__(self, ret):
@@ -26,6 +39,15 @@ class Reply:
     def __str__(self):
         return self.reply
 
+class Approval:
+    "A Gopherbot RequestApproval return object"
+    def __init__(self, ret):
+        self.user = ret["User"]
+        self.ret = ret["RetVal"]
+
+    def __str__(self):
+        return self.user
+
 class Memory:
     "A Gopherbot long-term memory object"
     def __init__(self, key, ret):
@@ -71,8 +93,10 @@ class Robot:
     Fail = 1
     MechanismFail = 2
     ConfigurationError = 3
+    RobotStopping = 5
     NotFound = 6
     Success = 7
+    TaskTimeout = 124
 
     def __init__(self):
         random.seed()
@@ -98,12 +122,23 @@ class Robot:
                     "Protocol": self.protocol, "CallerID": self.plugin_id,
                     "FuncArgs": func_args }
         func_json = json.dumps(func_call)
-        req = urllib2.Request(url="%s/json" % os.getenv("GOPHER_HTTP_POST"),
-            data=func_json)
-        req.add_header('Content-Type', 'application/json')
+        headers = { 'Content-Type': 'application/json',
+            'Authorization': "Bearer %s" % os.getenv("GOPHER_CALLER_TOKEN") }
+        url = "%s/json" % os.getenv("GOPHER_HTTP_POST")
         # sys.stderr.write("Sending: %s\n" % func_json)
-        f = urllib2.urlopen(req)
-        body = f.read()
+        socket_path = os.getenv("GOPHER_API_SOCKET")
+        if socket_path:
+            conn = UnixHTTPConnection(socket_path)
+            conn.request("POST", "/json", func_json, headers)
+            res = conn.getresponse()
+            body = res.read()
+            conn.close()
+            if res.status != 200:
+                raise urllib2.HTTPError(url, res.status, res.reason, res.msg, None)
+        else:
+            req = urllib2.Request(url=url, data=func_json, headers=headers)
+            f = urllib2.urlopen(req)
+            body = f.read()
         # sys.stderr.write("Got back: %s\n" % body)
         return json.loads(body)
 
@@ -126,20 +161,58 @@ class Robot:
         ret = self.Call("CheckoutDatum", { "Key": key, "RW": rw })
         return Memory(key, ret)
 
+    # ListDatum returns the keys of the plugin's memories starting with prefix
+    def ListDatum(self, prefix=""):
+        ret = self.Call("ListDatum", { "Prefix": prefix })
+        if ret["RetVal"] != self.Ok:
+            return []
+        return ret["Keys"]
+
+    # CheckoutData reads several memories read-only, returning a dict of
+    # key to datum; memories that don't exist are left out.
+    def CheckoutData(self, keys):
+        ret = self.Call("CheckoutData", { "Keys": keys })
+        if ret["RetVal"] != self.Ok:
+            return {}
+        return ret["Data"]
+
     def SpawnJob(self, name, args):
         return self.Call("SpawnJob", { "Name": name, "CmdArgs": args })["RetVal"]
 
     def AddJob(self, name, args):
         return self.Call("AddJob", { "Name": name, "CmdArgs": args })["RetVal"]
 
-    def AddTask(self, name, args):
-        return self.Call("AddTask", { "Name": name, "CmdArgs": args })["RetVal"]
-
-    def FinalTask(self, name, args):
-        return self.Call("FinalTask", { "Name": name, "CmdArgs": args })["RetVal"]
-
-    def FailTask(self, name, args):
-        return self.Call("FailTask", { "Name": name, "CmdArgs": args })["RetVal"]
+    def AddTask(self, name, args, timeout=None, retry=None):
+        funcargs = { "Name": name, "CmdArgs": args }
+        if timeout:
+            funcargs["Timeout"] = timeout
+        if retry:
+            funcargs["Retry"] = retry
+        return self.Call("AddTask", funcargs)["RetVal"]
+
+    def AddParallelTask(self, name, args, timeout=None, retry=None):
+        funcargs = { "Name": name, "CmdArgs": args }
+        if timeout:
+            funcargs["Timeout"] = timeout
+        if retry:
+            funcargs["Retry"] = retry
+        return self.Call("AddParallelTask", funcargs)["RetVal"]
+
+    def FinalTask(self, name, args, timeout=None, retry=None):
+        funcargs = { "Name": name, "CmdArgs": args }
+        if timeout:
+            funcargs["Timeout"] = timeout
+        if retry:
+            funcargs["Retry"] = retry
+        return self.Call("FinalTask", funcargs)["RetVal"]
+
+    def FailTask(self, name, args, timeout=None, retry=None):
+        funcargs = { "Name": name, "CmdArgs": args }
+        if timeout:
+            funcargs["Timeout"] = timeout
+        if retry:
+            funcargs["Retry"] = retry
+        return self.Call("FailTask", funcargs)["RetVal"]
 
     def AddCommand(self, plugin, cmd):
         return self.Call("AddCommand", { "Plugin": plugin, "Command": cmd })["RetVal"]
@@ -171,9 +244,10 @@ class Robot:
     def CheckinDatum(self, m):
         self.Call("CheckinDatum", { "Key": m.key, "Token": m.lock_token })
 
-    def UpdateDatum(self, m):
+    # With ttl (seconds), the memory expires and is removed by the robot
+    def UpdateDatum(self, m, ttl=0):
         ret = self.Call("UpdateDatum", { "Key": m.key, "Token": m.lock_token,
-        "Datum": m.datum })
+        "Datum": m.datum, "TTL": ttl })
         return ret["RetVal"]
 
     def GetSenderAttribute(self, attr):
@@ -192,6 +266,16 @@ class Robot:
         ret = self.Call("Recall", { "Key": memory })
         return ret["StrVal"]
 
+    # GetBrainLocks returns a dict with "Locks" held and lock wait "Stats";
+    # requires an administrator.
+    def GetBrainLocks(self):
+        return self.Call("GetBrainLocks", {})
+
+    # ReleaseBrainLock force-releases the lock on a memory (full key,
+    # including namespace); requires an administrator.
+    def ReleaseBrainLock(self, key):
+        return self.Call("ReleaseBrainLock", { "Key": key })["Boolean"]
+
     def PromptForReply(self, regex_id, prompt, format=""):
         return self.PromptUserChannelForReply(regex_id, self.user, self.channel, prompt, format)
 
@@ -208,6 +292,28 @@ class Robot:
             rep["RetVal"] = self.Interrupted
         return Reply(rep)
 
+    def PromptForChoice(self, prompt, choices, format=""):
+        return self.PromptUserChannelForChoice(self.user, self.channel, prompt, choices, format)
+
+    def PromptUserForChoice(self, user, prompt, choices, format=""):
+        return self.PromptUserChannelForChoice(user, "", prompt, choices, format)
+
+    def PromptUserChannelForChoice(self, user, channel, prompt, choices, format=""):
+        for i in range(0, 3):
+            rep = self.Call("PromptUserChannelForChoice", { "User": user, "Channel": channel, "Prompt": prompt, "Choices": list(choices) }, format)
+            if rep["RetVal"] == self.RetryPrompt:
+                continue
+            return Reply(rep)
+        if rep["RetVal"] == self.RetryPrompt:
+            rep["RetVal"] = self.Interrupted
+        return Reply(rep)
+
+    # RequestApproval waits for a user authorized for auth_require to approve
+    # or reject the request; ret is Normal when approved, Fail when rejected,
+    # or TaskTimeout when nobody decided within the timeout, e.g. "30m"
+    def RequestApproval(self, auth_require, timeout, request):
+        return Approval(self.Call("RequestApproval", { "AuthRequire": auth_require, "Timeout": timeout, "Request": request }))
+
     def SendChannelMessage(self, channel, message, format=""):
         ret = self.Call("SendChannelMessage", { "Channel": channel,
         "Message": message }, format)
@@ -235,6 +341,58 @@ class Robot:
         else:
             return self.SendUserChannelMessage(self.user, self.channel, message, format)
 
+    def SayThread(self, message, format=""):
+        ret = self.Call("SayThread", { "Message": message }, format)
+        return ret["RetVal"]
+
+    def ReplyThread(self, message, format=""):
+        ret = self.Call("ReplyThread", { "Message": message }, format)
+        return ret["RetVal"]
+
+    def SayProgress(self, message, format=""):
+        ret = self.Call("SayProgress", { "Message": message }, format)
+        return ret["Handle"], ret["RetVal"]
+
+    def UpdateProgress(self, handle, message, format=""):
+        ret = self.Call("UpdateProgress", { "Handle": handle, "Message": message }, format)
+        return ret["RetVal"]
+
+    def React(self, reaction):
+        ret = self.Call("React", { "Reaction": reaction })
+        return ret["RetVal"]
+
+    def Unreact(self, reaction):
+        ret = self.Call("Unreact", { "Reaction": reaction })
+        return ret["RetVal"]
+
+    def _sendFile(self, funcname, user, channel, path, title):
+        with open(path, "rb") as f:
+            data = base64.b64encode(f.read())
+        ret = self.Call(funcname, { "User": user, "Channel": channel,
+            "Filename": os.path.basename(path), "Title": title, "Data": data })
+        return ret["RetVal"]
+
+    def SendFile(self, path, title=""):
+        return self._sendFile("SendFile", "", "", path, title)
+
+    def SendChannelFile(self, channel, path, title=""):
+        return self._sendFile("SendChannelFile", "", channel, path, title)
+
+    def SendUserFile(self, user, path, title=""):
+        return self._sendFile("SendUserFile", user, "", path, title)
+
+    def GetAttachedFiles(self):
+        "Returns a list of dicts with ID, Name, Title, MimeType and Size"
+        ret = self.Call("GetAttachedFiles", {})
+        return ret["Files"] or []
+
+    def DownloadFile(self, fileid, path):
+        ret = self.Call("DownloadFile", { "FileID": fileid })
+        if ret["RetVal"] == self.Ok:
+            with open(path, "wb") as f:
+                f.write(base64.b64decode(ret["Data"] or ""))
+        return ret["RetVal"]
+
 class DirectBot(Robot):
     "Instantiate a robot for direct messaging with the user"
     def __init__(self, bot):
@@ -1,5 +1,6 @@
 require 'json'
 require 'net/http'
+require 'socket'
 require 'uri'
 
 class Attribute
@@ -28,6 +29,19 @@ class Reply
 	end
 end
 
+class Approval
+	def initialize(user, ret)
+		@user = user
+		@ret = ret
+	end
+
+	attr_reader :user, :ret
+
+	def to_s
+		@user
+	end
+end
+
 class Memory
 	def initialize(key, lt, exists, datum, ret)
 		@key = key
@@ -75,8 +89,10 @@ class BaseBot
 	Fail = 1
 	MechanismFail = 2
 	ConfigurationError = 3
+	RobotStopping = 5
 	NotFound = 6
 	Success = 7
+	TaskTimeout = 124
 
 	attr_reader :user, :channel
 
@@ -107,16 +123,32 @@ class BaseBot
 		return callBotFunc("AddJob", { "Name" => name, "CmdArgs" => args })["RetVal"]
 	end
 
-	def AddTask(name, args)
-		return callBotFunc("AddTask", { "Name" => name, "CmdArgs" => args })["RetVal"]
+	def AddTask(name, args, timeout=nil, retry=nil)
+		funcargs = { "Name" => name, "CmdArgs" => args }
+		funcargs["Timeout"] = timeout if timeout
+		funcargs["Retry"] = retry if retry
+		return callBotFunc("AddTask", funcargs)["RetVal"]
 	end
 
-	def FinalTask(name, args)
-		return callBotFunc("FinalTask", { "Name" => name, "CmdArgs" => args })["RetVal"]
+	def AddParallelTask(name, args, timeout=nil, retry=nil)
+		funcargs = { "Name" => name, "CmdArgs" => args }
+		funcargs["Timeout"] = timeout if timeout
+		funcargs["Retry"] = retry if retry
+		return callBotFunc("AddParallelTask", funcargs)["RetVal"]
 	end
 
-	def FailTask(name, args)
-		return callBotFunc("FailTask", { "Name" => name, "CmdArgs" => args })["RetVal"]
+	def FinalTask(name, args, timeout=nil, retry=nil)
+		funcargs = { "Name" => name, "CmdArgs" => args }
+		funcargs["Timeout"] = timeout if timeout
+		funcargs["Retry"] = retry if retry
+		return callBotFunc("FinalTask", funcargs)["RetVal"]
+	end
+
+	def FailTask(name, args, timeout=nil, retry=nil)
+		funcargs = { "Name" => name, "CmdArgs" => args }
+		funcargs["Timeout"] = timeout if timeout
+		funcargs["Retry"] = retry if retry
+		return callBotFunc("FailTask", funcargs)["RetVal"]
 	end
 
 	def AddCommand(name, arg)
@@ -157,20 +189,36 @@ class BaseBot
 		return Memory.new(key, ret["LockToken"], ret["Exists"], ret["Datum"], ret["RetVal"])
 	end
 
+	# Returns the keys of the plugin's memories starting with prefix
+	def ListDatum(prefix="")
+		ret = callBotFunc("ListDatum", { "Prefix" => prefix })
+		return [] if ret["RetVal"] != Ok
+		return ret["Keys"]
+	end
+
+	# Reads several memories read-only; returns a hash of key to datum
+	def CheckoutData(keys)
+		ret = callBotFunc("CheckoutData", { "Keys" => keys })
+		return {} if ret["RetVal"] != Ok
+		return ret["Data"]
+	end
+
 	def CheckinDatum(m)
 		args = { "Key" => m.key, "Token" => m.lock_token }
 		callBotFunc("CheckinDatum", args)
 		return 0
 	end
 
-	def UpdateDatum(m)
-		args = { "Key" => m.key, "Token" => m.lock_token, "Datum" => m.datum }
+	# With ttl (seconds), the memory expires and is removed by the robot
+	def UpdateDatum(m, ttl=0)
+		args = { "Key" => m.key, "Token" => m.lock_token, "Datum" => m.datum, "TTL" => ttl }
 		ret = callBotFunc("UpdateDatum", args)
 		return ret["RetVal"]
 	end
 
-	def Remember(k, v)
-		args = { "Key" => k, "Value" => v }
+	# ttl (seconds) overrides the default 7 minutes for short-term memories
+	def Remember(k, v, ttl=0)
+		args = { "Key" => k, "Value" => v, "TTL" => ttl }
 		ret = callBotFunc("Remember", args)
 		return ret["RetVal"]
 	end
@@ -184,6 +232,14 @@ class BaseBot
 		return callBotFunc("Recall", args).StrVal
 	end
 
+	def GetBrainLocks()
+		return callBotFunc("GetBrainLocks", {})
+	end
+
+	def ReleaseBrainLock(key)
+		return callBotFunc("ReleaseBrainLock", { "Key" => key })["Boolean"]
+	end
+
 	def GetTaskConfig()
 		ret = callBotFunc("GetTaskConfig", {})
 		return ret
@@ -256,6 +312,74 @@ class BaseBot
 		end
 	end
 
+	def SayThread(message, format="")
+		format = format.to_s if format.class == Symbol
+		ret = callBotFunc("SayThread", { "Message" => message }, format)
+		return ret["RetVal"]
+	end
+
+	def ReplyThread(message, format="")
+		format = format.to_s if format.class == Symbol
+		ret = callBotFunc("ReplyThread", { "Message" => message }, format)
+		return ret["RetVal"]
+	end
+
+	def SayProgress(message, format="")
+		format = format.to_s if format.class == Symbol
+		ret = callBotFunc("SayProgress", { "Message" => message }, format)
+		return ret["Handle"], ret["RetVal"]
+	end
+
+	def UpdateProgress(handle, message, format="")
+		format = format.to_s if format.class == Symbol
+		ret = callBotFunc("UpdateProgress", { "Handle" => handle, "Message" => message }, format)
+		return ret["RetVal"]
+	end
+
+	def React(reaction)
+		ret = callBotFunc("React", { "Reaction" => reaction })
+		return ret["RetVal"]
+	end
+
+	def Unreact(reaction)
+		ret = callBotFunc("Unreact", { "Reaction" => reaction })
+		return ret["RetVal"]
+	end
+
+	def sendFile(funcname, user, channel, path, title)
+		data = [ File.binread(path) ].pack("m0")
+		ret = callBotFunc(funcname, { "User" => user, "Channel" => channel,
+			"Filename" => File.basename(path), "Title" => title, "Data" => data })
+		return ret["RetVal"]
+	end
+	private :sendFile
+
+	def SendFile(path, title="")
+		return sendFile("SendFile", "", "", path, title)
+	end
+
+	def SendChannelFile(channel, path, title="")
+		return sendFile("SendChannelFile", "", channel, path, title)
+	end
+
+	def SendUserFile(user, path, title="")
+		return sendFile("SendUserFile", user, "", path, title)
+	end
+
+	# Returns an array of hashes with ID, Name, Title, MimeType and Size
+	def GetAttachedFiles()
+		ret = callBotFunc("GetAttachedFiles", {})
+		return ret["Files"] || []
+	end
+
+	def DownloadFile(fileid, path)
+		ret = callBotFunc("DownloadFile", { "FileID" => fileid })
+		if ret["RetVal"] == Ok
+			File.binwrite(path, (ret["Data"] || "").unpack("m0")[0])
+		end
+		return ret["RetVal"]
+	end
+
 	def PromptForReply(regex_id, prompt)
 		return PromptUserChannelForReply(regex_id, @user, @channel, prompt)
 	end
@@ -278,6 +402,32 @@ class BaseBot
 		end
 	end
 
+	def PromptForChoice(prompt, choices)
+		return PromptUserChannelForChoice(@user, @channel, prompt, choices)
+	end
+
+	def PromptUserForChoice(user, prompt, choices)
+		return PromptUserChannelForChoice(user, "", prompt, choices)
+	end
+
+	def PromptUserChannelForChoice(user, channel, prompt, choices)
+		args = { "User" => user, "Channel" => channel, "Prompt" => prompt, "Choices" => choices }
+		for i in 1..3
+			ret = callBotFunc("PromptUserChannelForChoice", args)
+			next if ret["RetVal"] == RetryPrompt
+			return Reply.new(ret["Reply"], ret["RetVal"])
+		end
+		return Reply.new(ret["Reply"], Interrupted)
+	end
+
+	# RequestApproval waits for a user authorized for auth_require to approve
+	# or reject the request; ret is Normal when approved, Fail when rejected,
+	# or TaskTimeout when nobody decided within the timeout, e.g. "30m"
+	def RequestApproval(auth_require, timeout, request)
+		ret = callBotFunc("RequestApproval", { "AuthRequire" => auth_require, "Timeout" => timeout, "Request" => request })
+		return Approval.new(ret["User"], ret["RetVal"])
+	end
+
 	def callBotFunc(funcname, args, format="")
 		if format.size == 0
 			format = @format
@@ -292,16 +442,42 @@ class BaseBot
 			"FuncArgs" => args
 		}
 		uri = URI.parse(ENV["GOPHER_HTTP_POST"] + "/json")
-		http = Net::HTTP.new(uri.host, uri.port)
-		req = Net::HTTP::Post.new(uri, initheader = {'Content-Type' =>'application/json'})
+		req = Net::HTTP::Post.new(uri, initheader = {
+			'Content-Type' =>'application/json',
+			'Authorization' => "Bearer #{ENV["GOPHER_CALLER_TOKEN"]}"
+		})
 		req.body = func.to_json
 #		STDERR.puts "Sending:\n#{req.body}"
-		res = http.request(req)
+		socket_path = ENV["GOPHER_API_SOCKET"]
+		if socket_path && socket_path.size > 0
+			res = socketRequest(socket_path, req)
+		else
+			http = Net::HTTP.new(uri.host, uri.port)
+			res = http.request(req)
+		end
 		body = res.body()
 #		STDERR.puts "Got back:\n#{body}"
 		return JSON.load(body)
 	end
 	private :callBotFunc
+
+	# Net::HTTP doesn't do unix sockets, so send the request directly
+	def socketRequest(socket_path, req)
+		io = Net::BufferedIO.new(UNIXSocket.new(socket_path))
+		begin
+			req.exec(io, "1.1", req.path)
+			res = nil
+			loop do
+				res = Net::HTTPResponse.read_new(io)
+				break unless res.kind_of?(Net::HTTPContinue)
+			end
+			res.reading_body(io, req.response_body_permitted?) {}
+			return res
+		ensure
+			io.close
+		end
+	end
+	private :socketRequest
 end
 
 class Robot < BaseBot
@@ -33,8 +33,10 @@ PLUGRET_Normal=0
 PLUGRET_Fail=1
 PLUGRET_MechanismFail=2
 PLUGRET_ConfigurationError=3
+PLUGRET_RobotStopping=5
 PLUGRET_NotFound=6
 PLUGRET_Success=7
+PLUGRET_TaskTimeout=124
 
 base64_encode(){
 	local MESSAGE
@@ -49,6 +51,11 @@ gbPostJSON(){
 	local GB_FUNCARGS="$2"
 	local FORMAT=${3:-$GB_FORMAT}
 	local JSON JSONRET
+	local CURL_ARGS=( -f -X POST -d @- )
+	if [ -n "$GOPHER_API_SOCKET" ]
+	then
+		CURL_ARGS+=( --unix-socket "$GOPHER_API_SOCKET" )
+	fi
 	#local GB_DEBUG="true"
 	JSON=$(cat <<EOF
 {
@@ -67,7 +74,9 @@ EOF
 		echo "Sending:" >&2
 		echo "$JSON" >&2
 	fi
-	JSONRET=$(echo "$JSON" | curl -f -X POST -d @- $GOPHER_HTTP_POST/json 2>/dev/null)
+	# The token is passed in a config on a file descriptor, since curl's
+	# arguments can be read by any local user with 'ps'
+	JSONRET=$(echo "$JSON" | curl "${CURL_ARGS[@]}" -K <(printf 'header = "Authorization: Bearer %s"\n' "$GOPHER_CALLER_TOKEN") $GOPHER_HTTP_POST/json 2>/dev/null)
 	if [ "$GB_DEBUG" = "true" ]
 	then
 		echo "Got back:" >&2
@@ -111,10 +120,13 @@ Remember(){
 	local GB_FUNCNAME="Remember"
 	local R_KEY=$(base64_encode "$1")
 	local R_MEMORY=$(base64_encode "$2")
+	# Optional third argument is the ttl in seconds
+	local R_TTL=${3:-0}
 	local GB_FUNCARGS=$(cat <<EOF
 {
 	"Key": "$R_KEY",
 	"Value": "$R_MEMORY",
+	"TTL": $R_TTL,
 	"Base64" : true
 }
 EOF
@@ -155,6 +167,67 @@ EOF
 	echo -n "$RETVAL"
 }
 
+# ListDatum prints the keys of the plugin's memories starting with prefix,
+# one per line
+ListDatum(){
+	local GB_FUNCNAME="ListDatum"
+	local GB_FUNCARGS=$(cat <<EOF
+{
+	"Prefix": "$1"
+}
+EOF
+)
+	local GB_RET=$(gbPostJSON $GB_FUNCNAME "$GB_FUNCARGS")
+	local RETVAL=$(echo "$GB_RET" | jq .RetVal)
+	if [ "$RETVAL" -ne 0 ]
+	then
+		return $RETVAL
+	fi
+	echo "$GB_RET" | jq -r '.Keys[]'
+}
+
+# CheckoutData key1 key2 ... prints a JSON object mapping each existing
+# key to its datum
+CheckoutData(){
+	local GB_FUNCNAME="CheckoutData"
+	local GB_FUNCARGS=$(jq -n '{ Keys: $ARGS.positional }' --args "$@")
+	local GB_RET=$(gbPostJSON $GB_FUNCNAME "$GB_FUNCARGS")
+	local RETVAL=$(echo "$GB_RET" | jq .RetVal)
+	if [ "$RETVAL" -ne 0 ]
+	then
+		return $RETVAL
+	fi
+	echo "$GB_RET" | jq -c .Data
+}
+
+# GetBrainLocks prints the JSON list of held locks and lock statistics
+GetBrainLocks(){
+	local GB_FUNCNAME="GetBrainLocks"
+	local GB_RET=$(gbPostJSON $GB_FUNCNAME "{}")
+	echo "$GB_RET"
+}
+
+ReleaseBrainLock(){
+	if [ -z "$1" ]
+	then
+		return 1
+	fi
+	local GB_FUNCNAME="ReleaseBrainLock"
+	local GB_FUNCARGS=$(cat <<EOF
+{
+	"Key": "$1"
+}
+EOF
+)
+	local GB_RET=$(gbPostJSON $GB_FUNCNAME "$GB_FUNCARGS")
+	local RETVAL=$(echo "$GB_RET" | jq .Boolean)
+	if [ "$RETVAL" == "true" ]
+	then
+		return 0
+	fi
+	return 1
+}
+
 SetParameter() {
 	local NAME=$(base64_encode "$1")
 	local VALUE=$(base64_encode "$2")
@@ -217,11 +290,47 @@ EOF
 	fi
 }
 
+# AddTask, AddParallelTask, FinalTask and FailTask take an optional timeout for the task,
+# and an optional retry policy of max attempts, backoff and comma-separated
+# exit codes to retry, e.g.:
+# AddTask -t 10m ssh-cmd make
+# AddTask -r 3 -b 10s -c 1,124 git-clone ...
 _pipeTask(){
 	local JSTR
+	local TIMEOUT
+	local ATTEMPTS
+	local BACKOFF
+	local RETRYON
+	local RETRY="null"
 	local FNAME="$1"
-	local TNAME="$2"
-	shift 2
+	shift
+	while [ -n "$1" ]
+	do
+		case "$1" in
+		-t)
+			TIMEOUT="$2"
+			;;
+		-r)
+			ATTEMPTS="$2"
+			;;
+		-b)
+			BACKOFF="$2"
+			;;
+		-c)
+			RETRYON="${2//,/, }"
+			;;
+		*)
+			break
+			;;
+		esac
+		shift 2
+	done
+	if [ -n "$ATTEMPTS" ]
+	then
+		RETRY="{ \"Attempts\": $ATTEMPTS, \"Backoff\": \"$BACKOFF\", \"RetryOn\": [ $RETRYON ] }"
+	fi
+	local TNAME="$1"
+	shift
 	for ARG in "$@"
 	do
 		JSTR="$JSTR \"$ARG\""
@@ -233,7 +342,9 @@ _pipeTask(){
 	local GB_FUNCARGS=$(cat <<EOF
 {
 	"Name": "$TNAME",
-	"CmdArgs": [ $JSTR ]
+	"CmdArgs": [ $JSTR ],
+	"Timeout": "$TIMEOUT",
+	"Retry": $RETRY
 }
 EOF
 )
@@ -249,6 +360,10 @@ AddTask(){
 	_pipeTask "AddTask" "$@"
 }
 
+AddParallelTask(){
+	_pipeTask "AddParallelTask" "$@"
+}
+
 FinalTask(){
 	_pipeTask "FinalTask" "$@"
 }
@@ -460,6 +575,85 @@ PromptUserForReply(){
 	PromptUserChannelForReply "$REGEX" "$PUSER" "" "$*"
 }
 
+# PromptUserChannelForChoice user channel prompt choice1 choice2 ...
+PromptUserChannelForChoice(){
+	local FORMAT
+	if [[ $1 = -? ]]; then FORMAT=$(getFormat $1); shift; fi
+	local GB_FUNCARGS GB_RET
+	local GB_FUNCNAME="PromptUserChannelForChoice"
+	local PUSER="$1"
+	local PCHANNEL="$2"
+	local PROMPT=$(base64_encode "$3")
+	shift 3
+	local CHOICES=$(printf '%s\n' "$@" | jq -R . | jq -s -c .)
+	GB_FUNCARGS=$(cat <<EOF
+{
+	"User": "$PUSER",
+	"Channel": "$PCHANNEL",
+	"Prompt": "$PROMPT",
+	"Choices": $CHOICES,
+	"Base64" : true
+}
+EOF
+)
+	local RETVAL
+	for TRY in 0 1 2
+	do
+		GB_RET=$(gbPostJSON $GB_FUNCNAME "$GB_FUNCARGS" $FORMAT)
+		gbBotRet "$GB_RET"
+		RETVAL=$?
+		if [ $RETVAL -eq $GBRET_RetryPrompt ]
+		then
+			continue
+		fi
+		gbExtract "$GB_RET" Reply
+		return $RETVAL
+	done
+	return $GBRET_Interrupted
+}
+
+# PromptForChoice prompt choice1 choice2 ...
+PromptForChoice(){
+	local FORMAT
+	if [[ $1 = -? ]]; then FORMAT=$1; shift; fi
+	PromptUserChannelForChoice $FORMAT "$GOPHER_USER" "$GOPHER_CHANNEL" "$@"
+}
+
+# PromptUserForChoice user prompt choice1 choice2 ...
+PromptUserForChoice(){
+	local FORMAT
+	if [[ $1 = -? ]]; then FORMAT=$1; shift; fi
+	local PUSER=$1
+	shift
+	PromptUserChannelForChoice $FORMAT "$PUSER" "" "$@"
+}
+
+# RequestApproval authrequire timeout request - waits for a user authorized
+# for authrequire to approve or reject the request, and prints the user that
+# decided. Returns PLUGRET_Normal when approved, PLUGRET_Fail when rejected,
+# or PLUGRET_TaskTimeout when nobody decided within the timeout, e.g. "30m"
+RequestApproval(){
+	local GB_FUNCARGS GB_RET
+	local GB_FUNCNAME="RequestApproval"
+	local AUTHREQUIRE="$1"
+	local TIMEOUT="$2"
+	local REQUEST=$(base64_encode "$3")
+	GB_FUNCARGS=$(cat <<EOF
+{
+	"AuthRequire": "$AUTHREQUIRE",
+	"Timeout": "$TIMEOUT",
+	"Request": "$REQUEST",
+	"Base64": true
+}
+EOF
+)
+	GB_RET=$(gbPostJSON $GB_FUNCNAME "$GB_FUNCARGS")
+	gbBotRet "$GB_RET"
+	local RETVAL=$?
+	gbExtract "$GB_RET" User
+	return $RETVAL
+}
+
 MessageFormat(){
 	if [ -n "$1" ]
 	then
@@ -571,3 +765,153 @@ Reply(){
 		SendUserMessage $FARG "$GOPHER_USER" "$*"
 	fi
 }
+
+# SayThread / ReplyThread keep all the pipeline's output in a single thread,
+# for protocols that support threads.
+gbThreadMessage(){
+	local GB_FUNCNAME=$1
+	shift
+	local FORMAT
+	if [[ $1 = -? ]]; then FORMAT=$(getFormat $1); shift; fi
+	local GB_FUNCARGS GB_RET
+	MESSAGE="$*"
+	MESSAGE=$(base64_encode "$MESSAGE")
+
+	GB_FUNCARGS=$(cat <<EOF
+{
+	"Message": "$MESSAGE",
+	"Base64" : true
+}
+EOF
+)
+	GB_RET=$(gbPostJSON $GB_FUNCNAME "$GB_FUNCARGS" $FORMAT)
+	gbBotRet "$GB_RET"
+}
+
+SayThread(){
+	gbThreadMessage SayThread "$@"
+}
+
+ReplyThread(){
+	gbThreadMessage ReplyThread "$@"
+}
+
+# SayProgress sends a message that later tasks in the pipeline can update
+# with UpdateProgress, and echoes the handle for the message. UpdateProgress
+# takes the handle, or "" for the most recent progress message, e.g.:
+# UpdateProgress "" "task 3/7: git-clone ... ok"
+SayProgress(){
+	local FORMAT
+	if [[ $1 = -? ]]; then FORMAT=$(getFormat $1); shift; fi
+	local GB_FUNCARGS GB_RET
+	local MESSAGE=$(base64_encode "$*")
+	GB_FUNCARGS=$(cat <<EOF
+{
+	"Message": "$MESSAGE",
+	"Base64" : true
+}
+EOF
+)
+	GB_RET=$(gbPostJSON SayProgress "$GB_FUNCARGS" $FORMAT)
+	gbExtract "$GB_RET" Handle
+	gbBotRet "$GB_RET"
+}
+
+UpdateProgress(){
+	local FORMAT
+	if [[ $1 = -? ]]; then FORMAT=$(getFormat $1); shift; fi
+	local HANDLE="$1"
+	shift
+	local GB_FUNCARGS GB_RET
+	local MESSAGE=$(base64_encode "$*")
+	GB_FUNCARGS=$(cat <<EOF
+{
+	"Handle": "$HANDLE",
+	"Message": "$MESSAGE",
+	"Base64" : true
+}
+EOF
+)
+	GB_RET=$(gbPostJSON UpdateProgress "$GB_FUNCARGS" $FORMAT)
+	gbBotRet "$GB_RET"
+}
+
+# React / Unreact add and remove an emoji reaction on the message that
+# started the pipeline, e.g. 'React thumbsup'.
+gbReaction(){
+	local GB_FUNCNAME=$1
+	local GB_FUNCARGS GB_RET
+	GB_FUNCARGS=$(cat <<EOF
+{
+	"Reaction": "$2"
+}
+EOF
+)
+	GB_RET=$(gbPostJSON $GB_FUNCNAME "$GB_FUNCARGS")
+	gbBotRet "$GB_RET"
+}
+
+React(){
+	gbReaction React "$1"
+}
+
+Unreact(){
+	gbReaction Unreact "$1"
+}
+
+# SendFile / SendChannelFile / SendUserFile upload a file, with an optional
+# title, e.g. 'SendFile report.txt "Nightly Report"'. The file is read by the
+# script and sent base64-encoded.
+gbSendFile(){
+	local GB_FUNCNAME=$1
+	local SF_USER="$2"
+	local SF_CHANNEL="$3"
+	local SF_FILE="$4"
+	local SF_TITLE="$5"
+	local GB_FUNCARGS GB_RET
+	if [ ! -r "$SF_FILE" ]
+	then
+		return $GBRET_MissingArguments
+	fi
+	GB_FUNCARGS=$(base64 -w 0 < "$SF_FILE" | jq -R -s -c \
+		--arg user "$SF_USER" --arg channel "$SF_CHANNEL" \
+		--arg filename "$(basename "$SF_FILE")" --arg title "$SF_TITLE" \
+		'{ User: $user, Channel: $channel, Filename: $filename, Title: $title, Data: . }')
+	GB_RET=$(gbPostJSON $GB_FUNCNAME "$GB_FUNCARGS")
+	gbBotRet "$GB_RET"
+}
+
+SendFile(){
+	gbSendFile SendFile "" "" "$1" "$2"
+}
+
+SendChannelFile(){
+	gbSendFile SendChannelFile "" "$1" "$2" "$3"
+}
+
+SendUserFile(){
+	gbSendFile SendUserFile "$1" "" "$2" "$3"
+}
+
+# GetAttachedFiles prints "<id><tab><name>" for each file attached to the
+# message that started the pipeline.
+GetAttachedFiles(){
+	local GB_RET
+	GB_RET=$(gbPostJSON GetAttachedFiles "{}")
+	echo "$GB_RET" | jq -r '.Files[]? | "\(.ID)\t\(.Name)"'
+}
+
+# DownloadFile writes an attached file to a path, e.g.
+# 'DownloadFile "$ID" /tmp/upload.txt'
+DownloadFile(){
+	local GB_FUNCARGS GB_RET
+	GB_FUNCARGS=$(jq -n -c --arg id "$1" '{ FileID: $id }')
+	GB_RET=$(gbPostJSON DownloadFile "$GB_FUNCARGS")
+	gbBotRet "$GB_RET"
+	local RETVAL=$?
+	if [ $RETVAL -eq 0 ]
+	then
+		echo "$GB_RET" | jq -r '.Data // ""' | base64 -d > "$2"
+	fi
+	return $RETVAL
+}
@@ -19,6 +19,10 @@ CommandMatchers:
   Regex: '(?i:waitask)'
 - Command: "asknow"
   Regex: '(?i:asknow)'
+- Command: "react"
+  Regex: '(?i:react)'
+- Command: "choose"
+  Regex: '(?i:choose)'
 EOF
 }
 
@@ -39,4 +43,12 @@ case "$command" in
 		REPLY=$(PromptForReply YesNo "Do you like puppies?")
 		sleep 1
 		Say "I like puppies too!"		
+		;;
+	"react")
+		React eyes
+		;;
+	"choose")
+		REPLY=$(PromptForChoice "Pick a color" red green blue)
+		Say "You picked $REPLY"
+		;;
 esac
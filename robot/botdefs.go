@@ -1,5 +1,7 @@
-// Package robot defines interfaces and constants for pluggable go modules
-package robot
+// Package robot defines interfaces and constants for pluggable go modules.
+// It was previously the separate github.com/lnxjedi/robot module; see
+// doc/src/upgrade/Robot-Package.md.
+package robot // import "github.com/lnxjedi/gopherbot/robot"
 
 // RetVal is a integer type for returning error conditions from bot methods, or 0 for Ok
 type RetVal int
@@ -54,6 +56,9 @@ const (
 	// reduces the likelihood of an authorization plugin mistakenly exiting with a success
 	// value
 	Success = 7
+	// TaskTimeout - the task ran longer than its Timeout and was killed;
+	// the same exit code as timeout(1)
+	TaskTimeout TaskRetVal = 124
 )
 
 const (
@@ -151,6 +156,8 @@ const (
 	Test
 	// Null connector for unconfigured robots
 	Null
+	// IRC connector
+	IRC
 )
 
 // MessageFormat indicates how the connector should display the content of
@@ -0,0 +1,143 @@
+package robot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HistoryLogger is provided by a HistoryProvider for each job / plugin run
+// where it's requested
+type HistoryLogger interface {
+	// Log a line of output, normally timestamped; bot should prefix with OUT or ERR
+	Log(line string)
+	// Add a plain line to the log, without a timestamp
+	Line(line string)
+	// Close a log file against further writes, but keep
+	Close()
+	// Finalize called after pipeline finishes, log can be removed.
+	Finalize()
+}
+
+// Streams for HistoryRecords
+const (
+	StreamOut     = "OUT"     // task stdout
+	StreamErr     = "ERR"     // task stderr
+	StreamLog     = "LOG"     // messages logged with Robot.Log
+	StreamSection = "SECTION" // pipeline markers, e.g. when a job's log is extended
+	StreamStart   = "START"   // a task is starting
+	StreamFinish  = "FINISH"  // a task finished, with Status
+)
+
+// HistoryRecord is a structured history log entry; providers that store
+// records write them as single lines of JSON, separate from the text log.
+type HistoryRecord struct {
+	Time   time.Time  `json:"time"`
+	Task   string     `json:"task,omitempty"`
+	Stream string     `json:"stream"`
+	Text   string     `json:"text,omitempty"`
+	Status TaskRetVal `json:"status,omitempty"` // for FINISH records
+}
+
+// StructuredLogger is an optional interface for HistoryLoggers that can
+// store HistoryRecords; the robot falls back to Log and Line for loggers
+// that don't implement it. The log returned by GetLog stays readable text,
+// with each record rendered by String.
+type StructuredLogger interface {
+	Record(rec HistoryRecord)
+}
+
+// RecordedHistory is an optional interface for HistoryProviders with
+// StructuredLoggers, for reading the stored records back.
+type RecordedHistory interface {
+	// GetRecords returns a reader for the records of a log, one JSON
+	// HistoryRecord per line
+	GetRecords(tag string, index int) (io.Reader, error)
+}
+
+// String renders a record as a line of text
+func (hr HistoryRecord) String() string {
+	ts := hr.Time.Format("Jan 2 15:04:05")
+	switch hr.Stream {
+	case StreamSection:
+		return "*** " + hr.Text
+	case StreamStart:
+		return fmt.Sprintf("%s *** %s", ts, hr.Text)
+	case StreamFinish:
+		line := fmt.Sprintf("%s *** Finished task '%s', status: %s", ts, hr.Task, hr.Status)
+		if len(hr.Text) > 0 {
+			line += " - " + hr.Text
+		}
+		return line
+	}
+	if len(hr.Task) > 0 {
+		return fmt.Sprintf("%s %s [%s] %s", ts, hr.Stream, hr.Task, hr.Text)
+	}
+	return fmt.Sprintf("%s %s %s", ts, hr.Stream, hr.Text)
+}
+
+// ParseHistoryRecord parses a line from GetRecords, returning false for
+// lines that aren't records.
+func ParseHistoryRecord(line string) (HistoryRecord, bool) {
+	var hr HistoryRecord
+	if !strings.HasPrefix(line, "{") {
+		return hr, false
+	}
+	if err := json.Unmarshal([]byte(line), &hr); err != nil || len(hr.Stream) == 0 {
+		return hr, false
+	}
+	return hr, true
+}
+
+// FormatHistoryLine renders a stored line as text; records are rendered
+// with String, and other lines are returned unchanged.
+func FormatHistoryLine(line string) string {
+	if hr, ok := ParseHistoryRecord(line); ok {
+		return hr.String()
+	}
+	return line
+}
+
+// HistoryProvider is responsible for storing and retrieving job histories
+type HistoryProvider interface {
+	// NewLog provides a HistoryLogger for the given tag / index, and
+	// cleans up logs older than maxHistories.
+	NewLog(tag string, index, maxHistories int) (HistoryLogger, error)
+	// GetLog gets an io.Reader() for a given history log
+	GetLog(tag string, index int) (io.Reader, error)
+	// GetLogURL provides a static URL for the history file if there is one
+	GetLogURL(tag string, index int) (URL string, exists bool)
+	// MakeLogURL publishes a log to a URL and returns the URL; this
+	// URL need only be available for a short timespan, e.g. 42 seconds
+	MakeLogURL(tag string, index int) (URL string, exists bool)
+}
+
+// LogMatch is a line matching a history log search, with context
+type LogMatch struct {
+	Index  int      // index of the log
+	Line   int      // line number of the match, starting at 1
+	Text   string   // the matching line
+	Before []string // context lines before the match
+	After  []string // context lines after the match
+}
+
+// SearchableHistory is an optional interface for HistoryProviders that can
+// search logs; providers that don't implement it don't support searching.
+type SearchableHistory interface {
+	// SearchLogs searches the logs for tag with the given indexes, in
+	// order, for lines matching re. Up to context lines before and after
+	// each match are returned, and the search stops after maxMatches.
+	// Logs that no longer exist are skipped.
+	SearchLogs(tag string, indexes []int, re *regexp.Regexp, context, maxMatches int) ([]LogMatch, error)
+}
+
+// HistoryLinker is an optional interface for the Handler passed to history
+// providers, for linking logs in the robot's built-in history web UI.
+type HistoryLinker interface {
+	// GetHistoryURL returns a link to a log in the history web UI, or
+	// false if the web UI isn't enabled
+	GetHistoryURL(tag string, index int) (string, bool)
+}
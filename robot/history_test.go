@@ -0,0 +1,59 @@
+package robot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var recTime = time.Date(2026, time.March, 4, 15, 4, 5, 0, time.UTC)
+
+func TestHistoryRecordString(t *testing.T) {
+	cases := []struct {
+		rec  HistoryRecord
+		want string
+	}{
+		{HistoryRecord{Time: recTime, Task: "build", Stream: StreamOut, Text: "compiling"}, "Mar 4 15:04:05 OUT [build] compiling"},
+		{HistoryRecord{Time: recTime, Task: "build", Stream: StreamErr, Text: "warning: unused"}, "Mar 4 15:04:05 ERR [build] warning: unused"},
+		{HistoryRecord{Time: recTime, Stream: StreamLog, Text: "Info starting"}, "Mar 4 15:04:05 LOG Info starting"},
+		{HistoryRecord{Time: recTime, Stream: StreamSection, Text: "Extended with 'deploy'"}, "*** Extended with 'deploy'"},
+		{HistoryRecord{Time: recTime, Task: "build", Stream: StreamStart, Text: "Starting task 'build'"}, "Mar 4 15:04:05 *** Starting task 'build'"},
+		{HistoryRecord{Time: recTime, Task: "build", Stream: StreamFinish, Status: Normal}, "Mar 4 15:04:05 *** Finished task 'build', status: Normal"},
+		{HistoryRecord{Time: recTime, Task: "build", Stream: StreamFinish, Status: Fail, Text: "timed out"}, "Mar 4 15:04:05 *** Finished task 'build', status: Fail - timed out"},
+	}
+	for _, c := range cases {
+		if got := c.rec.String(); got != c.want {
+			t.Errorf("String for %s record: want %q, got %q", c.rec.Stream, c.want, got)
+		}
+	}
+}
+
+func TestParseHistoryRecord(t *testing.T) {
+	rec := HistoryRecord{Time: recTime, Task: "build", Stream: StreamFinish, Status: Fail, Text: "timed out"}
+	b, _ := json.Marshal(rec)
+	got, ok := ParseHistoryRecord(string(b))
+	if !ok {
+		t.Fatalf("record not parsed: %s", b)
+	}
+	if !got.Time.Equal(rec.Time) || got.Task != rec.Task || got.Stream != rec.Stream || got.Status != rec.Status || got.Text != rec.Text {
+		t.Errorf("round trip: want %+v, got %+v", rec, got)
+	}
+
+	for _, line := range []string{
+		"Mar 4 15:04:05 OUT compiling",
+		"*** Extended with 'deploy'",
+		"",
+		`{"time":"2026-03-04T15:04:05Z","text":"no stream"}`,
+		`{"stream":"OUT",`,
+	} {
+		if _, ok := ParseHistoryRecord(line); ok {
+			t.Errorf("non-record parsed as a record: %q", line)
+		}
+		if got := FormatHistoryLine(line); got != line {
+			t.Errorf("FormatHistoryLine changed non-record %q to %q", line, got)
+		}
+	}
+	if got := FormatHistoryLine(string(b)); got != rec.String() {
+		t.Errorf("FormatHistoryLine: want %q, got %q", rec.String(), got)
+	}
+}
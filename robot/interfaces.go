@@ -1,6 +1,9 @@
 package robot
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 // Logger is used by a Brain for logging errors
 type Logger interface {
@@ -24,6 +27,16 @@ type SimpleBrain interface {
 	Delete(key string) error
 }
 
+// ExpiringBrain is an optional interface for brains that can expire
+// memories natively, e.g. with DynamoDB TTL. The robot also tracks
+// expirations itself and deletes expired memories, so native expiry
+// needn't be exact.
+type ExpiringBrain interface {
+	// StoreExpiring is Store for a memory that can be removed after
+	// expires; a later Store clears the expiration.
+	StoreExpiring(key string, blob *[]byte, expires time.Time) error
+}
+
 // Handler is the interface that defines the API for the handler object passed
 // to Connectors, history providers and brain providers.
 type Handler interface {
@@ -110,3 +123,73 @@ type Connector interface {
 	// The Run method starts the main loop and takes a channel for stopping it.
 	Run(stopchannel <-chan struct{})
 }
+
+// ThreadConnector is an optional interface for connectors that support
+// threaded messages. When the connector doesn't implement ThreadConnector,
+// threaded messages are sent as plain channel messages.
+type ThreadConnector interface {
+	// SendProtocolChannelThreadMessage sends a message to a thread in a
+	// channel. If thread is "", the message is posted to the channel and
+	// starts a new thread. Returns the ID of the thread, to be used for
+	// subsequent messages in the thread.
+	SendProtocolChannelThreadMessage(channelname, thread, msg string, format MessageFormat) (string, RetVal)
+	// SendProtocolUserChannelThreadMessage directs a message to a user in a
+	// channel thread, otherwise the same as SendProtocolChannelThreadMessage.
+	SendProtocolUserChannelThreadMessage(userid, username, channelname, thread, msg string, format MessageFormat) (string, RetVal)
+}
+
+// EditConnector is an optional interface for connectors that can update
+// the text of a message the robot sent, used for progress messages. When
+// the connector doesn't implement EditConnector, each update is sent as a
+// new message.
+type EditConnector interface {
+	// SendProtocolChannelEditableMessage sends a message to a channel,
+	// returning an opaque message ID for UpdateProtocolMessage.
+	SendProtocolChannelEditableMessage(channelname, msg string, format MessageFormat) (string, RetVal)
+	// SendProtocolUserEditableMessage sends a direct message to a user,
+	// returning an opaque message ID for UpdateProtocolMessage.
+	SendProtocolUserEditableMessage(username, msg string, format MessageFormat) (string, RetVal)
+	// UpdateProtocolMessage replaces the text of a message sent with one
+	// of the editable send methods.
+	UpdateProtocolMessage(messageid, msg string, format MessageFormat) RetVal
+}
+
+// ChoiceConnector is an optional interface for connectors that can offer a
+// fixed set of choices with a prompt, e.g. as buttons. When the user picks
+// a choice, the connector sends it to the robot with IncomingMessage as an
+// ordinary message from the user in the same channel, with the text of the
+// choice as the MessageText. When the connector doesn't implement
+// ChoiceConnector, the choices are sent as a numbered list.
+type ChoiceConnector interface {
+	// SendProtocolUserChannelChoiceMessage directs a prompt with choices to
+	// a user in a channel.
+	SendProtocolUserChannelChoiceMessage(userid, username, channelname, msg string, choices []string, format MessageFormat) RetVal
+	// SendProtocolUserChoiceMessage sends a prompt with choices to a user
+	// as a direct message.
+	SendProtocolUserChoiceMessage(username, msg string, choices []string, format MessageFormat) RetVal
+}
+
+// ReactionConnector is an optional interface for connectors that support
+// emoji reactions on messages. Reactions are given by name, without
+// surrounding colons, e.g. "thumbsup".
+type ReactionConnector interface {
+	// AddReaction adds a reaction to the message with the given ID, in the
+	// channel given by name or "<id>".
+	AddReaction(channelname, messageid, reaction string) RetVal
+	// RemoveReaction removes a reaction the robot added to a message.
+	RemoveReaction(channelname, messageid, reaction string) RetVal
+}
+
+// FileConnector is an optional interface for connectors that can upload
+// files to users and channels, and download files users attach to their
+// messages.
+type FileConnector interface {
+	// SendProtocolChannelFile uploads a file to a channel given by name or
+	// "<id>", with an optional title.
+	SendProtocolChannelFile(channelname, filename, title string, data io.Reader) RetVal
+	// SendProtocolUserFile uploads a file to a user as a direct message.
+	SendProtocolUserFile(username, filename, title string, data io.Reader) RetVal
+	// GetProtocolFile downloads the file with the given FileInfo ID,
+	// writing the contents to data.
+	GetProtocolFile(fileid string, data io.Writer) RetVal
+}
@@ -13,11 +13,12 @@ func _() {
 	_ = x[Terminal-2]
 	_ = x[Test-3]
 	_ = x[Null-4]
+	_ = x[IRC-5]
 }
 
-const _Protocol_name = "SlackRocketTerminalTestNull"
+const _Protocol_name = "SlackRocketTerminalTestNullIRC"
 
-var _Protocol_index = [...]uint8{0, 5, 11, 19, 23, 27}
+var _Protocol_index = [...]uint8{0, 5, 11, 19, 23, 27, 30}
 
 func (i Protocol) String() string {
 	if i < 0 || i >= Protocol(len(_Protocol_index)-1) {
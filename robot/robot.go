@@ -1,6 +1,10 @@
 package robot
 
-import "bytes"
+import (
+	"bytes"
+	"io"
+	"time"
+)
 
 // Robot defines the methods exposed by gopherbot.bot Robot struct, for
 // use by plugins/jobs/tasks. See bot/Robot for complete definitions.
@@ -20,22 +24,42 @@ type Robot interface {
 	Fixed() Robot
 	MessageFormat(f MessageFormat) Robot
 	Direct() Robot
+	TaskTimeout(d time.Duration) Robot
+	TaskRetry(attempts int, backoff time.Duration, retryOn ...TaskRetVal) Robot
 	Log(l LogLevel, m string, v ...interface{}) bool
 	SendChannelMessage(ch, msg string, v ...interface{}) RetVal
 	SendUserChannelMessage(u, ch, msg string, v ...interface{}) RetVal
 	SendUserMessage(u, msg string, v ...interface{}) RetVal
 	Reply(msg string, v ...interface{}) RetVal
 	Say(msg string, v ...interface{}) RetVal
+	ReplyThread(msg string, v ...interface{}) RetVal
+	SayThread(msg string, v ...interface{}) RetVal
+	SayProgress(msg string, v ...interface{}) (string, RetVal)
+	UpdateProgress(handle, msg string, v ...interface{}) RetVal
+	React(reaction string) RetVal
+	Unreact(reaction string) RetVal
+	SendFile(filename, title string, data io.Reader) RetVal
+	SendChannelFile(ch, filename, title string, data io.Reader) RetVal
+	SendUserFile(u, filename, title string, data io.Reader) RetVal
+	GetAttachedFiles() []FileInfo
+	DownloadFile(fileid string, data io.Writer) RetVal
 	RandomInt(n int) int
 	RandomString(s []string) string
 	Pause(s float64)
 	PromptForReply(regexID string, prompt string, v ...interface{}) (string, RetVal)
 	PromptUserForReply(regexID string, user string, prompt string, v ...interface{}) (string, RetVal)
 	PromptUserChannelForReply(regexID string, user string, channel string, prompt string, v ...interface{}) (string, RetVal)
+	PromptForChoice(prompt string, choices []string) (string, RetVal)
+	PromptUserForChoice(user string, prompt string, choices []string) (string, RetVal)
+	PromptUserChannelForChoice(user string, channel string, prompt string, choices []string) (string, RetVal)
 	CheckoutDatum(key string, datum interface{}, rw bool) (locktoken string, exists bool, ret RetVal)
 	CheckinDatum(key, locktoken string)
+	ListDatum(prefix string) (keys []string, ret RetVal)
+	CheckoutData(keys []string, data interface{}) (ret RetVal)
 	UpdateDatum(key, locktoken string, datum interface{}) (ret RetVal)
+	UpdateDatumTTL(key, locktoken string, datum interface{}, ttl time.Duration) (ret RetVal)
 	Remember(key, value string)
+	RememberFor(key, value string, ttl time.Duration)
 	RememberContext(context, value string)
 	Recall(key string) string
 	// Primarily job/pipeline methods
@@ -43,6 +67,8 @@ type Robot interface {
 	ExtendNamespace(string, int) bool
 	SpawnJob(string, ...string) RetVal
 	AddTask(string, ...string) RetVal
+	AddParallelTask(string, ...string) RetVal
+	RequestApproval(authRequire string, timeout time.Duration, request string) (string, TaskRetVal)
 	FinalTask(string, ...string) RetVal
 	FailTask(string, ...string) RetVal
 	AddJob(string, ...string) RetVal
@@ -29,7 +29,9 @@ type Message struct {
 // The *ID fields are required invariant internal representations that the
 // protocol accepts in it's interface methods.
 type ConnectorMessage struct {
-	// Protocol - string name of connector, e.g. "Slack"
+	// Protocol - string name of connector, e.g. "Slack"; identifies the
+	// connector the message came from when running secondary connectors,
+	// and is filled in by the robot if empty.
 	Protocol string
 	// optional UserName and required internal UserID
 	UserName, UserID string
@@ -39,10 +41,34 @@ type ConnectorMessage struct {
 	DirectMessage bool
 	// MessageText - sanitized message text, with all protocol-added junk removed
 	MessageText string
+	// ThreadID - for protocols with threads, the ID of the thread the message
+	// was sent in, or "" if it wasn't in a thread
+	ThreadID string
+	// MessageID - for protocols with threads, the ID of the message itself,
+	// used for starting a new thread from the message
+	MessageID string
+	// Reaction - for reaction events, the name of the reaction (emoji)
+	// added, e.g. "thumbsup"; MessageID is then the ID of the message that
+	// was reacted to, and MessageText is empty
+	Reaction string
+	// Files - for protocols supporting file uploads, any files the user
+	// attached to the message
+	Files []FileInfo
 	// MessageObject, Client - interfaces for the raw
 	MessageObject, Client interface{}
 }
 
+// FileInfo describes a file attached to an incoming message. The ID is
+// opaque to the robot, and only needs to be understood by the connector's
+// GetProtocolFile method.
+type FileInfo struct {
+	ID       string // protocol-specific file ID used for downloading
+	Name     string // file name, e.g. "report.txt"
+	Title    string // optional title or description
+	MimeType string // MIME type, if known
+	Size     int64  // size in bytes, if known
+}
+
 // PluginHandler is the struct a Go plugin registers for the Gopherbot plugin API.
 type PluginHandler struct {
 	DefaultConfig string /* A yaml-formatted multiline string defining the default Plugin configuration. It should be liberally commented for use in generating
@@ -14,15 +14,27 @@ func _() {
 	_ = x[ConfigurationError-3]
 	_ = x[PipelineAborted-4]
 	_ = x[RobotStopping-5]
+	_ = x[NotFound-6]
+	_ = x[Success-7]
+	_ = x[TaskTimeout-124]
 }
 
-const _TaskRetVal_name = "NormalFailMechanismFailConfigurationErrorPipelineAbortedRobotStopping"
+const (
+	_TaskRetVal_name_0 = "NormalFailMechanismFailConfigurationErrorPipelineAbortedRobotStoppingNotFoundSuccess"
+	_TaskRetVal_name_1 = "TaskTimeout"
+)
 
-var _TaskRetVal_index = [...]uint8{0, 6, 10, 23, 41, 56, 69}
+var (
+	_TaskRetVal_index_0 = [...]uint8{0, 6, 10, 23, 41, 56, 69, 77, 84}
+)
 
 func (i TaskRetVal) String() string {
-	if i < 0 || i >= TaskRetVal(len(_TaskRetVal_index)-1) {
+	switch {
+	case 0 <= i && i <= 7:
+		return _TaskRetVal_name_0[_TaskRetVal_index_0[i]:_TaskRetVal_index_0[i+1]]
+	case i == 124:
+		return _TaskRetVal_name_1
+	default:
 		return "TaskRetVal(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _TaskRetVal_name[_TaskRetVal_index[i]:_TaskRetVal_index[i+1]]
 }
@@ -0,0 +1,19 @@
+package robot
+
+import "unicode/utf8"
+
+// TruncateString shortens s to at most n bytes, without splitting a
+// multi-byte UTF-8 character; for the engine and connectors with limits on
+// message or label length.
+func TruncateString(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,23 @@
+package robot
+
+import "testing"
+
+func TestTruncateString(t *testing.T) {
+	cases := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"hello", 0, ""},
+		{"héllo", 2, "h"},
+		{"héllo", 3, "hé"},
+		{"世界", 5, "世"},
+	}
+	for _, c := range cases {
+		if got := TruncateString(c.s, c.n); got != c.want {
+			t.Errorf("TruncateString(%q, %d): want %q, got %q", c.s, c.n, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// +build integration
+
+package bot_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/lnxjedi/gopherbot/bot"
+	testc "github.com/lnxjedi/gopherbot/connectors/test"
+)
+
+func TestApproval(t *testing.T) {
+	done, conn := setup("test/membrain", "/tmp/bottest.log", t)
+
+	// The approval ID is random, so read it from the request
+	GetEvents()
+	conn.SendBotMessage(&testc.TestMessage{bobID, general, "deploy it"})
+	request := regexp.MustCompile(`^Approval needed for 'gated', run \d+: Deploy to production\?\nTo decide, tell me 'approve ([0-9a-f]{8})'`)
+	var id string
+	if got, err := conn.GetBotMessage(); err != nil {
+		t.Fatalf("FAILED timeout waiting for approval request")
+	} else if m := request.FindStringSubmatch(got.Message); m == nil {
+		t.Fatalf("FAILED approval request match; got: \"%s\"", got.Message)
+	} else {
+		id = m[1]
+	}
+	upper := strings.ToUpper(id)
+
+	tests := []testItem{
+		{davidID, general, ";approve 00000000", []testc.TestMessage{{null, general, "I don't have a pending approval request '00000000'"}}, []Event{CommandTaskRan, GoPluginRan}, 0},
+		{davidID, general, ";approve " + upper, []testc.TestMessage{{null, general, "Sorry, you're not authorized to approve that request"}}, []Event{CommandTaskRan, GoPluginRan, GoPluginRan, AdminCheckFailed}, 0},
+		{bobID, general, ";approve " + upper, []testc.TestMessage{{null, general, "Approved '" + id + "' for pipeline 'gated'"}, {null, general, "Deploying, approved by bob"}}, []Event{CommandTaskRan, GoPluginRan, GoPluginRan, AdminCheckFailed}, 0},
+		{bobID, general, ";reject " + id, []testc.TestMessage{{null, general, "I don't have a pending approval request '" + id + "'"}}, []Event{CommandTaskRan, GoPluginRan}, 0},
+	}
+	testcases(t, conn, tests)
+
+	teardown(t, done, conn)
+}
+
+func TestApprovalKill(t *testing.T) {
+	done, conn := setup("test/membrain", "/tmp/bottest.log", t)
+
+	tests := []testItem{
+		{aliceID, general, ";ping", []testc.TestMessage{{alice, general, "PONG"}}, []Event{CommandTaskRan, GoPluginRan}, 0},
+		{bobID, general, "stage it", []testc.TestMessage{{null, general, `^Approval needed for 'staged'`}}, []Event{TriggeredTaskRan, ExternalTaskRan}, 0},
+	}
+	testcases(t, conn, tests)
+
+	// Find the pipeline waiting for approval; fixed format is upper-cased by
+	// the test connector
+	waiting := regexp.MustCompile(`(?im)^\s*(\d+)\s.*staged\s+approval`)
+	conn.SendBotMessage(&testc.TestMessage{aliceID, general, ";ps"})
+	var wid string
+	if got, err := conn.GetBotMessage(); err != nil {
+		t.Fatalf("FAILED timeout waiting for ps")
+	} else if m := waiting.FindStringSubmatch(got.Message); m == nil {
+		t.Fatalf("FAILED finding the waiting pipeline; got: \"%s\"", got.Message)
+	} else {
+		wid = m[1]
+	}
+	GetEvents()
+
+	tests = []testItem{
+		{aliceID, general, ";kill " + wid, []testc.TestMessage{{null, general, "^Canceled approval request for pipeline " + wid + "$"}}, []Event{AdminCheckPassed, CommandTaskRan, GoPluginRan}, 200},
+		{aliceID, general, ";approve 00000000", []testc.TestMessage{{null, general, "I don't have a pending approval request"}}, []Event{CommandTaskRan, GoPluginRan}, 0},
+	}
+	testcases(t, conn, tests)
+
+	// The pipeline failed, so the task after the approval never said
+	// anything, and the pipeline is gone
+	psOutput := regexp.MustCompile(`(?i)^(wid|no pipelines running)`)
+	conn.SendBotMessage(&testc.TestMessage{aliceID, general, ";ps"})
+	if got, err := conn.GetBotMessage(); err != nil {
+		t.Errorf("FAILED timeout waiting for ps")
+	} else if !psOutput.MatchString(got.Message) {
+		t.Errorf("FAILED unexpected message after kill: \"%s\"", got.Message)
+	} else if strings.Contains(strings.ToLower(got.Message), "staged") {
+		t.Errorf("FAILED pipeline still running after kill: \"%s\"", got.Message)
+	}
+	time.Sleep(100 * time.Millisecond)
+	GetEvents()
+
+	teardown(t, done, conn)
+}
@@ -143,49 +143,55 @@ func testcases(t *testing.T, conn *testc.TestConnector, tests []testItem) {
 		// Clear out start-up events
 		GetEvents()
 		conn.SendBotMessage(&testc.TestMessage{test.user, test.channel, test.message})
-		for _, want := range test.replies {
-			if re, err := regexp.Compile(want.Message); err != nil {
-				t.Errorf("FAILED: regex \"%s\" didn't compile: %v", want.Message, err)
+		checkReplies(t, conn, test.replies, test.events)
+		if test.pause > 0 {
+			time.Sleep(time.Millisecond * time.Duration(test.pause))
+		}
+	}
+}
+
+// checkReplies checks the robot's replies and emitted events after a test
+// message or reaction
+func checkReplies(t *testing.T, conn *testc.TestConnector, replies []testc.TestMessage, events []Event) {
+	for _, want := range replies {
+		if re, err := regexp.Compile(want.Message); err != nil {
+			t.Errorf("FAILED: regex \"%s\" didn't compile: %v", want.Message, err)
+		} else {
+			got, err := conn.GetBotMessage()
+			if err != nil {
+				t.Errorf("FAILED timeout waiting for reply from robot; want: \"%s\"", want.Message)
 			} else {
-				got, err := conn.GetBotMessage()
-				if err != nil {
-					t.Errorf("FAILED timeout waiting for reply from robot; want: \"%s\"", want.Message)
+				if !re.MatchString(got.Message) {
+					t.Errorf("FAILED message regex match; want: \"%s\", got: \"%s\"", want.Message, got.Message)
 				} else {
-					if !re.MatchString(got.Message) {
-						t.Errorf("FAILED message regex match; want: \"%s\", got: \"%s\"", want.Message, got.Message)
-					} else {
-						if got.User != want.User || got.Channel != want.Channel {
-							t.Errorf("FAILED user/channel match; want u:%s, c:%s; got u:%s,c:%s", want.User, want.Channel, got.User, got.Channel)
-						}
+					if got.User != want.User || got.Channel != want.Channel {
+						t.Errorf("FAILED user/channel match; want u:%s, c:%s; got u:%s,c:%s", want.User, want.Channel, got.User, got.Channel)
 					}
 				}
 			}
 		}
-		ev := GetEvents()
-		evOk := true
-		if len(*ev) != len(test.events) {
-			evOk = false
-		} else {
-			for i, e := range *ev {
-				if e != test.events[i] {
-					evOk = false
-				}
+	}
+	ev := GetEvents()
+	evOk := true
+	if len(*ev) != len(events) {
+		evOk = false
+	} else {
+		for i, e := range *ev {
+			if e != events[i] {
+				evOk = false
 			}
 		}
-		if !evOk {
-			wevs := make([]string, len(test.events))
-			for i, e := range test.events {
-				wevs[i] = e.String()
-			}
-			gevs := make([]string, len(*ev))
-			for i, e := range *ev {
-				gevs[i] = e.String()
-			}
-			t.Errorf("FAILED emitted events; want: \"%s\"; got: %s\n", strings.Join(wevs, ", "), strings.Join(gevs, ", "))
+	}
+	if !evOk {
+		wevs := make([]string, len(events))
+		for i, e := range events {
+			wevs[i] = e.String()
 		}
-		if test.pause > 0 {
-			time.Sleep(time.Millisecond * time.Duration(test.pause))
+		gevs := make([]string, len(*ev))
+		for i, e := range *ev {
+			gevs[i] = e.String()
 		}
+		t.Errorf("FAILED emitted events; want: \"%s\"; got: %s\n", strings.Join(wevs, ", "), strings.Join(gevs, ", "))
 	}
 }
 
@@ -349,6 +355,14 @@ func TestPrompting(t *testing.T) {
 		{davidID, general, ";asknow", []testc.TestMessage{{david, general, `Do you like puppies\?`}, {null, general, `ok - answer puppies`}}, []Event{CommandTaskRan, ExternalTaskRan}, 0},
 		{davidID, general, "yes", []testc.TestMessage{{david, general, `Do you like kittens\?`}, {null, general, `I like puppies too!`}}, []Event{}, 0},
 		{davidID, general, "yes", []testc.TestMessage{{null, general, `I like kittens too!`}}, []Event{}, 0},
+		// Choices can be answered by number or, case-insensitively, by text
+		{davidID, general, ";choose", []testc.TestMessage{{david, general, `Pick a color \[red\|green\|blue\]`}}, []Event{CommandTaskRan, ExternalTaskRan}, 0},
+		{davidID, general, "2", []testc.TestMessage{{null, general, `You picked green`}}, []Event{}, 0},
+		{davidID, general, ";choose", []testc.TestMessage{{david, general, `Pick a color`}}, []Event{CommandTaskRan, ExternalTaskRan}, 0},
+		{davidID, general, "BLUE", []testc.TestMessage{{null, general, `You picked blue`}}, []Event{}, 0},
+		// A stale button click with no prompt waiting arrives as an ordinary
+		// message, and doesn't run anything
+		{davidID, general, "green", []testc.TestMessage{}, []Event{}, 200},
 	}
 	testcases(t, conn, tests)
 
@@ -374,7 +388,7 @@ func TestHelp(t *testing.T) {
 	tests := []testItem{
 		// Took a while to get the regex right; should be # of help msgs * 2 - 1; e.g. 10 lines -> 19
 		// NOTE: the default 'help' output is now too long for in-channel reply
-		{aliceID, deadzone, ";help", []testc.TestMessage{{alice, deadzone, `\(the help output was pretty long, so I sent you a private message\)`}, {alice, null, `(?s:^Command(?:[^\n]*\n){35}[^\n]*$)`}}, []Event{CommandTaskRan, GoPluginRan}, 0},
+		{aliceID, deadzone, ";help", []testc.TestMessage{{alice, deadzone, `\(the help output was pretty long, so I sent you a private message\)`}, {alice, null, `(?s:^Command(?:[^\n]*\n){41}[^\n]*$)`}}, []Event{CommandTaskRan, GoPluginRan}, 0},
 		{aliceID, deadzone, ";help help", []testc.TestMessage{{null, deadzone, `(?s:^Command(?:[^\n]*\n){3}[^\n]*$)`}}, []Event{CommandTaskRan, GoPluginRan}, 0},
 	}
 	testcases(t, conn, tests)
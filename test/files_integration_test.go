@@ -0,0 +1,54 @@
+// +build integration
+
+package bot_test
+
+/* files_integration_test.go - tests for uploading and downloading files
+ */
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/lnxjedi/gopherbot/bot"
+	testc "github.com/lnxjedi/gopherbot/connectors/test"
+)
+
+func TestFiles(t *testing.T) {
+	done, conn := setup("test/membrain", "/tmp/bottest.log", t)
+
+	conn.SendBotMessage(&testc.TestMessage{aliceID, general, ";upload report"})
+	if f, err := conn.GetBotFile(); err != nil {
+		t.Errorf("FAILED waiting for uploaded report: %v", err)
+	} else {
+		if f.Channel != general || f.Filename != "report.txt" || f.Title != "Status Report" {
+			t.Errorf("FAILED uploaded report; got c:%s, f:%s, t:%s", f.Channel, f.Filename, f.Title)
+		}
+		if string(f.Data) != "All systems nominal\n" {
+			t.Errorf("FAILED uploaded report contents; got: %q", f.Data)
+		}
+	}
+	if msg, err := conn.GetBotMessage(); err != nil || msg.Message != "Uploaded: 0" {
+		t.Errorf("FAILED upload reply; got: %v, %v", msg, err)
+	}
+
+	data := []byte{0, 1, 2, 253, 254, 255}
+	conn.SendBotFileMessage(&testc.TestMessage{bobID, general, ";copy attachments"},
+		&testc.TestFile{Filename: "data.bin", Data: data})
+	if f, err := conn.GetBotFile(); err != nil {
+		t.Errorf("FAILED waiting for copied file: %v", err)
+	} else {
+		if f.Channel != general || f.Filename != "data.bin" || f.Title != "Copy of data.bin" {
+			t.Errorf("FAILED copied file; got c:%s, f:%s, t:%s", f.Channel, f.Filename, f.Title)
+		}
+		if !bytes.Equal(f.Data, data) {
+			t.Errorf("FAILED copied file contents; want: %v, got: %v", data, f.Data)
+		}
+	}
+	if msg, err := conn.GetBotMessage(); err != nil || msg.Message != "Copied 1 file(s)" {
+		t.Errorf("FAILED copy reply; got: %v, %v", msg, err)
+	}
+
+	// Clear out events from the file commands
+	GetEvents()
+	teardown(t, done, conn)
+}
@@ -0,0 +1,8 @@
+#!/bin/bash
+
+# flaky.sh - job that always fails, for testing task retries
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+Say "Trying the flaky job"
+exit 1
@@ -0,0 +1,14 @@
+#!/bin/bash
+
+# gated.sh - job that waits for approval, for testing RequestApproval
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+APPROVER=$(RequestApproval Helpdesk 1m "Deploy to production?")
+RETVAL=$?
+if [ $RETVAL -ne $PLUGRET_Normal ]
+then
+	Say "Not deploying, status $RETVAL"
+	exit 0
+fi
+Say "Deploying, approved by $APPROVER"
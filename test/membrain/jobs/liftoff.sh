@@ -0,0 +1,7 @@
+#!/bin/bash
+
+# liftoff.sh - job triggered by a reaction, for testing reaction triggers
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+Say "Lift off!"
@@ -0,0 +1,10 @@
+#!/bin/bash
+
+# napper.sh - job that adds a task with a timeout shorter than the task's
+# configured Timeout, for testing the AddTask timeout override
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+FailTask report-failure
+AddTask -t 500ms nap 10
+AddTask send-message "Nap finished"
@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# progress.sh - job that updates a progress message from later tasks, for
+# testing SayProgress and UpdateProgress
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+# With no progress message yet, this sends a new one
+UpdateProgress "" "Build starting"
+HANDLE=$(SayProgress "Build 1/3")
+AddTask progress-update "$HANDLE" "Build 2/3"
+AddTask progress-update "" "Build 3/3"
+AddTask progress-update progress99 "Lost update"
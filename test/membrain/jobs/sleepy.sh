@@ -0,0 +1,11 @@
+#!/bin/bash
+
+# sleepy.sh - job that runs longer than its Timeout, for testing task
+# timeouts
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+FailTask report-failure
+Say "Going to sleep"
+sleep 10
+Say "Woke up"
@@ -0,0 +1,9 @@
+#!/bin/bash
+
+# staged.sh - job that adds the approval task, for testing canceling an
+# approval with 'kill'
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+AddTask approval Helpdesk 1m "Deploy to staging?"
+AddTask send-message "Staging deployed"
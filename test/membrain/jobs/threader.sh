@@ -0,0 +1,9 @@
+#!/bin/bash
+
+# threader.sh - job that sends threaded messages from two tasks, for
+# testing that a pipeline's threaded messages all go to the same thread
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+SayThread "Starting the build"
+AddTask thread-reply "Build finished"
@@ -0,0 +1,47 @@
+#!/bin/bash
+
+# files.sh - plugin for testing file uploads and downloads
+
+# START Boilerplate
+[ -z "$GOPHER_INSTALLDIR" ] && { echo "GOPHER_INSTALLDIR not set" >&2; exit 1; }
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+command=$1
+shift
+# END Boilerplate
+
+configure(){
+	cat <<"EOF"
+---
+CommandMatchers:
+- Command: "upload"
+  Regex: '(?i:upload report)'
+- Command: "copy"
+  Regex: '(?i:copy attachments)'
+EOF
+}
+
+FILEDIR=$(mktemp -d)
+trap "rm -rf $FILEDIR" EXIT
+
+case "$command" in
+# NOTE: only "configure" should print anything to stdout
+	"configure")
+		configure
+		;;
+	"upload")
+		echo "All systems nominal" > $FILEDIR/report.txt
+		SendFile $FILEDIR/report.txt "Status Report"
+		Say "Uploaded: $?"
+		;;
+	"copy")
+		COUNT=0
+		while IFS=$'\t' read ID NAME
+		do
+			DownloadFile "$ID" "$FILEDIR/$NAME"
+			SendFile "$FILEDIR/$NAME" "Copy of $NAME"
+			COUNT=$((COUNT + 1))
+		done < <(GetAttachedFiles)
+		Say "Copied $COUNT file(s)"
+		;;
+esac
@@ -0,0 +1,8 @@
+#!/bin/bash
+
+# nap.sh - task that sleeps for the given number of seconds
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+Say "Napping for $1 seconds"
+sleep $1
@@ -0,0 +1,13 @@
+#!/bin/bash
+
+# progress-update.sh - task that updates a progress message, reporting
+# any error
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+UpdateProgress "$1" "$2"
+RET=$?
+if [ $RET -ne $GBRET_Ok ]
+then
+	Say "UpdateProgress returned $RET"
+fi
@@ -0,0 +1,7 @@
+#!/bin/bash
+
+# report-failure.sh - fail task that reports why the pipeline failed
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+Say "Pipeline failed with code $GOPHER_FAIL_CODE: $GOPHER_FAIL_STRING"
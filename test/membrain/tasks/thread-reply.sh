@@ -0,0 +1,7 @@
+#!/bin/bash
+
+# thread-reply.sh - task that replies in the pipeline's thread
+
+source $GOPHER_INSTALLDIR/lib/gopherbot_v1.sh
+
+ReplyThread "$*"
@@ -0,0 +1,33 @@
+// +build integration
+
+package bot_test
+
+import (
+	"testing"
+
+	. "github.com/lnxjedi/gopherbot/bot"
+	testc "github.com/lnxjedi/gopherbot/connectors/test"
+)
+
+func TestProgress(t *testing.T) {
+	done, conn := setup("test/membrain", "/tmp/bottest.log", t)
+
+	// The triggering message is m0001; editable messages from the robot
+	// are e<number>, and updates are sent prefixed with "(updated <id>)".
+	tests := []testItem{
+		{bobID, general, "show progress", []testc.TestMessage{
+			{null, general, "Starting job 'progress', run 0"},
+			// an empty handle with no progress message sends a new one
+			{null, general, "^Build starting$"},
+			{null, general, "^Build 1/3$"},
+			// later tasks update the same message, by handle and with ""
+			{null, general, `^\(updated e0003\) Build 2/3$`},
+			{null, general, `^\(updated e0003\) Build 3/3$`},
+			{null, general, "^UpdateProgress returned 4$"},
+			{null, general, "Finished job 'progress', run 0"},
+		}, []Event{TriggeredTaskRan, ExternalTaskRan, ExternalTaskRan, ExternalTaskRan, ExternalTaskRan}, 100},
+	}
+	testcases(t, conn, tests)
+
+	teardown(t, done, conn)
+}
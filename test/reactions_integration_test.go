@@ -0,0 +1,46 @@
+// +build integration
+
+package bot_test
+
+import (
+	"testing"
+
+	. "github.com/lnxjedi/gopherbot/bot"
+	testc "github.com/lnxjedi/gopherbot/connectors/test"
+)
+
+type reactionItem struct {
+	user, channel, reaction string
+	replies                 []testc.TestMessage // note: TestMessage.Message -> regex
+	events                  []Event
+}
+
+func reactioncases(t *testing.T, conn *testc.TestConnector, tests []reactionItem) {
+	for _, test := range tests {
+		GetEvents()
+		conn.SendBotReaction(&testc.TestReaction{User: test.user, Channel: test.channel, Reaction: test.reaction})
+		checkReplies(t, conn, test.replies, test.events)
+	}
+}
+
+func TestReactions(t *testing.T) {
+	done, conn := setup("test/membrain", "/tmp/bottest.log", t)
+
+	tests := []testItem{
+		{bobID, general, ";react", []testc.TestMessage{{null, general, `^\+:eyes:$`}}, []Event{CommandTaskRan, ExternalTaskRan}, 0},
+		// Robot reactions don't re-trigger the command
+		{bobID, general, "hello world", []testc.TestMessage{}, []Event{}, 100},
+	}
+	testcases(t, conn, tests)
+
+	reactions := []reactionItem{
+		{bobID, general, "rocket", []testc.TestMessage{{null, general, "Lift off!"}}, []Event{TriggeredTaskRan, ExternalTaskRan}},
+		// Reaction triggers only match the configured user, channel and reaction
+		{aliceID, general, "rocket", []testc.TestMessage{}, []Event{}},
+		{bobID, random, "rocket", []testc.TestMessage{}, []Event{}},
+		{bobID, general, "eyes", []testc.TestMessage{}, []Event{}},
+	}
+	reactioncases(t, conn, reactions)
+
+	teardown(t, done, conn)
+}
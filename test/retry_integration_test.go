@@ -0,0 +1,21 @@
+// +build integration
+
+package bot_test
+
+import (
+	"testing"
+
+	. "github.com/lnxjedi/gopherbot/bot"
+	testc "github.com/lnxjedi/gopherbot/connectors/test"
+)
+
+func TestRetry(t *testing.T) {
+	done, conn := setup("test/membrain", "/tmp/bottest.log", t)
+
+	tests := []testItem{
+		{bobID, general, "flake out", []testc.TestMessage{{null, general, "Starting job 'flaky', run 0"}, {null, general, "Trying the flaky job"}, {null, general, "Trying the flaky job"}, {null, general, `^pipeline failed in task flaky with exit code 1 \(Fail\)`}, {null, general, `(?s)RETRY - TASK 'FLAKY' FAILED WITH STATUS FAIL \(ATTEMPT 1 OF 2\).*FAILED - PIPELINE FAILED`}, {null, general, `Job 'flaky', run number 0 failed in job: 'flaky', exit code: 1 \(Fail\)`}}, []Event{TriggeredTaskRan, ExternalTaskRan, ExternalTaskErrExit, ExternalTaskRan, ExternalTaskErrExit}, 100},
+	}
+	testcases(t, conn, tests)
+
+	teardown(t, done, conn)
+}
@@ -0,0 +1,32 @@
+// +build integration
+
+package bot_test
+
+import (
+	"testing"
+
+	. "github.com/lnxjedi/gopherbot/bot"
+	testc "github.com/lnxjedi/gopherbot/connectors/test"
+)
+
+func TestThreads(t *testing.T) {
+	done, conn := setup("test/membrain", "/tmp/bottest.log", t)
+
+	// Message IDs from the test connector count up from m0001; threads
+	// the robot starts are t<number>.
+	tests := []testItem{
+		// Both tasks use the thread of the message that started the job
+		{bobID, general, "thread it", []testc.TestMessage{{null, general, "Starting job 'threader', run 0"}, {null, general, `^\(thread m0001\) Starting the build$`}, {bob, general, `^\(thread m0001\) Build finished$`}, {null, general, "Finished job 'threader', run 0"}}, []Event{TriggeredTaskRan, ExternalTaskRan, ExternalTaskRan}, 100},
+		// A job in another channel starts a new thread, which the second
+		// task reuses
+		{bobID, general, "thread elsewhere", []testc.TestMessage{{null, random, "Starting job 'rethreader', run 0"}, {null, random, `^\(thread t0003\) Starting the build$`}, {bob, random, `^\(thread t0003\) Build finished$`}, {null, random, "Finished job 'rethreader', run 0"}}, []Event{TriggeredTaskRan, ExternalTaskRan, ExternalTaskRan}, 100},
+	}
+	testcases(t, conn, tests)
+
+	// A job started from a message in a thread replies in that thread
+	GetEvents()
+	conn.SendBotThreadMessage(&testc.TestMessage{bobID, general, "thread it"}, "t0042")
+	checkReplies(t, conn, []testc.TestMessage{{null, general, "Starting job 'threader', run 1"}, {null, general, `^\(thread t0042\) Starting the build$`}, {bob, general, `^\(thread t0042\) Build finished$`}, {null, general, "Finished job 'threader', run 1"}}, []Event{TriggeredTaskRan, ExternalTaskRan, ExternalTaskRan})
+
+	teardown(t, done, conn)
+}
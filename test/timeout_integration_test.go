@@ -0,0 +1,22 @@
+// +build integration
+
+package bot_test
+
+import (
+	"testing"
+
+	. "github.com/lnxjedi/gopherbot/bot"
+	testc "github.com/lnxjedi/gopherbot/connectors/test"
+)
+
+func TestTimeout(t *testing.T) {
+	done, conn := setup("test/membrain", "/tmp/bottest.log", t)
+
+	tests := []testItem{
+		{bobID, general, "sleep on it", []testc.TestMessage{{null, general, "Starting job 'sleepy', run 0"}, {null, general, "Going to sleep"}, {null, general, `^Pipeline failed with code 124: TaskTimeout - Task 'sleepy' timed out after 500ms and was killed$`}, {null, general, `Job 'sleepy', run number 0 failed in job: 'sleepy' - A job that runs longer than its Timeout, exit code: 124 \(TaskTimeout\)`}}, []Event{TriggeredTaskRan, ExternalTaskRan, ExternalTaskRan}, 100},
+		{bobID, general, "take a nap", []testc.TestMessage{{null, general, "Starting job 'napper', run 0"}, {null, general, "Napping for 10 seconds"}, {null, general, `^Pipeline failed with code 124: TaskTimeout - Task 'nap' timed out after 500ms and was killed$`}, {null, general, `Job 'napper', run number 0 failed in task: 'nap'.*exit code: 124 \(TaskTimeout\)`}}, []Event{TriggeredTaskRan, ExternalTaskRan, ExternalTaskRan, ExternalTaskRan}, 100},
+	}
+	testcases(t, conn, tests)
+
+	teardown(t, done, conn)
+}